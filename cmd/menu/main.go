@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"pos-system/internal/config"
+	"pos-system/internal/database"
+	"pos-system/internal/handlers"
+	"pos-system/internal/menuio"
+	"pos-system/pkg/storage"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const usage = `Usage:
+  menu export [-tenant slug] [-format json|csv] [-o file]
+  menu import [-tenant slug] [-format json|csv] [-dry-run] file
+
+Export writes every category, menu item and add-on to a file (stdout by default).
+Import upserts them from a file: categories by name, menu items and add-ons by
+SKU or name. Nothing is saved unless every row is valid. Both work on one
+tenant, DEFAULT_TENANT unless -tenant is given.
+`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "export":
+		exportMenu(os.Args[2:])
+	case "import":
+		importMenu(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func exportMenu(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", menuio.FormatJSON, "file format: json or csv")
+	output := flags.String("o", "", "output file (default stdout)")
+	tenant := flags.String("tenant", "", "tenant slug (default DEFAULT_TENANT)")
+	flags.Parse(args)
+
+	_, db := connect(*tenant)
+	menu, err := menuio.Export(db)
+	if err != nil {
+		log.Fatalf("Failed to export menu: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := menuio.Write(w, *format, menu); err != nil {
+		log.Fatalf("Failed to write menu: %v", err)
+	}
+
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d categories, %d menu items and %d add-ons to %s\n",
+			len(menu.Categories), len(menu.MenuItems), len(menu.AddOns), *output)
+	}
+}
+
+func importMenu(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "file format: json or csv (default from the file extension)")
+	dryRun := flags.Bool("dry-run", false, "validate and report without saving")
+	tenant := flags.String("tenant", "", "tenant slug (default DEFAULT_TENANT)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	menu, err := menuio.Read(file, *format)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	cfg, db := connect(*tenant)
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	report, err := handlers.ApplyMenuImport(db, store, menu, *dryRun, nil)
+	if err != nil {
+		log.Fatalf("Failed to import menu: %v", err)
+	}
+
+	for _, row := range report.Rows {
+		fmt.Printf("%-9s %-9s %s\n", row.Action, row.Kind, row.Name)
+	}
+	for _, issue := range report.Errors {
+		fmt.Printf("error     %s\n", issue.Error())
+	}
+
+	fmt.Printf("\nCategories: %d created, %d updated, %d unchanged\n",
+		report.Categories.Created, report.Categories.Updated, report.Categories.Unchanged)
+	fmt.Printf("Menu items: %d created, %d updated, %d unchanged\n",
+		report.MenuItems.Created, report.MenuItems.Updated, report.MenuItems.Unchanged)
+	fmt.Printf("Add-ons:    %d created, %d updated, %d unchanged\n",
+		report.AddOns.Created, report.AddOns.Updated, report.AddOns.Unchanged)
+
+	switch {
+	case !report.Valid():
+		fmt.Printf("\n%d errors, nothing was imported\n", len(report.Errors))
+		os.Exit(1)
+	case report.DryRun:
+		fmt.Println("\nDry run, nothing was imported")
+	default:
+		fmt.Println("\nImport complete")
+	}
+}
+
+// connect opens the database scoped to a tenant
+func connect(tenant string) (*config.Config, *gorm.DB) {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.NewDatabase(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if tenant == "" {
+		tenant = cfg.Tenancy.DefaultTenant
+	}
+	scoped, err := db.ForTenant(tenant)
+	if err != nil {
+		log.Fatalf("Failed to find tenant: %v", err)
+	}
+	return cfg, scoped
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"pos-system/internal/config"
@@ -18,12 +19,20 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	tenant := flag.String("tenant", cfg.Tenancy.DefaultTenant, "slug of the tenant to seed")
+	flag.Parse()
+
 	// Connect to database
 	db, err := database.NewDatabase(cfg)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Test data goes into one tenant
+	if db.DB, err = db.ForTenant(*tenant); err != nil {
+		log.Fatalf("Failed to find tenant: %v", err)
+	}
+
 	fmt.Println("🌱 Seeding database with test data...")
 
 	// Create users
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"pos-system/internal/config"
+	"pos-system/internal/database"
+	"pos-system/internal/models"
+	"pos-system/pkg/auth"
+	"strings"
+)
+
+const usage = `Usage:
+  tenant create -name name -admin-email email -admin-password password [-admin-username username] slug
+  tenant list
+  tenant suspend slug
+  tenant activate slug
+
+Create provisions a tenant served from <slug>.TENANT_BASE_DOMAIN, with a main
+outlet, the default payment methods and tags, and an admin user. Suspended
+tenants keep their data but every request to them is refused.
+`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "create":
+		createTenant(os.Args[2:])
+	case "list":
+		listTenants()
+	case "suspend":
+		setTenantActive(os.Args[2:], false)
+	case "activate":
+		setTenantActive(os.Args[2:], true)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func createTenant(args []string) {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	name := flags.String("name", "", "business name")
+	username := flags.String("admin-username", "admin", "admin username")
+	email := flags.String("admin-email", "", "admin email")
+	password := flags.String("admin-password", "", "admin password, at least 6 characters")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || strings.TrimSpace(*name) == "" || *email == "" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if len(*password) < 6 {
+		log.Fatal("The admin password must be at least 6 characters")
+	}
+
+	hashedPassword, err := auth.HashPassword(*password)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+	admin := models.User{
+		Username: *username,
+		Email:    *email,
+		Password: hashedPassword,
+		Role:     "admin",
+		IsActive: true,
+	}
+
+	db := connect()
+	tenant, err := database.ProvisionTenant(db.DB, strings.TrimSpace(*name), flags.Arg(0), &admin)
+	if err != nil {
+		log.Fatalf("Failed to create tenant: %v", err)
+	}
+	fmt.Printf("Created tenant %s (%s) with admin %s\n", tenant.Slug, tenant.Name, admin.Username)
+}
+
+func listTenants() {
+	db := connect()
+	var tenants []models.Tenant
+	if err := db.DB.Order("slug").Find(&tenants).Error; err != nil {
+		log.Fatalf("Failed to list tenants: %v", err)
+	}
+
+	for _, tenant := range tenants {
+		status := "active"
+		if !tenant.IsActive {
+			status = "suspended"
+		}
+		fmt.Printf("%-24s %-10s %s\n", tenant.Slug, status, tenant.Name)
+	}
+}
+
+func setTenantActive(args []string, active bool) {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db := connect()
+	result := db.DB.Model(&models.Tenant{}).Where("slug = ?", strings.ToLower(args[0])).Update("is_active", active)
+	if result.Error != nil {
+		log.Fatalf("Failed to update tenant: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		log.Fatalf("Tenant %s not found", args[0])
+	}
+
+	if active {
+		fmt.Printf("Activated tenant %s\n", args[0])
+	} else {
+		fmt.Printf("Suspended tenant %s\n", args[0])
+	}
+}
+
+func connect() *database.Database {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.NewDatabase(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	return db
+}
@@ -5,16 +5,25 @@ import (
 	"log"
 	"pos-system/internal/config"
 	"pos-system/internal/database"
+	"pos-system/internal/events"
+	"pos-system/internal/handlers"
+	"pos-system/internal/models"
 	"pos-system/internal/routes"
+	"pos-system/internal/tenancy"
 	"pos-system/pkg/auth"
+	"pos-system/pkg/storage"
+	"time"
+	_ "time/tzdata" // Outlet timezones on hosts without zoneinfo
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type App struct {
 	config     *config.Config
 	database   *database.Database
 	jwtService *auth.JWTService
+	events     *events.Dispatcher
 	router     *gin.Engine
 }
 
@@ -26,18 +35,56 @@ func NewApp(cfg *config.Config) *App {
 	}
 
 	// Initialize JWT service
-	jwtService := auth.NewJWTService(cfg.JWT.SecretKey, cfg.JWT.ExpiryHours)
+	jwtService := auth.NewJWTService(cfg.JWT.SecretKey,
+		time.Duration(cfg.JWT.AccessMinutes)*time.Minute,
+		time.Duration(cfg.JWT.RefreshDays)*24*time.Hour)
 
-	// Initialize Gin router
+	// Initialize event dispatcher for stock alerts and invitations
+	dispatcher := events.NewDispatcher()
+	dispatcher.Subscribe(events.LogHandler)
+	if cfg.Events.WebhookURL != "" {
+		dispatcher.Subscribe(events.Webhook(cfg.Events.WebhookURL, nil))
+	}
+
+	// Load outlet timezone for availability schedules
+	location, err := time.LoadLocation(cfg.Outlet.Timezone)
+	if err != nil {
+		log.Fatalf("Failed to load outlet timezone %q: %v", cfg.Outlet.Timezone, err)
+	}
+
+	// Initialize storage for uploaded images
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Apply scheduled price changes as they fall due
+	go applyPriceChanges(db.DB, time.Minute)
+
+	// Expire loyalty points as they fall due
+	go expireLoyaltyPoints(db.DB, time.Hour)
+
+	// Forget refresh tokens and revocations once the tokens have expired
+	go purgeExpiredTokens(db.DB, time.Hour)
+
+	// Resolve the tenant of each request from its subdomain or token
+	resolver := tenancy.NewResolver(db.DB, cfg.Tenancy.BaseDomain, cfg.Tenancy.DefaultTenant)
+
+	// Initialize Gin router; handlers pass the request context, which
+	// carries the tenant, on to the database
 	router := gin.Default()
+	router.ContextWithFallback = true
 
 	// Setup routes
-	routes.SetupRoutes(router, db.DB, jwtService)
+	routes.SetupRoutes(router, db.DB, jwtService, resolver, dispatcher, location, store, cfg.Media.BaseURL, cfg.Outlet.CountryCode, cfg.Loyalty,
+		cfg.Invites.AcceptURL, time.Duration(cfg.Invites.ExpiryHours)*time.Hour,
+		cfg.PIN.MaxAttempts, time.Duration(cfg.PIN.LockoutMinutes)*time.Minute)
 
 	return &App{
 		config:     cfg,
 		database:   db,
 		jwtService: jwtService,
+		events:     dispatcher,
 		router:     router,
 	}
 }
@@ -47,3 +94,60 @@ func (a *App) Run() error {
 	log.Printf("Starting server on %s", address)
 	return a.router.Run(address)
 }
+
+// applyPriceChanges applies due scheduled price changes now and then every interval
+func applyPriceChanges(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := tenancy.ForEach(db, func(tenant models.Tenant, db *gorm.DB) error {
+			applied, err := handlers.ApplyDuePriceChanges(db, time.Now())
+			if applied > 0 {
+				log.Printf("Applied %d scheduled price changes for %s", applied, tenant.Slug)
+			}
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to apply scheduled price changes: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// expireLoyaltyPoints expires due loyalty points now and then every interval
+func expireLoyaltyPoints(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := tenancy.ForEach(db, func(tenant models.Tenant, db *gorm.DB) error {
+			expired, err := handlers.ExpireLoyaltyPoints(db, time.Now())
+			if expired > 0 {
+				log.Printf("Expired %d loyalty points for %s", expired, tenant.Slug)
+			}
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to expire loyalty points: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// purgeExpiredTokens deletes expired refresh tokens and revocations now and then every interval
+func purgeExpiredTokens(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := tenancy.ForEach(db, func(tenant models.Tenant, db *gorm.DB) error {
+			_, err := handlers.PurgeExpiredTokens(db, time.Now())
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to purge expired tokens: %v", err)
+		}
+		<-ticker.C
+	}
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"pos-system/pkg/loyalty"
+	"pos-system/pkg/storage"
 	"strconv"
 	
 	"github.com/joho/godotenv"
@@ -11,6 +13,14 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Invites  InviteConfig
+	PIN      PINConfig
+	Tenancy  TenancyConfig
+	Events   EventsConfig
+	Outlet   OutletConfig
+	Storage  storage.Config
+	Media    MediaConfig
+	Loyalty  loyalty.Program
 }
 
 type ServerConfig struct {
@@ -28,10 +38,39 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	SecretKey   string
+	SecretKey     string
+	AccessMinutes int // Lifetime of access tokens
+	RefreshDays   int // Lifetime of refresh tokens; each refresh issues a new one
+}
+
+type InviteConfig struct {
+	AcceptURL   string // Page invitees open to create their account; the token is added as ?token=, and {tenant} is replaced by the tenant slug
 	ExpiryHours int
 }
 
+type PINConfig struct {
+	MaxAttempts    int // Wrong PINs in a row before a device is locked
+	LockoutMinutes int // How long PIN logins on a locked device are refused
+}
+
+type TenancyConfig struct {
+	BaseDomain    string // Tenants are served from <slug>.<BaseDomain>; empty disables subdomains
+	DefaultTenant string // Slug of the tenant of requests that name none; empty requires every request to name one
+}
+
+type OutletConfig struct {
+	Timezone    string // IANA name; availability schedules are evaluated in it
+	CountryCode string // Calling code for customer phone numbers written without one
+}
+
+type MediaConfig struct {
+	BaseURL string // Prefix of uploaded image URLs; the API serves them under /media
+}
+
+type EventsConfig struct {
+	WebhookURL string // Receives stock alerts and other events; disabled when empty
+}
+
 func Load() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
@@ -50,8 +89,47 @@ func Load() (*Config, error) {
 			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
 		},
 		JWT: JWTConfig{
-			SecretKey:   getEnv("JWT_SECRET", "your-secret-key"),
-			ExpiryHours: getEnvInt("JWT_EXPIRY_HOURS", 24),
+			SecretKey:     getEnv("JWT_SECRET", "your-secret-key"),
+			AccessMinutes: getEnvInt("JWT_ACCESS_MINUTES", 15),
+			RefreshDays:   getEnvInt("JWT_REFRESH_DAYS", 30),
+		},
+		Invites: InviteConfig{
+			AcceptURL:   getEnv("INVITE_ACCEPT_URL", "http://localhost:8080/admin/accept-invite"),
+			ExpiryHours: getEnvInt("INVITE_EXPIRY_HOURS", 72),
+		},
+		PIN: PINConfig{
+			MaxAttempts:    getEnvInt("PIN_MAX_ATTEMPTS", 5),
+			LockoutMinutes: getEnvInt("PIN_LOCKOUT_MINUTES", 15),
+		},
+		Tenancy: TenancyConfig{
+			BaseDomain:    getEnv("TENANT_BASE_DOMAIN", ""),
+			DefaultTenant: getEnv("DEFAULT_TENANT", "default"),
+		},
+		Outlet: OutletConfig{
+			Timezone:    getEnv("OUTLET_TIMEZONE", "Asia/Jakarta"),
+			CountryCode: getEnv("OUTLET_COUNTRY_CODE", "62"),
+		},
+		Events: EventsConfig{
+			WebhookURL: getEnv("EVENTS_WEBHOOK_URL", ""),
+		},
+		Storage: storage.Config{
+			Driver: getEnv("STORAGE_DRIVER", "local"),
+			Dir:    getEnv("STORAGE_DIR", "./uploads"),
+			S3: storage.S3Config{
+				Endpoint:        getEnv("S3_ENDPOINT", ""),
+				Region:          getEnv("S3_REGION", "us-east-1"),
+				Bucket:          getEnv("S3_BUCKET", ""),
+				AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+				SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+				PathStyle:       getEnvBool("S3_PATH_STYLE", false),
+			},
+		},
+		Media: MediaConfig{
+			BaseURL: getEnv("MEDIA_BASE_URL", "/media"),
+		},
+		Loyalty: loyalty.Program{
+			PointValue:   getEnvFloat("LOYALTY_POINT_VALUE", 100),
+			ExpiryMonths: getEnvInt("LOYALTY_EXPIRY_MONTHS", 12),
 		},
 	}
 
@@ -73,3 +151,21 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
@@ -1,10 +1,12 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"pos-system/internal/config"
 	"pos-system/internal/models"
+	"pos-system/internal/tenancy"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -15,6 +17,73 @@ type Database struct {
 	DB *gorm.DB
 }
 
+// tenantModels are the models owned by a tenant. Every query on them is
+// limited to the current tenant.
+var tenantModels = []interface{}{
+	&models.Outlet{},
+	&models.User{},
+	&models.RefreshToken{},
+	&models.RevokedToken{},
+	&models.Invitation{},
+	&models.Device{},
+	&models.Category{},
+	&models.MenuItem{},
+	&models.Barcode{},
+	&models.Tag{},
+	&models.MenuVersion{},
+	&models.LoyaltyTier{},
+	&models.Customer{},
+	&models.LoyaltyEarnRule{},
+	&models.LoyaltyEntry{},
+	&models.BundleSlot{},
+	&models.AddOn{},
+	&models.PriceList{},
+	&models.PriceListItem{},
+	&models.PriceChange{},
+	&models.PriceHistory{},
+	&models.Transaction{},
+	&models.TransactionItem{},
+	&models.TransactionItemAddOn{},
+	&models.TransactionPayment{},
+	&models.StoredValueAccount{},
+	&models.StoredValueEntry{},
+	&models.HouseAccount{},
+	&models.HouseAccountEntry{},
+	&models.Expense{},
+	&models.PaymentMethod{},
+	&models.Ingredient{},
+	&models.OutletStock{},
+	&models.OutletItemStock{},
+	&models.RecipeLine{},
+	&models.StockMovement{},
+	&models.StockTake{},
+	&models.StockTakeLine{},
+	&models.Supplier{},
+	&models.PurchaseOrder{},
+	&models.PurchaseOrderLine{},
+	&models.AvailabilitySchedule{},
+}
+
+// legacyUniqueIndexes were unique across the whole database before tenancy;
+// they are now unique per tenant
+var legacyUniqueIndexes = []string{
+	"idx_barcodes_code",
+	"idx_customers_phone",
+	"idx_customers_email",
+	"idx_loyalty_tiers_name",
+	"idx_users_username",
+	"idx_users_email",
+	"idx_menu_items_sku",
+	"idx_add_ons_sku",
+	"idx_transactions_transaction_no",
+	"idx_payment_methods_code",
+	"idx_outlets_code",
+	"idx_price_lists_name",
+	"idx_purchase_orders_po_number",
+	"idx_stored_value_accounts_code",
+	"idx_tags_slug",
+}
+
 func NewDatabase(cfg *config.Config) (*Database, error) {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
 		cfg.Database.Host,
@@ -33,34 +102,222 @@ func NewDatabase(cfg *config.Config) (*Database, error) {
 	}
 
 	// Auto-migrate the schema
-	if err := db.AutoMigrate(
-		&models.User{},
-		&models.Category{},
-		&models.MenuItem{},
-		&models.AddOn{},
-		&models.Transaction{},
-		&models.TransactionItem{},
-		&models.TransactionItemAddOn{},
-		&models.Expense{},
-		&models.PaymentMethod{},
-	); err != nil {
+	if err := db.AutoMigrate(append([]interface{}{&models.Tenant{}}, tenantModels...)...); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	// Seed default data
-	if err := seedDefaultData(db); err != nil {
-		log.Printf("Warning: failed to seed default data: %v", err)
+	if err := tenancy.Register(db, tenantModels...); err != nil {
+		return nil, fmt.Errorf("failed to set up tenancy: %w", err)
+	}
+
+	// Without a tenant owning them, rows from before tenancy are unreachable
+	if err := setupTenants(db, cfg.Tenancy.DefaultTenant); err != nil {
+		return nil, fmt.Errorf("failed to set up tenants: %w", err)
+	}
+
+	// Without pg_trgm, menu search fails but everything else works
+	if err := setupMenuSearch(db); err != nil {
+		log.Printf("Warning: failed to set up menu search: %v", err)
+	}
+
+	if err := protectStoredValueLedger(db); err != nil {
+		log.Printf("Warning: failed to protect the stored-value ledger: %v", err)
+	}
+
+	if err := tenancy.ForEach(db, func(tenant models.Tenant, db *gorm.DB) error {
+		return seedTenant(db)
+	}); err != nil {
+		log.Printf("Warning: failed to seed tenants: %v", err)
 	}
 
 	return &Database{DB: db}, nil
 }
 
+// ForTenant returns a handle on the database that only sees the tenant with
+// the given slug, for command line tools
+func (d *Database) ForTenant(slug string) (*gorm.DB, error) {
+	tenant, err := tenancy.NewResolver(d.DB, "", "").BySlug(slug)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", slug, err)
+	}
+	return d.DB.WithContext(tenancy.WithTenant(context.Background(), tenant.ID)), nil
+}
+
+// setupMenuSearch creates the indexes used by menu search and fills in the
+// search text of menu items that have none yet
+func setupMenuSearch(db *gorm.DB) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_menu_items_search_fts ON menu_items USING GIN (to_tsvector('simple', search_text))",
+		"CREATE INDEX IF NOT EXISTS idx_menu_items_search_trgm ON menu_items USING GIN (search_text gin_trgm_ops)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	// Search text only depends on the item's own row, so every tenant is
+	// refreshed at once
+	return models.RefreshSearchText(db.WithContext(tenancy.AllTenants(context.Background())), "search_text = ''")
+}
+
+// protectStoredValueLedger makes the database reject updates and deletes of
+// stored-value ledger entries
+func protectStoredValueLedger(db *gorm.DB) error {
+	statements := []string{
+		`CREATE OR REPLACE FUNCTION reject_stored_value_entry_change() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'stored_value_entries is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS stored_value_entries_append_only ON stored_value_entries",
+		`CREATE TRIGGER stored_value_entries_append_only
+		BEFORE UPDATE OR DELETE ON stored_value_entries
+		FOR EACH ROW EXECUTE FUNCTION reject_stored_value_entry_change()`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupTenants creates the default tenant on a new database, and gives the
+// first tenant the rows recorded before there were tenants
+func setupTenants(db *gorm.DB, defaultSlug string) error {
+	var owner models.Tenant
+	if err := db.Order("id").First(&owner).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		slug, err := models.NormalizeTenantSlug(defaultSlug)
+		if err != nil {
+			slug = "default"
+		}
+		owner = models.Tenant{Name: "Default", Slug: slug, IsActive: true}
+		if err := db.Create(&owner).Error; err != nil {
+			return fmt.Errorf("failed to create default tenant: %w", err)
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// The stored-value ledger rejects updates; protectStoredValueLedger
+		// puts its trigger back
+		if err := tx.Exec("DROP TRIGGER IF EXISTS stored_value_entries_append_only ON stored_value_entries").Error; err != nil {
+			return err
+		}
+		for _, model := range tenantModels {
+			stmt := &gorm.Statement{DB: tx}
+			if err := stmt.Parse(model); err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE "+stmt.Schema.Table+" SET tenant_id = ? WHERE tenant_id = 0", owner.ID).Error; err != nil {
+				return err
+			}
+		}
+		for _, index := range legacyUniqueIndexes {
+			if err := tx.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ProvisionTenant creates a tenant with a default outlet, the default
+// payment methods and tags, and optionally its first user
+func ProvisionTenant(db *gorm.DB, name, slug string, admin *models.User) (*models.Tenant, error) {
+	slug, err := models.NormalizeTenantSlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	var taken int64
+	if err := db.Model(&models.Tenant{}).Where("slug = ?", slug).Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, fmt.Errorf("tenant %s already exists", slug)
+	}
+
+	tenant := models.Tenant{Name: name, Slug: slug, IsActive: true}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&tenant).Error; err != nil {
+			return fmt.Errorf("failed to create tenant: %w", err)
+		}
+
+		tx = tx.WithContext(tenancy.WithTenant(context.Background(), tenant.ID))
+		if err := seedTenant(tx); err != nil {
+			return err
+		}
+		if admin != nil {
+			if err := tx.Create(admin).Error; err != nil {
+				return fmt.Errorf("failed to create user %s: %w", admin.Username, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// seedTenant sets up a tenant's default outlet and data. db must be scoped
+// to the tenant.
+func seedTenant(db *gorm.DB) error {
+	if err := setupDefaultOutlet(db); err != nil {
+		return fmt.Errorf("failed to set up the default outlet: %w", err)
+	}
+	return seedDefaultData(db)
+}
+
+// setupDefaultOutlet creates the tenant's first outlet, and assigns it the
+// sales, expenses and stock recorded before there were outlets
+func setupDefaultOutlet(db *gorm.DB) error {
+	var outlet models.Outlet
+	if err := db.Unscoped().Order("id").First(&outlet).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		outlet = models.Outlet{Name: "Main Outlet", Code: "MAIN", IsActive: true}
+		if err := db.Create(&outlet).Error; err != nil {
+			return fmt.Errorf("failed to create default outlet: %w", err)
+		}
+	}
+
+	// Raw SQL is not scoped by tenancy
+	tenant := tenancy.Clause(db.Statement.Context, tenancy.Column)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"transactions", "expenses", "stock_movements", "stock_takes", "purchase_orders"} {
+			if err := tx.Exec("UPDATE "+table+" SET outlet_id = ? WHERE outlet_id IS NULL AND ?", outlet.ID, tenant).Error; err != nil {
+				return err
+			}
+		}
+
+		// Stock on hand moves to the outlet the first time only
+		var stocked int64
+		if err := tx.Model(&models.OutletStock{}).Count(&stocked).Error; err != nil || stocked > 0 {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO outlet_stocks (tenant_id, outlet_id, ingredient_id, stock_qty, updated_at)
+			SELECT tenant_id, ?, id, stock_qty, NOW() FROM ingredients WHERE deleted_at IS NULL AND ?
+		`, outlet.ID, tenant).Error
+	})
+}
+
 func seedDefaultData(db *gorm.DB) error {
 	// Seed default payment methods
 	paymentMethods := []models.PaymentMethod{
 		{Name: "Cash", Code: "cash", IsActive: true},
 		{Name: "Credit Card", Code: "card", IsActive: true},
 		{Name: "Qris", Code: "qris", IsActive: true},
+		{Name: "Loyalty Points", Code: "points", IsActive: true},
+		{Name: "Gift Card", Code: "gift_card", IsActive: true},
+		{Name: "Customer Balance", Code: "balance", IsActive: true},
+		{Name: "House Account", Code: "account", IsActive: true},
 	}
 
 	for _, pm := range paymentMethods {
@@ -74,6 +331,31 @@ func seedDefaultData(db *gorm.DB) error {
 		}
 	}
 
+	// Seed common allergens and dietary tags
+	tags := []models.Tag{
+		{Name: "Milk", Slug: "milk", Kind: models.TagKindAllergen},
+		{Name: "Eggs", Slug: "eggs", Kind: models.TagKindAllergen},
+		{Name: "Peanuts", Slug: "peanuts", Kind: models.TagKindAllergen},
+		{Name: "Tree Nuts", Slug: "tree-nuts", Kind: models.TagKindAllergen},
+		{Name: "Gluten", Slug: "gluten", Kind: models.TagKindAllergen},
+		{Name: "Soy", Slug: "soy", Kind: models.TagKindAllergen},
+		{Name: "Sesame", Slug: "sesame", Kind: models.TagKindAllergen},
+		{Name: "Vegan", Slug: "vegan", Kind: models.TagKindDietary},
+		{Name: "Vegetarian", Slug: "vegetarian", Kind: models.TagKindDietary},
+		{Name: "Dairy-Free", Slug: "dairy-free", Kind: models.TagKindDietary},
+	}
+
+	for _, tag := range tags {
+		var existing models.Tag
+		if err := db.Where("slug = ?", tag.Slug).First(&existing).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				if err := db.Create(&tag).Error; err != nil {
+					return fmt.Errorf("failed to create tag %s: %w", tag.Name, err)
+				}
+			}
+		}
+	}
+
 	// Seed default categories
 	categories := []models.Category{
 		// {Name: "Coffee", Description: "All types of coffee"},
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	IngredientLowStock = "ingredient.low_stock"
+	MenuItemLowStock   = "menu_item.low_stock"
+	MenuItemSoldOut    = "menu_item.sold_out"
+	MenuItemRestocked  = "menu_item.restocked"
+	AddOnSoldOut       = "add_on.sold_out"
+	AddOnRestocked     = "add_on.restocked"
+	UserInvited        = "user.invited"
+)
+
+// Event is a notification about something that happened in the system
+type Event struct {
+	Type       string      `json:"type"`
+	Data       interface{} `json:"data"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+// New creates an event of the given type occurring now
+func New(eventType string, data interface{}) Event {
+	return Event{Type: eventType, Data: data, OccurredAt: time.Now()}
+}
+
+// Invitation is the data of a user.invited event. A webhook can email the
+// accept URL to the invitee; it grants an account, so logs leave it out.
+type Invitation struct {
+	Tenant    string    `json:"tenant"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by"`
+	AcceptURL string    `json:"accept_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (i Invitation) String() string {
+	return fmt.Sprintf("{Tenant:%s Email:%s Role:%s InvitedBy:%s ExpiresAt:%s}",
+		i.Tenant, i.Email, i.Role, i.InvitedBy, i.ExpiresAt.Format(time.RFC3339))
+}
+
+// Handler receives published events. Handlers are called synchronously and
+// must not block.
+type Handler func(Event)
+
+// Dispatcher fans published events out to its subscribers
+type Dispatcher struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Subscribe registers a handler for every published event
+func (d *Dispatcher) Subscribe(handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, handler)
+}
+
+// Publish delivers events to every subscriber. A nil dispatcher drops them.
+func (d *Dispatcher) Publish(events ...Event) {
+	if d == nil {
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, event := range events {
+		for _, handler := range d.handlers {
+			handler(event)
+		}
+	}
+}
+
+// LogHandler writes events to the standard logger
+func LogHandler(event Event) {
+	log.Printf("Event %s: %+v", event.Type, event.Data)
+}
+
+// Webhook returns a handler that POSTs each event as JSON to url in the background
+func Webhook(url string, client *http.Client) Handler {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return func(event Event) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Webhook: failed to encode %s event: %v", event.Type, err)
+			return
+		}
+
+		go func() {
+			resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("Webhook: failed to deliver %s event: %v", event.Type, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				log.Printf("Webhook: %s event rejected with status %d", event.Type, resp.StatusCode)
+			}
+		}()
+	}
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatcherPublish(t *testing.T) {
+	dispatcher := NewDispatcher()
+
+	var received []Event
+	dispatcher.Subscribe(func(event Event) {
+		received = append(received, event)
+	})
+
+	dispatcher.Publish(New(IngredientLowStock, nil), New(MenuItemSoldOut, nil))
+
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(received))
+	}
+
+	if received[1].Type != MenuItemSoldOut {
+		t.Errorf("Expected second event to be %s, got %s", MenuItemSoldOut, received[1].Type)
+	}
+}
+
+func TestNilDispatcherPublish(t *testing.T) {
+	var dispatcher *Dispatcher
+
+	// Must not panic
+	dispatcher.Publish(New(IngredientLowStock, nil))
+}
+
+func TestWebhook(t *testing.T) {
+	delivered := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		delivered <- event
+	}))
+	defer server.Close()
+
+	Webhook(server.URL, nil)(New(IngredientLowStock, map[string]interface{}{"ingredient_id": 1}))
+
+	select {
+	case event := <-delivered:
+		if event.Type != IngredientLowStock {
+			t.Errorf("Expected event type %s, got %s", IngredientLowStock, event.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook was not delivered")
+	}
+}
+
+func TestInvitationAcceptURLNotLogged(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	invitation := Invitation{Email: "ani@example.com", Role: "cashier", AcceptURL: "https://pos.example.com/admin/accept-invite?token=secret"}
+	LogHandler(New(UserInvited, invitation))
+
+	if strings.Contains(logged.String(), "secret") {
+		t.Errorf("Expected the invitation token to be left out of logs, got %q", logged.String())
+	}
+	if !strings.Contains(logged.String(), "ani@example.com") {
+		t.Errorf("Expected the invitee to be logged, got %q", logged.String())
+	}
+
+	// Webhooks still receive it
+	body, err := json.Marshal(New(UserInvited, invitation))
+	if err != nil {
+		t.Fatalf("Failed to encode event: %v", err)
+	}
+	if !strings.Contains(string(body), "token=secret") {
+		t.Errorf("Expected the accept URL in the webhook body, got %s", body)
+	}
+}
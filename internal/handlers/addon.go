@@ -1,20 +1,123 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"pos-system/internal/models"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"gorm.io/gorm"
 )
 
 type AddOnHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	location *time.Location // Outlet timezone for availability schedules
 }
 
-func NewAddOnHandler(db *gorm.DB) *AddOnHandler {
-	return &AddOnHandler{db: db}
+// AddOnLinksRequest carries the menu items and categories an add-on is linked to.
+// A nil slice leaves the existing links untouched; an empty slice clears them.
+type AddOnLinksRequest struct {
+	MenuItemIDs *[]uint `json:"menu_item_ids"`
+	CategoryIDs *[]uint `json:"category_ids"`
+}
+
+// effectiveAddOnCondition matches add-ons that apply to the joined menu_items row:
+// add-ons linked to the item itself, linked to its category, or not linked at all (global).
+const effectiveAddOnCondition = `(
+	add_ons.id IN (SELECT add_on_id FROM add_on_menu_items WHERE add_on_menu_items.menu_item_id = menu_items.id)
+	OR add_ons.id IN (SELECT add_on_id FROM add_on_categories WHERE add_on_categories.category_id = menu_items.category_id)
+	OR (NOT EXISTS (SELECT 1 FROM add_on_menu_items WHERE add_on_menu_items.add_on_id = add_ons.id)
+		AND NOT EXISTS (SELECT 1 FROM add_on_categories WHERE add_on_categories.add_on_id = add_ons.id))
+)`
+
+// effectiveAddOnRow is a single (menu item, add-on) pair returned by loadEffectiveAddOns
+type effectiveAddOnRow struct {
+	EffectiveFor uint
+	models.AddOn
+}
+
+// loadEffectiveAddOns resolves the available add-ons for each of the given menu items
+// in a single query, keyed by menu item ID
+func loadEffectiveAddOns(db *gorm.DB, menuItemIDs []uint) (map[uint][]models.AddOn, error) {
+	result := make(map[uint][]models.AddOn, len(menuItemIDs))
+	if len(menuItemIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []effectiveAddOnRow
+	if err := db.Table("add_ons").
+		Select("menu_items.id AS effective_for, add_ons.*").
+		Joins("JOIN menu_items ON menu_items.deleted_at IS NULL AND "+effectiveAddOnCondition).
+		Where("menu_items.id IN ? AND add_ons.is_available = ? AND add_ons.deleted_at IS NULL", menuItemIDs, true).
+		Order("add_ons.name").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		addOn := row.AddOn
+		if addOn.Price > 0 {
+			addOn.Margin = ((addOn.Price - addOn.COGS) / addOn.Price) * 100
+		}
+		result[row.EffectiveFor] = append(result[row.EffectiveFor], addOn)
+	}
+
+	return result, nil
+}
+
+// replaceAddOnLinks replaces the menu item and category links of an add-on
+func replaceAddOnLinks(tx *gorm.DB, addOn *models.AddOn, links AddOnLinksRequest) error {
+	if links.MenuItemIDs != nil {
+		var menuItems []models.MenuItem
+		if len(*links.MenuItemIDs) > 0 {
+			if err := tx.Where("id IN ?", *links.MenuItemIDs).Find(&menuItems).Error; err != nil {
+				return err
+			}
+			if len(menuItems) != len(uniqueIDs(*links.MenuItemIDs)) {
+				return fmt.Errorf("one or more menu items not found")
+			}
+		}
+		if err := tx.Model(addOn).Association("MenuItems").Replace(menuItems); err != nil {
+			return err
+		}
+	}
+
+	if links.CategoryIDs != nil {
+		var categories []models.Category
+		if len(*links.CategoryIDs) > 0 {
+			if err := tx.Where("id IN ?", *links.CategoryIDs).Find(&categories).Error; err != nil {
+				return err
+			}
+			if len(categories) != len(uniqueIDs(*links.CategoryIDs)) {
+				return fmt.Errorf("one or more categories not found")
+			}
+		}
+		if err := tx.Model(addOn).Association("Categories").Replace(categories); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uniqueIDs returns ids with duplicates removed, preserving order
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func NewAddOnHandler(db *gorm.DB, location *time.Location) *AddOnHandler {
+	return &AddOnHandler{db: db, location: location}
 }
 
 func (h *AddOnHandler) GetAddOns(c *gin.Context) {
@@ -25,16 +128,21 @@ func (h *AddOnHandler) GetAddOns(c *gin.Context) {
 	var addOns []models.AddOn
 	var total int64
 
-	query := h.db.Model(&models.AddOn{}).Preload("MenuItem")
+	query := h.db.WithContext(c).Model(&models.AddOn{}).Preload("MenuItems").Preload("Categories").Preload("Tags")
 	
 	// Filter by menu item ID if provided
 	if menuItemID := c.Query("menu_item_id"); menuItemID != "" {
 		if menuItemID == "global" {
-			// Get global add-ons (not tied to any specific menu item)
-			query = query.Where("menu_item_id IS NULL")
+			// Get global add-ons (not linked to any menu item or category)
+			query = query.Where("NOT EXISTS (SELECT 1 FROM add_on_menu_items WHERE add_on_menu_items.add_on_id = add_ons.id)").
+				Where("NOT EXISTS (SELECT 1 FROM add_on_categories WHERE add_on_categories.add_on_id = add_ons.id)")
 		} else {
-			// Get add-ons for specific menu item OR global add-ons
-			query = query.Where("menu_item_id = ? OR menu_item_id IS NULL", menuItemID)
+			// Get add-ons effective for the menu item (direct, category or global links)
+			effective := h.db.WithContext(c).Table("add_ons").
+				Select("add_ons.id").
+				Joins("JOIN menu_items ON "+effectiveAddOnCondition).
+				Where("menu_items.id = ?", menuItemID)
+			query = query.Where("add_ons.id IN (?)", effective)
 		}
 	}
 	
@@ -68,16 +176,57 @@ func (h *AddOnHandler) GetAddOns(c *gin.Context) {
 
 func (h *AddOnHandler) CreateAddOn(c *gin.Context) {
 	var addOn models.AddOn
-	if err := c.ShouldBindJSON(&addOn); err != nil {
+	if err := c.ShouldBindBodyWith(&addOn, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var links AddOnLinksRequest
+	if err := c.ShouldBindBodyWith(&links, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tags TagsRequest
+	if err := c.ShouldBindBodyWith(&tags, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.db.Create(&addOn).Error; err != nil {
+	tx := h.db.WithContext(c).Begin()
+	addOn.MenuItems = nil
+	addOn.Categories = nil
+	addOn.Tags = nil
+	addOn.SoldOut = false
+	if err := tx.Create(&addOn).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create add-on"})
 		return
 	}
 
+	if err := recordAddOnPrice(tx, addOn, "created", currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record price history"})
+		return
+	}
+
+	if err := replaceAddOnLinks(tx, &addOn, links); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := replaceTags(tx, &addOn, tags.TagIDs); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	// Reload with links
+	h.db.WithContext(c).Preload("MenuItems").Preload("Categories").Preload("Tags").First(&addOn, addOn.ID)
+
 	// Calculate margin
 	if addOn.Price > 0 {
 		addOn.Margin = ((addOn.Price - addOn.COGS) / addOn.Price) * 100
@@ -90,7 +239,7 @@ func (h *AddOnHandler) GetAddOn(c *gin.Context) {
 	id := c.Param("id")
 	
 	var addOn models.AddOn
-	if err := h.db.Preload("MenuItem").First(&addOn, id).Error; err != nil {
+	if err := h.db.WithContext(c).Preload("MenuItems").Preload("Categories").Preload("Tags").First(&addOn, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Add-on not found"})
 		return
 	}
@@ -107,21 +256,72 @@ func (h *AddOnHandler) UpdateAddOn(c *gin.Context) {
 	id := c.Param("id")
 	
 	var addOn models.AddOn
-	if err := h.db.First(&addOn, id).Error; err != nil {
+	if err := h.db.WithContext(c).First(&addOn, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Add-on not found"})
 		return
 	}
 
-	if err := c.ShouldBindJSON(&addOn); err != nil {
+	wasAvailable, soldOut := addOn.IsAvailable, addOn.SoldOut
+	if err := c.ShouldBindBodyWith(&addOn, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Toggling availability by hand overrides sold out
+	addOn.SoldOut = soldOut && addOn.IsAvailable == wasAvailable
+
+	var links AddOnLinksRequest
+	if err := c.ShouldBindBodyWith(&links, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.db.Save(&addOn).Error; err != nil {
+	var tags TagsRequest
+	if err := c.ShouldBindBodyWith(&tags, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	addOn.MenuItems = nil
+	addOn.Categories = nil
+	addOn.Tags = nil
+	if err := tx.Omit("MenuItems", "Categories", "Tags").Save(&addOn).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update add-on"})
 		return
 	}
 
+	if err := recordAddOnPrice(tx, addOn, "manual", currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record price history"})
+		return
+	}
+
+	if err := replaceAddOnLinks(tx, &addOn, links); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := replaceTags(tx, &addOn, tags.TagIDs); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Add-ons with a recipe take their COGS from it
+	if err := recalculateRecipeCOGS(tx, nil, []uint{addOn.ID}, currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recalculate COGS"})
+		return
+	}
+
+	tx.Commit()
+
+	// Reload with links
+	h.db.WithContext(c).Preload("MenuItems").Preload("Categories").Preload("Tags").First(&addOn, addOn.ID)
+
 	// Calculate margin
 	if addOn.Price > 0 {
 		addOn.Margin = ((addOn.Price - addOn.COGS) / addOn.Price) * 100
@@ -133,7 +333,22 @@ func (h *AddOnHandler) UpdateAddOn(c *gin.Context) {
 func (h *AddOnHandler) DeleteAddOn(c *gin.Context) {
 	id := c.Param("id")
 	
-	if err := h.db.Delete(&models.AddOn{}, id).Error; err != nil {
+	var addOn models.AddOn
+	if err := h.db.WithContext(c).First(&addOn, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Add-on not found"})
+		return
+	}
+
+	// Unlink before deleting so a soft-deleted add-on leaves no dangling links
+	err := h.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		for _, association := range []string{"MenuItems", "Categories", "Tags"} {
+			if err := tx.Model(&addOn).Association(association).Clear(); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&addOn).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete add-on"})
 		return
 	}
@@ -142,32 +357,33 @@ func (h *AddOnHandler) DeleteAddOn(c *gin.Context) {
 }
 
 // GetAddOnsForMenuItem gets all add-ons available for a specific menu item
-// This includes both global add-ons and menu-item-specific add-ons
+// This includes global add-ons and add-ons linked to the item or its category
 func (h *AddOnHandler) GetAddOnsForMenuItem(c *gin.Context) {
 	menuItemID := c.Param("menu_item_id")
 	
 	// Check if menu item exists
 	var menuItem models.MenuItem
-	if err := h.db.First(&menuItem, menuItemID).Error; err != nil {
+	if err := h.db.WithContext(c).First(&menuItem, menuItemID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
 		return
 	}
 
-	var addOns []models.AddOn
-	
-	// Get add-ons for this specific menu item OR global add-ons (menu_item_id IS NULL)
-	if err := h.db.Where("(menu_item_id = ? OR menu_item_id IS NULL) AND is_available = ?", menuItemID, true).
-		Preload("MenuItem").Find(&addOns).Error; err != nil {
+	effective, err := loadEffectiveAddOns(h.db.WithContext(c), []uint{menuItem.ID})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch add-ons"})
 		return
 	}
 
-	// Calculate margin for each add-on
-	for i := range addOns {
-		if addOns[i].Price > 0 {
-			addOns[i].Margin = ((addOns[i].Price - addOns[i].COGS) / addOns[i].Price) * 100
-		}
+	addOnIDs := make([]uint, len(effective[menuItem.ID]))
+	for i, addOn := range effective[menuItem.ID] {
+		addOnIDs[i] = addOn.ID
+	}
+	tags, err := loadAddOnTags(h.db.WithContext(c), addOnIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch add-on tags"})
+		return
 	}
+	addOns := withAddOnTags(effective[menuItem.ID], tags, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"menu_item": gin.H{
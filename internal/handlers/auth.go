@@ -2,17 +2,25 @@ package handlers
 
 import (
 	"net/http"
+	"pos-system/internal/events"
 	"pos-system/internal/models"
 	"pos-system/pkg/auth"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthHandler struct {
 	db         *gorm.DB
 	jwtService *auth.JWTService
+	events     *events.Dispatcher
+	acceptURL  string        // Invitation page; {tenant} is replaced by the tenant slug
+	inviteTTL  time.Duration // How long an invitation can be accepted
+	pinLimit   int           // Wrong PINs in a row before a device is locked
+	pinLockout time.Duration // How long PIN logins on a locked device are refused
 }
 
 type LoginRequest struct {
@@ -20,23 +28,26 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-type RegisterRequest struct {
-	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	FullName string `json:"full_name" binding:"required"`
-	Password string `json:"password" binding:"required,min=6"`
-	Role     string `json:"role"`
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  models.User `json:"user"`
+	Token        string      `json:"token"`         // Access token
+	ExpiresAt    time.Time   `json:"expires_at"`    // When the access token expires
+	RefreshToken string      `json:"refresh_token"` // Trades for the next access token; can be used once
+	User         models.User `json:"user"`
 }
 
-func NewAuthHandler(db *gorm.DB, jwtService *auth.JWTService) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, jwtService *auth.JWTService, dispatcher *events.Dispatcher, acceptURL string, inviteTTL time.Duration, pinLimit int, pinLockout time.Duration) *AuthHandler {
 	return &AuthHandler{
 		db:         db,
 		jwtService: jwtService,
+		events:     dispatcher,
+		acceptURL:  acceptURL,
+		inviteTTL:  inviteTTL,
+		pinLimit:   pinLimit,
+		pinLockout: pinLockout,
 	}
 }
 
@@ -48,7 +59,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := h.db.Where("username = ? AND is_active = ?", req.Username, true).First(&user).Error; err != nil {
+	if err := h.db.WithContext(c).Preload("Outlets").Where("username = ? AND is_active = ?", req.Username, true).First(&user).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
@@ -58,74 +69,218 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.jwtService.GenerateToken(user.ID, user.Username, user.Role)
+	response, err := h.startSession(h.db.WithContext(c), user, 0)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: token,
-		User:  user,
-	})
+	c.JSON(http.StatusOK, response)
 }
 
-func (h *AuthHandler) Register(c *gin.Context) {
-	var req RegisterRequest
+// Refresh trades a refresh token for a new access token and refresh token.
+// Each refresh token can be traded once; trading one again means it was
+// copied, so the whole session is revoked.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if user already exists
-	var existingUser models.User
-	if err := h.db.Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var stored models.RefreshToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", auth.HashToken(req.RefreshToken)).
+		First(&stored).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(req.Password)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+	now := time.Now()
+	if stored.UsedAt != nil && stored.RevokedAt == nil {
+		if err := revokeSession(tx, stored.SessionID, h.jwtService.AccessTTL()); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token already used; the session has been revoked"})
+		return
+	}
+	if stored.UsedAt != nil || stored.RevokedAt != nil || now.After(stored.ExpiresAt) {
+		tx.Rollback()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	role := req.Role
-	if role == "" {
-		role = "cashier"
+	var user models.User
+	if err := tx.Preload("Outlets").Where("is_active = ?", true).First(&user, stored.UserID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
 	}
 
-	user := models.User{
-		Username: req.Username,
-		Email:    req.Email,
-		FullName: req.FullName,
-		Password: hashedPassword,
-		Role:     role,
-		IsActive: true,
+	// A PIN login only goes on from the device it was made on
+	var deviceID uint
+	if stored.DeviceID != nil {
+		device, err := requestDevice(c, tx)
+		if err != nil || device.ID != *stored.DeviceID {
+			tx.Rollback()
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		deviceID = device.ID
 	}
 
-	if err := h.db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	if err := tx.Model(&stored).Update("used_at", now).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
 
-	token, err := h.jwtService.GenerateToken(user.ID, user.Username, user.Role)
+	response, err := h.issueTokens(tx, user, stored.SessionID, deviceID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the current session, or with ?all=true every session of
+// the user
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims := c.MustGet("claims").(*auth.Claims)
+
+	var err error
+	if c.Query("all") == "true" {
+		err = revokeUserTokens(h.db.WithContext(c), claims.UserID)
+	} else {
+		err = revokeSession(h.db.WithContext(c), claims.SessionID, h.jwtService.AccessTTL())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, LoginResponse{
-		Token: token,
-		User:  user,
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// startSession issues the first tokens of a new login, bound to a device for
+// PIN logins and to none (0) otherwise
+func (h *AuthHandler) startSession(db *gorm.DB, user models.User, deviceID uint) (LoginResponse, error) {
+	sessionID, err := auth.NewTokenID()
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return h.issueTokens(db, user, sessionID, deviceID)
+}
+
+// issueTokens returns an access token and a new refresh token for a session
+func (h *AuthHandler) issueTokens(db *gorm.DB, user models.User, sessionID string, deviceID uint) (LoginResponse, error) {
+	token, err := h.jwtService.GenerateToken(auth.Claims{
+		UserID:       user.ID,
+		TenantID:     user.TenantID,
+		Username:     user.Username,
+		Role:         user.Role,
+		SessionID:    sessionID,
+		TokenVersion: user.TokenVersion,
+		DeviceID:     deviceID,
+	})
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	now := time.Now()
+	stored := models.RefreshToken{
+		UserID:    user.ID,
+		SessionID: sessionID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(h.jwtService.RefreshTTL()),
+	}
+	if deviceID != 0 {
+		stored.DeviceID = &deviceID
+	}
+	if err := db.Create(&stored).Error; err != nil {
+		return LoginResponse{}, err
+	}
+
+	return LoginResponse{
+		Token:        token,
+		ExpiresAt:    now.Add(h.jwtService.AccessTTL()),
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+// revokeSession ends a login: its refresh tokens can no longer be traded, and
+// its access tokens, which all expire within accessTTL, are rejected
+func revokeSession(db *gorm.DB, sessionID string, accessTTL time.Duration) error {
+	now := time.Now()
+	if err := db.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{TokenID: sessionID, ExpiresAt: now.Add(accessTTL)}).Error
+}
+
+// revokeUserTokens logs a user out of every session. Inside a transaction it
+// commits or rolls back with the change that called for it.
+func revokeUserTokens(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
 	})
 }
 
+// PurgeExpiredTokens deletes the refresh tokens and revocations of tokens
+// that have expired anyway, and returns how many it deleted
+func PurgeExpiredTokens(db *gorm.DB, now time.Time) (int64, error) {
+	refreshTokens := db.Where("expires_at < ?", now).Delete(&models.RefreshToken{})
+	if refreshTokens.Error != nil {
+		return 0, refreshTokens.Error
+	}
+	revocations := db.Where("expires_at < ?", now).Delete(&models.RevokedToken{})
+	if revocations.Error != nil {
+		return refreshTokens.RowsAffected, revocations.Error
+	}
+	return refreshTokens.RowsAffected + revocations.RowsAffected, nil
+}
+
 func (h *AuthHandler) GetProfile(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(c).Preload("Outlets").First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -137,7 +292,7 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(c).First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -152,16 +307,23 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	// Only the changed columns are written, so a concurrent logout's token
+	// version is not overwritten
+	updates := map[string]interface{}{}
 	if req.Username != "" {
 		user.Username = req.Username
+		updates["username"] = req.Username
 	}
 	if req.Email != "" {
 		user.Email = req.Email
+		updates["email"] = req.Email
 	}
 
-	if err := h.db.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
-		return
+	if len(updates) > 0 {
+		if err := h.db.WithContext(c).Model(&user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, user)
@@ -170,7 +332,7 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 func (h *AuthHandler) GetUsers(c *gin.Context) {
 	var users []models.User
 
-	if err := h.db.Find(&users).Error; err != nil {
+	if err := h.db.WithContext(c).Preload("Outlets").Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
@@ -186,7 +348,7 @@ func (h *AuthHandler) GetUser(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(c).Preload("Outlets").First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -202,7 +364,7 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(c).First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -213,6 +375,7 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 		Role     string `json:"role"`
+		IsActive *bool  `json:"is_active"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -220,19 +383,31 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	// Update fields if provided
+	// Update fields if provided. Only the changed columns are written, so a
+	// concurrent revocation's token version is not overwritten.
+	updates := map[string]interface{}{}
 	if req.Username != "" {
 		user.Username = req.Username
+		updates["username"] = req.Username
 	}
 	if req.FullName != "" {
 		user.FullName = req.FullName
+		updates["full_name"] = req.FullName
 	}
 	if req.Email != "" {
 		user.Email = req.Email
+		updates["email"] = req.Email
 	}
 	if req.Role != "" {
+		if !models.ValidUserRole(req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
 		user.Role = req.Role
+		updates["role"] = req.Role
 	}
+	// A new password or deactivation logs the user out everywhere
+	revoke := false
 	if req.Password != "" {
 		hashedPassword, err := auth.HashPassword(req.Password)
 		if err != nil {
@@ -240,9 +415,28 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 			return
 		}
 		user.Password = hashedPassword
+		updates["password"] = hashedPassword
+		revoke = true
+	}
+	if req.IsActive != nil {
+		revoke = revoke || (user.IsActive && !*req.IsActive)
+		user.IsActive = *req.IsActive
+		updates["is_active"] = *req.IsActive
 	}
 
-	if err := h.db.Save(&user).Error; err != nil {
+	// The old password must not keep working if the sessions cannot be revoked
+	err = h.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(&user).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if revoke {
+			return revokeUserTokens(tx, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
@@ -258,7 +452,7 @@ func (h *AuthHandler) UpdateUserRole(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(c).First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -273,22 +467,13 @@ func (h *AuthHandler) UpdateUserRole(c *gin.Context) {
 	}
 
 	// Validate role
-	validRoles := []string{"admin", "manager", "cashier"}
-	isValidRole := false
-	for _, role := range validRoles {
-		if req.Role == role {
-			isValidRole = true
-			break
-		}
-	}
-
-	if !isValidRole {
+	if !models.ValidUserRole(req.Role) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
 		return
 	}
 
 	user.Role = req.Role
-	if err := h.db.Save(&user).Error; err != nil {
+	if err := h.db.WithContext(c).Model(&user).Update("role", req.Role).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
 		return
 	}
@@ -311,15 +496,44 @@ func (h *AuthHandler) DeleteUser(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(c).First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	if err := h.db.Delete(&user).Error; err != nil {
+	err = h.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := revokeUserTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// RevokeUserTokens logs a user out of every session, e.g. after a device is
+// lost
+func (h *AuthHandler) RevokeUserTokens(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := revokeUserTokens(h.db.WithContext(c), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tokens revoked successfully"})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"pos-system/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestUserUpdatesKeepTokenVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: dryRunPool{}}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	// The user was loaded at token version 1; a logout elsewhere may have
+	// bumped it since
+	if err := db.Callback().Query().After("gorm:query").Register("test:load", func(tx *gorm.DB) {
+		if user, ok := tx.Statement.Dest.(*models.User); ok {
+			*user = models.User{ID: 3, Username: "ani", Role: "cashier", IsActive: true, TokenVersion: 1}
+		}
+	}); err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+	var updates []string
+	if err := db.Callback().Update().After("gorm:update").Register("test:capture", func(tx *gorm.DB) {
+		if tx.Statement.Table == "users" {
+			updates = append(updates, tx.Statement.SQL.String())
+		}
+	}); err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+
+	h := &AuthHandler{db: db}
+	cases := []struct {
+		name    string
+		handler gin.HandlerFunc
+		body    string
+	}{
+		{"UpdateUser", h.UpdateUser, `{"full_name": "Ani S", "password": "secret123", "is_active": false}`},
+		{"UpdateUserRole", h.UpdateUserRole, `{"role": "manager"}`},
+		{"UpdateProfile", h.UpdateProfile, `{"email": "ani@example.com"}`},
+	}
+	for _, tc := range cases {
+		updates = nil
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("PUT", "/api/v1/users/3", strings.NewReader(tc.body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "3"}}
+		c.Set("user_id", uint(3))
+
+		tc.handler(c)
+
+		if len(updates) == 0 {
+			t.Fatalf("%s: expected the user to be updated", tc.name)
+		}
+		for _, sql := range updates {
+			if strings.Contains(sql, `"token_version"=$`) {
+				t.Errorf("%s: expected the loaded token version not to be written back, got %q", tc.name, sql)
+			}
+		}
+	}
+}
+
+// dryRunPool lets a dry-run database begin transactions; nothing is run on it
+type dryRunPool struct{}
+
+var errDryRun = errors.New("dry run")
+
+func (dryRunPool) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, errDryRun }
+func (dryRunPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errDryRun
+}
+func (dryRunPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errDryRun
+}
+func (dryRunPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+func (dryRunPool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return &dryRunTx{}, nil
+}
+
+type dryRunTx struct{ dryRunPool }
+
+func (*dryRunTx) Commit() error   { return nil }
+func (*dryRunTx) Rollback() error { return nil }
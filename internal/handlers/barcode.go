@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type UpdateBarcodesRequest struct {
+	Barcodes []string `json:"barcodes"`
+}
+
+func (h *MenuHandler) GetMenuItemBarcodes(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	respondBarcodes(c, h.db.WithContext(c), menuItem)
+}
+
+// UpdateMenuItemBarcodes replaces the barcodes of a menu item
+func (h *MenuHandler) UpdateMenuItemBarcodes(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	var req UpdateBarcodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes := make([]string, 0, len(req.Barcodes))
+	seen := make(map[string]bool)
+	for _, value := range req.Barcodes {
+		code, err := models.NormalizeBarcode(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Barcode %q: %v", value, err)})
+			return
+		}
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+
+	if len(codes) > 0 {
+		var taken models.Barcode
+		err := h.db.WithContext(c).Where("code IN ? AND menu_item_id <> ?", codes, menuItem.ID).First(&taken).Error
+		if err == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":        fmt.Sprintf("Barcode %s is already assigned to another menu item", taken.Code),
+				"menu_item_id": taken.MenuItemID,
+			})
+			return
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check barcodes"})
+			return
+		}
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Where("menu_item_id = ?", menuItem.ID).Delete(&models.Barcode{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update barcodes"})
+		return
+	}
+	for _, code := range codes {
+		if err := tx.Create(&models.Barcode{MenuItemID: menuItem.ID, Code: code}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update barcodes"})
+			return
+		}
+	}
+	tx.Commit()
+
+	respondBarcodes(c, h.db.WithContext(c), menuItem)
+}
+
+func respondBarcodes(c *gin.Context, db *gorm.DB, menuItem models.MenuItem) {
+	var barcodes []models.Barcode
+	if err := db.Where("menu_item_id = ?", menuItem.ID).Order("id").Find(&barcodes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch barcodes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"menu_item_id": menuItem.ID,
+		"sku":          menuItem.SKU,
+		"barcodes":     barcodes,
+	})
+}
+
+// LookupMenuItem finds the menu item for a scanned barcode or SKU and returns
+// it as it would be added to an order: priced with the transaction's or the
+// given price list, with its orderable add-ons, and whether it can be ordered
+// right now on the transaction's or the given channel
+func (h *MenuHandler) LookupMenuItem(c *gin.Context) {
+	code := strings.TrimSpace(c.Query("code"))
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	menuItem, matchedBy, err := findMenuItemByCode(h.db.WithContext(c), code)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No menu item found for this code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up code"})
+		return
+	}
+
+	var priceList *models.PriceList
+	channel := normalizeChannel(c.Query("channel"))
+	if transactionID := c.Query("transaction_id"); transactionID != "" {
+		scope, err := userOutletScope(c, h.db.WithContext(c))
+		if err != nil {
+			respondOutletError(c, err)
+			return
+		}
+		var transaction models.Transaction
+		if err := h.db.WithContext(c).Where(scope.clause("outlet_id")).First(&transaction, transactionID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Transaction not found"})
+			return
+		}
+		channel = transaction.Channel
+		if priceList, err = transactionPriceList(h.db.WithContext(c), transaction); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price list"})
+			return
+		}
+	} else if value := c.Query("price_list"); value != "" {
+		if priceList, err = priceListParam(h.db.WithContext(c), value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Price list not found"})
+			return
+		}
+	}
+
+	off, err := loadOffSchedule(h.db.WithContext(c), time.Now().In(h.location))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability schedules"})
+		return
+	}
+
+	soldOut, err := loadSoldOut(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	effectiveAddOns, err := loadEffectiveAddOns(h.db.WithContext(c), []uint{menuItem.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch add-ons"})
+		return
+	}
+	menuItem.AddOns = make([]models.AddOn, 0, len(effectiveAddOns[menuItem.ID]))
+	for _, addOn := range effectiveAddOns[menuItem.ID] {
+		if addOn.IsAvailable && !off.addOnOffSchedule(addOn.ID) && !soldOut.addOns[addOn.ID] {
+			menuItem.AddOns = append(menuItem.AddOns, addOn)
+		}
+	}
+
+	if priceList != nil {
+		applyMenuItemPrices(&menuItem, priceList)
+	}
+	if menuItem.Price > 0 {
+		menuItem.Margin = ((menuItem.Price - menuItem.COGS) / menuItem.Price) * 100
+	}
+
+	hidden := hiddenOnChannel{}
+	if channel != "" {
+		if hidden, err = loadHiddenOnChannel(h.db.WithContext(c), channel); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+			return
+		}
+	}
+
+	reason := ""
+	switch {
+	case menuItem.SoldOut || soldOut.menuItems[menuItem.ID]:
+		menuItem.SoldOut = true
+		reason = "sold out"
+	case !menuItem.IsAvailable:
+		reason = "not available"
+	case off.menuItemOffSchedule(menuItem):
+		reason = "not available at this time"
+	case channel != "" && hidden.menuItemHidden(menuItem):
+		reason = "not sold on " + channel
+	}
+
+	response := gin.H{
+		"code":       code,
+		"matched_by": matchedBy,
+		"menu_item":  menuItem,
+		"orderable":  reason == "",
+		"reason":     reason,
+	}
+	if priceList != nil {
+		response["price_list"] = gin.H{"id": priceList.ID, "name": priceList.Name}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// findMenuItemByCode resolves a scanned or typed code to a menu item, trying
+// barcodes first and then SKUs. matchedBy is "barcode" or "sku".
+func findMenuItemByCode(db *gorm.DB, code string) (menuItem models.MenuItem, matchedBy string, err error) {
+	code = strings.TrimSpace(code)
+
+	// Codes that cannot be barcodes, e.g. with a wrong check digit, may still be SKUs
+	if normalized, err := models.NormalizeBarcode(code); err == nil {
+		var barcode models.Barcode
+		err := db.Where("code = ?", normalized).First(&barcode).Error
+		if err == nil {
+			err = db.Preload("Category").First(&menuItem, barcode.MenuItemID).Error
+			if err == nil {
+				return menuItem, "barcode", nil
+			}
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return menuItem, "", err
+		}
+	}
+
+	if code == "" {
+		return menuItem, "", gorm.ErrRecordNotFound
+	}
+	if err := db.Preload("Category").Where("sku = ?", code).First(&menuItem).Error; err != nil {
+		return menuItem, "", err
+	}
+	return menuItem, "sku", nil
+}
+
+// skuInUse reports whether another live menu item has the SKU. Empty SKUs are
+// never in use.
+func skuInUse(db *gorm.DB, sku string, exceptID uint) bool {
+	if sku == "" {
+		return false
+	}
+	var count int64
+	db.Model(&models.MenuItem{}).Where("sku = ? AND id <> ?", sku, exceptID).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BundleSlotRequest struct {
+	Name       string `json:"name"`
+	MenuItemID *uint  `json:"menu_item_id"`
+	CategoryID *uint  `json:"category_id"`
+	Quantity   int    `json:"quantity" binding:"required,min=1"`
+	SortOrder  int    `json:"sort_order"`
+}
+
+type UpdateBundleSlotsRequest struct {
+	Slots []BundleSlotRequest `json:"slots" binding:"required,dive"`
+}
+
+// BundleChoiceRequest picks the menu item for a category slot of a bundle
+type BundleChoiceRequest struct {
+	SlotID     uint `json:"slot_id" binding:"required"`
+	MenuItemID uint `json:"menu_item_id" binding:"required"`
+}
+
+// bundleComponent is a resolved component of a single bundle
+type bundleComponent struct {
+	SlotID   uint
+	MenuItem models.MenuItem
+	Quantity int // Per bundle
+}
+
+// GetBundleSlots returns the component slots of a bundle menu item
+func (h *MenuHandler) GetBundleSlots(c *gin.Context) {
+	id := c.Param("id")
+
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).Preload("BundleSlots", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order, id")
+	}).Preload("BundleSlots.MenuItem").Preload("BundleSlots.Category").First(&menuItem, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	if menuItem.ItemType != "bundle" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Menu item is not a bundle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bundle_id": menuItem.ID,
+		"cogs":      menuItem.COGS,
+		"slots":     menuItem.BundleSlots,
+	})
+}
+
+// UpdateBundleSlots replaces the component slots of a bundle and recalculates its COGS
+func (h *MenuHandler) UpdateBundleSlots(c *gin.Context) {
+	id := c.Param("id")
+
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	if menuItem.ItemType != "bundle" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Menu item is not a bundle"})
+		return
+	}
+
+	var req UpdateBundleSlotsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slots := make([]models.BundleSlot, 0, len(req.Slots))
+	for i, slotReq := range req.Slots {
+		if (slotReq.MenuItemID == nil) == (slotReq.CategoryID == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Slot %d must have either menu_item_id or category_id", i+1)})
+			return
+		}
+
+		if slotReq.MenuItemID != nil {
+			var component models.MenuItem
+			if err := h.db.WithContext(c).First(&component, *slotReq.MenuItemID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Menu item %d not found", *slotReq.MenuItemID)})
+				return
+			}
+			if component.ItemType == "bundle" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Menu item %s is a bundle and cannot be a component", component.Name)})
+				return
+			}
+		} else {
+			var category models.Category
+			if err := h.db.WithContext(c).First(&category, *slotReq.CategoryID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Category %d not found", *slotReq.CategoryID)})
+				return
+			}
+		}
+
+		slots = append(slots, models.BundleSlot{
+			BundleID:   menuItem.ID,
+			Name:       slotReq.Name,
+			MenuItemID: slotReq.MenuItemID,
+			CategoryID: slotReq.CategoryID,
+			Quantity:   slotReq.Quantity,
+			SortOrder:  slotReq.SortOrder,
+		})
+	}
+
+	tx := h.db.WithContext(c).Begin()
+
+	if err := tx.Where("bundle_id = ?", menuItem.ID).Delete(&models.BundleSlot{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bundle slots"})
+		return
+	}
+
+	if len(slots) > 0 {
+		if err := tx.Create(&slots).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bundle slots"})
+			return
+		}
+	}
+
+	if err := recalculateBundleCOGS(tx, menuItem.ID, currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate bundle COGS"})
+		return
+	}
+
+	tx.Commit()
+
+	h.GetBundleSlots(c)
+}
+
+// recalculateBundleCOGS sets a bundle's COGS to the sum of its components.
+// Choice slots use the most expensive available item of the category, so the
+// listed margin never overstates the real one.
+func recalculateBundleCOGS(tx *gorm.DB, bundleID uint, userID *uint) error {
+	var slots []models.BundleSlot
+	if err := tx.Where("bundle_id = ?", bundleID).Find(&slots).Error; err != nil {
+		return err
+	}
+
+	var cogs float64
+	for _, slot := range slots {
+		var slotCOGS float64
+		if slot.IsChoice() {
+			if err := tx.Model(&models.MenuItem{}).
+				Where("category_id = ? AND item_type <> ? AND is_available = ?", *slot.CategoryID, "bundle", true).
+				Select("COALESCE(MAX(cogs), 0)").
+				Scan(&slotCOGS).Error; err != nil {
+				return err
+			}
+		} else if slot.MenuItemID != nil {
+			if err := tx.Model(&models.MenuItem{}).
+				Where("id = ?", *slot.MenuItemID).
+				Select("COALESCE(MAX(cogs), 0)").
+				Scan(&slotCOGS).Error; err != nil {
+				return err
+			}
+		}
+		cogs += slotCOGS * float64(slot.Quantity)
+	}
+
+	var bundle models.MenuItem
+	if err := tx.First(&bundle, bundleID).Error; err != nil {
+		return err
+	}
+	return updateMenuItemCOGS(tx, &bundle, cogs, "bundle", userID)
+}
+
+// recalculateBundlesUsing refreshes the COGS of every bundle that can contain the given menu item
+func recalculateBundlesUsing(tx *gorm.DB, menuItem models.MenuItem, userID *uint) error {
+	var bundleIDs []uint
+	if err := tx.Model(&models.BundleSlot{}).
+		Where("menu_item_id = ? OR category_id = ?", menuItem.ID, menuItem.CategoryID).
+		Distinct().
+		Pluck("bundle_id", &bundleIDs).Error; err != nil {
+		return err
+	}
+
+	for _, bundleID := range bundleIDs {
+		if err := recalculateBundleCOGS(tx, bundleID, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveBundleComponents expands a bundle into its components, using the
+// customer's choices for category slots
+func resolveBundleComponents(tx *gorm.DB, bundle models.MenuItem, choices []BundleChoiceRequest) ([]bundleComponent, error) {
+	var slots []models.BundleSlot
+	if err := tx.Where("bundle_id = ?", bundle.ID).Order("sort_order, id").Find(&slots).Error; err != nil {
+		return nil, err
+	}
+
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("Bundle %s has no components", bundle.Name)
+	}
+
+	chosen := make(map[uint]uint, len(choices))
+	for _, choice := range choices {
+		chosen[choice.SlotID] = choice.MenuItemID
+	}
+
+	components := make([]bundleComponent, 0, len(slots))
+	for _, slot := range slots {
+		var menuItem models.MenuItem
+		if slot.IsChoice() {
+			menuItemID, ok := chosen[slot.ID]
+			if !ok {
+				return nil, fmt.Errorf("Choose an item for %s in bundle %s", slotLabel(slot), bundle.Name)
+			}
+			if err := tx.Where("id = ? AND category_id = ?", menuItemID, *slot.CategoryID).First(&menuItem).Error; err != nil {
+				return nil, fmt.Errorf("Menu item %d is not a valid choice for %s in bundle %s", menuItemID, slotLabel(slot), bundle.Name)
+			}
+			if menuItem.ItemType == "bundle" {
+				return nil, fmt.Errorf("Menu item %s is a bundle and cannot be a component", menuItem.Name)
+			}
+		} else if err := tx.First(&menuItem, *slot.MenuItemID).Error; err != nil {
+			return nil, fmt.Errorf("Component %d of bundle %s not found", *slot.MenuItemID, bundle.Name)
+		}
+
+		if !menuItem.IsAvailable {
+			return nil, fmt.Errorf("Menu item %s is not available", menuItem.Name)
+		}
+
+		components = append(components, bundleComponent{
+			SlotID:   slot.ID,
+			MenuItem: menuItem,
+			Quantity: slot.Quantity,
+		})
+	}
+
+	return components, nil
+}
+
+// createBundleComponentLines stores the component lines of a sold bundle line and
+// allocates the bundle revenue (excluding add-ons) back across them
+func createBundleComponentLines(tx *gorm.DB, parent models.TransactionItem, components []bundleComponent) error {
+	weights := make([]float64, len(components))
+	for i, component := range components {
+		weights[i] = component.MenuItem.Price * float64(component.Quantity)
+	}
+	shares := models.AllocateBundleRevenue(parent.UnitPrice*float64(parent.Quantity), weights)
+
+	for i, component := range components {
+		slotID := component.SlotID
+		quantity := component.Quantity * parent.Quantity
+		line := models.TransactionItem{
+			TransactionID: parent.TransactionID,
+			MenuItemID:    component.MenuItem.ID,
+			ParentItemID:  &parent.ID,
+			BundleSlotID:  &slotID,
+			Quantity:      quantity,
+			UnitPrice:     shares[i] / float64(quantity),
+			TotalPrice:    shares[i],
+		}
+		if err := tx.Create(&line).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rescaleBundleComponentLines updates the component lines of a bundle line after
+// its quantity changed from oldQuantity, keeping the original choices
+func rescaleBundleComponentLines(tx *gorm.DB, parent models.TransactionItem, oldQuantity int) error {
+	var lines []models.TransactionItem
+	if err := tx.Preload("MenuItem").Where("parent_item_id = ?", parent.ID).Order("id").Find(&lines).Error; err != nil {
+		return err
+	}
+
+	if len(lines) == 0 || oldQuantity <= 0 {
+		return nil
+	}
+
+	components := make([]bundleComponent, len(lines))
+	for i, line := range lines {
+		components[i] = bundleComponent{MenuItem: line.MenuItem, Quantity: line.Quantity / oldQuantity}
+	}
+
+	weights := make([]float64, len(components))
+	for i, component := range components {
+		weights[i] = component.MenuItem.Price * float64(component.Quantity)
+	}
+	shares := models.AllocateBundleRevenue(parent.UnitPrice*float64(parent.Quantity), weights)
+
+	for i := range lines {
+		quantity := components[i].Quantity * parent.Quantity
+		if err := tx.Model(&lines[i]).Updates(map[string]interface{}{
+			"quantity":    quantity,
+			"unit_price":  shares[i] / float64(quantity),
+			"total_price": shares[i],
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func slotLabel(slot models.BundleSlot) string {
+	if slot.Name != "" {
+		return slot.Name
+	}
+	return fmt.Sprintf("slot %d", slot.ID)
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ReorderCategoriesRequest struct {
+	ParentID    *uint  `json:"parent_id"`                       // Empty for top level
+	CategoryIDs []uint `json:"category_ids" binding:"required"` // Every category under the parent, in order
+}
+
+type ReorderMenuItemsRequest struct {
+	CategoryID  uint   `json:"category_id" binding:"required"`
+	MenuItemIDs []uint `json:"menu_item_ids" binding:"required"` // Every menu item in the category, in order
+}
+
+// MenuTreeCategory is a category with its menu items and subcategories
+type MenuTreeCategory struct {
+	ID          uint                `json:"id"`
+	ParentID    *uint               `json:"parent_id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	SortOrder   int                 `json:"sort_order"`
+	Channels    models.Channels     `json:"channels"`
+	Items       []MenuTreeItem      `json:"items"`
+	Children    []*MenuTreeCategory `json:"children"`
+}
+
+// MenuTreeItem is the part of a menu item needed to draw a menu
+type MenuTreeItem struct {
+	ID           uint            `json:"id"`
+	SKU          string          `json:"sku"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	Price        float64         `json:"price"`
+	ItemType     string          `json:"item_type"`
+	IsAvailable  bool            `json:"is_available"`
+	SoldOut      bool            `json:"sold_out"`
+	ImageURL     string          `json:"image_url"`
+	ThumbnailURL string          `json:"thumbnail_url"`
+	SortOrder    int             `json:"sort_order"`
+	Channels     models.Channels `json:"channels"`
+}
+
+// GetMenuTree returns the whole category hierarchy with the menu items of each
+// category, in sort order, from two queries. With channel, categories and items
+// not shown on it are left out; with orderable=true, so are items that cannot be
+// ordered right now.
+func (h *MenuHandler) GetMenuTree(c *gin.Context) {
+	h.getMenuTree(c, c.Query("orderable") == "true")
+}
+
+// GetOrderableMenuTree returns the menu tree with only the menu items that can
+// be ordered right now, for the public menu
+func (h *MenuHandler) GetOrderableMenuTree(c *gin.Context) {
+	h.getMenuTree(c, true)
+}
+
+func (h *MenuHandler) getMenuTree(c *gin.Context, orderableOnly bool) {
+	channel := normalizeChannel(c.Query("channel"))
+
+	var priceList *models.PriceList
+	if value := c.Query("price_list"); value != "" {
+		var err error
+		if priceList, err = priceListParam(h.db.WithContext(c), value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Price list not found"})
+			return
+		}
+	}
+
+	var categories []models.Category
+	if err := h.db.WithContext(c).Order("sort_order, name, id").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	hidden := hiddenOnChannel{channel: channel, categories: map[uint]bool{}}
+	if channel != "" {
+		hidden.categories = models.HiddenCategories(categories, channel)
+	}
+
+	// Sold out follows the stock at the outlet the menu is read for
+	soldOut, err := loadSoldOut(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	var off offSchedule
+	if orderableOnly {
+		var err error
+		if off, err = loadOffSchedule(h.db.WithContext(c), time.Now().In(h.location)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability schedules"})
+			return
+		}
+	}
+
+	query := h.db.WithContext(c).Model(&models.MenuItem{}).
+		Select("id, category_id, sku, name, description, price, item_type, is_available, sold_out, image_url, thumbnail_url, sort_order, channels")
+	if channel != "" {
+		query = hidden.where(query)
+	}
+	if orderableOnly {
+		query = query.Where("is_available = ?", true)
+	}
+	var menuItems []models.MenuItem
+	if err := query.Order("sort_order, name, id").Find(&menuItems).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch menu items"})
+		return
+	}
+
+	nodes := make(map[uint]*MenuTreeCategory, len(categories))
+	for _, category := range categories {
+		if hidden.categories[category.ID] {
+			continue
+		}
+		nodes[category.ID] = &MenuTreeCategory{
+			ID:          category.ID,
+			ParentID:    category.ParentID,
+			Name:        category.Name,
+			Description: category.Description,
+			SortOrder:   category.SortOrder,
+			Channels:    category.Channels,
+			Items:       []MenuTreeItem{},
+			Children:    []*MenuTreeCategory{},
+		}
+	}
+
+	for _, menuItem := range menuItems {
+		node, ok := nodes[menuItem.CategoryID]
+		if !ok || (orderableOnly && (off.menuItemOffSchedule(menuItem) || soldOut.menuItems[menuItem.ID])) {
+			continue
+		}
+		node.Items = append(node.Items, MenuTreeItem{
+			ID:           menuItem.ID,
+			SKU:          menuItem.SKU,
+			Name:         menuItem.Name,
+			Description:  menuItem.Description,
+			Price:        priceList.MenuItemPrice(menuItem),
+			ItemType:     menuItem.ItemType,
+			IsAvailable:  menuItem.IsAvailable,
+			SoldOut:      menuItem.SoldOut || soldOut.menuItems[menuItem.ID],
+			ImageURL:     menuItem.ImageURL,
+			ThumbnailURL: menuItem.ThumbnailURL,
+			SortOrder:    menuItem.SortOrder,
+			Channels:     menuItem.Channels,
+		})
+	}
+
+	// Categories are already sorted, so appending keeps siblings in order. A
+	// category whose parent is gone is shown at the top level.
+	tree := []*MenuTreeCategory{}
+	for _, category := range categories {
+		node, ok := nodes[category.ID]
+		if !ok {
+			continue
+		}
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		tree = append(tree, node)
+	}
+
+	response := gin.H{"categories": tree}
+	if channel != "" {
+		response["channel"] = channel
+	}
+	if priceList != nil {
+		response["price_list"] = gin.H{"id": priceList.ID, "name": priceList.Name}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ReorderCategories moves categories under a parent, or to the top level, and
+// orders them as listed, as after a drag and drop
+func (h *MenuHandler) ReorderCategories(c *gin.Context) {
+	var req ReorderCategoriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var categories []models.Category
+	if err := h.db.WithContext(c).Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+	parents := models.CategoryParents(categories)
+
+	if req.ParentID != nil {
+		if _, ok := parents[*req.ParentID]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+			return
+		}
+	}
+
+	seen := make(map[uint]bool)
+	for _, id := range req.CategoryIDs {
+		if _, ok := parents[id]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Category %d not found", id)})
+			return
+		}
+		if seen[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Category %d is listed twice", id)})
+			return
+		}
+		seen[id] = true
+		if req.ParentID != nil && models.CreatesCycle(parents, id, *req.ParentID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A category cannot be moved under itself or its subcategories"})
+			return
+		}
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	for i, id := range req.CategoryIDs {
+		if err := tx.Model(&models.Category{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"parent_id": req.ParentID, "sort_order": i}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder categories"})
+			return
+		}
+	}
+	tx.Commit()
+
+	query := h.db.WithContext(c).Order("sort_order, name, id")
+	if req.ParentID != nil {
+		query = query.Where("parent_id = ?", *req.ParentID)
+	} else {
+		query = query.Where("parent_id IS NULL")
+	}
+	var siblings []models.Category
+	query.Find(&siblings)
+
+	c.JSON(http.StatusOK, gin.H{"parent_id": req.ParentID, "categories": siblings})
+}
+
+// ReorderMenuItems moves menu items into a category and orders them as listed
+func (h *MenuHandler) ReorderMenuItems(c *gin.Context) {
+	var req ReorderMenuItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var category models.Category
+	if err := h.db.WithContext(c).First(&category, req.CategoryID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+		return
+	}
+
+	seen := make(map[uint]bool)
+	for _, id := range req.MenuItemIDs {
+		if seen[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Menu item %d is listed twice", id)})
+			return
+		}
+		seen[id] = true
+	}
+
+	var count int64
+	h.db.WithContext(c).Model(&models.MenuItem{}).Where("id IN ?", req.MenuItemIDs).Count(&count)
+	if int(count) != len(req.MenuItemIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	for i, id := range req.MenuItemIDs {
+		if err := tx.Model(&models.MenuItem{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"category_id": category.ID, "sort_order": i}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder menu items"})
+			return
+		}
+	}
+	if err := models.RefreshSearchText(tx, "id IN ?", req.MenuItemIDs); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder menu items"})
+		return
+	}
+	tx.Commit()
+
+	var menuItems []models.MenuItem
+	h.db.WithContext(c).Where("category_id = ?", category.ID).Order("sort_order, name, id").Find(&menuItems)
+
+	c.JSON(http.StatusOK, gin.H{"category_id": category.ID, "menu_items": menuItems})
+}
+
+// checkCategoryParent returns an error unless parentID exists and is not the
+// category itself or one of its subcategories. id is 0 for a new category.
+func checkCategoryParent(db *gorm.DB, id, parentID uint) error {
+	var categories []models.Category
+	if err := db.Select("id, parent_id").Find(&categories).Error; err != nil {
+		return err
+	}
+	parents := models.CategoryParents(categories)
+
+	if _, ok := parents[parentID]; !ok {
+		return errors.New("Parent category not found")
+	}
+	if id != 0 && models.CreatesCycle(parents, id, parentID) {
+		return errors.New("A category cannot be moved under itself or its subcategories")
+	}
+	return nil
+}
+
+// normalizeChannels lowercases and deduplicates a list of channels
+func normalizeChannels(channels models.Channels) models.Channels {
+	normalized := models.Channels{}
+	seen := make(map[string]bool)
+	for _, channel := range channels {
+		channel = normalizeChannel(channel)
+		if channel != "" && !seen[channel] {
+			seen[channel] = true
+			normalized = append(normalized, channel)
+		}
+	}
+	return normalized
+}
+
+// hiddenOnChannel holds the categories not shown on a sales channel
+type hiddenOnChannel struct {
+	channel    string
+	categories map[uint]bool
+}
+
+func loadHiddenOnChannel(db *gorm.DB, channel string) (hiddenOnChannel, error) {
+	var categories []models.Category
+	if err := db.Select("id, parent_id, channels").Find(&categories).Error; err != nil {
+		return hiddenOnChannel{}, err
+	}
+	return hiddenOnChannel{channel: channel, categories: models.HiddenCategories(categories, channel)}, nil
+}
+
+// menuItemHidden reports whether the menu item, its category or one of the
+// category's ancestors leaves the channel out
+func (h hiddenOnChannel) menuItemHidden(menuItem models.MenuItem) bool {
+	return !menuItem.Channels.Includes(h.channel) || h.categories[menuItem.CategoryID]
+}
+
+// where limits a menu item query to the items shown on the channel
+func (h hiddenOnChannel) where(query *gorm.DB) *gorm.DB {
+	if len(h.categories) > 0 {
+		query = query.Where("category_id NOT IN ?", idList(h.categories))
+	}
+	included, _ := json.Marshal([]string{h.channel})
+	return query.Where("(channels IS NULL OR channels = '[]'::jsonb OR channels @> ?::jsonb)", string(included))
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CustomerHandler struct {
+	db          *gorm.DB
+	countryCode string // Calling code for phone numbers written without one
+}
+
+type CustomerRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Phone string `json:"phone"`
+	Email string `json:"email" binding:"omitempty,email"`
+	Notes string `json:"notes"`
+}
+
+type MergeCustomersRequest struct {
+	CustomerIDs []uint `json:"customer_ids" binding:"required,min=1"` // Duplicates to merge into the customer
+}
+
+// CustomerProfile summarises a customer's paid orders
+type CustomerProfile struct {
+	models.Customer
+	VisitCount     int64                `json:"visit_count"`
+	LifetimeSpend  float64              `json:"lifetime_spend"`
+	AverageSpend   float64              `json:"average_spend"`
+	FirstVisit     *time.Time           `json:"first_visit"`
+	LastVisit      *time.Time           `json:"last_visit"`
+	FavouriteItems []FavouriteItem      `json:"favourite_items"`
+	RecentOrders   []models.Transaction `json:"recent_orders"`
+}
+
+type FavouriteItem struct {
+	MenuItemID uint    `json:"menu_item_id"`
+	Name       string  `json:"name"`
+	Quantity   int64   `json:"quantity"`
+	OrderCount int64   `json:"order_count"`
+	TotalSpend float64 `json:"total_spend"`
+}
+
+// DuplicateCustomers is a group of customers that look like the same person
+type DuplicateCustomers struct {
+	Reason    string            `json:"reason"` // name, phone, email
+	Customers []models.Customer `json:"customers"`
+}
+
+func NewCustomerHandler(db *gorm.DB, countryCode string) *CustomerHandler {
+	return &CustomerHandler{db: db, countryCode: countryCode}
+}
+
+func (h *CustomerHandler) GetCustomers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := h.db.WithContext(c).Model(&models.Customer{})
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		condition := "name ILIKE ? OR email ILIKE ?"
+		args := []interface{}{"%" + search + "%", "%" + search + "%"}
+		if digits := phoneDigits(search); digits != "" {
+			condition += " OR phone LIKE ?"
+			args = append(args, "%"+digits+"%")
+		}
+		query = query.Where(condition, args...)
+	}
+
+	var total int64
+	var customers []models.Customer
+	query.Count(&total)
+	if err := query.Order("name").Offset(offset).Limit(limit).Find(&customers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  customers,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// LookupCustomer finds a customer by phone number as typed at the till
+func (h *CustomerHandler) LookupCustomer(c *gin.Context) {
+	phone, err := models.NormalizePhone(c.Query("phone"), h.countryCode)
+	if err != nil || phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid phone number is required"})
+		return
+	}
+
+	var customer models.Customer
+	if err := h.db.WithContext(c).Where("phone = ?", phone).First(&customer).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found", "phone": phone})
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+func (h *CustomerHandler) GetCustomer(c *gin.Context) {
+	var customer models.Customer
+	if err := h.db.WithContext(c).First(&customer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
+	var req CustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var customer models.Customer
+	if !h.applyCustomerRequest(c, &customer, req) {
+		return
+	}
+
+	if err := h.db.WithContext(c).Create(&customer).Error; err != nil {
+		h.respondSaveError(c, customer, "Failed to create customer")
+		return
+	}
+
+	c.JSON(http.StatusCreated, customer)
+}
+
+func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
+	var customer models.Customer
+	if err := h.db.WithContext(c).First(&customer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	var req CustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.applyCustomerRequest(c, &customer, req) {
+		return
+	}
+
+	if err := h.db.WithContext(c).Save(&customer).Error; err != nil {
+		h.respondSaveError(c, customer, "Failed to update customer")
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// DeleteCustomer removes a customer. Their orders are kept, unlinked.
+func (h *CustomerHandler) DeleteCustomer(c *gin.Context) {
+	id := c.Param("id")
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Model(&models.Transaction{}).Where("customer_id = ?", id).Update("customer_id", nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink transactions"})
+		return
+	}
+	// Free the phone and email for a new customer
+	if err := tx.Model(&models.Customer{}).Where("id = ?", id).Updates(map[string]interface{}{"phone": "", "email": ""}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer"})
+		return
+	}
+	if err := tx.Delete(&models.Customer{}, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Customer deleted successfully"})
+}
+
+// GetCustomerProfile shows a customer with visit count, lifetime spend,
+// favourite items and recent orders. Only paid orders count as visits.
+func (h *CustomerHandler) GetCustomerProfile(c *gin.Context) {
+	var customer models.Customer
+	if err := h.db.WithContext(c).First(&customer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	profile := CustomerProfile{Customer: customer}
+
+	var visits struct {
+		VisitCount    int64
+		LifetimeSpend float64
+		FirstVisit    *time.Time
+		LastVisit     *time.Time
+	}
+	if err := h.db.WithContext(c).Model(&models.Transaction{}).
+		Select("COUNT(*) AS visit_count, COALESCE(SUM(total), 0) AS lifetime_spend, MIN(paid_at) AS first_visit, MAX(paid_at) AS last_visit").
+		Where("customer_id = ? AND status = ?", customer.ID, "paid").
+		Scan(&visits).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer visits"})
+		return
+	}
+	profile.VisitCount = visits.VisitCount
+	profile.LifetimeSpend = visits.LifetimeSpend
+	profile.FirstVisit = visits.FirstVisit
+	profile.LastVisit = visits.LastVisit
+	if visits.VisitCount > 0 {
+		profile.AverageSpend = visits.LifetimeSpend / float64(visits.VisitCount)
+	}
+
+	profile.FavouriteItems = []FavouriteItem{}
+	if err := h.db.WithContext(c).Table("transaction_items").
+		Select(`menu_items.id AS menu_item_id, menu_items.name,
+			SUM(transaction_items.quantity) AS quantity,
+			COUNT(DISTINCT transactions.id) AS order_count,
+			SUM(transaction_items.total_price) AS total_spend`).
+		Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
+		Joins("JOIN menu_items ON transaction_items.menu_item_id = menu_items.id").
+		Where("transactions.customer_id = ? AND transactions.status = ? AND transactions.deleted_at IS NULL", customer.ID, "paid").
+		Where("transaction_items.parent_item_id IS NULL").
+		Group("menu_items.id, menu_items.name").
+		Order("quantity DESC, order_count DESC").
+		Limit(5).
+		Scan(&profile.FavouriteItems).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favourite items"})
+		return
+	}
+
+	profile.RecentOrders = []models.Transaction{}
+	if err := preloadTransactionDetails(h.db.WithContext(c)).Where("customer_id = ?", customer.ID).
+		Order("created_at DESC").Limit(10).Find(&profile.RecentOrders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recent orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetDuplicateCustomers lists groups of customers that share a name, phone
+// or email and are probably the same person, as candidates for merging
+func (h *CustomerHandler) GetDuplicateCustomers(c *gin.Context) {
+	groups := []DuplicateCustomers{}
+	keys := []struct {
+		reason string
+		column string
+	}{
+		{"phone", "phone"},
+		{"email", "email"},
+		{"name", "LOWER(TRIM(name))"},
+	}
+
+	for _, key := range keys {
+		var values []string
+		if err := h.db.WithContext(c).Model(&models.Customer{}).
+			Select(key.column).
+			Where(key.column+" <> ''").
+			Group(key.column).
+			Having("COUNT(*) > 1").
+			Pluck(key.column, &values).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch duplicate customers"})
+			return
+		}
+
+		for _, value := range values {
+			var customers []models.Customer
+			if err := h.db.WithContext(c).Where(key.column+" = ?", value).Order("id").Find(&customers).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch duplicate customers"})
+				return
+			}
+			groups = append(groups, DuplicateCustomers{Reason: key.reason, Customers: customers})
+		}
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// MergeCustomers folds duplicates into the customer in the URL. Their orders
+// and loyalty points move over, and their phone, email and notes fill in what
+// the customer is missing. The duplicates are deleted, pointing at the customer they were
+// merged into.
+func (h *CustomerHandler) MergeCustomers(c *gin.Context) {
+	var req MergeCustomersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var customer models.Customer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, c.Param("id")).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	ids := uniqueIDs(req.CustomerIDs)
+	var duplicates []models.Customer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Order("id").Find(&duplicates).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
+		return
+	}
+	if len(duplicates) != len(ids) {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "One or more customers not found"})
+		return
+	}
+
+	var notes []string
+	if customer.Notes != "" {
+		notes = append(notes, customer.Notes)
+	}
+	for _, duplicate := range duplicates {
+		if duplicate.ID == customer.ID {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A customer cannot be merged into itself"})
+			return
+		}
+
+		if err := tx.Model(&models.Transaction{}).Where("customer_id = ?", duplicate.ID).Update("customer_id", customer.ID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move transactions"})
+			return
+		}
+		if err := tx.Model(&models.LoyaltyEntry{}).Where("customer_id = ?", duplicate.ID).Update("customer_id", customer.ID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move loyalty points"})
+			return
+		}
+		if err := mergeStoredValue(tx, duplicate.ID, customer.ID, currentUserID(c)); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move customer balance"})
+			return
+		}
+		if err := mergeHouseAccount(tx, duplicate.ID, customer.ID); err != nil {
+			tx.Rollback()
+			var tenderErr *tenderError
+			if errors.As(err, &tenderErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move house account"})
+			return
+		}
+		customer.Points += duplicate.Points
+		customer.LifetimePoints += duplicate.LifetimePoints
+
+		if customer.Phone == "" {
+			customer.Phone = duplicate.Phone
+		}
+		if customer.Email == "" {
+			customer.Email = duplicate.Email
+		}
+		if duplicate.Notes != "" {
+			notes = append(notes, duplicate.Notes)
+		}
+
+		// The phone and email move to the customer, so the duplicate must let go of them first
+		if err := tx.Model(&duplicate).Updates(map[string]interface{}{
+			"phone":           "",
+			"email":           "",
+			"points":          0,
+			"lifetime_points": 0,
+			"merged_into_id":  customer.ID,
+		}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge customers"})
+			return
+		}
+		if err := tx.Delete(&duplicate).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge customers"})
+			return
+		}
+	}
+	customer.Notes = strings.Join(notes, "\n")
+
+	if err := tx.Save(&customer).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge customers"})
+		return
+	}
+	if err := refreshLoyaltyTiers(tx, &customer.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer tier"})
+		return
+	}
+	tx.Commit()
+
+	h.db.WithContext(c).First(&customer, customer.ID)
+
+	c.JSON(http.StatusOK, gin.H{"customer": customer, "merged": len(duplicates)})
+}
+
+// applyCustomerRequest normalizes and sets the request fields on customer.
+// It responds and returns false if the phone is invalid or the phone or
+// email belongs to another customer.
+func (h *CustomerHandler) applyCustomerRequest(c *gin.Context, customer *models.Customer, req CustomerRequest) bool {
+	phone, err := models.NormalizePhone(req.Phone, h.countryCode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid phone number: %s", req.Phone)})
+		return false
+	}
+
+	customer.Name = strings.TrimSpace(req.Name)
+	customer.Phone = phone
+	customer.Email = models.NormalizeEmail(req.Email)
+	customer.Notes = req.Notes
+
+	if existing, field := h.findDuplicate(c, customer); existing != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    fmt.Sprintf("Another customer has this %s", field),
+			"customer": existing,
+		})
+		return false
+	}
+	return true
+}
+
+// findDuplicate returns another customer with the same phone or email and
+// which of them matched
+func (h *CustomerHandler) findDuplicate(c *gin.Context, customer *models.Customer) (*models.Customer, string) {
+	for _, field := range []string{"phone", "email"} {
+		value := customer.Phone
+		if field == "email" {
+			value = customer.Email
+		}
+		if value == "" {
+			continue
+		}
+
+		var existing models.Customer
+		if err := h.db.WithContext(c).Where(field+" = ? AND id <> ?", value, customer.ID).First(&existing).Error; err == nil {
+			return &existing, field
+		}
+	}
+	return nil, ""
+}
+
+// respondSaveError reports a failed save, as a conflict when another
+// customer took the phone or email in the meantime
+func (h *CustomerHandler) respondSaveError(c *gin.Context, customer models.Customer, message string) {
+	if existing, field := h.findDuplicate(c, &customer); existing != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    fmt.Sprintf("Another customer has this %s", field),
+			"customer": existing,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// loadCustomer finds the customer to link a transaction to
+func loadCustomer(db *gorm.DB, id uint) (*models.Customer, error) {
+	var customer models.Customer
+	if err := db.First(&customer, id).Error; err != nil {
+		return nil, fmt.Errorf("Customer %d not found", id)
+	}
+	return &customer, nil
+}
+
+// phoneDigits returns the digits of a search that looks like part of a phone
+// number, dropping a leading 0 so local and international forms both match
+func phoneDigits(search string) string {
+	var digits strings.Builder
+	for _, r := range search {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' || r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return ""
+		}
+	}
+	return strings.TrimLeft(digits.String(), "0")
+}
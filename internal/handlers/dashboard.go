@@ -3,6 +3,8 @@ package handlers
 import (
 	"net/http"
 	"pos-system/internal/models"
+	"pos-system/internal/tenancy"
+	"pos-system/pkg/receivables"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -63,65 +65,82 @@ func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
 
 	stats := DashboardStats{}
 
+	// Figures cover the requested outlet, or all the user's outlets consolidated
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+	salesOutlets := scope.clause("transactions.outlet_id")
+	expenseOutlets := scope.clause("expenses.outlet_id")
+
+	// Raw SQL is not scoped to the tenant by itself
+	salesTenant := tenancy.Clause(c, "transactions.tenant_id")
+	expenseTenant := tenancy.Clause(c, "expenses.tenant_id")
+
 	// Build base queries based on whether date filters are provided
 	var salesQuery, expenseQuery, orderQuery *gorm.DB
 
 	if startDate != "" && endDate != "" {
 		// Use date filtering when dates are provided
-		salesQuery = h.db.Model(&models.Transaction{}).
+		salesQuery = h.db.WithContext(c).Model(&models.Transaction{}).
 			Where("status = ? AND DATE(created_at) BETWEEN ? AND ?", "paid", startDate, endDate)
-		expenseQuery = h.db.Model(&models.Expense{}).
+		expenseQuery = h.db.WithContext(c).Model(&models.Expense{}).
 			Where("type = ? AND DATE(date) BETWEEN ? AND ?", "operational", startDate, endDate)
-		orderQuery = h.db.Model(&models.Transaction{}).
+		orderQuery = h.db.WithContext(c).Model(&models.Transaction{}).
 			Where("DATE(created_at) BETWEEN ? AND ?", startDate, endDate)
 	} else {
 		// Use all data when no date filters are provided
-		salesQuery = h.db.Model(&models.Transaction{}).
+		salesQuery = h.db.WithContext(c).Model(&models.Transaction{}).
 			Where("status = ?", "paid")
-		expenseQuery = h.db.Model(&models.Expense{}).
+		expenseQuery = h.db.WithContext(c).Model(&models.Expense{}).
 			Where("type = ?", "operational")
-		orderQuery = h.db.Model(&models.Transaction{})
+		orderQuery = h.db.WithContext(c).Model(&models.Transaction{})
 	}
+	salesQuery = salesQuery.Where(salesOutlets)
+	expenseQuery = expenseQuery.Where(expenseOutlets)
+	orderQuery = orderQuery.Where(salesOutlets)
 
 	// Total Sales (paid transactions only)
 	salesQuery.Select("COALESCE(SUM(total), 0)").Scan(&stats.TotalSales)
 
 	// Calculate Total COGS
+	// Bundle lines are skipped throughout: their COGS and revenue are carried by their component lines
 	var cogsQuery *gorm.DB
 	if startDate != "" && endDate != "" {
-		cogsQuery = h.db.Table("transaction_items").
+		cogsQuery = h.db.WithContext(c).Table("transaction_items").
 			Select("COALESCE(SUM(transaction_items.quantity * menu_items.cogs), 0)").
-			Joins("JOIN menu_items ON transaction_items.menu_item_id = menu_items.id").
+			Joins("JOIN menu_items ON transaction_items.menu_item_id = menu_items.id AND menu_items.item_type <> 'bundle'").
 			Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
 			Where("transactions.status = ? AND DATE(transactions.created_at) BETWEEN ? AND ?", "paid", startDate, endDate)
 	} else {
-		cogsQuery = h.db.Table("transaction_items").
+		cogsQuery = h.db.WithContext(c).Table("transaction_items").
 			Select("COALESCE(SUM(transaction_items.quantity * menu_items.cogs), 0)").
-			Joins("JOIN menu_items ON transaction_items.menu_item_id = menu_items.id").
+			Joins("JOIN menu_items ON transaction_items.menu_item_id = menu_items.id AND menu_items.item_type <> 'bundle'").
 			Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
 			Where("transactions.status = ?", "paid")
 	}
-	cogsQuery.Scan(&stats.TotalCOGS)
+	cogsQuery.Where(salesOutlets).Scan(&stats.TotalCOGS)
 
 	// Calculate Add-ons COGS
 	var addOnCOGS float64
 	var addOnCogsQuery *gorm.DB
 	if startDate != "" && endDate != "" {
-		addOnCogsQuery = h.db.Table("transaction_item_add_ons").
+		addOnCogsQuery = h.db.WithContext(c).Table("transaction_item_add_ons").
 			Select("COALESCE(SUM(transaction_item_add_ons.quantity * add_ons.cogs * transaction_items.quantity), 0)").
 			Joins("JOIN add_ons ON transaction_item_add_ons.add_on_id = add_ons.id").
 			Joins("JOIN transaction_items ON transaction_item_add_ons.transaction_item_id = transaction_items.id").
 			Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
 			Where("transactions.status = ? AND DATE(transactions.created_at) BETWEEN ? AND ?", "paid", startDate, endDate)
 	} else {
-		addOnCogsQuery = h.db.Table("transaction_item_add_ons").
+		addOnCogsQuery = h.db.WithContext(c).Table("transaction_item_add_ons").
 			Select("COALESCE(SUM(transaction_item_add_ons.quantity * add_ons.cogs * transaction_items.quantity), 0)").
 			Joins("JOIN add_ons ON transaction_item_add_ons.add_on_id = add_ons.id").
 			Joins("JOIN transaction_items ON transaction_item_add_ons.transaction_item_id = transaction_items.id").
 			Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
 			Where("transactions.status = ?", "paid")
 	}
-	addOnCogsQuery.Scan(&addOnCOGS)
+	addOnCogsQuery.Where(salesOutlets).Scan(&addOnCOGS)
 
 	// Total COGS includes menu items and add-ons
 	stats.TotalCOGS += addOnCOGS
@@ -146,27 +165,31 @@ func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
 	orderQuery.Count(&stats.TotalOrders)
 
 	if startDate != "" && endDate != "" {
-		h.db.Model(&models.Transaction{}).
+		h.db.WithContext(c).Model(&models.Transaction{}).
 			Where("status = ? AND DATE(created_at) BETWEEN ? AND ?", "pending", startDate, endDate).
+			Where(salesOutlets).
 			Count(&stats.PendingOrders)
 
-		h.db.Model(&models.Transaction{}).
+		h.db.WithContext(c).Model(&models.Transaction{}).
 			Where("status = ? AND DATE(created_at) BETWEEN ? AND ?", "paid", startDate, endDate).
+			Where(salesOutlets).
 			Count(&stats.PaidOrders)
 	} else {
-		h.db.Model(&models.Transaction{}).
+		h.db.WithContext(c).Model(&models.Transaction{}).
 			Where("status = ?", "pending").
+			Where(salesOutlets).
 			Count(&stats.PendingOrders)
 
-		h.db.Model(&models.Transaction{}).
+		h.db.WithContext(c).Model(&models.Transaction{}).
 			Where("status = ?", "paid").
+			Where(salesOutlets).
 			Count(&stats.PaidOrders)
 	}
 
 	// Top menu items
-	topMenuQuery := h.db.Table("transaction_items").
+	topMenuQuery := h.db.WithContext(c).Table("transaction_items").
 		Select("menu_items.name, SUM(transaction_items.quantity) as total_sold, SUM(transaction_items.unit_price * transaction_items.quantity) as total_revenue").
-		Joins("JOIN menu_items ON transaction_items.menu_item_id = menu_items.id").
+		Joins("JOIN menu_items ON transaction_items.menu_item_id = menu_items.id AND menu_items.item_type <> 'bundle'").
 		Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id")
 
 	if startDate != "" && endDate != "" {
@@ -175,13 +198,13 @@ func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
 		topMenuQuery = topMenuQuery.Where("transactions.status = ?", "paid")
 	}
 
-	topMenuQuery.Group("menu_items.id, menu_items.name").
+	topMenuQuery.Where(salesOutlets).Group("menu_items.id, menu_items.name").
 		Order("total_sold DESC").
 		Limit(5).
 		Scan(&stats.TopMenuItems)
 
 	// Top add-ons
-	topAddOnQuery := h.db.Table("transaction_item_add_ons").
+	topAddOnQuery := h.db.WithContext(c).Table("transaction_item_add_ons").
 		Select("add_ons.name, SUM(transaction_item_add_ons.quantity) as total_sold, SUM(transaction_item_add_ons.total_price) as total_revenue").
 		Joins("JOIN add_ons ON transaction_item_add_ons.add_on_id = add_ons.id").
 		Joins("JOIN transaction_items ON transaction_item_add_ons.transaction_item_id = transaction_items.id").
@@ -193,61 +216,61 @@ func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
 		topAddOnQuery = topAddOnQuery.Where("transactions.status = ?", "paid")
 	}
 
-	topAddOnQuery.Group("add_ons.id, add_ons.name").
+	topAddOnQuery.Where(salesOutlets).Group("add_ons.id, add_ons.name").
 		Order("total_sold DESC").
 		Limit(5).
 		Scan(&stats.TopAddOns)
 
 	// Sales chart data
 	if startDate != "" && endDate != "" {
-		h.db.Raw(`
+		h.db.WithContext(c).Raw(`
 			SELECT 
 				DATE(created_at) as date,
 				COALESCE(SUM(total), 0) as amount,
 				COUNT(*) as orders
 			FROM transactions 
-			WHERE deleted_at IS NULL AND status = 'paid' AND DATE(created_at) BETWEEN ? AND ?
+			WHERE deleted_at IS NULL AND status = 'paid' AND DATE(created_at) BETWEEN ? AND ? AND ? AND ?
 			GROUP BY DATE(created_at)
 			ORDER BY date DESC
-		`, startDate, endDate).Scan(&stats.SalesChart)
+		`, startDate, endDate, salesOutlets, salesTenant).Scan(&stats.SalesChart)
 	} else {
-		h.db.Raw(`
+		h.db.WithContext(c).Raw(`
 			SELECT 
 				DATE(created_at) as date,
 				COALESCE(SUM(total), 0) as amount,
 				COUNT(*) as orders
 			FROM transactions 
-			WHERE deleted_at IS NULL AND status = 'paid'
+			WHERE deleted_at IS NULL AND status = 'paid' AND ? AND ?
 			GROUP BY DATE(created_at)
 			ORDER BY date DESC
 			LIMIT 30
-		`).Scan(&stats.SalesChart)
+		`, salesOutlets, salesTenant).Scan(&stats.SalesChart)
 	}
 
 	// Expense chart data
 	if startDate != "" && endDate != "" {
-		h.db.Raw(`
+		h.db.WithContext(c).Raw(`
 			SELECT 
 				DATE(date) as date,
 				COALESCE(SUM(amount), 0) as amount,
 				type
 			FROM expenses 
-			WHERE deleted_at IS NULL AND DATE(date) BETWEEN ? AND ?
+			WHERE deleted_at IS NULL AND DATE(date) BETWEEN ? AND ? AND ? AND ?
 			GROUP BY DATE(date), type
 			ORDER BY date DESC
-		`, startDate, endDate).Scan(&stats.ExpenseChart)
+		`, startDate, endDate, expenseOutlets, expenseTenant).Scan(&stats.ExpenseChart)
 	} else {
-		h.db.Raw(`
+		h.db.WithContext(c).Raw(`
 			SELECT 
 				DATE(date) as date,
 				COALESCE(SUM(amount), 0) as amount,
 				type
 			FROM expenses 
-			WHERE deleted_at IS NULL
+			WHERE deleted_at IS NULL AND ? AND ?
 			GROUP BY DATE(date), type
 			ORDER BY date DESC
 			LIMIT 30
-		`).Scan(&stats.ExpenseChart)
+		`, expenseOutlets, expenseTenant).Scan(&stats.ExpenseChart)
 	}
 
 	c.JSON(http.StatusOK, stats)
@@ -270,9 +293,18 @@ func (h *DashboardHandler) GetSalesReport(c *gin.Context) {
 
 	var report SalesReport
 
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+	outlets := scope.clause("transactions.outlet_id")
+	tenant := tenancy.Clause(c, "transactions.tenant_id")
+
 	// Total sales and orders
-	h.db.Model(&models.Transaction{}).
+	h.db.WithContext(c).Model(&models.Transaction{}).
 		Where("status = ? AND DATE(created_at) BETWEEN ? AND ?", "paid", startDate, endDate).
+		Where(outlets).
 		Select("COALESCE(SUM(total), 0) as total_sales, COUNT(*) as total_orders").
 		Scan(&report)
 
@@ -282,20 +314,20 @@ func (h *DashboardHandler) GetSalesReport(c *gin.Context) {
 	}
 
 	// Top categories
-	h.db.Raw(`
+	h.db.WithContext(c).Raw(`
 		SELECT 
 			categories.name as category_name,
 			COALESCE(SUM(transaction_items.total_price), 0) as total_sales,
 			COUNT(DISTINCT transactions.id) as total_orders
 		FROM transaction_items
-		JOIN menu_items ON transaction_items.menu_item_id = menu_items.id
+		JOIN menu_items ON transaction_items.menu_item_id = menu_items.id AND menu_items.item_type <> 'bundle'
 		JOIN categories ON menu_items.category_id = categories.id
 		JOIN transactions ON transaction_items.transaction_id = transactions.id
-		WHERE transactions.status = 'paid' AND DATE(transactions.created_at) BETWEEN ? AND ?
+		WHERE transactions.status = 'paid' AND DATE(transactions.created_at) BETWEEN ? AND ? AND ? AND ?
 		GROUP BY categories.id, categories.name
 		ORDER BY total_sales DESC
 		LIMIT 5
-	`, startDate, endDate).Scan(&report.TopCategories)
+	`, startDate, endDate, outlets, tenant).Scan(&report.TopCategories)
 
 	c.JSON(http.StatusOK, report)
 }
@@ -317,23 +349,32 @@ func (h *DashboardHandler) GetProfitAnalysis(c *gin.Context) {
 
 	var analysis ProfitAnalysis
 
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+	outlets := scope.clause("transactions.outlet_id")
+	tenant := tenancy.Clause(c, "transactions.tenant_id")
+
 	// Revenue from paid transactions
-	h.db.Model(&models.Transaction{}).
+	h.db.WithContext(c).Model(&models.Transaction{}).
 		Where("status = ? AND DATE(created_at) BETWEEN ? AND ?", "paid", startDate, endDate).
+		Where(outlets).
 		Select("COALESCE(SUM(total), 0)").
 		Scan(&analysis.Revenue)
 
 	// COGS calculation for menu items
-	h.db.Raw(`
+	h.db.WithContext(c).Raw(`
 		SELECT COALESCE(SUM(menu_items.cogs * transaction_items.quantity), 0) as cogs
 		FROM transaction_items
-		JOIN menu_items ON transaction_items.menu_item_id = menu_items.id
+		JOIN menu_items ON transaction_items.menu_item_id = menu_items.id AND menu_items.item_type <> 'bundle'
 		JOIN transactions ON transaction_items.transaction_id = transactions.id
-		WHERE transactions.status = 'paid' AND DATE(transactions.created_at) BETWEEN ? AND ?
-	`, startDate, endDate).Scan(&analysis)
+		WHERE transactions.status = 'paid' AND DATE(transactions.created_at) BETWEEN ? AND ? AND ? AND ?
+	`, startDate, endDate, outlets, tenant).Scan(&analysis)
 
 	// Add-on revenue and COGS
-	h.db.Raw(`
+	h.db.WithContext(c).Raw(`
 		SELECT 
 			COALESCE(SUM(add_ons.price * transaction_item_add_ons.quantity * transaction_items.quantity), 0) as addon_revenue,
 			COALESCE(SUM(add_ons.cogs * transaction_item_add_ons.quantity * transaction_items.quantity), 0) as addon_cogs
@@ -341,12 +382,13 @@ func (h *DashboardHandler) GetProfitAnalysis(c *gin.Context) {
 		JOIN add_ons ON transaction_item_add_ons.add_on_id = add_ons.id
 		JOIN transaction_items ON transaction_item_add_ons.transaction_item_id = transaction_items.id
 		JOIN transactions ON transaction_items.transaction_id = transactions.id
-		WHERE transactions.status = 'paid' AND DATE(transactions.created_at) BETWEEN ? AND ?
-	`, startDate, endDate).Scan(&analysis)
+		WHERE transactions.status = 'paid' AND DATE(transactions.created_at) BETWEEN ? AND ? AND ? AND ?
+	`, startDate, endDate, outlets, tenant).Scan(&analysis)
 
 	// Operational expenses
-	h.db.Model(&models.Expense{}).
+	h.db.WithContext(c).Model(&models.Expense{}).
 		Where("type = ? AND DATE(date) BETWEEN ? AND ?", "operational", startDate, endDate).
+		Where(scope.clause("expenses.outlet_id")).
 		Select("COALESCE(SUM(amount), 0)").
 		Scan(&analysis.Expenses)
 
@@ -364,3 +406,255 @@ func (h *DashboardHandler) GetProfitAnalysis(c *gin.Context) {
 
 	c.JSON(http.StatusOK, analysis)
 }
+
+// GetStoredValueReport reports gift cards and customer balances. Money put on
+// them is owed to customers until it is spent, so the outstanding balance is a
+// liability; it only becomes revenue when redeemed on an order.
+func (h *DashboardHandler) GetStoredValueReport(c *gin.Context) {
+	startDate := c.DefaultQuery("start_date", time.Now().AddDate(0, -1, 0).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+
+	type StoredValueLiability struct {
+		AccountType string  `json:"account_type"`
+		Accounts    int64   `json:"accounts"` // With a balance left
+		Balance     float64 `json:"balance"`
+	}
+
+	type StoredValueMovement struct {
+		AccountType string  `json:"account_type"`
+		EntryType   string  `json:"entry_type"`
+		Entries     int64   `json:"entries"`
+		Amount      float64 `json:"amount"`
+	}
+
+	type StoredValueReport struct {
+		Liability   float64                `json:"liability"` // Owed on all gift cards and balances at the end of end_date
+		Liabilities []StoredValueLiability `json:"liabilities"`
+		Sold        float64                `json:"sold"`     // Issued and topped up in the period
+		Redeemed    float64                `json:"redeemed"` // Spent on orders in the period, net of refunds; already counted in sales
+		Breakage    float64                `json:"breakage"` // Written off from voided gift cards in the period
+		Movements   []StoredValueMovement  `json:"movements"`
+	}
+
+	tenant := tenancy.Clause(c, "stored_value_accounts.tenant_id")
+	report := StoredValueReport{
+		Liabilities: []StoredValueLiability{},
+		Movements:   []StoredValueMovement{},
+	}
+
+	// Balances as the ledger stood at the end of end_date
+	h.db.WithContext(c).Raw(`
+		SELECT account_type, COUNT(*) FILTER (WHERE balance > 0.005) AS accounts, COALESCE(SUM(balance), 0) AS balance
+		FROM (
+			SELECT stored_value_accounts.type AS account_type, SUM(stored_value_entries.amount) AS balance
+			FROM stored_value_entries
+			JOIN stored_value_accounts ON stored_value_entries.account_id = stored_value_accounts.id
+			WHERE DATE(stored_value_entries.created_at) <= ? AND ?
+			GROUP BY stored_value_accounts.id, stored_value_accounts.type
+		) balances
+		GROUP BY account_type
+		ORDER BY account_type
+	`, endDate, tenant).Scan(&report.Liabilities)
+
+	h.db.WithContext(c).Raw(`
+		SELECT
+			stored_value_accounts.type AS account_type,
+			stored_value_entries.type AS entry_type,
+			COUNT(*) AS entries,
+			COALESCE(SUM(stored_value_entries.amount), 0) AS amount
+		FROM stored_value_entries
+		JOIN stored_value_accounts ON stored_value_entries.account_id = stored_value_accounts.id
+		WHERE DATE(stored_value_entries.created_at) BETWEEN ? AND ? AND ?
+		GROUP BY stored_value_accounts.type, stored_value_entries.type
+		ORDER BY stored_value_accounts.type, stored_value_entries.type
+	`, startDate, endDate, tenant).Scan(&report.Movements)
+
+	for _, liability := range report.Liabilities {
+		report.Liability += liability.Balance
+	}
+	for _, movement := range report.Movements {
+		switch movement.EntryType {
+		case models.StoredValueIssue, models.StoredValueTopUp:
+			report.Sold += movement.Amount
+		case models.StoredValueRedeem, models.StoredValueRefund:
+			report.Redeemed -= movement.Amount
+		case models.StoredValueVoid:
+			report.Breakage -= movement.Amount
+		}
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetReceivablesAging reports what house account customers owe, split by how
+// long ago it was charged. Payments settle the oldest charges first.
+func (h *DashboardHandler) GetReceivablesAging(c *gin.Context) {
+	asOfDate := c.DefaultQuery("as_of", time.Now().Format("2006-01-02"))
+	asOf, err := endOfDate(asOfDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid as_of, expected YYYY-MM-DD"})
+		return
+	}
+
+	type AccountAging struct {
+		HouseAccountID uint              `json:"house_account_id"`
+		CustomerID     uint              `json:"customer_id"`
+		CustomerName   string            `json:"customer_name"`
+		CreditLimit    float64           `json:"credit_limit"`
+		Aging          receivables.Aging `json:"aging"`
+	}
+
+	type AgingReport struct {
+		AsOf     string            `json:"as_of"`
+		Total    receivables.Aging `json:"total"`
+		Accounts []AccountAging    `json:"accounts"`
+	}
+
+	var accounts []models.HouseAccount
+	if err := h.db.WithContext(c).Unscoped().Preload("Customer", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("id").Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch house accounts"})
+		return
+	}
+
+	var entries []models.HouseAccountEntry
+	if err := h.db.WithContext(c).Select("house_account_id", "created_at", "amount").
+		Where("created_at <= ?", asOf).
+		Order("created_at, id").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch house account entries"})
+		return
+	}
+	lines := map[uint][]receivables.Entry{}
+	for _, entry := range entries {
+		lines[entry.HouseAccountID] = append(lines[entry.HouseAccountID], receivables.Entry{Date: entry.CreatedAt, Amount: entry.Amount})
+	}
+
+	report := AgingReport{AsOf: asOfDate, Accounts: []AccountAging{}}
+	for _, account := range accounts {
+		aging := receivables.Age(lines[account.ID], asOf)
+		if aging.Total > -0.005 && aging.Total < 0.005 && aging.Credit < 0.005 {
+			continue
+		}
+		row := AccountAging{
+			HouseAccountID: account.ID,
+			CustomerID:     account.CustomerID,
+			CreditLimit:    account.CreditLimit,
+			Aging:          aging,
+		}
+		if account.Customer != nil {
+			row.CustomerName = account.Customer.Name
+		}
+		report.Accounts = append(report.Accounts, row)
+		report.Total.Add(aging)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetCashFlow reports the money that came in and went out in a period. Sales
+// charged to house accounts are revenue when sold but bring in no money until
+// they are settled, so settlements are reported on their own. Points, gift
+// cards and balances bring in no money either; gift cards and balances did
+// when they were sold or topped up.
+//
+// House accounts and stored value belong to the business, not an outlet, so
+// settlements and stored value sold are only included when consolidated.
+func (h *DashboardHandler) GetCashFlow(c *gin.Context) {
+	startDate := c.DefaultQuery("start_date", time.Now().AddDate(0, -1, 0).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+	outlets := scope.clause("transactions.outlet_id")
+	tenant := tenancy.Clause(c, "transactions.tenant_id")
+	consolidated := requestedOutlet(c) == ""
+
+	type MethodAmount struct {
+		PaymentMethod string  `json:"payment_method"`
+		Amount        float64 `json:"amount"`
+	}
+
+	type CashFlow struct {
+		SalesReceipts       []MethodAmount `json:"sales_receipts"`
+		Settlements         []MethodAmount `json:"settlements"`            // House account payments
+		StoredValueSold     []MethodAmount `json:"stored_value_sold"`      // Gift cards issued and balances topped up
+		ChargedToAccount    float64        `json:"charged_to_account"`     // Sales on credit; revenue, but not yet cash
+		PaidWithStoredValue float64        `json:"paid_with_stored_value"` // Sales paid with points, gift cards or balances
+		CashIn              float64        `json:"cash_in"`
+		Expenses            float64        `json:"expenses"`
+		NetCashFlow         float64        `json:"net_cash_flow"`
+	}
+
+	flow := CashFlow{
+		SalesReceipts:   []MethodAmount{},
+		Settlements:     []MethodAmount{},
+		StoredValueSold: []MethodAmount{},
+	}
+	nonCash := []string{accountPaymentMethod, loyaltyPaymentMethod, giftCardPaymentMethod, balancePaymentMethod}
+
+	// Tenders of paid orders; orders paid before split payments have no tender rows
+	var tenders []MethodAmount
+	h.db.WithContext(c).Raw(`
+		SELECT payment_method, COALESCE(SUM(amount), 0) AS amount
+		FROM (
+			SELECT transaction_payments.payment_method, transaction_payments.amount
+			FROM transaction_payments
+			JOIN transactions ON transaction_payments.transaction_id = transactions.id
+			WHERE transactions.status = 'paid' AND transactions.deleted_at IS NULL AND DATE(transactions.paid_at) BETWEEN ? AND ? AND ? AND ?
+			UNION ALL
+			SELECT transactions.payment_method, transactions.total
+			FROM transactions
+			WHERE transactions.status = 'paid' AND transactions.deleted_at IS NULL AND DATE(transactions.paid_at) BETWEEN ? AND ? AND ? AND ?
+				AND NOT EXISTS (SELECT 1 FROM transaction_payments WHERE transaction_payments.transaction_id = transactions.id)
+		) tenders
+		GROUP BY payment_method
+		ORDER BY payment_method
+	`, startDate, endDate, outlets, tenant, startDate, endDate, outlets, tenant).Scan(&tenders)
+
+	for _, tender := range tenders {
+		switch tender.PaymentMethod {
+		case accountPaymentMethod:
+			flow.ChargedToAccount += tender.Amount
+		case loyaltyPaymentMethod, giftCardPaymentMethod, balancePaymentMethod:
+			flow.PaidWithStoredValue += tender.Amount
+		default:
+			flow.SalesReceipts = append(flow.SalesReceipts, tender)
+			flow.CashIn += tender.Amount
+		}
+	}
+
+	if consolidated {
+		h.db.WithContext(c).Model(&models.HouseAccountEntry{}).
+			Select("payment_method, COALESCE(-SUM(amount), 0) AS amount").
+			Where("type = ? AND DATE(created_at) BETWEEN ? AND ?", models.AccountPayment, startDate, endDate).
+			Group("payment_method").Order("payment_method").
+			Scan(&flow.Settlements)
+
+		h.db.WithContext(c).Model(&models.StoredValueEntry{}).
+			Select("payment_method, COALESCE(SUM(amount), 0) AS amount").
+			Where("type IN ? AND payment_method NOT IN ? AND DATE(created_at) BETWEEN ? AND ?",
+				[]string{models.StoredValueIssue, models.StoredValueTopUp}, nonCash, startDate, endDate).
+			Group("payment_method").Order("payment_method").
+			Scan(&flow.StoredValueSold)
+	}
+
+	for _, settlement := range flow.Settlements {
+		flow.CashIn += settlement.Amount
+	}
+	for _, sold := range flow.StoredValueSold {
+		flow.CashIn += sold.Amount
+	}
+
+	h.db.WithContext(c).Model(&models.Expense{}).
+		Where("DATE(date) BETWEEN ? AND ?", startDate, endDate).
+		Where(scope.clause("expenses.outlet_id")).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&flow.Expenses)
+
+	flow.NetCashFlow = flow.CashIn - flow.Expenses
+
+	c.JSON(http.StatusOK, flow)
+}
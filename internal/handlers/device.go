@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pos-system/internal/models"
+	"pos-system/pkg/auth"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errUnregisteredDevice = errors.New("Device is not registered")
+
+type DeviceHandler struct {
+	db *gorm.DB
+}
+
+type DeviceRequest struct {
+	Name     string `json:"name" binding:"required"`
+	OutletID *uint  `json:"outlet_id"` // Only users working at the outlet can log in; empty for any
+}
+
+type SetPINRequest struct {
+	PIN      string `json:"pin" binding:"required"`
+	Password string `json:"password" binding:"required"` // Current password
+}
+
+type SwitchUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	PIN      string `json:"pin" binding:"required"`
+}
+
+func NewDeviceHandler(db *gorm.DB) *DeviceHandler {
+	return &DeviceHandler{db: db}
+}
+
+// RegisterDevice registers a terminal for PIN logins. The device token is
+// only returned here; the terminal sends it in the X-Device-Token header.
+func (h *DeviceHandler) RegisterDevice(c *gin.Context) {
+	var req DeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.OutletID != nil {
+		var outlet models.Outlet
+		if err := h.db.WithContext(c).Where("is_active = ?", true).First(&outlet, *req.OutletID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Outlet not found"})
+			return
+		}
+	}
+
+	token, hash, err := auth.NewDeviceToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	device := models.Device{
+		Name:           strings.TrimSpace(req.Name),
+		OutletID:       req.OutletID,
+		TokenHash:      hash,
+		RegisteredByID: c.GetUint("user_id"),
+	}
+	if err := h.db.WithContext(c).Create(&device).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"device": device,
+		"token":  token,
+	})
+}
+
+// GetDevices lists the registered devices; revoked ones only with
+// ?include_revoked=true
+func (h *DeviceHandler) GetDevices(c *gin.Context) {
+	query := h.db.WithContext(c).Preload("Outlet").Order("name")
+	if c.Query("include_revoked") != "true" {
+		query = query.Where("revoked_at IS NULL")
+	}
+
+	var devices []models.Device
+	if err := query.Find(&devices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// UnlockDevice lets PIN logins be tried again on a device locked by wrong
+// PINs
+func (h *DeviceHandler) UnlockDevice(c *gin.Context) {
+	device, ok := h.findDevice(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.WithContext(c).Model(&device).Updates(map[string]interface{}{
+		"failed_pin_attempts": 0,
+		"locked_until":        nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock device"})
+		return
+	}
+	device.FailedPINAttempts = 0
+	device.LockedUntil = nil
+
+	c.JSON(http.StatusOK, device)
+}
+
+// RevokeDevice unregisters a device, e.g. a lost tablet. The logins made on
+// it stop working at once.
+func (h *DeviceHandler) RevokeDevice(c *gin.Context) {
+	device, ok := h.findDevice(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	err := h.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&device).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("device_id = ? AND revoked_at IS NULL", device.ID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device revoked successfully"})
+}
+
+// findDevice loads the registered device of the id parameter, or responds
+// with an error
+func (h *DeviceHandler) findDevice(c *gin.Context) (models.Device, bool) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return models.Device{}, false
+	}
+
+	var device models.Device
+	if err := h.db.WithContext(c).Where("revoked_at IS NULL").First(&device, deviceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return models.Device{}, false
+	}
+	return device, true
+}
+
+// requestDevice returns the registered device whose token the request
+// carries
+func requestDevice(c *gin.Context, db *gorm.DB) (models.Device, error) {
+	var device models.Device
+	token := c.GetHeader(auth.DeviceTokenHeader)
+	if token == "" {
+		return device, errUnregisteredDevice
+	}
+	if err := db.Where("token_hash = ? AND revoked_at IS NULL", auth.HashToken(token)).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return device, errUnregisteredDevice
+		}
+		return device, err
+	}
+	return device, nil
+}
+
+// SetPIN sets the current user's PIN for logging in on registered devices
+func (h *AuthHandler) SetPIN(c *gin.Context) {
+	var req SetPINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c).First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := auth.CheckPassword(user.Password, req.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	hashedPIN, err := auth.HashPIN(req.PIN)
+	if errors.Is(err, auth.ErrInvalidPIN) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash PIN"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Model(&user).Update("pin_hash", hashedPIN).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set PIN"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "PIN set successfully"})
+}
+
+// ClearPIN removes the current user's PIN
+func (h *AuthHandler) ClearPIN(c *gin.Context) {
+	if err := h.db.WithContext(c).Model(&models.User{}).
+		Where("id = ?", c.GetUint("user_id")).
+		Update("pin_hash", "").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear PIN"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "PIN cleared successfully"})
+}
+
+// GetDeviceUsers lists the users who can log in with a PIN on the device of
+// the request, for a terminal to show who can take over
+func (h *AuthHandler) GetDeviceUsers(c *gin.Context) {
+	device, err := requestDevice(c, h.db.WithContext(c))
+	if err != nil {
+		respondDeviceError(c, err)
+		return
+	}
+
+	query := h.db.WithContext(c).Select("id", "username", "full_name", "role").
+		Where("is_active = ? AND pin_hash <> ''", true).
+		Order("full_name")
+	if device.OutletID != nil {
+		query = query.Where("(role = 'admin' OR NOT EXISTS (SELECT 1 FROM user_outlets WHERE user_outlets.user_id = users.id) "+
+			"OR EXISTS (SELECT 1 FROM user_outlets WHERE user_outlets.user_id = users.id AND user_outlets.outlet_id = ?))", *device.OutletID)
+	}
+
+	var users []models.User
+	if err := query.Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// SwitchUser logs a user in with their PIN on a registered device, ending
+// the session of the user handing the device over, if any. The tokens it
+// issues only work together with the device token. Wrong PINs are counted
+// per device; too many in a row lock PIN logins on it for a while.
+func (h *AuthHandler) SwitchUser(c *gin.Context) {
+	var req SwitchUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Locking the device makes concurrent attempts count one after another
+	device, err := requestDevice(c, tx.Clauses(clause.Locking{Strength: "UPDATE"}))
+	if err != nil {
+		tx.Rollback()
+		respondDeviceError(c, err)
+		return
+	}
+
+	now := time.Now()
+	if device.PINLocked(now) {
+		tx.Rollback()
+		respondPINLocked(c, device, now)
+		return
+	}
+
+	var user models.User
+	err = tx.Preload("Outlets").Where("username = ? AND is_active = ?", req.Username, true).First(&user).Error
+	if err != nil || auth.CheckPIN(user.PINHash, req.PIN) != nil {
+		locked := device.PINFailed(now, h.pinLimit, h.pinLockout)
+		if err := saveDeviceAttempts(tx, &device); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record attempt"})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record attempt"})
+			return
+		}
+		if locked {
+			respondPINLocked(c, device, now)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if !worksAt(user, device.OutletID) {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": errOutletForbidden.Error()})
+		return
+	}
+
+	device.PINSucceeded(now)
+	if err := saveDeviceAttempts(tx, &device); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch user"})
+		return
+	}
+
+	// The previous user's token may have expired while they were serving
+	if claims, err := h.jwtService.ClaimsOf(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")); err == nil &&
+		claims.DeviceID == device.ID && claims.TenantID == c.GetUint("tenant_id") && claims.SessionID != "" {
+		if err := revokeSession(tx, claims.SessionID, h.jwtService.AccessTTL()); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end the previous session"})
+			return
+		}
+	}
+
+	response, err := h.startSession(tx, user, device.ID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func saveDeviceAttempts(db *gorm.DB, device *models.Device) error {
+	return db.Model(device).Select("failed_pin_attempts", "locked_until", "last_used_at").Updates(device).Error
+}
+
+// worksAt reports whether a user may work at an outlet: admins and users not
+// assigned to any outlet work at every one
+func worksAt(user models.User, outletID *uint) bool {
+	if outletID == nil || user.Role == "admin" || len(user.Outlets) == 0 {
+		return true
+	}
+	for _, outlet := range user.Outlets {
+		if outlet.ID == *outletID {
+			return true
+		}
+	}
+	return false
+}
+
+func respondDeviceError(c *gin.Context, err error) {
+	if errors.Is(err, errUnregisteredDevice) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find device"})
+}
+
+func respondPINLocked(c *gin.Context, device models.Device, now time.Time) {
+	retryAfter := int(device.LockedUntil.Sub(now).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":        "Too many wrong PINs; try again later",
+		"locked_until": device.LockedUntil,
+	})
+}
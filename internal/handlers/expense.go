@@ -20,8 +20,13 @@ type CreateExpenseRequest struct {
 	Description string    `json:"description" binding:"required"`
 	Amount      float64   `json:"amount" binding:"required,gt=0"`
 	Date        time.Time `json:"date" binding:"required"`
+	OutletID    *uint     `json:"outlet_id"` // Defaults to the X-Outlet-ID header or the user's only outlet
 }
 
+// errRawMaterialExpense is returned for raw material expenses entered by
+// hand; they come from the stock ledger so the quantities are recorded too
+const errRawMaterialExpense = "Raw material expenses are recorded from stock purchases: use POST /api/v1/inventory/movements with type purchase, or receive a purchase order"
+
 func NewExpenseHandler(db *gorm.DB) *ExpenseHandler {
 	return &ExpenseHandler{db: db}
 }
@@ -33,8 +38,19 @@ func (h *ExpenseHandler) CreateExpense(c *gin.Context) {
 		return
 	}
 
+	if req.Type == "raw_material" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errRawMaterialExpense})
+		return
+	}
+
 	userID, _ := c.Get("user_id")
 
+	outletID, err := resolveOutletID(c, h.db.WithContext(c), req.OutletID)
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
 	expense := models.Expense{
 		Type:        req.Type,
 		Category:    req.Category,
@@ -42,15 +58,16 @@ func (h *ExpenseHandler) CreateExpense(c *gin.Context) {
 		Amount:      req.Amount,
 		Date:        req.Date,
 		UserID:      userID.(uint),
+		OutletID:    &outletID,
 	}
 
-	if err := h.db.Create(&expense).Error; err != nil {
+	if err := h.db.WithContext(c).Create(&expense).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create expense"})
 		return
 	}
 
 	// Reload with user association
-	h.db.Preload("User").First(&expense, expense.ID)
+	h.db.WithContext(c).Preload("User").First(&expense, expense.ID)
 
 	c.JSON(http.StatusCreated, expense)
 }
@@ -67,7 +84,13 @@ func (h *ExpenseHandler) GetExpenses(c *gin.Context) {
 	var expenses []models.Expense
 	var total int64
 
-	query := h.db.Model(&models.Expense{}).Preload("User")
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	query := h.db.WithContext(c).Model(&models.Expense{}).Preload("User").Where(scope.clause("outlet_id"))
 
 	if expenseType != "" {
 		query = query.Where("type = ?", expenseType)
@@ -100,7 +123,7 @@ func (h *ExpenseHandler) GetExpense(c *gin.Context) {
 	id := c.Param("id")
 
 	var expense models.Expense
-	if err := h.db.Preload("User").First(&expense, id).Error; err != nil {
+	if err := h.db.WithContext(c).Preload("User").First(&expense, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
 		return
 	}
@@ -112,30 +135,50 @@ func (h *ExpenseHandler) UpdateExpense(c *gin.Context) {
 	id := c.Param("id")
 
 	var expense models.Expense
-	if err := h.db.First(&expense, id).Error; err != nil {
+	if err := h.db.WithContext(c).First(&expense, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
 		return
 	}
 
+	// Purchase expenses mirror the stock ledger and cannot drift from it
+	if expense.StockMovementID != nil || expense.PurchaseOrderID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expense was created from a stock purchase and cannot be changed"})
+		return
+	}
+
 	var req CreateExpenseRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Raw material expenses entered before the stock ledger can still be corrected
+	if req.Type == "raw_material" && expense.Type != "raw_material" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errRawMaterialExpense})
+		return
+	}
+
 	expense.Type = req.Type
 	expense.Category = req.Category
 	expense.Description = req.Description
 	expense.Amount = req.Amount
 	expense.Date = req.Date
+	if req.OutletID != nil {
+		outletID, err := resolveOutletID(c, h.db.WithContext(c), req.OutletID)
+		if err != nil {
+			respondOutletError(c, err)
+			return
+		}
+		expense.OutletID = &outletID
+	}
 
-	if err := h.db.Save(&expense).Error; err != nil {
+	if err := h.db.WithContext(c).Save(&expense).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update expense"})
 		return
 	}
 
 	// Reload with user association
-	h.db.Preload("User").First(&expense, expense.ID)
+	h.db.WithContext(c).Preload("User").First(&expense, expense.ID)
 
 	c.JSON(http.StatusOK, expense)
 }
@@ -143,7 +186,18 @@ func (h *ExpenseHandler) UpdateExpense(c *gin.Context) {
 func (h *ExpenseHandler) DeleteExpense(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := h.db.Delete(&models.Expense{}, id).Error; err != nil {
+	var expense models.Expense
+	if err := h.db.WithContext(c).First(&expense, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+		return
+	}
+
+	if expense.StockMovementID != nil || expense.PurchaseOrderID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expense was created from a stock purchase and cannot be deleted"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Delete(&models.Expense{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete expense"})
 		return
 	}
@@ -155,7 +209,13 @@ func (h *ExpenseHandler) GetExpenseSummary(c *gin.Context) {
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
 
-	query := h.db.Model(&models.Expense{})
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	query := h.db.WithContext(c).Model(&models.Expense{}).Where(scope.clause("outlet_id"))
 
 	if startDate != "" {
 		query = query.Where("date >= ?", startDate)
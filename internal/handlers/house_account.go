@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"pos-system/pkg/receivables"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// accountPaymentMethod is the payment method code for charging an order to
+// the customer's house account
+const accountPaymentMethod = "account"
+
+type HouseAccountHandler struct {
+	db *gorm.DB
+}
+
+type HouseAccountRequest struct {
+	CreditLimit float64 `json:"credit_limit" binding:"min=0"`
+	Status      string  `json:"status" binding:"omitempty,oneof=active suspended"`
+	Notes       string  `json:"notes"`
+}
+
+type AccountPaymentRequest struct {
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	PaymentMethod string  `json:"payment_method" binding:"required"`
+	Reference     string  `json:"reference"`
+	Note          string  `json:"note"`
+}
+
+type AdjustAccountRequest struct {
+	Amount float64 `json:"amount" binding:"required"` // Positive adds to what is owed
+	Note   string  `json:"note" binding:"required"`
+}
+
+type HouseAccountResponse struct {
+	models.HouseAccount
+	AvailableCredit float64                    `json:"available_credit"`
+	Aging           receivables.Aging          `json:"aging"`
+	Entries         []models.HouseAccountEntry `json:"entries"`
+}
+
+// AccountStatement lists what happened on a house account in a period
+type AccountStatement struct {
+	Account        models.HouseAccount        `json:"account"`
+	StartDate      string                     `json:"start_date"`
+	EndDate        string                     `json:"end_date"`
+	OpeningBalance float64                    `json:"opening_balance"`
+	Charges        float64                    `json:"charges"` // Orders charged, less refunds
+	Payments       float64                    `json:"payments"`
+	Adjustments    float64                    `json:"adjustments"`
+	ClosingBalance float64                    `json:"closing_balance"`
+	Aging          receivables.Aging          `json:"aging"` // As of the end date
+	Entries        []models.HouseAccountEntry `json:"entries"`
+}
+
+func NewHouseAccountHandler(db *gorm.DB) *HouseAccountHandler {
+	return &HouseAccountHandler{db: db}
+}
+
+func (h *HouseAccountHandler) GetHouseAccounts(c *gin.Context) {
+	query := h.db.WithContext(c).Preload("Customer").Order("balance DESC, id")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if c.Query("owing") == "true" {
+		query = query.Where("balance > ?", 0.005)
+	}
+
+	var accounts []models.HouseAccount
+	if err := query.Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch house accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": accounts})
+}
+
+func (h *HouseAccountHandler) GetHouseAccount(c *gin.Context) {
+	var account models.HouseAccount
+	if err := h.db.WithContext(c).Preload("Customer").Where("customer_id = ?", c.Param("id")).First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer has no house account"})
+		return
+	}
+
+	h.respondAccount(c, http.StatusOK, account)
+}
+
+// SaveHouseAccount opens a house account for a customer or changes its credit
+// limit and status. Lowering the limit below the balance only stops new charges.
+func (h *HouseAccountHandler) SaveHouseAccount(c *gin.Context) {
+	var req HouseAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var customer models.Customer
+	if err := h.db.WithContext(c).First(&customer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	account := models.HouseAccount{CustomerID: customer.ID, Status: "active"}
+	status := http.StatusOK
+	if err := h.db.WithContext(c).Where("customer_id = ?", customer.ID).First(&account).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		status = http.StatusCreated
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch house account"})
+		return
+	}
+
+	account.CreditLimit = req.CreditLimit
+	account.Notes = req.Notes
+	if req.Status != "" {
+		account.Status = req.Status
+	}
+	// Only the settings are saved; the balance is left to the ledger
+	if err := h.db.WithContext(c).Select("customer_id", "credit_limit", "status", "notes", "created_at", "updated_at").Save(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save house account"})
+		return
+	}
+
+	h.db.WithContext(c).Preload("Customer").First(&account, account.ID)
+	h.respondAccount(c, status, account)
+}
+
+// RecordAccountPayment records a settlement, which may pay off part of what
+// is owed
+func (h *HouseAccountHandler) RecordAccountPayment(c *gin.Context) {
+	var req AccountPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkFundingMethod(h.db.WithContext(c), req.PaymentMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.postToAccount(c, func(account *models.HouseAccount) (models.HouseAccountEntry, error) {
+		if req.Amount > account.Balance+0.005 {
+			return models.HouseAccountEntry{}, &tenderError{fmt.Sprintf("Payment is more than the %.2f owed", account.Balance)}
+		}
+		return models.HouseAccountEntry{
+			Type:          models.AccountPayment,
+			Amount:        -req.Amount,
+			PaymentMethod: req.PaymentMethod,
+			Reference:     req.Reference,
+			Note:          req.Note,
+		}, nil
+	})
+}
+
+// AdjustHouseAccount corrects what a customer owes by hand, e.g. to write off
+// a small difference
+func (h *HouseAccountHandler) AdjustHouseAccount(c *gin.Context) {
+	var req AdjustAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.postToAccount(c, func(account *models.HouseAccount) (models.HouseAccountEntry, error) {
+		return models.HouseAccountEntry{
+			Type:   models.AccountAdjust,
+			Amount: req.Amount,
+			Note:   req.Note,
+		}, nil
+	})
+}
+
+// GetAccountStatement builds the statement of a house account for a period,
+// by default the previous calendar month
+func (h *HouseAccountHandler) GetAccountStatement(c *gin.Context) {
+	var account models.HouseAccount
+	if err := h.db.WithContext(c).Preload("Customer").Where("customer_id = ?", c.Param("id")).First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer has no house account"})
+		return
+	}
+
+	firstOfMonth := time.Now().AddDate(0, 0, 1-time.Now().Day())
+	startDate := c.DefaultQuery("start_date", firstOfMonth.AddDate(0, -1, 0).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", firstOfMonth.AddDate(0, 0, -1).Format("2006-01-02"))
+	asOf, err := endOfDate(endDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date, expected YYYY-MM-DD"})
+		return
+	}
+
+	statement := AccountStatement{
+		Account:   account,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Entries:   []models.HouseAccountEntry{},
+	}
+
+	h.db.WithContext(c).Model(&models.HouseAccountEntry{}).
+		Where("house_account_id = ? AND DATE(created_at) < ?", account.ID, startDate).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&statement.OpeningBalance)
+
+	if err := h.db.WithContext(c).Preload("Transaction").
+		Where("house_account_id = ? AND DATE(created_at) BETWEEN ? AND ?", account.ID, startDate, endDate).
+		Order("created_at, id").
+		Find(&statement.Entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statement entries"})
+		return
+	}
+
+	statement.ClosingBalance = statement.OpeningBalance
+	for _, entry := range statement.Entries {
+		switch entry.Type {
+		case models.AccountCharge, models.AccountReverse:
+			statement.Charges += entry.Amount
+		case models.AccountPayment:
+			statement.Payments -= entry.Amount
+		default:
+			statement.Adjustments += entry.Amount
+		}
+		statement.ClosingBalance += entry.Amount
+	}
+
+	aging, err := ageHouseAccount(h.db.WithContext(c), account.ID, asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to age house account"})
+		return
+	}
+	statement.Aging = aging
+
+	c.JSON(http.StatusOK, statement)
+}
+
+// postToAccount locks the customer's house account and adds the entry build
+// returns for it, in a DB transaction
+func (h *HouseAccountHandler) postToAccount(c *gin.Context, build func(account *models.HouseAccount) (models.HouseAccountEntry, error)) {
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	customerID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	account, err := lockHouseAccount(tx, uint(customerID))
+	if err != nil {
+		tx.Rollback()
+		respondStoredValueError(c, err)
+		return
+	}
+
+	entry, err := build(account)
+	if err != nil {
+		tx.Rollback()
+		respondStoredValueError(c, err)
+		return
+	}
+	entry.UserID = currentUserID(c)
+	if err := postHouseAccount(tx, account, entry); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update house account"})
+		return
+	}
+	tx.Commit()
+
+	h.db.WithContext(c).Preload("Customer").First(account, account.ID)
+	h.respondAccount(c, http.StatusOK, *account)
+}
+
+func (h *HouseAccountHandler) respondAccount(c *gin.Context, status int, account models.HouseAccount) {
+	aging, err := ageHouseAccount(h.db.WithContext(c), account.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to age house account"})
+		return
+	}
+
+	entries := []models.HouseAccountEntry{}
+	if err := h.db.WithContext(c).Where("house_account_id = ?", account.ID).Order("id DESC").Limit(50).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch house account history"})
+		return
+	}
+
+	c.JSON(status, HouseAccountResponse{
+		HouseAccount:    account,
+		AvailableCredit: max(account.CreditLimit-account.Balance, 0),
+		Aging:           aging,
+		Entries:         entries,
+	})
+}
+
+// postHouseAccount adds an entry to a locked house account and applies it to
+// the balance
+func postHouseAccount(tx *gorm.DB, account *models.HouseAccount, entry models.HouseAccountEntry) error {
+	entry.HouseAccountID = account.ID
+	entry.BalanceAfter = account.Balance + entry.Amount
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(account).Update("balance", entry.BalanceAfter).Error; err != nil {
+		return err
+	}
+	account.Balance = entry.BalanceAfter
+	return nil
+}
+
+// lockHouseAccount finds a customer's house account and locks it for the
+// rest of the DB transaction
+func lockHouseAccount(tx *gorm.DB, customerID uint) (*models.HouseAccount, error) {
+	var account models.HouseAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("customer_id = ?", customerID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &tenderError{"Customer has no house account"}
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// chargeHouseAccount charges an order to the house account of its customer,
+// within the credit limit
+func chargeHouseAccount(tx *gorm.DB, transaction *models.Transaction, amount float64, userID *uint) (*models.HouseAccount, error) {
+	if transaction.CustomerID == nil {
+		return nil, &tenderError{"Link a customer to charge their house account"}
+	}
+	account, err := lockHouseAccount(tx, *transaction.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if account.Status != "active" {
+		return nil, &tenderError{"House account is suspended"}
+	}
+	if account.Balance+amount > account.CreditLimit+0.005 {
+		return nil, &tenderError{fmt.Sprintf("Charge exceeds the credit limit; %.2f available", max(account.CreditLimit-account.Balance, 0))}
+	}
+
+	if amount > 0 {
+		if err := postHouseAccount(tx, account, models.HouseAccountEntry{
+			Type:          models.AccountCharge,
+			Amount:        amount,
+			TransactionID: &transaction.ID,
+			UserID:        userID,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return account, nil
+}
+
+// mergeHouseAccount moves a merged customer's house account to the customer
+// they were merged into. Two accounts are only merged when the duplicate's
+// is settled, so its charges keep their age.
+func mergeHouseAccount(tx *gorm.DB, fromID, intoID uint) error {
+	var from models.HouseAccount
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("customer_id = ?", fromID).First(&from).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var existing int64
+	if err := tx.Model(&models.HouseAccount{}).Where("customer_id = ?", intoID).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing == 0 {
+		return tx.Model(&from).Update("customer_id", intoID).Error
+	}
+	if from.Balance > 0.005 || from.Balance < -0.005 {
+		return &tenderError{fmt.Sprintf("Customer #%d has an unsettled house account", fromID)}
+	}
+	return nil
+}
+
+// ageHouseAccount ages what is owed on a house account as of asOf
+func ageHouseAccount(db *gorm.DB, accountID uint, asOf time.Time) (receivables.Aging, error) {
+	var entries []models.HouseAccountEntry
+	if err := db.Select("created_at", "amount").
+		Where("house_account_id = ? AND created_at <= ?", accountID, asOf).
+		Order("created_at, id").Find(&entries).Error; err != nil {
+		return receivables.Aging{}, err
+	}
+
+	lines := make([]receivables.Entry, len(entries))
+	for i, entry := range entries {
+		lines[i] = receivables.Entry{Date: entry.CreatedAt, Amount: entry.Amount}
+	}
+	return receivables.Age(lines, asOf), nil
+}
+
+// endOfDate returns the last moment of a YYYY-MM-DD date
+func endOfDate(date string) (time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
@@ -0,0 +1,616 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pos-system/internal/events"
+	"pos-system/internal/models"
+	"pos-system/pkg/inventory"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InventoryHandler struct {
+	db     *gorm.DB
+	events *events.Dispatcher
+}
+
+type IngredientRequest struct {
+	Name              string  `json:"name" binding:"required"`
+	Unit              string  `json:"unit" binding:"required"`
+	UnitCost          float64 `json:"unit_cost" binding:"min=0"`
+	StockQty          float64 `json:"stock_qty"`
+	OutletID          *uint   `json:"outlet_id"` // Outlet the opening stock is at
+	LowStockThreshold float64 `json:"low_stock_threshold" binding:"min=0"`
+}
+
+type RecipeLineRequest struct {
+	IngredientID uint    `json:"ingredient_id" binding:"required"`
+	Quantity     float64 `json:"quantity" binding:"required,gt=0"`
+}
+
+type UpdateRecipeRequest struct {
+	Lines []RecipeLineRequest `json:"lines" binding:"dive"`
+}
+
+func NewInventoryHandler(db *gorm.DB, dispatcher *events.Dispatcher) *InventoryHandler {
+	return &InventoryHandler{db: db, events: dispatcher}
+}
+
+// Ingredients
+func (h *InventoryHandler) GetIngredients(c *gin.Context) {
+	var ingredients []models.Ingredient
+
+	query := h.db.WithContext(c).Model(&models.Ingredient{})
+	if search := c.Query("search"); search != "" {
+		query = query.Where("name ILIKE ?", "%"+search+"%")
+	}
+
+	if err := query.Order("name").Find(&ingredients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ingredients)
+}
+
+func (h *InventoryHandler) GetIngredient(c *gin.Context) {
+	id := c.Param("id")
+
+	var ingredient models.Ingredient
+	if err := h.db.WithContext(c).First(&ingredient, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ingredient)
+}
+
+func (h *InventoryHandler) CreateIngredient(c *gin.Context) {
+	var req IngredientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ingredient := models.Ingredient{
+		Name:              req.Name,
+		Unit:              req.Unit,
+		UnitCost:          req.UnitCost,
+		LowStockThreshold: req.LowStockThreshold,
+	}
+
+	var outletID uint
+	if req.StockQty != 0 {
+		var err error
+		if outletID, err = resolveOutletID(c, h.db.WithContext(c), req.OutletID); err != nil {
+			respondOutletError(c, err)
+			return
+		}
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Create(&ingredient).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ingredient"})
+		return
+	}
+
+	// Opening stock goes through the ledger like any other stock change
+	if req.StockQty != 0 {
+		movement := models.StockMovement{
+			IngredientID: ingredient.ID,
+			OutletID:     &outletID,
+			Type:         "adjustment",
+			Quantity:     req.StockQty,
+			Reason:       "Opening stock",
+			UserID:       currentUserID(c),
+		}
+		if err := recordStockMovement(tx, &movement); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record opening stock"})
+			return
+		}
+	}
+
+	alerts, err := refreshStockStatus(tx, []uint{ingredient.ID})
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock status"})
+		return
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
+	h.db.WithContext(c).First(&ingredient, ingredient.ID)
+
+	c.JSON(http.StatusCreated, ingredient)
+}
+
+// UpdateIngredient updates an ingredient and recalculates the COGS of every
+// recipe using it when the unit cost changes. Stock is not changed here; use
+// stock movements or a stock take instead.
+func (h *InventoryHandler) UpdateIngredient(c *gin.Context) {
+	id := c.Param("id")
+
+	var ingredient models.Ingredient
+	if err := h.db.WithContext(c).First(&ingredient, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ingredient not found"})
+		return
+	}
+
+	var req IngredientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	costChanged := ingredient.UnitCost != req.UnitCost
+	ingredient.Name = req.Name
+	ingredient.Unit = req.Unit
+	ingredient.UnitCost = req.UnitCost
+	ingredient.LowStockThreshold = req.LowStockThreshold
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Save(&ingredient).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ingredient"})
+		return
+	}
+
+	if costChanged {
+		if err := recalculateCOGSForIngredients(tx, []uint{ingredient.ID}, currentUserID(c)); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recalculate COGS"})
+			return
+		}
+	}
+
+	// The threshold may have changed
+	alerts, err := refreshStockStatus(tx, []uint{ingredient.ID})
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock status"})
+		return
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
+	h.db.WithContext(c).First(&ingredient, ingredient.ID)
+
+	c.JSON(http.StatusOK, ingredient)
+}
+
+func (h *InventoryHandler) DeleteIngredient(c *gin.Context) {
+	id := c.Param("id")
+
+	var recipeCount int64
+	h.db.WithContext(c).Model(&models.RecipeLine{}).Where("ingredient_id = ?", id).Count(&recipeCount)
+	if recipeCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ingredient is used in recipes"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Delete(&models.Ingredient{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ingredient"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ingredient deleted successfully"})
+}
+
+// Recipes
+func (h *InventoryHandler) GetMenuItemRecipe(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).Preload("Recipe.Ingredient").First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"menu_item_id": menuItem.ID,
+		"cogs":         menuItem.COGS,
+		"lines":        menuItem.Recipe,
+	})
+}
+
+// UpdateMenuItemRecipe replaces the recipe of a menu item and sets its COGS from it
+func (h *InventoryHandler) UpdateMenuItemRecipe(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+	// COGS of a bundle is the sum of its components, and selling it takes
+	// their stock
+	if menuItem.ItemType == "bundle" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundles have no recipe of their own; set recipes on their components"})
+		return
+	}
+
+	var req UpdateRecipeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := replaceRecipe(tx, "menu_item_id", menuItem.ID, req.Lines); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := recalculateRecipeCOGS(tx, []uint{menuItem.ID}, nil, currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recalculate COGS"})
+		return
+	}
+
+	// The new recipe may not be makeable from the stock on hand
+	alerts, err := refreshStockStatus(tx, recipeIngredientIDs(req.Lines))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock status"})
+		return
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
+	h.GetMenuItemRecipe(c)
+}
+
+func (h *InventoryHandler) GetAddOnRecipe(c *gin.Context) {
+	var addOn models.AddOn
+	if err := h.db.WithContext(c).Preload("Recipe.Ingredient").First(&addOn, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Add-on not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"add_on_id": addOn.ID,
+		"cogs":      addOn.COGS,
+		"lines":     addOn.Recipe,
+	})
+}
+
+// UpdateAddOnRecipe replaces the recipe of an add-on and sets its COGS from it
+func (h *InventoryHandler) UpdateAddOnRecipe(c *gin.Context) {
+	var addOn models.AddOn
+	if err := h.db.WithContext(c).First(&addOn, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Add-on not found"})
+		return
+	}
+
+	var req UpdateRecipeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := replaceRecipe(tx, "add_on_id", addOn.ID, req.Lines); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := recalculateRecipeCOGS(tx, nil, []uint{addOn.ID}, currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recalculate COGS"})
+		return
+	}
+
+	// The new recipe may not be makeable from the stock on hand
+	alerts, err := refreshStockStatus(tx, recipeIngredientIDs(req.Lines))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock status"})
+		return
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
+	h.GetAddOnRecipe(c)
+}
+
+// replaceRecipe replaces the recipe lines owned by ownerColumn = ownerID
+func replaceRecipe(tx *gorm.DB, ownerColumn string, ownerID uint, lines []RecipeLineRequest) error {
+	if err := tx.Where(ownerColumn+" = ?", ownerID).Delete(&models.RecipeLine{}).Error; err != nil {
+		return err
+	}
+
+	for _, lineReq := range lines {
+		var ingredient models.Ingredient
+		if err := tx.First(&ingredient, lineReq.IngredientID).Error; err != nil {
+			return fmt.Errorf("Ingredient %d not found", lineReq.IngredientID)
+		}
+
+		id := ownerID
+		line := models.RecipeLine{
+			IngredientID: lineReq.IngredientID,
+			Quantity:     lineReq.Quantity,
+		}
+		if ownerColumn == "add_on_id" {
+			line.AddOnID = &id
+		} else {
+			line.MenuItemID = &id
+		}
+
+		if err := tx.Create(&line).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func recipeIngredientIDs(lines []RecipeLineRequest) []uint {
+	ids := make([]uint, len(lines))
+	for i, line := range lines {
+		ids[i] = line.IngredientID
+	}
+	return uniqueIDs(ids)
+}
+
+// recalculateRecipeCOGS sets the COGS of the given menu items and add-ons from
+// their recipes. Items without a recipe keep their hand-entered COGS. userID is
+// who triggered the recalculation, for the price history.
+func recalculateRecipeCOGS(tx *gorm.DB, menuItemIDs, addOnIDs []uint, userID *uint) error {
+	for _, menuItemID := range menuItemIDs {
+		var lines []models.RecipeLine
+		if err := tx.Preload("Ingredient").Where("menu_item_id = ?", menuItemID).Find(&lines).Error; err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		var menuItem models.MenuItem
+		if err := tx.First(&menuItem, menuItemID).Error; err != nil {
+			return err
+		}
+		if err := updateMenuItemCOGS(tx, &menuItem, models.RecipeCost(lines), "recipe", userID); err != nil {
+			return err
+		}
+
+		// Bundles built from this item carry its COGS
+		if err := recalculateBundlesUsing(tx, menuItem, userID); err != nil {
+			return err
+		}
+	}
+
+	for _, addOnID := range addOnIDs {
+		var lines []models.RecipeLine
+		if err := tx.Preload("Ingredient").Where("add_on_id = ?", addOnID).Find(&lines).Error; err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		var addOn models.AddOn
+		if err := tx.First(&addOn, addOnID).Error; err != nil {
+			return err
+		}
+		if err := updateAddOnCOGS(tx, &addOn, models.RecipeCost(lines), userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recalculateCOGSForIngredients recalculates every recipe that uses the given ingredients
+func recalculateCOGSForIngredients(tx *gorm.DB, ingredientIDs []uint, userID *uint) error {
+	var menuItemIDs, addOnIDs []uint
+	if err := tx.Model(&models.RecipeLine{}).
+		Where("ingredient_id IN ? AND menu_item_id IS NOT NULL", ingredientIDs).
+		Distinct().Pluck("menu_item_id", &menuItemIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.RecipeLine{}).
+		Where("ingredient_id IN ? AND add_on_id IS NOT NULL", ingredientIDs).
+		Distinct().Pluck("add_on_id", &addOnIDs).Error; err != nil {
+		return err
+	}
+
+	return recalculateRecipeCOGS(tx, menuItemIDs, addOnIDs, userID)
+}
+
+// ingredientUsage returns the ingredient quantities consumed by the lines of a
+// transaction, keyed by ingredient ID. A bundle consumes through its
+// component lines only.
+func ingredientUsage(tx *gorm.DB, transactionID uint) (map[uint]float64, error) {
+	var items []models.TransactionItem
+	if err := tx.Preload("AddOns").Where("transaction_id = ?", transactionID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	var bundleIDs []uint
+	if err := tx.Model(&models.MenuItem{}).Unscoped().
+		Where("id IN (SELECT menu_item_id FROM transaction_items WHERE transaction_id = ? AND parent_item_id IS NULL) AND item_type = ?", transactionID, "bundle").
+		Pluck("id", &bundleIDs).Error; err != nil {
+		return nil, err
+	}
+
+	// Portions of each menu item and add-on sold
+	menuItemPortions := make(map[uint]float64)
+	addOnPortions := make(map[uint]float64)
+	for _, item := range items {
+		if item.ParentItemID != nil || !containsID(bundleIDs, item.MenuItemID) {
+			menuItemPortions[item.MenuItemID] += float64(item.Quantity)
+		}
+		for _, addOn := range item.AddOns {
+			addOnPortions[addOn.AddOnID] += float64(addOn.Quantity * item.Quantity)
+		}
+	}
+
+	usage := make(map[uint]float64)
+	if len(menuItemPortions) > 0 {
+		var lines []models.RecipeLine
+		if err := tx.Where("menu_item_id IN ?", mapKeys(menuItemPortions)).Find(&lines).Error; err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			usage[line.IngredientID] += line.Quantity * menuItemPortions[*line.MenuItemID]
+		}
+	}
+	if len(addOnPortions) > 0 {
+		var lines []models.RecipeLine
+		if err := tx.Where("add_on_id IN ?", mapKeys(addOnPortions)).Find(&lines).Error; err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			usage[line.IngredientID] += line.Quantity * addOnPortions[*line.AddOnID]
+		}
+	}
+
+	return usage, nil
+}
+
+// consumeIngredients deducts the ingredients used by a paid transaction from
+// the stock of its outlet and records the sale movements. It must run in the
+// payment's DB transaction.
+func consumeIngredients(tx *gorm.DB, transaction *models.Transaction, userID *uint) ([]events.Event, error) {
+	usage, err := ingredientUsage(tx, transaction.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ingredients are locked in ID order, so payments sharing some cannot deadlock
+	for _, ingredientID := range mapKeys(usage) {
+		movement := models.StockMovement{
+			IngredientID:  ingredientID,
+			OutletID:      transaction.OutletID,
+			Type:          "sale",
+			Quantity:      -usage[ingredientID],
+			UserID:        userID,
+			TransactionID: &transaction.ID,
+		}
+		if err := recordStockMovement(tx, &movement); err != nil {
+			return nil, err
+		}
+	}
+
+	return refreshStockStatus(tx, mapKeys(usage))
+}
+
+// reverseConsumption puts back the ingredients consumed by a transaction at
+// its outlet, recording refund movements at the cost of the original sale
+// movements
+func reverseConsumption(tx *gorm.DB, transaction *models.Transaction, userID *uint, reason string) ([]events.Event, error) {
+	var consumed []struct {
+		IngredientID uint
+		Quantity     float64
+		TotalCost    float64
+	}
+	if err := tx.Model(&models.StockMovement{}).
+		Select("ingredient_id, SUM(quantity) AS quantity, SUM(total_cost) AS total_cost").
+		Where("transaction_id = ? AND type IN ?", transaction.ID, []string{"sale", "refund"}).
+		Group("ingredient_id").
+		Order("ingredient_id").
+		Scan(&consumed).Error; err != nil {
+		return nil, err
+	}
+
+	var restocked []uint
+	for _, row := range consumed {
+		// Net consumption is negative; anything else has already been reversed
+		if row.Quantity >= 0 {
+			continue
+		}
+
+		movement := models.StockMovement{
+			IngredientID:  row.IngredientID,
+			OutletID:      transaction.OutletID,
+			Type:          "refund",
+			Quantity:      -row.Quantity,
+			UnitCost:      row.TotalCost / row.Quantity,
+			Reason:        reason,
+			UserID:        userID,
+			TransactionID: &transaction.ID,
+		}
+		if err := recordStockMovement(tx, &movement); err != nil {
+			return nil, err
+		}
+		restocked = append(restocked, row.IngredientID)
+	}
+
+	return refreshStockStatus(tx, restocked)
+}
+
+// recordStockMovement applies a movement to the ingredient's stock on hand, in
+// total and at the movement's outlet, and writes it to the ledger. Every stock
+// change goes through here. Purchases move the ingredient's unit cost to the
+// new weighted average; other movements without a unit cost are costed at the
+// ingredient's current unit cost.
+func recordStockMovement(tx *gorm.DB, movement *models.StockMovement) error {
+	var ingredient models.Ingredient
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ingredient, movement.IngredientID).Error; err != nil {
+		return fmt.Errorf("Ingredient %d not found", movement.IngredientID)
+	}
+
+	if movement.Type == "purchase" {
+		unitCost := inventory.MovingAverageCost(ingredient.StockQty, ingredient.UnitCost, movement.Quantity, movement.UnitCost)
+		if unitCost != ingredient.UnitCost {
+			if err := tx.Model(&ingredient).Update("unit_cost", unitCost).Error; err != nil {
+				return err
+			}
+			if err := recalculateCOGSForIngredients(tx, []uint{ingredient.ID}, movement.UserID); err != nil {
+				return err
+			}
+		}
+	} else if movement.UnitCost == 0 {
+		movement.UnitCost = ingredient.UnitCost
+	}
+	movement.TotalCost = movement.Quantity * movement.UnitCost
+
+	if err := adjustIngredientStock(tx, ingredient.ID, movement.Quantity); err != nil {
+		return err
+	}
+	if movement.OutletID != nil {
+		if err := adjustOutletStock(tx, *movement.OutletID, ingredient.ID, movement.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(movement).Error
+}
+
+// adjustOutletStock changes the stock on hand of an ingredient at an outlet by
+// delta. Use recordStockMovement so the change is kept in the ledger.
+func adjustOutletStock(tx *gorm.DB, outletID, ingredientID uint, delta float64) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "outlet_id"}, {Name: "ingredient_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"stock_qty":  gorm.Expr("outlet_stocks.stock_qty + EXCLUDED.stock_qty"),
+			"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(&models.OutletStock{OutletID: outletID, IngredientID: ingredientID, StockQty: delta}).Error
+}
+
+// adjustIngredientStock changes the stock on hand of an ingredient by delta.
+// Use recordStockMovement so the change is kept in the ledger.
+func adjustIngredientStock(tx *gorm.DB, ingredientID uint, delta float64) error {
+	return tx.Model(&models.Ingredient{}).
+		Where("id = ?", ingredientID).
+		Update("stock_qty", gorm.Expr("stock_qty + ?", delta)).Error
+}
+
+// mapKeys returns the keys of m in ascending order
+func mapKeys(m map[uint]float64) []uint {
+	keys := make([]uint, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
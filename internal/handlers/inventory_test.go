@@ -0,0 +1,15 @@
+package handlers
+
+import "testing"
+
+func TestMapKeysLockIngredientsInIDOrder(t *testing.T) {
+	usage := map[uint]float64{9: 1, 2: 1, 31: 1, 4: 1, 17: 1}
+	for i := 0; i < 20; i++ {
+		keys := mapKeys(usage)
+		for j := 1; j < len(keys); j++ {
+			if keys[j-1] >= keys[j] {
+				t.Fatalf("Expected ascending ingredient IDs, got %v", keys)
+			}
+		}
+	}
+}
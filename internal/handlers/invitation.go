@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"pos-system/internal/events"
+	"pos-system/internal/models"
+	"pos-system/pkg/auth"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InviteUserRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=admin manager cashier"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	FullName string `json:"full_name" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type BootstrapRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	FullName string `json:"full_name" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// InviteUser invites someone to create an account with the given role. The
+// token is only returned here and in the user.invited event; an earlier
+// pending invitation for the same email stops working.
+func (h *AuthHandler) InviteUser(c *gin.Context) {
+	var req InviteUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	var count int64
+	if err := h.db.WithContext(c).Model(&models.User{}).Where("LOWER(email) = ?", email).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing users"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+		return
+	}
+
+	token, err := auth.NewTokenID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	inviterID := c.GetUint("user_id")
+	now := time.Now()
+	invitation := models.Invitation{
+		Email:       email,
+		Role:        req.Role,
+		TokenHash:   auth.HashToken(token),
+		InvitedByID: inviterID,
+		ExpiresAt:   now.Add(h.inviteTTL),
+	}
+
+	err = h.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Invitation{}).
+			Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", email, now).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+	invitation.Status = invitation.CurrentStatus(now)
+
+	acceptURL := h.inviteURL(c.GetString("tenant_slug"), token)
+	h.events.Publish(events.New(events.UserInvited, events.Invitation{
+		Tenant:    c.GetString("tenant_slug"),
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		InvitedBy: c.GetString("username"),
+		AcceptURL: acceptURL,
+		ExpiresAt: invitation.ExpiresAt,
+	}))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": invitation,
+		"token":      token,
+		"accept_url": acceptURL,
+	})
+}
+
+// inviteURL returns the page an invitee opens to accept an invitation
+func (h *AuthHandler) inviteURL(tenantSlug, token string) string {
+	acceptURL := strings.ReplaceAll(h.acceptURL, "{tenant}", tenantSlug)
+	separator := "?"
+	if strings.Contains(acceptURL, "?") {
+		separator = "&"
+	}
+	return acceptURL + separator + "token=" + url.QueryEscape(token)
+}
+
+// GetInvitations lists invitations, newest first, optionally only those with
+// the given status
+func (h *AuthHandler) GetInvitations(c *gin.Context) {
+	now := time.Now()
+	query := h.db.WithContext(c).Preload("InvitedBy").Order("created_at DESC")
+
+	switch c.Query("status") {
+	case "":
+	case models.InvitationPending:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	case models.InvitationAccepted:
+		query = query.Where("accepted_at IS NOT NULL")
+	case models.InvitationRevoked:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NOT NULL")
+	case models.InvitationExpired:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	var invitations []models.Invitation
+	if err := query.Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+	for i := range invitations {
+		invitations[i].Status = invitations[i].CurrentStatus(now)
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation stops a pending invitation from being accepted
+func (h *AuthHandler) RevokeInvitation(c *gin.Context) {
+	invitationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	var invitation models.Invitation
+	if err := h.db.WithContext(c).First(&invitation, invitationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	now := time.Now()
+	if status := invitation.CurrentStatus(now); status != models.InvitationPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation is already " + status})
+		return
+	}
+
+	if err := h.db.WithContext(c).Model(&invitation).Update("revoked_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	invitation.Status = invitation.CurrentStatus(now)
+
+	c.JSON(http.StatusOK, invitation)
+}
+
+// AcceptInvitation creates the account an invitation was for, with the role
+// the inviter chose, and logs it in
+func (h *AuthHandler) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var invitation models.Invitation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", auth.HashToken(req.Token)).
+		First(&invitation).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation"})
+		return
+	}
+
+	now := time.Now()
+	if status := invitation.CurrentStatus(now); status != models.InvitationPending {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation is " + status})
+		return
+	}
+
+	var count int64
+	if err := tx.Model(&models.User{}).Where("username = ? OR LOWER(email) = ?", req.Username, invitation.Email).Count(&count).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing users"})
+		return
+	}
+	if count > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user := models.User{
+		Username: req.Username,
+		Email:    invitation.Email,
+		FullName: req.FullName,
+		Password: hashedPassword,
+		Role:     invitation.Role,
+		IsActive: true,
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	if err := tx.Model(&invitation).Updates(map[string]interface{}{
+		"accepted_at": now,
+		"user_id":     user.ID,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	response, err := h.startSession(tx, user, 0)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+var errUsersExist = errors.New("users already exist")
+
+// Bootstrap creates the first admin of a tenant that has no users yet, so a
+// fresh install can be set up without the database. Once any user exists,
+// even a deleted one, it is refused.
+func (h *AuthHandler) Bootstrap(c *gin.Context) {
+	var req BootstrapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user := models.User{
+		Username: req.Username,
+		Email:    strings.ToLower(strings.TrimSpace(req.Email)),
+		FullName: req.FullName,
+		Password: hashedPassword,
+		Role:     "admin",
+		IsActive: true,
+	}
+
+	var response LoginResponse
+	err = h.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		// Two bootstraps at once must not both see no users
+		if err := tx.Exec("LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errUsersExist
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		var err error
+		response, err = h.startSession(tx, user, 0)
+		return err
+	})
+	if errors.Is(err, errUsersExist) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Setup is already complete; ask an admin for an invitation"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create admin"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
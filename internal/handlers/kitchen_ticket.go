@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"pos-system/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KitchenTicket is what the kitchen needs to prepare an order, without prices
+type KitchenTicket struct {
+	TransactionID uint                `json:"transaction_id"`
+	TransactionNo string              `json:"transaction_no"`
+	OrderType     string              `json:"order_type"`
+	Channel       string              `json:"channel"`
+	CustomerName  string              `json:"customer_name"`
+	Status        string              `json:"status"`
+	CreatedAt     time.Time           `json:"created_at"`
+	Allergens     []string            `json:"allergens"` // Every allergen in the order
+	Lines         []KitchenTicketLine `json:"lines"`
+}
+
+// KitchenTicketLine is one line of a kitchen ticket. Its allergens include
+// those of its add-ons and bundle components.
+type KitchenTicketLine struct {
+	MenuItemID uint                 `json:"menu_item_id"`
+	Name       string               `json:"name"`
+	Quantity   int                  `json:"quantity"`
+	AddOns     []KitchenTicketAddOn `json:"add_ons"`
+	Components []KitchenTicketLine  `json:"components,omitempty"`
+	Allergens  []string             `json:"allergens"`
+	Dietary    []string             `json:"dietary"`
+	tags       [][]models.Tag
+}
+
+type KitchenTicketAddOn struct {
+	AddOnID  uint   `json:"add_on_id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// GetKitchenTicket returns the kitchen ticket of a transaction, with the
+// allergens of every line
+func (h *TransactionHandler) GetKitchenTicket(c *gin.Context) {
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	var transaction models.Transaction
+	if err := preloadTransactionDetails(h.db.WithContext(c)).Where(scope.clause("outlet_id")).First(&transaction, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newKitchenTicket(transaction))
+}
+
+func newKitchenTicket(transaction models.Transaction) KitchenTicket {
+	ticket := KitchenTicket{
+		TransactionID: transaction.ID,
+		TransactionNo: transaction.TransactionNo,
+		OrderType:     transaction.OrderType,
+		Channel:       transaction.Channel,
+		CustomerName:  transaction.CustomerName,
+		Status:        transaction.Status,
+		CreatedAt:     transaction.CreatedAt,
+		Lines:         make([]KitchenTicketLine, 0, len(transaction.Items)),
+	}
+
+	var orderTags [][]models.Tag
+	for _, item := range transaction.Items {
+		line := newKitchenTicketLine(item)
+		for _, component := range item.Components {
+			componentLine := newKitchenTicketLine(component)
+			line.Components = append(line.Components, componentLine)
+			line.tags = append(line.tags, componentLine.tags...)
+		}
+		line.Allergens = models.TagNames(models.TagKindAllergen, line.tags...)
+		ticket.Lines = append(ticket.Lines, line)
+		orderTags = append(orderTags, line.tags...)
+	}
+	ticket.Allergens = models.TagNames(models.TagKindAllergen, orderTags...)
+
+	return ticket
+}
+
+func newKitchenTicketLine(item models.TransactionItem) KitchenTicketLine {
+	line := KitchenTicketLine{
+		MenuItemID: item.MenuItemID,
+		Name:       item.MenuItem.Name,
+		Quantity:   item.Quantity,
+		AddOns:     make([]KitchenTicketAddOn, 0, len(item.AddOns)),
+		Dietary:    models.TagNames(models.TagKindDietary, item.MenuItem.Tags),
+		tags:       [][]models.Tag{item.MenuItem.Tags},
+	}
+	for _, addOn := range item.AddOns {
+		line.AddOns = append(line.AddOns, KitchenTicketAddOn{
+			AddOnID:  addOn.AddOnID,
+			Name:     addOn.AddOn.Name,
+			Quantity: addOn.Quantity,
+		})
+		line.tags = append(line.tags, addOn.AddOn.Tags)
+	}
+	line.Allergens = models.TagNames(models.TagKindAllergen, line.tags...)
+	return line
+}
@@ -0,0 +1,766 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"pos-system/internal/tenancy"
+	"pos-system/pkg/loyalty"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// loyaltyPaymentMethod is the payment method code for paying with points
+const loyaltyPaymentMethod = "points"
+
+var (
+	errNoLoyaltyCustomer  = errors.New("A customer is required to redeem points")
+	errInsufficientPoints = errors.New("Customer does not have enough points")
+)
+
+type LoyaltyHandler struct {
+	db      *gorm.DB
+	program loyalty.Program
+}
+
+type LoyaltyTierRequest struct {
+	Name           string  `json:"name" binding:"required"`
+	MinPoints      int     `json:"min_points" binding:"min=0"`
+	EarnMultiplier float64 `json:"earn_multiplier" binding:"min=0"` // Defaults to 1
+	ExpiryMonths   *int    `json:"expiry_months" binding:"omitempty,min=0"`
+	Benefits       string  `json:"benefits"`
+}
+
+type LoyaltyEarnRuleRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	Type        string  `json:"type" binding:"required,oneof=spend item"`
+	SpendAmount float64 `json:"spend_amount" binding:"min=0"`
+	MenuItemID  *uint   `json:"menu_item_id"`
+	Points      int     `json:"points" binding:"required,min=1"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+type AdjustPointsRequest struct {
+	Points int    `json:"points" binding:"required"` // Positive to add, negative to take away
+	Note   string `json:"note" binding:"required"`
+}
+
+type RedeemPointsRequest struct {
+	Points int `json:"points" binding:"min=0"` // 0 cancels the redemption
+}
+
+func NewLoyaltyHandler(db *gorm.DB, program loyalty.Program) *LoyaltyHandler {
+	return &LoyaltyHandler{db: db, program: program}
+}
+
+// Tiers
+func (h *LoyaltyHandler) GetTiers(c *gin.Context) {
+	var tiers []models.LoyaltyTier
+	if err := h.db.WithContext(c).Order("min_points, id").Find(&tiers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loyalty tiers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tiers)
+}
+
+func (h *LoyaltyHandler) CreateTier(c *gin.Context) {
+	var req LoyaltyTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tier models.LoyaltyTier
+	applyLoyaltyTierRequest(&tier, req)
+	h.saveTier(c, &tier, http.StatusCreated)
+}
+
+func (h *LoyaltyHandler) UpdateTier(c *gin.Context) {
+	var tier models.LoyaltyTier
+	if err := h.db.WithContext(c).First(&tier, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loyalty tier not found"})
+		return
+	}
+
+	var req LoyaltyTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	applyLoyaltyTierRequest(&tier, req)
+	h.saveTier(c, &tier, http.StatusOK)
+}
+
+// saveTier saves a tier and moves customers into the tiers their lifetime
+// points now reach
+func (h *LoyaltyHandler) saveTier(c *gin.Context, tier *models.LoyaltyTier, status int) {
+	var existing int64
+	h.db.WithContext(c).Model(&models.LoyaltyTier{}).Where("LOWER(name) = LOWER(?) AND id <> ?", tier.Name, tier.ID).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A loyalty tier with this name already exists"})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Save(tier).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save loyalty tier"})
+		return
+	}
+	if err := refreshLoyaltyTiers(tx, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer tiers"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(status, tier)
+}
+
+func (h *LoyaltyHandler) DeleteTier(c *gin.Context) {
+	id := c.Param("id")
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Model(&models.Customer{}).Unscoped().Where("tier_id = ?", id).Update("tier_id", nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer tiers"})
+		return
+	}
+	result := tx.Delete(&models.LoyaltyTier{}, id)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete loyalty tier"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loyalty tier not found"})
+		return
+	}
+	if err := refreshLoyaltyTiers(tx, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer tiers"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Loyalty tier deleted successfully"})
+}
+
+// Earn rules
+func (h *LoyaltyHandler) GetEarnRules(c *gin.Context) {
+	query := h.db.WithContext(c).Preload("MenuItem").Order("id")
+	if active := c.Query("active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	var rules []models.LoyaltyEarnRule
+	if err := query.Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch earn rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *LoyaltyHandler) CreateEarnRule(c *gin.Context) {
+	var req LoyaltyEarnRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.LoyaltyEarnRule{IsActive: true}
+	if err := h.applyEarnRuleRequest(c, &rule, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.WithContext(c).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create earn rule"})
+		return
+	}
+
+	h.db.WithContext(c).Preload("MenuItem").First(&rule, rule.ID)
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *LoyaltyHandler) UpdateEarnRule(c *gin.Context) {
+	var rule models.LoyaltyEarnRule
+	if err := h.db.WithContext(c).First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Earn rule not found"})
+		return
+	}
+
+	var req LoyaltyEarnRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.applyEarnRuleRequest(c, &rule, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule.MenuItem = nil
+	if err := h.db.WithContext(c).Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update earn rule"})
+		return
+	}
+
+	h.db.WithContext(c).Preload("MenuItem").First(&rule, rule.ID)
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *LoyaltyHandler) DeleteEarnRule(c *gin.Context) {
+	if err := h.db.WithContext(c).Delete(&models.LoyaltyEarnRule{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete earn rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Earn rule deleted successfully"})
+}
+
+// GetCustomerPoints shows a customer's balance, tier, points expiring soon
+// and ledger, newest first
+func (h *LoyaltyHandler) GetCustomerPoints(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	customerID := uint(id)
+
+	// Expire what is due first, so the balance is current
+	tx := h.db.WithContext(c).Begin()
+	if _, err := expireLoyaltyPoints(tx, &customerID, time.Now()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expire points"})
+		return
+	}
+	tx.Commit()
+
+	var customer models.Customer
+	if err := h.db.WithContext(c).Preload("Tier").First(&customer, customerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	var total int64
+	var entries []models.LoyaltyEntry
+	query := h.db.WithContext(c).Model(&models.LoyaltyEntry{}).Where("customer_id = ?", customer.ID)
+	query.Count(&total)
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch points history"})
+		return
+	}
+
+	var expiring []struct {
+		Points    int       `json:"points"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := h.db.WithContext(c).Model(&models.LoyaltyEntry{}).
+		Select("SUM(remaining) AS points, expires_at").
+		Where("customer_id = ? AND remaining > 0 AND expires_at <= ?", customer.ID, time.Now().AddDate(0, 0, 30)).
+		Group("expires_at").Order("expires_at").
+		Scan(&expiring).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expiring points"})
+		return
+	}
+
+	response := gin.H{
+		"customer_id":     customer.ID,
+		"points":          customer.Points,
+		"lifetime_points": customer.LifetimePoints,
+		"value":           h.program.Value(customer.Points),
+		"point_value":     h.program.PointValue,
+		"tier":            customer.Tier,
+		"expiring_soon":   expiring,
+		"entries":         entries,
+		"total":           total,
+		"page":            page,
+		"limit":           limit,
+	}
+
+	var next []models.LoyaltyTier
+	h.db.WithContext(c).Where("min_points > ?", customer.LifetimePoints).Order("min_points").Limit(1).Find(&next)
+	if len(next) > 0 {
+		response["next_tier"] = next[0]
+		response["points_to_next_tier"] = next[0].MinPoints - customer.LifetimePoints
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdjustCustomerPoints adds or takes away points by hand, e.g. as goodwill
+// or to correct a mistake. Adjustments do not count towards tiers.
+func (h *LoyaltyHandler) AdjustCustomerPoints(c *gin.Context) {
+	var req AdjustPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	customer, err := lockLoyaltyCustomer(tx, c.Param("id"), time.Now())
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	entry := models.LoyaltyEntry{
+		CustomerID: customer.ID,
+		Type:       models.PointsAdjust,
+		Points:     req.Points,
+		Note:       req.Note,
+		UserID:     currentUserID(c),
+	}
+	if req.Points > 0 {
+		entry.Remaining = req.Points
+		entry.ExpiresAt = h.program.ExpiresAt(time.Now(), tierExpiryMonths(customer))
+	} else {
+		shortfall, err := takePoints(tx, customer.ID, -req.Points, 0, time.Now())
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust points"})
+			return
+		}
+		if shortfall > 0 {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInsufficientPoints.Error()})
+			return
+		}
+	}
+
+	if err := recordPoints(tx, &entry, 0); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust points"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// RedeemPoints applies a customer's points to a pending transaction as a
+// discount. The points are only taken when the transaction is paid.
+func (h *TransactionHandler) RedeemPoints(c *gin.Context) {
+	var req RedeemPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	var transaction models.Transaction
+	if err := h.db.WithContext(c).Where(scope.clause("outlet_id")).First(&transaction, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	if transaction.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Points can only be redeemed on pending transactions"})
+		return
+	}
+
+	if req.Points > 0 {
+		if transaction.CustomerID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errNoLoyaltyCustomer.Error()})
+			return
+		}
+		var customer models.Customer
+		if err := h.db.WithContext(c).First(&customer, *transaction.CustomerID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found"})
+			return
+		}
+		if customer.Points < req.Points {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Customer has %d points", customer.Points)})
+			return
+		}
+	}
+
+	transaction.PointsRedeemed = req.Points
+	transaction.LoyaltyDiscount = h.program.Value(req.Points)
+	if err := recalculateTransactionTotals(h.db.WithContext(c), &transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction items"})
+		return
+	}
+	if transaction.Total < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Points are worth more than the order total"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Save(&transaction).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
+		return
+	}
+
+	preloadTransactionDetails(h.db.WithContext(c)).First(&transaction, transaction.ID)
+	c.JSON(http.StatusOK, transaction)
+}
+
+// settleLoyalty takes the points redeemed on a transaction being paid and
+// credits the points it earns. pointsTender is the part of the total paid
+// with points. It must run in the payment's DB transaction, after the total
+// is set.
+func settleLoyalty(tx *gorm.DB, transaction *models.Transaction, program loyalty.Program, pointsTender float64, userID *uint) error {
+	payingWithPoints := pointsTender > 0
+	if transaction.CustomerID == nil {
+		if transaction.PointsRedeemed > 0 || payingWithPoints {
+			return errNoLoyaltyCustomer
+		}
+		return nil
+	}
+
+	now := time.Now()
+	customer, err := lockLoyaltyCustomer(tx, *transaction.CustomerID, now)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The customer was deleted; the order can still be paid without points
+		if transaction.PointsRedeemed > 0 || payingWithPoints {
+			return errNoLoyaltyCustomer
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	redeemed := transaction.PointsRedeemed
+	if payingWithPoints {
+		redeemed += program.PointsFor(pointsTender)
+	}
+	if redeemed > 0 {
+		shortfall, err := takePoints(tx, customer.ID, redeemed, 0, now)
+		if err != nil {
+			return err
+		}
+		if shortfall > 0 {
+			return errInsufficientPoints
+		}
+		entry := models.LoyaltyEntry{
+			CustomerID:    customer.ID,
+			TransactionID: &transaction.ID,
+			Type:          models.PointsRedeem,
+			Points:        -redeemed,
+			UserID:        userID,
+		}
+		if err := recordPoints(tx, &entry, 0); err != nil {
+			return err
+		}
+	}
+	transaction.PointsRedeemed = redeemed
+
+	// Only the part not paid with points earns, so orders paid fully with points earn nothing
+	spend := transaction.Total - pointsTender
+	if spend <= 0.005 {
+		return nil
+	}
+
+	var rules []models.LoyaltyEarnRule
+	if err := tx.Where("is_active = ?", true).Find(&rules).Error; err != nil {
+		return err
+	}
+	var items []models.TransactionItem
+	if err := tx.Where("transaction_id = ?", transaction.ID).Find(&items).Error; err != nil {
+		return err
+	}
+
+	earnRules := make([]loyalty.Rule, len(rules))
+	for i, rule := range rules {
+		earnRules[i] = loyalty.Rule{Type: rule.Type, SpendAmount: rule.SpendAmount, Points: rule.Points}
+		if rule.MenuItemID != nil {
+			earnRules[i].MenuItemID = *rule.MenuItemID
+		}
+	}
+	// Bundle components count too, so a coffee in a combo still earns its stamp
+	lines := make([]loyalty.Line, len(items))
+	for i, item := range items {
+		lines[i] = loyalty.Line{MenuItemID: item.MenuItemID, Quantity: item.Quantity}
+	}
+
+	multiplier := 1.0
+	if customer.Tier != nil {
+		multiplier = customer.Tier.EarnMultiplier
+	}
+	earned := loyalty.Earn(spend, lines, earnRules, multiplier)
+	if earned <= 0 {
+		return nil
+	}
+
+	entry := models.LoyaltyEntry{
+		CustomerID:    customer.ID,
+		TransactionID: &transaction.ID,
+		Type:          models.PointsEarn,
+		Points:        earned,
+		Remaining:     earned,
+		ExpiresAt:     program.ExpiresAt(now, tierExpiryMonths(customer)),
+		UserID:        userID,
+	}
+	if err := recordPoints(tx, &entry, earned); err != nil {
+		return err
+	}
+	transaction.PointsEarned = earned
+
+	return refreshLoyaltyTiers(tx, &customer.ID)
+}
+
+// reverseLoyalty undoes the points a refunded transaction earned and gives
+// back the points redeemed on it. Earned points that were already spent
+// leave the balance negative. It must run in the refund's DB transaction.
+func reverseLoyalty(tx *gorm.DB, transaction *models.Transaction, program loyalty.Program, userID *uint) error {
+	if transaction.CustomerID == nil || (transaction.PointsEarned == 0 && transaction.PointsRedeemed == 0) {
+		return nil
+	}
+
+	now := time.Now()
+	customer, err := lockLoyaltyCustomer(tx, *transaction.CustomerID, now)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if transaction.PointsEarned > 0 {
+		// Take the points back from what is left of the lot they were earned in first
+		var earn models.LoyaltyEntry
+		var earnID uint
+		if err := tx.Where("transaction_id = ? AND type = ?", transaction.ID, models.PointsEarn).First(&earn).Error; err == nil {
+			earnID = earn.ID
+		}
+		if _, err := takePoints(tx, customer.ID, transaction.PointsEarned, earnID, now); err != nil {
+			return err
+		}
+
+		entry := models.LoyaltyEntry{
+			CustomerID:    customer.ID,
+			TransactionID: &transaction.ID,
+			Type:          models.PointsReverse,
+			Points:        -transaction.PointsEarned,
+			Note:          "Refund of earned points",
+			UserID:        userID,
+		}
+		if err := recordPoints(tx, &entry, -transaction.PointsEarned); err != nil {
+			return err
+		}
+	}
+
+	if transaction.PointsRedeemed > 0 {
+		entry := models.LoyaltyEntry{
+			CustomerID:    customer.ID,
+			TransactionID: &transaction.ID,
+			Type:          models.PointsReverse,
+			Points:        transaction.PointsRedeemed,
+			Remaining:     transaction.PointsRedeemed,
+			ExpiresAt:     program.ExpiresAt(now, tierExpiryMonths(customer)),
+			Note:          "Refund of redeemed points",
+			UserID:        userID,
+		}
+		if err := recordPoints(tx, &entry, 0); err != nil {
+			return err
+		}
+	}
+
+	return refreshLoyaltyTiers(tx, &customer.ID)
+}
+
+// lockLoyaltyCustomer expires the customer's due points and returns the
+// customer with their tier, locked for the rest of the DB transaction
+func lockLoyaltyCustomer(tx *gorm.DB, id interface{}, now time.Time) (*models.Customer, error) {
+	var customer models.Customer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, id).Error; err != nil {
+		return nil, err
+	}
+	if _, err := expireLoyaltyPoints(tx, &customer.ID, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Preload("Tier").First(&customer, customer.ID).Error; err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// recordPoints adds an entry to the ledger and applies it to the customer's
+// balance. lifetime is what the entry adds to the points that decide tiers.
+func recordPoints(tx *gorm.DB, entry *models.LoyaltyEntry, lifetime int) error {
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Customer{}).Where("id = ?", entry.CustomerID).Updates(map[string]interface{}{
+		"points":          gorm.Expr("points + ?", entry.Points),
+		"lifetime_points": gorm.Expr("lifetime_points + ?", lifetime),
+	}).Error
+}
+
+// takePoints spends points from a customer's unexpired lots, soonest to
+// expire first, starting with the lot firstLotID if it is set. It returns the
+// points that could not be covered; the caller decides whether that is an
+// error.
+func takePoints(tx *gorm.DB, customerID uint, points int, firstLotID uint, now time.Time) (int, error) {
+	var lots []models.LoyaltyEntry
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("customer_id = ? AND remaining > 0 AND (expires_at IS NULL OR expires_at > ?)", customerID, now).
+		Order(fmt.Sprintf("id = %d DESC, expires_at NULLS LAST, id", firstLotID)).
+		Find(&lots).Error; err != nil {
+		return 0, err
+	}
+
+	remaining := make([]int, len(lots))
+	for i, lot := range lots {
+		remaining[i] = lot.Remaining
+	}
+	taken, shortfall := loyalty.Allocate(remaining, points)
+
+	for i, lot := range lots {
+		if taken[i] == 0 {
+			continue
+		}
+		if err := tx.Model(&models.LoyaltyEntry{}).Where("id = ?", lot.ID).
+			Update("remaining", lot.Remaining-taken[i]).Error; err != nil {
+			return 0, err
+		}
+	}
+	return shortfall, nil
+}
+
+// refreshLoyaltyTiers puts customers in the highest tier of their tenant their
+// lifetime points reach, or no tier. With customerID nil every customer is
+// updated.
+func refreshLoyaltyTiers(tx *gorm.DB, customerID *uint) error {
+	query := tx.Model(&models.Customer{}).Unscoped()
+	if customerID != nil {
+		query = query.Where("id = ?", *customerID)
+	} else {
+		query = query.Where("1 = 1")
+	}
+	// The subquery is raw SQL, so it is not tenant scoped on its own
+	return query.Update("tier_id", gorm.Expr(`(SELECT id FROM loyalty_tiers
+		WHERE ? AND loyalty_tiers.tenant_id = customers.tenant_id AND loyalty_tiers.min_points <= customers.lifetime_points
+		ORDER BY loyalty_tiers.min_points DESC, loyalty_tiers.id LIMIT 1)`,
+		tenancy.Clause(tx.Statement.Context, "loyalty_tiers.tenant_id"))).Error
+}
+
+// ExpireLoyaltyPoints expires the unspent points of every lot whose expiry
+// has passed and returns how many points expired. Lots are locked so that
+// several instances can run it at once.
+func ExpireLoyaltyPoints(db *gorm.DB, now time.Time) (int, error) {
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	expired, err := expireLoyaltyPoints(tx, nil, now)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return expired, nil
+}
+
+// expireLoyaltyPoints records the expiry of due lots, for one customer or
+// for all of them
+func expireLoyaltyPoints(db *gorm.DB, customerID *uint, now time.Time) (int, error) {
+	query := db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("remaining > 0 AND expires_at <= ?", now)
+	if customerID != nil {
+		query = query.Where("customer_id = ?", *customerID)
+	}
+
+	var lots []models.LoyaltyEntry
+	if err := query.Order("expires_at, id").Find(&lots).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, lot := range lots {
+		if err := db.Model(&models.LoyaltyEntry{}).Where("id = ?", lot.ID).Update("remaining", 0).Error; err != nil {
+			return 0, err
+		}
+		entry := models.LoyaltyEntry{
+			CustomerID: lot.CustomerID,
+			Type:       models.PointsExpire,
+			Points:     -lot.Remaining,
+			Note:       fmt.Sprintf("Expired from entry %d", lot.ID),
+		}
+		if err := recordPoints(db, &entry, 0); err != nil {
+			return 0, err
+		}
+		expired += lot.Remaining
+	}
+	return expired, nil
+}
+
+func applyLoyaltyTierRequest(tier *models.LoyaltyTier, req LoyaltyTierRequest) {
+	tier.Name = req.Name
+	tier.MinPoints = req.MinPoints
+	tier.EarnMultiplier = req.EarnMultiplier
+	if tier.EarnMultiplier == 0 {
+		tier.EarnMultiplier = 1
+	}
+	tier.ExpiryMonths = req.ExpiryMonths
+	tier.Benefits = req.Benefits
+}
+
+func (h *LoyaltyHandler) applyEarnRuleRequest(c *gin.Context, rule *models.LoyaltyEarnRule, req LoyaltyEarnRuleRequest) error {
+	rule.Name = req.Name
+	rule.Type = req.Type
+	rule.Points = req.Points
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+
+	switch req.Type {
+	case loyalty.RuleSpend:
+		if req.SpendAmount <= 0 {
+			return errors.New("spend_amount is required for spend rules")
+		}
+		rule.SpendAmount = req.SpendAmount
+		rule.MenuItemID = nil
+	case loyalty.RuleItem:
+		if req.MenuItemID == nil {
+			return errors.New("menu_item_id is required for item rules")
+		}
+		var menuItem models.MenuItem
+		if err := h.db.WithContext(c).First(&menuItem, *req.MenuItemID).Error; err != nil {
+			return fmt.Errorf("Menu item %d not found", *req.MenuItemID)
+		}
+		rule.SpendAmount = 0
+		rule.MenuItemID = req.MenuItemID
+	}
+	return nil
+}
+
+func tierExpiryMonths(customer *models.Customer) *int {
+	if customer.Tier == nil {
+		return nil
+	}
+	return customer.Tier.ExpiryMonths
+}
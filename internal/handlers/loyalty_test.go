@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"pos-system/internal/models"
+	"pos-system/internal/tenancy"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRefreshLoyaltyTiersStaysInTenant(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=pos_test"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := tenancy.Register(db, &models.Customer{}, &models.LoyaltyTier{}); err != nil {
+		t.Fatalf("Failed to register tenancy: %v", err)
+	}
+
+	var statements []*gorm.Statement
+	if err := db.Callback().Update().After("gorm:update").Register("test:capture", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement)
+	}); err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+
+	const tenantA, tenantB uint = 1, 2
+	customerID := uint(7)
+	for _, tenantID := range []uint{tenantA, tenantB} {
+		statements = nil
+		tx := db.WithContext(tenancy.WithTenant(context.Background(), tenantID))
+		if err := refreshLoyaltyTiers(tx, &customerID); err != nil {
+			t.Fatalf("Failed to refresh tiers: %v", err)
+		}
+		if len(statements) != 1 {
+			t.Fatalf("Expected one update, got %d", len(statements))
+		}
+
+		// Tier 1 of tenant A must not be given to a customer of tenant B
+		stmt := statements[0]
+		sql := stmt.SQL.String()
+		subquery := sql[strings.Index(sql, "(SELECT"):strings.Index(sql, "LIMIT 1)")]
+		if !strings.Contains(subquery, "loyalty_tiers.tenant_id = $") {
+			t.Errorf("Expected the tier subquery to be limited to the tenant, got %q", sql)
+		}
+		if !strings.Contains(subquery, "loyalty_tiers.tenant_id = customers.tenant_id") {
+			t.Errorf("Expected the tier subquery to match the customer's tenant, got %q", sql)
+		}
+		if !strings.Contains(sql, `"customers"."tenant_id" = $`) {
+			t.Errorf("Expected the update to be limited to the tenant, got %q", sql)
+		}
+		for _, v := range stmt.Vars {
+			if id, ok := v.(uint); ok && (id == tenantA || id == tenantB) && id != tenantID {
+				t.Errorf("Expected the update to be bound to tenant %d only, got %v", tenantID, stmt.Vars)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pos-system/pkg/storage"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MediaHandler struct {
+	store storage.Storage
+}
+
+func NewMediaHandler(store storage.Storage) *MediaHandler {
+	return &MediaHandler{store: store}
+}
+
+// ServeMedia serves stored files such as menu images. Uploads never reuse a
+// key, so responses may be cached for a year without revalidation.
+func (h *MediaHandler) ServeMedia(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	body, object, err := h.store.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer body.Close()
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	if !object.ModTime.IsZero() {
+		c.Header("Last-Modified", object.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if object.ETag != "" {
+		c.Header("ETag", object.ETag)
+		if c.GetHeader("If-None-Match") == object.ETag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.DataFromReader(http.StatusOK, object.Size, object.ContentType, body, nil)
+}
@@ -1,30 +1,76 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"pos-system/internal/models"
+	"pos-system/pkg/storage"
+	"pos-system/pkg/textsearch"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"gorm.io/gorm"
 )
 
 type MenuHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	location *time.Location  // Outlet timezone for availability schedules
+	store    storage.Storage // Uploaded images
+	mediaURL string          // Prefix of uploaded image URLs
 }
 
-func NewMenuHandler(db *gorm.DB) *MenuHandler {
-	return &MenuHandler{db: db}
+func NewMenuHandler(db *gorm.DB, location *time.Location, store storage.Storage, mediaURL string) *MenuHandler {
+	return &MenuHandler{db: db, location: location, store: store, mediaURL: mediaURL}
 }
 
 // Categories
+// GetCategories lists categories flat, in sort order, with the number of menu
+// items in each. Menu items are only included with include=items; use the menu
+// tree for the hierarchy.
 func (h *MenuHandler) GetCategories(c *gin.Context) {
+	query := h.db.WithContext(c).Order("sort_order, name, id")
+	if c.Query("include") == "items" {
+		query = query.Preload("MenuItems", func(db *gorm.DB) *gorm.DB {
+			return db.Order("sort_order, name, id")
+		})
+	}
+
 	var categories []models.Category
-	if err := h.db.Preload("MenuItems").Find(&categories).Error; err != nil {
+	if err := query.Find(&categories).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
 		return
 	}
 
+	if channel := normalizeChannel(c.Query("channel")); channel != "" {
+		hidden := models.HiddenCategories(categories, channel)
+		visible := make([]models.Category, 0, len(categories))
+		for _, category := range categories {
+			if !hidden[category.ID] {
+				visible = append(visible, category)
+			}
+		}
+		categories = visible
+	}
+
+	var counts []struct {
+		CategoryID uint
+		Count      int64
+	}
+	if err := h.db.WithContext(c).Model(&models.MenuItem{}).Select("category_id, COUNT(*) AS count").Group("category_id").Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count menu items"})
+		return
+	}
+	itemCounts := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		itemCounts[count.CategoryID] = count.Count
+	}
+	for i := range categories {
+		categories[i].ItemCount = itemCounts[categories[i].ID]
+	}
+
 	c.JSON(http.StatusOK, categories)
 }
 
@@ -35,7 +81,16 @@ func (h *MenuHandler) CreateCategory(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Create(&category).Error; err != nil {
+	if category.ParentID != nil {
+		if err := checkCategoryParent(h.db.WithContext(c), 0, *category.ParentID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	category.Channels = normalizeChannels(category.Channels)
+	category.MenuItems = nil
+
+	if err := h.db.WithContext(c).Create(&category).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
 		return
 	}
@@ -47,28 +102,52 @@ func (h *MenuHandler) UpdateCategory(c *gin.Context) {
 	id := c.Param("id")
 	
 	var category models.Category
-	if err := h.db.First(&category, id).Error; err != nil {
+	if err := h.db.WithContext(c).First(&category, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 		return
 	}
 
+	previousName := category.Name
 	if err := c.ShouldBindJSON(&category); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.db.Save(&category).Error; err != nil {
+	if category.ParentID != nil {
+		if err := checkCategoryParent(h.db.WithContext(c), category.ID, *category.ParentID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	category.Channels = normalizeChannels(category.Channels)
+	category.MenuItems = nil
+
+	if err := h.db.WithContext(c).Save(&category).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
 		return
 	}
 
+	// Menu items are found by their category's name
+	if category.Name != previousName {
+		if err := models.RefreshSearchText(h.db.WithContext(c), "category_id = ?", category.ID); err != nil {
+			log.Printf("Failed to refresh search text for category %d: %v", category.ID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, category)
 }
 
 func (h *MenuHandler) DeleteCategory(c *gin.Context) {
 	id := c.Param("id")
 	
-	if err := h.db.Delete(&models.Category{}, id).Error; err != nil {
+	var children int64
+	h.db.WithContext(c).Model(&models.Category{}).Where("parent_id = ?", id).Count(&children)
+	if children > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category has subcategories; move or delete them first"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Delete(&models.Category{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
 		return
 	}
@@ -78,6 +157,16 @@ func (h *MenuHandler) DeleteCategory(c *gin.Context) {
 
 // Menu Items
 func (h *MenuHandler) GetMenuItems(c *gin.Context) {
+	h.getMenuItems(c, c.Query("orderable") == "true")
+}
+
+// GetOrderableMenuItems returns only the menu items that can be ordered right
+// now: available, and inside their own and their category's schedules
+func (h *MenuHandler) GetOrderableMenuItems(c *gin.Context) {
+	h.getMenuItems(c, true)
+}
+
+func (h *MenuHandler) getMenuItems(c *gin.Context, orderableOnly bool) {
 	categoryID := c.Query("category_id")
 	available := c.Query("available")
 	search := c.Query("search")
@@ -97,11 +186,33 @@ func (h *MenuHandler) GetMenuItems(c *gin.Context) {
 	var menuItems []models.MenuItem
 	var total int64
 
-	query := h.db.Model(&models.MenuItem{}).Preload("Category").Preload("AddOns", "is_available = ?", true)
+	query := h.db.WithContext(c).Model(&models.MenuItem{}).Preload("Category").Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("tags.name")
+	})
 	
-	// Apply filters
+	// Apply filters; a category includes its subcategories
 	if categoryID != "" {
-		query = query.Where("category_id = ?", categoryID)
+		id, err := strconv.ParseUint(categoryID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category_id"})
+			return
+		}
+		var categories []models.Category
+		if err := h.db.WithContext(c).Select("id, parent_id").Find(&categories).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+			return
+		}
+		ids := models.WithDescendants(models.CategoryParents(categories), map[uint]bool{uint(id): true})
+		query = query.Where("category_id IN ?", idList(ids))
+	}
+
+	if channel := normalizeChannel(c.Query("channel")); channel != "" {
+		hidden, err := loadHiddenOnChannel(h.db.WithContext(c), channel)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+			return
+		}
+		query = hidden.where(query)
 	}
 	
 	if available != "" {
@@ -112,12 +223,87 @@ func (h *MenuHandler) GetMenuItems(c *gin.Context) {
 		}
 	}
 	
-	if search != "" {
-		query = query.Where("name ILIKE ? OR description ILIKE ?", "%"+search+"%", "%"+search+"%")
+	// Full-text search on word prefixes, falling back to trigram similarity for typos
+	terms := textsearch.Terms(search)
+	if len(terms) > 0 {
+		query = query.Where("(to_tsvector('simple', menu_items.search_text) @@ to_tsquery('simple', ?) OR ? <% menu_items.search_text)",
+			textsearch.PrefixQuery(terms), strings.Join(terms, " "))
+	}
+
+	// Items must carry every requested tag and none of the excluded allergens
+	if value := c.Query("tag"); value != "" {
+		tags, err := tagSlugsParam(h.db.WithContext(c), value, "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, tag := range tags {
+			query = query.Where("id IN (SELECT menu_item_id FROM menu_item_tags WHERE tag_id = ?)", tag.ID)
+		}
+	}
+
+	excludedAllergens := make(map[uint]bool)
+	if value := c.Query("exclude_allergens"); value != "" {
+		allergens, err := tagSlugsParam(h.db.WithContext(c), value, models.TagKindAllergen)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, allergen := range allergens {
+			excludedAllergens[allergen.ID] = true
+		}
+		if len(excludedAllergens) > 0 {
+			query = query.Where("id NOT IN (SELECT menu_item_id FROM menu_item_tags WHERE tag_id IN ?)", idList(excludedAllergens))
+		}
+	}
+
+	var priceList *models.PriceList
+	if value := c.Query("price_list"); value != "" {
+		var err error
+		if priceList, err = priceListParam(h.db.WithContext(c), value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Price list not found"})
+			return
+		}
+	}
+
+	// Sold out follows the stock at the outlet the menu is read for
+	soldOut, err := loadSoldOut(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	var off offSchedule
+	if orderableOnly {
+		var err error
+		if off, err = loadOffSchedule(h.db.WithContext(c), time.Now().In(h.location)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability schedules"})
+			return
+		}
+
+		query = query.Where("is_available = ?", true)
+		if len(off.menuItems) > 0 {
+			query = query.Where("id NOT IN ?", idList(off.menuItems))
+		}
+		if len(soldOut.menuItems) > 0 {
+			query = query.Where("id NOT IN ?", idList(soldOut.menuItems))
+		}
+		if len(off.categories) > 0 {
+			query = query.Where("category_id NOT IN ?", idList(off.categories))
+		}
 	}
 
 	// Count total records
 	query.Count(&total)
+
+	// Rank search results: full-text relevance, then how closely the name and the rest match
+	if len(terms) > 0 {
+		text := strings.Join(terms, " ")
+		query = query.Select("menu_items.*, (ts_rank(to_tsvector('simple', menu_items.search_text), to_tsquery('simple', ?))"+
+			" + word_similarity(?, menu_items.name) + word_similarity(?, menu_items.search_text) / 2) AS search_rank",
+			textsearch.PrefixQuery(terms), text, text).
+			Order("search_rank DESC")
+	}
 	
 	// Apply pagination only if limit is specified
 	if limit > 0 {
@@ -125,35 +311,58 @@ func (h *MenuHandler) GetMenuItems(c *gin.Context) {
 	}
 	
 	// Execute query
-	if err := query.Order("created_at DESC").Find(&menuItems).Error; err != nil {
+	if err := query.Order("sort_order, created_at DESC").Find(&menuItems).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch menu items"})
 		return
 	}
 
-	// Calculate margin for each item and its add-ons
+	// Resolve effective add-ons for all returned items in one query
+	menuItemIDs := make([]uint, len(menuItems))
 	for i := range menuItems {
+		menuItemIDs[i] = menuItems[i].ID
+	}
+	effectiveAddOns, err := loadEffectiveAddOns(h.db.WithContext(c), menuItemIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch add-ons"})
+		return
+	}
+	addOnIDs := make(map[uint]bool)
+	for _, addOns := range effectiveAddOns {
+		for _, addOn := range addOns {
+			addOnIDs[addOn.ID] = true
+		}
+	}
+	addOnTags, err := loadAddOnTags(h.db.WithContext(c), idList(addOnIDs))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch add-on tags"})
+		return
+	}
+
+	// Attach add-ons, apply the price list and calculate margin for each item
+	for i := range menuItems {
+		menuItems[i].AddOns = withAddOnTags(effectiveAddOns[menuItems[i].ID], addOnTags, excludedAllergens)
+		if priceList != nil {
+			applyMenuItemPrices(&menuItems[i], priceList)
+		}
 		if menuItems[i].Price > 0 {
 			menuItems[i].Margin = ((menuItems[i].Price - menuItems[i].COGS) / menuItems[i].Price) * 100
 		}
-		
-		// Calculate margins for add-ons
-		for j := range menuItems[i].AddOns {
-			if menuItems[i].AddOns[j].Price > 0 {
-				menuItems[i].AddOns[j].Margin = ((menuItems[i].AddOns[j].Price - menuItems[i].AddOns[j].COGS) / menuItems[i].AddOns[j].Price) * 100
-			}
+
+		if len(terms) > 0 {
+			menuItems[i].Highlights = searchHighlights(menuItems[i], terms)
+		}
+		if soldOut.menuItems[menuItems[i].ID] {
+			menuItems[i].SoldOut = true
 		}
-		
-		// Also include global add-ons for this menu item
-		var globalAddOns []models.AddOn
-		if err := h.db.Where("menu_item_id IS NULL AND is_available = ?", true).Find(&globalAddOns).Error; err == nil {
-			// Calculate margins for global add-ons
-			for k := range globalAddOns {
-				if globalAddOns[k].Price > 0 {
-					globalAddOns[k].Margin = ((globalAddOns[k].Price - globalAddOns[k].COGS) / globalAddOns[k].Price) * 100
+
+		if orderableOnly {
+			addOns := make([]models.AddOn, 0, len(menuItems[i].AddOns))
+			for _, addOn := range menuItems[i].AddOns {
+				if addOn.IsAvailable && !off.addOnOffSchedule(addOn.ID) && !soldOut.addOns[addOn.ID] {
+					addOns = append(addOns, addOn)
 				}
 			}
-			// Append global add-ons to menu item's add-ons
-			menuItems[i].AddOns = append(menuItems[i].AddOns, globalAddOns...)
+			menuItems[i].AddOns = addOns
 		}
 	}
 
@@ -165,6 +374,10 @@ func (h *MenuHandler) GetMenuItems(c *gin.Context) {
 		"message": "Menu items retrieved successfully",
 	}
 	
+	if priceList != nil {
+		response["price_list"] = gin.H{"id": priceList.ID, "name": priceList.Name}
+	}
+
 	// Add pagination info only if pagination was used
 	if limit > 0 {
 		response["page"] = page
@@ -177,23 +390,77 @@ func (h *MenuHandler) GetMenuItems(c *gin.Context) {
 
 func (h *MenuHandler) CreateMenuItem(c *gin.Context) {
 	var menuItem models.MenuItem
-	if err := c.ShouldBindJSON(&menuItem); err != nil {
+	if err := c.ShouldBindBodyWith(&menuItem, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tags TagsRequest
+	if err := c.ShouldBindBodyWith(&tags, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Validate category exists
 	var category models.Category
-	if err := h.db.First(&category, menuItem.CategoryID).Error; err != nil {
+	if err := h.db.WithContext(c).First(&category, menuItem.CategoryID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
 		return
 	}
 
-	if err := h.db.Create(&menuItem).Error; err != nil {
+	if menuItem.ItemType == "" {
+		menuItem.ItemType = "item"
+	}
+	if menuItem.ItemType != "item" && menuItem.ItemType != "bundle" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item type"})
+		return
+	}
+
+	menuItem.SKU = strings.TrimSpace(menuItem.SKU)
+	if skuInUse(h.db.WithContext(c), menuItem.SKU, 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SKU is already in use"})
+		return
+	}
+
+	menuItem.Channels = normalizeChannels(menuItem.Channels)
+
+	// Bundle components and barcodes are managed through their own endpoints, tags through tag_ids
+	menuItem.BundleSlots = nil
+	menuItem.Barcodes = nil
+	menuItem.Tags = nil
+	menuItem.SoldOut = false
+	menuItem.LowStock = false
+	menuItem.ThumbnailURL = ""
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Create(&menuItem).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create menu item"})
 		return
 	}
 
+	if err := recordMenuItemPrice(tx, menuItem, "created", currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record price history"})
+		return
+	}
+
+	if err := replaceTags(tx, &menuItem, tags.TagIDs); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.RefreshSearchText(tx, "id = ?", menuItem.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update search text"})
+		return
+	}
+
+	tx.Commit()
+
+	h.db.WithContext(c).Preload("Tags").First(&menuItem, menuItem.ID)
+
 	// Calculate margin
 	if menuItem.Price > 0 {
 		menuItem.Margin = ((menuItem.Price - menuItem.COGS) / menuItem.Price) * 100
@@ -206,11 +473,30 @@ func (h *MenuHandler) GetMenuItem(c *gin.Context) {
 	id := c.Param("id")
 	
 	var menuItem models.MenuItem
-	if err := h.db.Preload("Category").First(&menuItem, id).Error; err != nil {
+	if err := h.db.WithContext(c).Preload("Category").
+		Preload("BundleSlots", func(db *gorm.DB) *gorm.DB {
+			return db.Order("sort_order, id")
+		}).
+		Preload("Barcodes", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).
+		Preload("Tags", func(db *gorm.DB) *gorm.DB {
+			return db.Order("tags.name")
+		}).
+		First(&menuItem, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
 		return
 	}
 
+	if value := c.Query("price_list"); value != "" {
+		priceList, err := priceListParam(h.db.WithContext(c), value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Price list not found"})
+			return
+		}
+		applyMenuItemPrices(&menuItem, priceList)
+	}
+
 	// Calculate margin
 	if menuItem.Price > 0 {
 		menuItem.Margin = ((menuItem.Price - menuItem.COGS) / menuItem.Price) * 100
@@ -223,30 +509,124 @@ func (h *MenuHandler) UpdateMenuItem(c *gin.Context) {
 	id := c.Param("id")
 	
 	var menuItem models.MenuItem
-	if err := h.db.First(&menuItem, id).Error; err != nil {
+	if err := h.db.WithContext(c).First(&menuItem, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
 		return
 	}
 
-	if err := c.ShouldBindJSON(&menuItem); err != nil {
+	previousType := menuItem.ItemType
+	wasAvailable, soldOut, lowStock := menuItem.IsAvailable, menuItem.SoldOut, menuItem.LowStock
+	previousImage, thumbnailURL := menuItem.ImageURL, menuItem.ThumbnailURL
+	if err := c.ShouldBindBodyWith(&menuItem, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tags TagsRequest
+	if err := c.ShouldBindBodyWith(&tags, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Pointing image_url elsewhere drops an uploaded image, whose files are removed once saved
+	menuItem.ThumbnailURL = thumbnailURL
+	var removedImage string
+	if menuItem.ImageURL != previousImage {
+		removedImage = menuItem.ImageKey
+		menuItem.ThumbnailURL = ""
+		menuItem.ImageKey = ""
+	}
+
+	// Stock flags are maintained by inventory; toggling availability by hand overrides sold out
+	menuItem.SoldOut = soldOut && menuItem.IsAvailable == wasAvailable
+	menuItem.LowStock = lowStock
+
+	if menuItem.ItemType != "item" && menuItem.ItemType != "bundle" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item type"})
+		return
+	}
+
+	if previousType != menuItem.ItemType {
+		var slotCount int64
+		h.db.WithContext(c).Model(&models.BundleSlot{}).Where("bundle_id = ? OR menu_item_id = ?", menuItem.ID, menuItem.ID).Count(&slotCount)
+		if slotCount > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change the type of a menu item used in bundle slots"})
+			return
+		}
+
+		// A bundle's stock and COGS come from its components
+		var recipeCount int64
+		h.db.WithContext(c).Model(&models.RecipeLine{}).Where("menu_item_id = ?", menuItem.ID).Count(&recipeCount)
+		if menuItem.ItemType == "bundle" && recipeCount > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Remove the recipe before making this menu item a bundle"})
+			return
+		}
+	}
+
 	// Validate category exists if category_id is being updated
 	if menuItem.CategoryID != 0 {
 		var category models.Category
-		if err := h.db.First(&category, menuItem.CategoryID).Error; err != nil {
+		if err := h.db.WithContext(c).First(&category, menuItem.CategoryID).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
 			return
 		}
 	}
 
-	if err := h.db.Save(&menuItem).Error; err != nil {
+	menuItem.SKU = strings.TrimSpace(menuItem.SKU)
+	if skuInUse(h.db.WithContext(c), menuItem.SKU, menuItem.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SKU is already in use"})
+		return
+	}
+
+	menuItem.Channels = normalizeChannels(menuItem.Channels)
+	menuItem.BundleSlots = nil
+	menuItem.Barcodes = nil
+	menuItem.Tags = nil
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Save(&menuItem).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update menu item"})
 		return
 	}
 
+	if err := recordMenuItemPrice(tx, menuItem, "manual", currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record price history"})
+		return
+	}
+
+	if err := replaceTags(tx, &menuItem, tags.TagIDs); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.RefreshSearchText(tx, "id = ?", menuItem.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update search text"})
+		return
+	}
+
+	// Items with a recipe take their COGS from it, and bundles built from this item carry its COGS
+	if err := recalculateRecipeCOGS(tx, []uint{menuItem.ID}, nil, currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recalculate COGS"})
+		return
+	}
+	if menuItem.ItemType != "bundle" {
+		if err := recalculateBundlesUsing(tx, menuItem, currentUserID(c)); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bundle COGS"})
+			return
+		}
+	}
+
+	tx.Commit()
+	removeReplacedMenuImages(c.Request.Context(), h.db.WithContext(c), h.store, removedImage)
+
+	h.db.WithContext(c).Preload("Tags").First(&menuItem, menuItem.ID)
+
 	// Calculate margin
 	if menuItem.Price > 0 {
 		menuItem.Margin = ((menuItem.Price - menuItem.COGS) / menuItem.Price) * 100
@@ -258,10 +638,26 @@ func (h *MenuHandler) UpdateMenuItem(c *gin.Context) {
 func (h *MenuHandler) DeleteMenuItem(c *gin.Context) {
 	id := c.Param("id")
 	
-	if err := h.db.Delete(&models.MenuItem{}, id).Error; err != nil {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Delete(&menuItem).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete menu item"})
 		return
 	}
 
+	// Free the item's barcodes for reuse
+	h.db.WithContext(c).Where("menu_item_id = ?", menuItem.ID).Delete(&models.Barcode{})
+
+	// Uploaded images are not kept for deleted items, unless a published
+	// menu version, which a rollback can bring the item back from, shows them
+	if menuItem.ImageKey != "" {
+		removeReplacedMenuImages(c.Request.Context(), h.db.WithContext(c), h.store, menuItem.ImageKey)
+		h.db.WithContext(c).Unscoped().Model(&menuItem).Updates(map[string]interface{}{"image_url": "", "thumbnail_url": "", "image_key": ""})
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Menu item deleted successfully"})
 }
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"pos-system/internal/models"
+	"pos-system/pkg/imaging"
+	"pos-system/pkg/storage"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxImageSize limits the size of an uploaded image file
+const maxImageSize = 10 << 20
+
+// menuImageSizes are the versions stored for each uploaded menu item image
+var menuImageSizes = []struct {
+	name          string
+	width, height int
+	mode          imaging.Mode
+}{
+	{"display", 1200, 1200, imaging.Fit},
+	{"thumb", 320, 320, imaging.Fill},
+}
+
+// menuImageKey is the storage key of one size of an uploaded image
+func menuImageKey(base, size string) string {
+	return base + "-" + size + ".jpg"
+}
+
+func (h *MenuHandler) menuImageURL(base, size string) string {
+	return strings.TrimSuffix(h.mediaURL, "/") + "/" + menuImageKey(base, size)
+}
+
+// UploadMenuItemImage stores an uploaded image as display and thumbnail sizes
+// and points the menu item at them, replacing any previous upload
+func (h *MenuHandler) UploadMenuItemImage(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageSize+1<<20)
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image is required"})
+		return
+	}
+	if fileHeader.Size > maxImageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Image is too large"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+
+	// The type is sniffed from the data, whatever the client claimed
+	img, err := imaging.Decode(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Keys are never reused, so stored images can be cached indefinitely
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+		return
+	}
+	base := fmt.Sprintf("menu-items/%d/%s", menuItem.ID, hex.EncodeToString(suffix))
+
+	ctx := c.Request.Context()
+	for _, size := range menuImageSizes {
+		encoded, err := imaging.EncodeJPEG(imaging.Resize(img, size.width, size.height, size.mode), 85)
+		if err == nil {
+			err = h.store.Put(ctx, menuImageKey(base, size.name), encoded, "image/jpeg")
+		}
+		if err != nil {
+			log.Printf("Failed to store image for menu item %d: %v", menuItem.ID, err)
+			removeMenuImage(context.Background(), h.store, base)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+			return
+		}
+	}
+
+	previous := menuItem.ImageKey
+	if err := h.db.WithContext(c).Model(&menuItem).Updates(map[string]interface{}{
+		"image_url":     h.menuImageURL(base, "display"),
+		"thumbnail_url": h.menuImageURL(base, "thumb"),
+		"image_key":     base,
+	}).Error; err != nil {
+		removeMenuImage(context.Background(), h.store, base)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update menu item"})
+		return
+	}
+	removeReplacedMenuImages(context.Background(), h.db.WithContext(c), h.store, previous)
+
+	h.db.WithContext(c).Preload("Category").First(&menuItem, menuItem.ID)
+	if menuItem.Price > 0 {
+		menuItem.Margin = ((menuItem.Price - menuItem.COGS) / menuItem.Price) * 100
+	}
+
+	c.JSON(http.StatusOK, menuItem)
+}
+
+// DeleteMenuItemImage removes a menu item's image, deleting the files if it
+// was uploaded
+func (h *MenuHandler) DeleteMenuItemImage(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	previous := menuItem.ImageKey
+	if err := h.db.WithContext(c).Model(&menuItem).Updates(map[string]interface{}{
+		"image_url":     "",
+		"thumbnail_url": "",
+		"image_key":     "",
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update menu item"})
+		return
+	}
+	removeReplacedMenuImages(c.Request.Context(), h.db.WithContext(c), h.store, previous)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image removed successfully"})
+}
+
+// removeMenuImage deletes every size of an uploaded image. Failures only leave
+// unreferenced files behind, so they are logged rather than returned.
+func removeMenuImage(ctx context.Context, store storage.Storage, base string) {
+	if base == "" || store == nil {
+		return
+	}
+	for _, size := range menuImageSizes {
+		if err := store.Delete(ctx, menuImageKey(base, size.name)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to delete image %s: %v", menuImageKey(base, size.name), err)
+		}
+	}
+}
+
+// removeReplacedMenuImages deletes uploaded images a menu item no longer
+// shows, except those a published menu version still shows: rolling back to
+// that version puts them back. If the versions cannot be read, the images are
+// kept.
+func removeReplacedMenuImages(ctx context.Context, db *gorm.DB, store storage.Storage, bases ...string) {
+	if store == nil {
+		return
+	}
+
+	query := db.Where("1 = 0")
+	replaced := 0
+	for _, base := range bases {
+		if base != "" {
+			query = query.Or("document LIKE ?", "%"+base+"-%")
+			replaced++
+		}
+	}
+	if replaced == 0 {
+		return
+	}
+
+	var documents []string
+	if err := db.Model(&models.MenuVersion{}).Where("status = ?", models.MenuVersionPublished).Where(query).
+		Pluck("document", &documents).Error; err != nil {
+		log.Printf("Failed to check menu versions for images, keeping them: %v", err)
+		return
+	}
+	removeUnreferencedMenuImages(ctx, store, documents, bases)
+}
+
+// removeUnreferencedMenuImages deletes the images that none of the menu
+// version documents show. Documents hold image URLs, which contain the key.
+func removeUnreferencedMenuImages(ctx context.Context, store storage.Storage, documents, bases []string) {
+	for _, base := range bases {
+		referenced := false
+		for _, document := range documents {
+			if strings.Contains(document, base+"-") {
+				referenced = true
+				break
+			}
+		}
+		if !referenced {
+			removeMenuImage(ctx, store, base)
+		}
+	}
+}
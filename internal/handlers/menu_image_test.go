@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"pos-system/internal/menuio"
+	"pos-system/pkg/storage"
+	"testing"
+)
+
+func TestRollbackKeepsImagesOfPublishedVersions(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	h := &MenuHandler{store: store, mediaURL: "http://localhost:8080/media"}
+
+	first, second, draft := "menu-items/1/aaaa", "menu-items/1/bbbb", "menu-items/1/cccc"
+	for _, base := range []string{first, second, draft} {
+		for _, size := range menuImageSizes {
+			if err := store.Put(ctx, menuImageKey(base, size.name), []byte("jpeg"), "image/jpeg"); err != nil {
+				t.Fatalf("Failed to store image: %v", err)
+			}
+		}
+	}
+
+	// Version 1 was published with the first image, and version 2 with the
+	// second after a new upload; the third was uploaded but never published
+	var documents []string
+	for _, base := range []string{first, second} {
+		document, err := json.Marshal(menuio.Menu{MenuItems: []menuio.MenuItem{
+			{SKU: "LAT", Name: "Latte", Category: "Coffee", Price: 28000, ImageURL: h.menuImageURL(base, "display")},
+		}})
+		if err != nil {
+			t.Fatalf("Failed to encode menu: %v", err)
+		}
+		documents = append(documents, string(document))
+	}
+
+	// Replacing the images keeps those rolling back to version 1 or 2 shows
+	removeUnreferencedMenuImages(ctx, store, documents, []string{first, second, draft})
+
+	for _, base := range []string{first, second} {
+		for _, size := range menuImageSizes {
+			file, _, err := store.Get(ctx, menuImageKey(base, size.name))
+			if err != nil {
+				t.Errorf("Expected %s to be kept for rollback, got %v", menuImageKey(base, size.name), err)
+				continue
+			}
+			file.Close()
+		}
+	}
+	for _, size := range menuImageSizes {
+		if _, _, err := store.Get(ctx, menuImageKey(draft, size.name)); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Expected %s to be removed, got %v", menuImageKey(draft, size.name), err)
+		}
+	}
+}
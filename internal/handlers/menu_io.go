@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"pos-system/internal/menuio"
+	"pos-system/internal/models"
+	"pos-system/pkg/storage"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxImportSize limits the size of an uploaded menu file
+const maxImportSize = 10 << 20
+
+// ExportMenu downloads every category, menu item and add-on as CSV or JSON
+func (h *MenuHandler) ExportMenu(c *gin.Context) {
+	format := c.DefaultQuery("format", menuio.FormatJSON)
+	if format != menuio.FormatCSV && format != menuio.FormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	menu, err := menuio.Export(h.db.WithContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export menu"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := menuio.Write(&buf, format, menu); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export menu"})
+		return
+	}
+
+	contentType := "application/json"
+	if format == menuio.FormatCSV {
+		contentType = "text/csv"
+	}
+	filename := fmt.Sprintf("menu-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// ImportMenu upserts categories, menu items and add-ons from a CSV or JSON
+// file, sent either as the request body or as the "file" field of a multipart
+// form. Nothing is saved unless every row is valid; with dry_run=true nothing
+// is saved at all and the report shows what would happen.
+func (h *MenuHandler) ImportMenu(c *gin.Context) {
+	var (
+		body     io.Reader = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+		filename string
+	)
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		if fileHeader.Size > maxImportSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is too large"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+			return
+		}
+		defer file.Close()
+		body, filename = file, fileHeader.Filename
+	}
+
+	format := importFormat(c.Query("format"), filename, c.ContentType())
+	if format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	menu, err := menuio.Read(body, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := ApplyMenuImport(h.db.WithContext(c), h.store, menu, c.Query("dry_run") == "true", currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import menu"})
+		return
+	}
+
+	if !report.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Menu file has errors", "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ApplyMenuImport applies a menu file in a single database transaction, which
+// is committed only if every row is valid and dryRun is false. Bundles that
+// can contain an imported menu item get their COGS recalculated, and uploaded
+// images replaced by the file are removed from store unless a published menu
+// version shows them.
+func ApplyMenuImport(db *gorm.DB, store storage.Storage, menu *menuio.Menu, dryRun bool, userID *uint) (*menuio.Report, error) {
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	report, err := applyMenuTx(tx, menu, false, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	report.DryRun = dryRun
+
+	if !report.Valid() || dryRun {
+		tx.Rollback()
+		return report, nil
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	report.Applied = true
+
+	removeReplacedMenuImages(context.Background(), db, store, report.Images...)
+	return report, nil
+}
+
+// applyMenuTx applies a menu inside tx and recalculates the COGS of bundles
+// that can contain a changed menu item. With complete, the menu replaces the
+// live menu: rows must only refer to each other, and rows left out are
+// deleted. The caller must roll tx back unless the report is valid.
+func applyMenuTx(tx *gorm.DB, menu *menuio.Menu, complete bool, userID *uint) (*menuio.Report, error) {
+	if complete {
+		if issues := append(menuio.Validate(menu), menuio.CheckReferences(menu)...); len(issues) > 0 {
+			return &menuio.Report{Rows: []menuio.Result{}, Errors: issues}, nil
+		}
+	}
+
+	report, err := menuio.Apply(tx, menu, userID)
+	if err != nil || !report.Valid() {
+		return report, err
+	}
+
+	if complete {
+		if err := menuio.Prune(tx, report); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, menuItemID := range report.Changed {
+		var menuItem models.MenuItem
+		if err := tx.First(&menuItem, menuItemID).Error; err != nil {
+			return nil, err
+		}
+		if err := recalculateBundlesUsing(tx, menuItem, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// importFormat picks the format of an uploaded menu from the format query
+// parameter, the file extension or the content type, in that order
+func importFormat(query, filename, contentType string) string {
+	switch {
+	case query != "":
+		if query == menuio.FormatCSV || query == menuio.FormatJSON {
+			return query
+		}
+		return ""
+	case strings.EqualFold(filepath.Ext(filename), ".csv"):
+		return menuio.FormatCSV
+	case strings.EqualFold(filepath.Ext(filename), ".json"):
+		return menuio.FormatJSON
+	case contentType == "text/csv":
+		return menuio.FormatCSV
+	case contentType == "application/json":
+		return menuio.FormatJSON
+	}
+	return ""
+}
@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-system/internal/menuio"
+	"pos-system/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CreateMenuDraftRequest struct {
+	Name          string `json:"name" binding:"required"`
+	FromVersionID *uint  `json:"from_version_id"` // Start from this version instead of the live menu
+}
+
+type UpdateMenuDraftRequest struct {
+	Name string       `json:"name"`
+	Menu *menuio.Menu `json:"menu"` // Replaces the whole draft menu
+}
+
+// MenuDraftChangesRequest stages changes to some rows of a draft
+type MenuDraftChangesRequest struct {
+	Upsert menuio.Menu    `json:"upsert"` // Rows to add, or to replace the rows with the same SKU or name
+	Remove menuio.RowRefs `json:"remove"` // Rows to take out of the menu
+}
+
+// MenuVersionResponse is a menu version with its menu
+type MenuVersionResponse struct {
+	models.MenuVersion
+	Menu   *menuio.Menu   `json:"menu"`
+	Issues []menuio.Issue `json:"issues,omitempty"` // Problems to fix before a draft can be published
+}
+
+// GetMenuVersions lists drafts and published versions, newest first,
+// without their menus
+func (h *MenuHandler) GetMenuVersions(c *gin.Context) {
+	query := h.db.WithContext(c).Order("id DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var versions []models.MenuVersion
+	if err := query.Omit("document").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch menu versions"})
+		return
+	}
+
+	response := gin.H{"data": versions}
+	if live, err := liveMenuVersionID(h.db.WithContext(c)); err == nil && live != nil {
+		response["live_version_id"] = *live
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *MenuHandler) GetMenuVersion(c *gin.Context) {
+	var version models.MenuVersion
+	if err := h.db.WithContext(c).First(&version, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu version not found"})
+		return
+	}
+
+	respondMenuVersion(c, http.StatusOK, version)
+}
+
+// CreateMenuDraft starts a draft from the live menu or from another version.
+// Availability is left out, so publishing keeps whatever is live.
+func (h *MenuHandler) CreateMenuDraft(c *gin.Context) {
+	var req CreateMenuDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var menu *menuio.Menu
+	if req.FromVersionID != nil {
+		var from models.MenuVersion
+		if err := h.db.WithContext(c).First(&from, *req.FromVersionID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Menu version not found"})
+			return
+		}
+		var err error
+		if menu, err = decodeMenuDocument(from.Document); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read menu version"})
+			return
+		}
+	} else {
+		var err error
+		if menu, err = menuio.Export(h.db.WithContext(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export menu"})
+			return
+		}
+	}
+	menu.ClearAvailability()
+
+	baseVersionID, err := liveMenuVersionID(h.db.WithContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch menu versions"})
+		return
+	}
+
+	document, err := json.Marshal(menu)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create draft"})
+		return
+	}
+
+	version := models.MenuVersion{
+		Name:          req.Name,
+		Status:        models.MenuVersionDraft,
+		Document:      string(document),
+		BaseVersionID: baseVersionID,
+		CreatedBy:     currentUserID(c),
+	}
+	if err := h.db.WithContext(c).Create(&version).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create draft"})
+		return
+	}
+
+	respondMenuVersion(c, http.StatusCreated, version)
+}
+
+// UpdateMenuDraft renames a draft or replaces its whole menu
+func (h *MenuHandler) UpdateMenuDraft(c *gin.Context) {
+	var req UpdateMenuDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.changeMenuDraft(c, func(version *models.MenuVersion, menu *menuio.Menu) error {
+		if req.Name != "" {
+			version.Name = req.Name
+		}
+		if req.Menu != nil {
+			*menu = *req.Menu
+		}
+		return nil
+	})
+}
+
+// ChangeMenuDraft adds, replaces and removes rows of a draft
+func (h *MenuHandler) ChangeMenuDraft(c *gin.Context) {
+	var req MenuDraftChangesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.changeMenuDraft(c, func(version *models.MenuVersion, menu *menuio.Menu) error {
+		if err := menu.Remove(req.Remove); err != nil {
+			return err
+		}
+		menu.Upsert(req.Upsert)
+		return nil
+	})
+}
+
+// changeMenuDraft applies change to a locked draft and saves it. An error
+// from change is the client's and is returned as a bad request.
+func (h *MenuHandler) changeMenuDraft(c *gin.Context, change func(version *models.MenuVersion, menu *menuio.Menu) error) {
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var version models.MenuVersion
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&version, c.Param("id")).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu version not found"})
+		return
+	}
+	if version.Status != models.MenuVersionDraft {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only drafts can be changed"})
+		return
+	}
+
+	menu, err := decodeMenuDocument(version.Document)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read draft"})
+		return
+	}
+	if err := change(&version, menu); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	document, err := json.Marshal(menu)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update draft"})
+		return
+	}
+	version.Document = string(document)
+	if err := tx.Save(&version).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update draft"})
+		return
+	}
+	tx.Commit()
+
+	respondMenuVersion(c, http.StatusOK, version)
+}
+
+// DiscardMenuDraft abandons a draft. It is kept, marked discarded.
+func (h *MenuHandler) DiscardMenuDraft(c *gin.Context) {
+	result := h.db.WithContext(c).Model(&models.MenuVersion{}).
+		Where("id = ? AND status = ?", c.Param("id"), models.MenuVersionDraft).
+		Update("status", models.MenuVersionDiscarded)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discard draft"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft discarded successfully"})
+}
+
+// GetMenuVersionDiff lists what publishing a draft, or rolling back to a
+// published version, would change in the live menu
+func (h *MenuHandler) GetMenuVersionDiff(c *gin.Context) {
+	var version models.MenuVersion
+	if err := h.db.WithContext(c).First(&version, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu version not found"})
+		return
+	}
+
+	menu, err := decodeMenuDocument(version.Document)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read menu version"})
+		return
+	}
+	if version.Status != models.MenuVersionDraft {
+		menu.ClearAvailability()
+	}
+
+	live, err := menuio.Export(h.db.WithContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export menu"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"version_id": version.ID,
+		"changes":    menuio.Diff(live, menu),
+		"issues":     menuDocumentIssues(menu),
+	})
+}
+
+// PublishMenuDraft makes the live menu match a draft in one database
+// transaction: rows are created and updated, and rows left out of the draft
+// are deleted. With dry_run=true nothing is saved and the report shows what
+// would happen.
+func (h *MenuHandler) PublishMenuDraft(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	h.publishMenu(c, func(tx *gorm.DB, version *models.MenuVersion) (*menuio.Menu, *models.MenuVersion, string) {
+		if version.Status != models.MenuVersionDraft {
+			return nil, nil, "Only drafts can be published"
+		}
+		menu, err := decodeMenuDocument(version.Document)
+		if err != nil {
+			return nil, nil, "Draft cannot be read"
+		}
+		return menu, version, ""
+	}, dryRun)
+}
+
+// RollbackMenuVersion restores the live menu to a published version. The
+// restored menu is recorded as a new published version.
+func (h *MenuHandler) RollbackMenuVersion(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	h.publishMenu(c, func(tx *gorm.DB, target *models.MenuVersion) (*menuio.Menu, *models.MenuVersion, string) {
+		if target.Status != models.MenuVersionPublished {
+			return nil, nil, "Only published versions can be rolled back to"
+		}
+		menu, err := decodeMenuDocument(target.Document)
+		if err != nil {
+			return nil, nil, "Menu version cannot be read"
+		}
+		// Availability is operational, not part of the menu being restored
+		menu.ClearAvailability()
+
+		version := &models.MenuVersion{
+			Name:         fmt.Sprintf("Rollback to %s", target.Name),
+			RollbackOfID: &target.ID,
+			CreatedBy:    currentUserID(c),
+		}
+		return menu, version, ""
+	}, dryRun)
+}
+
+// publishMenu applies the menu picked by prepare from the version in the URL
+// and records the result as a published version. prepare returns the menu,
+// the version to mark published (new or the one given) and, if the request
+// cannot proceed, a message for the client.
+func (h *MenuHandler) publishMenu(c *gin.Context, prepare func(tx *gorm.DB, version *models.MenuVersion) (*menuio.Menu, *models.MenuVersion, string), dryRun bool) {
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Publishing is serialized so the live menu always matches the latest version
+	if err := tx.Exec("LOCK TABLE menu_versions IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish menu"})
+		return
+	}
+
+	var source models.MenuVersion
+	if err := tx.First(&source, c.Param("id")).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu version not found"})
+		return
+	}
+
+	menu, version, message := prepare(tx, &source)
+	if message != "" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	baseVersionID, err := liveMenuVersionID(tx)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch menu versions"})
+		return
+	}
+
+	userID := currentUserID(c)
+	report, err := applyMenuTx(tx, menu, true, userID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish menu"})
+		return
+	}
+	report.DryRun = dryRun
+
+	if !report.Valid() {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Menu has errors", "report": report})
+		return
+	}
+	if dryRun {
+		tx.Rollback()
+		c.JSON(http.StatusOK, gin.H{"report": report})
+		return
+	}
+
+	// Keep what actually went live, to roll back to
+	live, err := menuio.Export(tx)
+	if err == nil {
+		var document []byte
+		if document, err = json.Marshal(live); err == nil {
+			now := time.Now()
+			version.Status = models.MenuVersionPublished
+			version.Document = string(document)
+			version.PublishedBy = userID
+			version.PublishedAt = &now
+			if version.BaseVersionID == nil {
+				version.BaseVersionID = baseVersionID
+			}
+			err = tx.Save(version).Error
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish menu"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish menu"})
+		return
+	}
+	report.Applied = true
+
+	// Images shown by earlier versions are kept for rolling back to them
+	removeReplacedMenuImages(context.Background(), h.db.WithContext(c), h.store, report.Images...)
+
+	c.JSON(http.StatusOK, gin.H{"version": version, "report": report})
+}
+
+// liveMenuVersionID returns the most recently published version, which the
+// live menu matches unless it was edited directly since
+func liveMenuVersionID(db *gorm.DB) (*uint, error) {
+	var versions []models.MenuVersion
+	if err := db.Select("id").Where("status = ?", models.MenuVersionPublished).
+		Order("published_at DESC, id DESC").Limit(1).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	return &versions[0].ID, nil
+}
+
+func decodeMenuDocument(document string) (*menuio.Menu, error) {
+	var menu menuio.Menu
+	if err := json.Unmarshal([]byte(document), &menu); err != nil {
+		return nil, err
+	}
+	return &menu, nil
+}
+
+// menuDocumentIssues lists the problems that would stop a menu from being
+// published, short of conflicts with the database
+func menuDocumentIssues(menu *menuio.Menu) []menuio.Issue {
+	issues := append(menuio.Validate(menu), menuio.CheckReferences(menu)...)
+	if issues == nil {
+		issues = []menuio.Issue{}
+	}
+	return issues
+}
+
+func respondMenuVersion(c *gin.Context, status int, version models.MenuVersion) {
+	menu, err := decodeMenuDocument(version.Document)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read menu version"})
+		return
+	}
+
+	response := MenuVersionResponse{MenuVersion: version, Menu: menu}
+	if version.Status == models.MenuVersionDraft {
+		response.Issues = menuDocumentIssues(menu)
+	}
+	c.JSON(status, response)
+}
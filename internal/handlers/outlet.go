@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pos-system/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errOutletRequired  = errors.New("outlet_id is required")
+	errOutletNotFound  = errors.New("Outlet not found")
+	errOutletForbidden = errors.New("You are not assigned to this outlet")
+)
+
+type OutletHandler struct {
+	db *gorm.DB
+}
+
+type OutletRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+	Address  string `json:"address"`
+	Phone    string `json:"phone"`
+	IsActive *bool  `json:"is_active"`
+}
+
+type UserOutletsRequest struct {
+	OutletIDs []uint `json:"outlet_ids"` // Empty lets the user work at every outlet
+}
+
+func NewOutletHandler(db *gorm.DB) *OutletHandler {
+	return &OutletHandler{db: db}
+}
+
+func (h *OutletHandler) GetOutlets(c *gin.Context) {
+	query := h.db.WithContext(c).Order("name")
+	if c.Query("active") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var outlets []models.Outlet
+	if err := query.Find(&outlets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, outlets)
+}
+
+func (h *OutletHandler) GetOutlet(c *gin.Context) {
+	var outlet models.Outlet
+	if err := h.db.WithContext(c).First(&outlet, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, outlet)
+}
+
+func (h *OutletHandler) CreateOutlet(c *gin.Context) {
+	var req OutletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	outlet := models.Outlet{IsActive: true}
+	applyOutletRequest(&outlet, req)
+	if h.outletCodeTaken(c, outlet.Code, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An outlet with this code already exists"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Create(&outlet).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create outlet"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, outlet)
+}
+
+func (h *OutletHandler) UpdateOutlet(c *gin.Context) {
+	var outlet models.Outlet
+	if err := h.db.WithContext(c).First(&outlet, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+
+	var req OutletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	applyOutletRequest(&outlet, req)
+	if h.outletCodeTaken(c, outlet.Code, outlet.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An outlet with this code already exists"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Save(&outlet).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update outlet"})
+		return
+	}
+
+	c.JSON(http.StatusOK, outlet)
+}
+
+// DeleteOutlet removes an outlet. Its orders, expenses and stock history are
+// kept; an outlet with stock on hand must have it transferred out first.
+func (h *OutletHandler) DeleteOutlet(c *gin.Context) {
+	var outlet models.Outlet
+	if err := h.db.WithContext(c).First(&outlet, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+
+	var stocked int64
+	h.db.WithContext(c).Model(&models.OutletStock{}).Where("outlet_id = ? AND stock_qty <> 0", outlet.ID).Count(&stocked)
+	if stocked > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Outlet still has stock on hand"})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Exec("DELETE FROM user_outlets WHERE outlet_id = ?", outlet.ID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unassign users"})
+		return
+	}
+	if err := tx.Delete(&outlet).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete outlet"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Outlet deleted successfully"})
+}
+
+// GetOutletStock lists the stock on hand of every ingredient at an outlet
+func (h *OutletHandler) GetOutletStock(c *gin.Context) {
+	outletID, err := resolveOutlet(c, h.db.WithContext(c), c.Param("id"))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	var ingredients []models.Ingredient
+	if err := h.db.WithContext(c).Order("name").Find(&ingredients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+	stock, err := outletStockQty(h.db.WithContext(c), outletID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlet stock"})
+		return
+	}
+
+	results := make([]outletIngredient, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		qty := stock[ingredient.ID]
+		if c.Query("low") == "true" && qty > ingredient.LowStockThreshold {
+			continue
+		}
+		results = append(results, outletIngredient{
+			OutletID:          outletID,
+			IngredientID:      ingredient.ID,
+			Name:              ingredient.Name,
+			Unit:              ingredient.Unit,
+			StockQty:          qty,
+			LowStockThreshold: ingredient.LowStockThreshold,
+			LowStock:          qty <= ingredient.LowStockThreshold,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"outlet_id":   outletID,
+		"ingredients": results,
+	})
+}
+
+// SetUserOutlets assigns a user to outlets
+func (h *OutletHandler) SetUserOutlets(c *gin.Context) {
+	var user models.User
+	if err := h.db.WithContext(c).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var req UserOutletsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	outlets := []models.Outlet{}
+	if ids := uniqueIDs(req.OutletIDs); len(ids) > 0 {
+		if err := h.db.WithContext(c).Where("id IN ?", ids).Find(&outlets).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlets"})
+			return
+		}
+		if len(outlets) != len(ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Outlet not found"})
+			return
+		}
+	}
+
+	if err := h.db.WithContext(c).Model(&user).Association("Outlets").Replace(outlets); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign outlets"})
+		return
+	}
+
+	h.db.WithContext(c).Preload("Outlets").First(&user, user.ID)
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *OutletHandler) outletCodeTaken(c *gin.Context, code string, exceptID uint) bool {
+	var count int64
+	h.db.WithContext(c).Model(&models.Outlet{}).Where("code = ? AND id <> ?", code, exceptID).Count(&count)
+	return count > 0
+}
+
+func applyOutletRequest(outlet *models.Outlet, req OutletRequest) {
+	outlet.Name = req.Name
+	outlet.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	outlet.Address = req.Address
+	outlet.Phone = req.Phone
+	if req.IsActive != nil {
+		outlet.IsActive = *req.IsActive
+	}
+}
+
+// outletScope is the outlets a list or report covers: one outlet, the
+// outlets the user works at, or every outlet
+type outletScope struct {
+	all bool
+	ids []uint
+}
+
+// clause returns a condition limiting column to the scope's outlets. It can
+// be passed to Where, or as an argument of raw SQL.
+func (s outletScope) clause(column string) clause.Expr {
+	if s.all {
+		return clause.Expr{SQL: "TRUE"}
+	}
+	if len(s.ids) == 0 {
+		return clause.Expr{SQL: "FALSE"}
+	}
+	return clause.Expr{SQL: column + " IN ?", Vars: []interface{}{s.ids}}
+}
+
+// userOutletIDs returns the outlets the current user works at, or nil when
+// they may work at every outlet: admins, and users not assigned to any
+func userOutletIDs(c *gin.Context, db *gorm.DB) ([]uint, error) {
+	if role, _ := c.Get("role"); role == "admin" {
+		return nil, nil
+	}
+	userID := currentUserID(c)
+	if userID == nil {
+		return nil, nil
+	}
+
+	var ids []uint
+	if err := db.Table("user_outlets").Where("user_id = ?", *userID).Pluck("outlet_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return ids, nil
+}
+
+// requestedOutlet returns the outlet_id query parameter, or the X-Outlet-ID
+// header a till sends with every request
+func requestedOutlet(c *gin.Context) string {
+	if outletID := c.Query("outlet_id"); outletID != "" {
+		return outletID
+	}
+	return c.GetHeader("X-Outlet-ID")
+}
+
+// resolveOutlet returns the outlet a new record belongs to: the given ID,
+// else the requested outlet, else the user's only outlet or the only outlet
+// there is. The outlet must be active and one the user works at.
+func resolveOutlet(c *gin.Context, db *gorm.DB, given string) (uint, error) {
+	allowed, err := userOutletIDs(c, db)
+	if err != nil {
+		return 0, err
+	}
+
+	if given == "" || given == "0" {
+		given = requestedOutlet(c)
+	}
+	if given == "" {
+		if len(allowed) == 1 {
+			given = strconv.FormatUint(uint64(allowed[0]), 10)
+		} else {
+			var outlets []models.Outlet
+			if err := db.Where("is_active = ?", true).Limit(2).Find(&outlets).Error; err != nil {
+				return 0, err
+			}
+			if len(outlets) != 1 {
+				return 0, errOutletRequired
+			}
+			given = strconv.FormatUint(uint64(outlets[0].ID), 10)
+		}
+	}
+
+	id, err := strconv.ParseUint(given, 10, 64)
+	if err != nil {
+		return 0, errOutletNotFound
+	}
+	var outlet models.Outlet
+	if err := db.Where("is_active = ?", true).First(&outlet, id).Error; err != nil {
+		return 0, errOutletNotFound
+	}
+	if allowed != nil && !containsID(allowed, outlet.ID) {
+		return 0, errOutletForbidden
+	}
+	return outlet.ID, nil
+}
+
+// resolveOutletID is resolveOutlet for an optional ID from a request body
+func resolveOutletID(c *gin.Context, db *gorm.DB, given *uint) (uint, error) {
+	if given == nil {
+		return resolveOutlet(c, db, "")
+	}
+	return resolveOutlet(c, db, strconv.FormatUint(uint64(*given), 10))
+}
+
+// readOutletScope returns the outlets a list or report covers: the requested
+// outlet, or, consolidated, every outlet the user works at
+func readOutletScope(c *gin.Context, db *gorm.DB) (outletScope, error) {
+	allowed, err := userOutletIDs(c, db)
+	if err != nil {
+		return outletScope{}, err
+	}
+
+	requested := requestedOutlet(c)
+	if requested == "" {
+		return outletScope{all: allowed == nil, ids: allowed}, nil
+	}
+
+	id, err := strconv.ParseUint(requested, 10, 64)
+	if err != nil {
+		return outletScope{}, errOutletNotFound
+	}
+	if allowed != nil && !containsID(allowed, uint(id)) {
+		return outletScope{}, errOutletForbidden
+	}
+	return outletScope{ids: []uint{uint(id)}}, nil
+}
+
+// userOutletScope returns the outlets the user works at. Records loaded by ID
+// are limited to it, so those of another outlet are not found.
+func userOutletScope(c *gin.Context, db *gorm.DB) (outletScope, error) {
+	allowed, err := userOutletIDs(c, db)
+	if err != nil {
+		return outletScope{}, err
+	}
+	return outletScope{all: allowed == nil, ids: allowed}, nil
+}
+
+func respondOutletError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOutletForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errOutletRequired), errors.Is(err, errOutletNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlets"})
+	}
+}
+
+// outletStockQty returns the stock on hand at an outlet, keyed by ingredient
+// ID. A nil ingredientIDs returns every ingredient stocked there.
+func outletStockQty(db *gorm.DB, outletID uint, ingredientIDs []uint) (map[uint]float64, error) {
+	query := db.Where("outlet_id = ?", outletID)
+	if ingredientIDs != nil {
+		query = query.Where("ingredient_id IN ?", ingredientIDs)
+	}
+
+	var rows []models.OutletStock
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	stock := make(map[uint]float64, len(rows))
+	for _, row := range rows {
+		stock[row.IngredientID] = row.StockQty
+	}
+	return stock, nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PriceChangeHandler struct {
+	db *gorm.DB
+}
+
+type PriceChangeRequest struct {
+	MenuItemID  *uint     `json:"menu_item_id"`
+	AddOnID     *uint     `json:"add_on_id"`
+	Price       float64   `json:"price" binding:"min=0"`
+	EffectiveAt time.Time `json:"effective_at" binding:"required"`
+	Notes       string    `json:"notes"`
+}
+
+func NewPriceChangeHandler(db *gorm.DB) *PriceChangeHandler {
+	return &PriceChangeHandler{db: db}
+}
+
+func (h *PriceChangeHandler) GetPriceChanges(c *gin.Context) {
+	var changes []models.PriceChange
+
+	query := h.db.WithContext(c).Model(&models.PriceChange{}).Preload("MenuItem").Preload("AddOn").Preload("User")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if menuItemID := c.Query("menu_item_id"); menuItemID != "" {
+		query = query.Where("menu_item_id = ?", menuItemID)
+	}
+	if addOnID := c.Query("add_on_id"); addOnID != "" {
+		query = query.Where("add_on_id = ?", addOnID)
+	}
+
+	if err := query.Order("effective_at, id").Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price changes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// CreatePriceChange schedules a new price for a menu item or add-on
+func (h *PriceChangeHandler) CreatePriceChange(c *gin.Context) {
+	var req PriceChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case req.MenuItemID != nil && req.AddOnID == nil:
+		var menuItem models.MenuItem
+		if err := h.db.WithContext(c).First(&menuItem, *req.MenuItemID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Menu item not found"})
+			return
+		}
+	case req.AddOnID != nil && req.MenuItemID == nil:
+		var addOn models.AddOn
+		if err := h.db.WithContext(c).First(&addOn, *req.AddOnID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Add-on not found"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either menu_item_id or add_on_id is required"})
+		return
+	}
+
+	if !req.EffectiveAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "effective_at must be in the future"})
+		return
+	}
+
+	change := models.PriceChange{
+		MenuItemID:  req.MenuItemID,
+		AddOnID:     req.AddOnID,
+		Price:       req.Price,
+		EffectiveAt: req.EffectiveAt,
+		Status:      "pending",
+		Notes:       req.Notes,
+		UserID:      currentUserID(c),
+	}
+
+	if err := h.db.WithContext(c).Create(&change).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule price change"})
+		return
+	}
+
+	h.db.WithContext(c).Preload("MenuItem").Preload("AddOn").Preload("User").First(&change, change.ID)
+
+	c.JSON(http.StatusCreated, change)
+}
+
+// CancelPriceChange cancels a price change that has not been applied yet
+func (h *PriceChangeHandler) CancelPriceChange(c *gin.Context) {
+	var change models.PriceChange
+	if err := h.db.WithContext(c).First(&change, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Price change not found"})
+		return
+	}
+
+	if change.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending price changes can be cancelled"})
+		return
+	}
+
+	// Guard against the scheduler applying it in the meantime
+	result := h.db.WithContext(c).Model(&models.PriceChange{}).
+		Where("id = ? AND status = ?", change.ID, "pending").
+		Update("status", "cancelled")
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel price change"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending price changes can be cancelled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price change cancelled successfully"})
+}
+
+// GetMenuItemPriceHistory returns the price and COGS history of a menu item
+// with its pending price changes
+func (h *PriceChangeHandler) GetMenuItemPriceHistory(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	h.respondPriceHistory(c, "menu_item_id", menuItem.ID, menuItem.Name, menuItem.Price, menuItem.COGS)
+}
+
+// GetAddOnPriceHistory returns the price and COGS history of an add-on with
+// its pending price changes
+func (h *PriceChangeHandler) GetAddOnPriceHistory(c *gin.Context) {
+	var addOn models.AddOn
+	if err := h.db.WithContext(c).First(&addOn, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Add-on not found"})
+		return
+	}
+
+	h.respondPriceHistory(c, "add_on_id", addOn.ID, addOn.Name, addOn.Price, addOn.COGS)
+}
+
+func (h *PriceChangeHandler) respondPriceHistory(c *gin.Context, ownerColumn string, ownerID uint, name string, price, cogs float64) {
+	query := h.db.WithContext(c).Preload("User").Where(ownerColumn+" = ?", ownerID)
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("created_at < ?::date + INTERVAL '1 day'", endDate)
+	}
+
+	var history []models.PriceHistory
+	if err := query.Order("created_at, id").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+	for i := range history {
+		history[i].Margin = marginPercent(history[i].Price, history[i].COGS)
+	}
+
+	var scheduled []models.PriceChange
+	if err := h.db.WithContext(c).Preload("User").
+		Where(ownerColumn+" = ? AND status = ?", ownerID, "pending").
+		Order("effective_at, id").
+		Find(&scheduled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price changes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		ownerColumn: ownerID,
+		"name":      name,
+		"current": gin.H{
+			"price":  price,
+			"cogs":   cogs,
+			"margin": marginPercent(price, cogs),
+		},
+		"history":   history,
+		"scheduled": scheduled,
+	})
+}
+
+// ApplyDuePriceChanges applies every pending price change whose effective time
+// has passed, oldest first, and returns how many were applied. Changes for
+// deleted items are cancelled. Rows are locked so that several instances can
+// run it at once.
+func ApplyDuePriceChanges(db *gorm.DB, now time.Time) (int, error) {
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var changes []models.PriceChange
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND effective_at <= ?", "pending", now).
+		Order("effective_at, id").
+		Find(&changes).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	applied := 0
+	for _, change := range changes {
+		ok, err := applyPriceChange(tx, change)
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("price change %d: %w", change.ID, err)
+		}
+
+		updates := map[string]interface{}{"status": "cancelled"}
+		if ok {
+			updates = map[string]interface{}{"status": "applied", "applied_at": now}
+			applied++
+		}
+		if err := tx.Model(&models.PriceChange{}).Where("id = ?", change.ID).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return applied, nil
+}
+
+// applyPriceChange sets the new price and records it in the price history. It
+// returns false if the menu item or add-on no longer exists; any other error
+// is returned so the change is tried again on the next tick.
+func applyPriceChange(tx *gorm.DB, change models.PriceChange) (bool, error) {
+	if change.MenuItemID != nil {
+		var menuItem models.MenuItem
+		if err := tx.First(&menuItem, *change.MenuItemID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		if err := tx.Model(&menuItem).Update("price", change.Price).Error; err != nil {
+			return false, err
+		}
+		return true, recordPriceHistory(tx, models.PriceHistory{
+			MenuItemID:    &menuItem.ID,
+			Price:         change.Price,
+			COGS:          menuItem.COGS,
+			Source:        "scheduled",
+			PriceChangeID: &change.ID,
+			UserID:        change.UserID,
+		})
+	}
+
+	var addOn models.AddOn
+	if err := tx.First(&addOn, change.AddOnID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := tx.Model(&addOn).Update("price", change.Price).Error; err != nil {
+		return false, err
+	}
+	return true, recordPriceHistory(tx, models.PriceHistory{
+		AddOnID:       &addOn.ID,
+		Price:         change.Price,
+		COGS:          addOn.COGS,
+		Source:        "scheduled",
+		PriceChangeID: &change.ID,
+		UserID:        change.UserID,
+	})
+}
+
+// recordPriceHistory appends an entry to the price history of a menu item or
+// add-on, unless its price and COGS are the same as in the latest entry
+func recordPriceHistory(tx *gorm.DB, entry models.PriceHistory) error {
+	query := tx.Where("menu_item_id = ?", entry.MenuItemID)
+	if entry.AddOnID != nil {
+		query = tx.Where("add_on_id = ?", entry.AddOnID)
+	}
+
+	var latest models.PriceHistory
+	err := query.Order("created_at DESC, id DESC").First(&latest).Error
+	if err == nil && latest.Price == entry.Price && latest.COGS == entry.COGS {
+		return nil
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	return tx.Create(&entry).Error
+}
+
+// recordMenuItemPrice records the current price and COGS of a menu item
+func recordMenuItemPrice(tx *gorm.DB, menuItem models.MenuItem, source string, userID *uint) error {
+	return recordPriceHistory(tx, models.PriceHistory{
+		MenuItemID: &menuItem.ID,
+		Price:      menuItem.Price,
+		COGS:       menuItem.COGS,
+		Source:     source,
+		UserID:     userID,
+	})
+}
+
+// recordAddOnPrice records the current price and COGS of an add-on
+func recordAddOnPrice(tx *gorm.DB, addOn models.AddOn, source string, userID *uint) error {
+	return recordPriceHistory(tx, models.PriceHistory{
+		AddOnID: &addOn.ID,
+		Price:   addOn.Price,
+		COGS:    addOn.COGS,
+		Source:  source,
+		UserID:  userID,
+	})
+}
+
+// updateMenuItemCOGS sets the COGS of a menu item and records the change
+func updateMenuItemCOGS(tx *gorm.DB, menuItem *models.MenuItem, cogs float64, source string, userID *uint) error {
+	if menuItem.COGS == cogs {
+		return nil
+	}
+	if err := tx.Model(menuItem).Update("cogs", cogs).Error; err != nil {
+		return err
+	}
+	menuItem.COGS = cogs
+	return recordMenuItemPrice(tx, *menuItem, source, userID)
+}
+
+// updateAddOnCOGS sets the COGS of an add-on from its recipe and records the change
+func updateAddOnCOGS(tx *gorm.DB, addOn *models.AddOn, cogs float64, userID *uint) error {
+	if addOn.COGS == cogs {
+		return nil
+	}
+	if err := tx.Model(addOn).Update("cogs", cogs).Error; err != nil {
+		return err
+	}
+	addOn.COGS = cogs
+	return recordAddOnPrice(tx, *addOn, "recipe", userID)
+}
+
+func marginPercent(price, cogs float64) float64 {
+	if price <= 0 {
+		return 0
+	}
+	return ((price - cogs) / price) * 100
+}
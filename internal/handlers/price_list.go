@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PriceListHandler struct {
+	db *gorm.DB
+}
+
+type PriceListItemRequest struct {
+	MenuItemID *uint   `json:"menu_item_id"`
+	AddOnID    *uint   `json:"add_on_id"`
+	Price      float64 `json:"price" binding:"min=0"`
+}
+
+type PriceListRequest struct {
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description"`
+	Channel     string                 `json:"channel"`
+	OrderType   string                 `json:"order_type" binding:"omitempty,oneof=dine_in takeaway delivery"`
+	IsActive    *bool                  `json:"is_active"`
+	Items       []PriceListItemRequest `json:"items" binding:"dive"`
+}
+
+func NewPriceListHandler(db *gorm.DB) *PriceListHandler {
+	return &PriceListHandler{db: db}
+}
+
+func (h *PriceListHandler) GetPriceLists(c *gin.Context) {
+	var priceLists []models.PriceList
+
+	query := h.db.WithContext(c).Model(&models.PriceList{})
+	if channel := c.Query("channel"); channel != "" {
+		query = query.Where("channel = ?", normalizeChannel(channel))
+	}
+	if active := c.Query("active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	if err := query.Order("name").Find(&priceLists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price lists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, priceLists)
+}
+
+func (h *PriceListHandler) GetPriceList(c *gin.Context) {
+	var priceList models.PriceList
+	if err := h.db.WithContext(c).Preload("Items.MenuItem").Preload("Items.AddOn").First(&priceList, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Price list not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, priceList)
+}
+
+func (h *PriceListHandler) CreatePriceList(c *gin.Context) {
+	var req PriceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	priceList := models.PriceList{IsActive: true}
+	applyPriceListRequest(&priceList, req)
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Omit("Items").Create(&priceList).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create price list"})
+		return
+	}
+
+	if err := replacePriceListItems(tx, priceList.ID, req.Items); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	h.db.WithContext(c).Preload("Items.MenuItem").Preload("Items.AddOn").First(&priceList, priceList.ID)
+
+	c.JSON(http.StatusCreated, priceList)
+}
+
+func (h *PriceListHandler) UpdatePriceList(c *gin.Context) {
+	var priceList models.PriceList
+	if err := h.db.WithContext(c).First(&priceList, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Price list not found"})
+		return
+	}
+
+	var req PriceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	applyPriceListRequest(&priceList, req)
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Omit("Items").Save(&priceList).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update price list"})
+		return
+	}
+
+	if err := replacePriceListItems(tx, priceList.ID, req.Items); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	h.GetPriceList(c)
+}
+
+func (h *PriceListHandler) DeletePriceList(c *gin.Context) {
+	id := c.Param("id")
+
+	var pendingOrders int64
+	h.db.WithContext(c).Model(&models.Transaction{}).Where("price_list_id = ? AND status = ?", id, "pending").Count(&pendingOrders)
+	if pendingOrders > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price list is used by pending transactions"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Delete(&models.PriceList{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete price list"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price list deleted successfully"})
+}
+
+func applyPriceListRequest(priceList *models.PriceList, req PriceListRequest) {
+	priceList.Name = req.Name
+	priceList.Description = req.Description
+	priceList.Channel = normalizeChannel(req.Channel)
+	priceList.OrderType = req.OrderType
+	if req.IsActive != nil {
+		priceList.IsActive = *req.IsActive
+	}
+}
+
+// replacePriceListItems replaces the overrides of a price list. Each item names
+// exactly one menu item or add-on, at most once.
+func replacePriceListItems(tx *gorm.DB, priceListID uint, items []PriceListItemRequest) error {
+	if err := tx.Where("price_list_id = ?", priceListID).Delete(&models.PriceListItem{}).Error; err != nil {
+		return err
+	}
+
+	seenMenuItems := make(map[uint]bool)
+	seenAddOns := make(map[uint]bool)
+	for _, itemReq := range items {
+		switch {
+		case itemReq.MenuItemID != nil && itemReq.AddOnID == nil:
+			if seenMenuItems[*itemReq.MenuItemID] {
+				return fmt.Errorf("Menu item %d is listed more than once", *itemReq.MenuItemID)
+			}
+			seenMenuItems[*itemReq.MenuItemID] = true
+
+			var menuItem models.MenuItem
+			if err := tx.First(&menuItem, *itemReq.MenuItemID).Error; err != nil {
+				return fmt.Errorf("Menu item %d not found", *itemReq.MenuItemID)
+			}
+		case itemReq.AddOnID != nil && itemReq.MenuItemID == nil:
+			if seenAddOns[*itemReq.AddOnID] {
+				return fmt.Errorf("Add-on %d is listed more than once", *itemReq.AddOnID)
+			}
+			seenAddOns[*itemReq.AddOnID] = true
+
+			var addOn models.AddOn
+			if err := tx.First(&addOn, *itemReq.AddOnID).Error; err != nil {
+				return fmt.Errorf("Add-on %d not found", *itemReq.AddOnID)
+			}
+		default:
+			return fmt.Errorf("Each price list item needs either menu_item_id or add_on_id")
+		}
+
+		item := models.PriceListItem{
+			PriceListID: priceListID,
+			MenuItemID:  itemReq.MenuItemID,
+			AddOnID:     itemReq.AddOnID,
+			Price:       itemReq.Price,
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func normalizeChannel(channel string) string {
+	return strings.ToLower(strings.TrimSpace(channel))
+}
+
+// resolvePriceList returns the price list for a new order: the requested one
+// if given, otherwise the active list that best fits its channel and order
+// type. It returns nil when base prices apply.
+func resolvePriceList(db *gorm.DB, priceListID *uint, channel, orderType string) (*models.PriceList, error) {
+	if priceListID != nil {
+		var priceList models.PriceList
+		if err := db.Preload("Items").First(&priceList, *priceListID).Error; err != nil {
+			return nil, fmt.Errorf("Price list %d not found", *priceListID)
+		}
+		if !priceList.IsActive {
+			return nil, fmt.Errorf("Price list %s is not active", priceList.Name)
+		}
+		return &priceList, nil
+	}
+
+	var priceLists []models.PriceList
+	if err := db.Where("is_active = ?", true).Find(&priceLists).Error; err != nil {
+		return nil, err
+	}
+
+	priceList := models.SelectPriceList(priceLists, channel, orderType)
+	if priceList == nil {
+		return nil, nil
+	}
+	if err := db.Where("price_list_id = ?", priceList.ID).Find(&priceList.Items).Error; err != nil {
+		return nil, err
+	}
+	return priceList, nil
+}
+
+// transactionPriceList returns the price list a transaction was created with,
+// even if it has since been deactivated or deleted
+func transactionPriceList(db *gorm.DB, transaction models.Transaction) (*models.PriceList, error) {
+	if transaction.PriceListID == nil {
+		return nil, nil
+	}
+
+	var priceList models.PriceList
+	if err := db.Unscoped().Preload("Items").First(&priceList, *transaction.PriceListID).Error; err != nil {
+		return nil, err
+	}
+	return &priceList, nil
+}
+
+// priceListParam loads the price list named by a price_list query parameter,
+// given as an ID or a name
+func priceListParam(db *gorm.DB, value string) (*models.PriceList, error) {
+	query := db.Preload("Items")
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("name = ?", value)
+	}
+
+	var priceList models.PriceList
+	if err := query.First(&priceList).Error; err != nil {
+		return nil, err
+	}
+	return &priceList, nil
+}
+
+// applyMenuItemPrices replaces the base prices of a menu item and its add-ons
+// with those of a price list and recalculates the margins
+func applyMenuItemPrices(menuItem *models.MenuItem, priceList *models.PriceList) {
+	menuItem.Price = priceList.MenuItemPrice(*menuItem)
+	for i := range menuItem.AddOns {
+		addOn := &menuItem.AddOns[i]
+		addOn.Price = priceList.AddOnPrice(*addOn)
+		if addOn.Price > 0 {
+			addOn.Margin = ((addOn.Price - addOn.COGS) / addOn.Price) * 100
+		}
+	}
+}
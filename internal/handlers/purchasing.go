@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pos-system/internal/events"
+	"pos-system/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PurchasingHandler struct {
+	db     *gorm.DB
+	events *events.Dispatcher
+}
+
+type SupplierRequest struct {
+	Name        string `json:"name" binding:"required"`
+	ContactName string `json:"contact_name"`
+	Phone       string `json:"phone"`
+	Email       string `json:"email" binding:"omitempty,email"`
+	Address     string `json:"address"`
+	Notes       string `json:"notes"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+type PurchaseOrderLineRequest struct {
+	IngredientID uint    `json:"ingredient_id" binding:"required"`
+	Quantity     float64 `json:"quantity" binding:"required,gt=0"`
+	UnitCost     float64 `json:"unit_cost" binding:"min=0"`
+}
+
+type PurchaseOrderRequest struct {
+	SupplierID uint                       `json:"supplier_id" binding:"required"`
+	OutletID   *uint                      `json:"outlet_id"` // Outlet the goods are delivered to
+	Notes      string                     `json:"notes"`
+	ExpectedAt *time.Time                 `json:"expected_at"`
+	Lines      []PurchaseOrderLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type ReceiveLineRequest struct {
+	LineID   uint     `json:"line_id" binding:"required"`
+	Quantity float64  `json:"quantity" binding:"required,gt=0"`
+	UnitCost *float64 `json:"unit_cost" binding:"omitempty,min=0"` // Invoiced price, defaults to the ordered price
+}
+
+type ReceivePurchaseOrderRequest struct {
+	Lines []ReceiveLineRequest `json:"lines" binding:"required,min=1,dive"`
+	Notes string               `json:"notes"`
+}
+
+func NewPurchasingHandler(db *gorm.DB, dispatcher *events.Dispatcher) *PurchasingHandler {
+	return &PurchasingHandler{db: db, events: dispatcher}
+}
+
+// Suppliers
+func (h *PurchasingHandler) GetSuppliers(c *gin.Context) {
+	var suppliers []models.Supplier
+
+	query := h.db.WithContext(c).Model(&models.Supplier{})
+	if search := c.Query("search"); search != "" {
+		query = query.Where("name ILIKE ? OR contact_name ILIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+	if active := c.Query("active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	if err := query.Order("name").Find(&suppliers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, suppliers)
+}
+
+func (h *PurchasingHandler) GetSupplier(c *gin.Context) {
+	var supplier models.Supplier
+	if err := h.db.WithContext(c).First(&supplier, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, supplier)
+}
+
+func (h *PurchasingHandler) CreateSupplier(c *gin.Context) {
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	supplier := models.Supplier{IsActive: true}
+	applySupplierRequest(&supplier, req)
+
+	if err := h.db.WithContext(c).Create(&supplier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create supplier"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, supplier)
+}
+
+func (h *PurchasingHandler) UpdateSupplier(c *gin.Context) {
+	var supplier models.Supplier
+	if err := h.db.WithContext(c).First(&supplier, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	applySupplierRequest(&supplier, req)
+
+	if err := h.db.WithContext(c).Save(&supplier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update supplier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, supplier)
+}
+
+func (h *PurchasingHandler) DeleteSupplier(c *gin.Context) {
+	id := c.Param("id")
+
+	var openOrders int64
+	h.db.WithContext(c).Model(&models.PurchaseOrder{}).
+		Where("supplier_id = ? AND status IN ?", id, []string{"draft", "sent", "partially_received"}).
+		Count(&openOrders)
+	if openOrders > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier has open purchase orders"})
+		return
+	}
+
+	if err := h.db.WithContext(c).Delete(&models.Supplier{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete supplier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Supplier deleted successfully"})
+}
+
+// GetSupplierSpend reports what was spent with each supplier, from the
+// expenses created when purchase orders are received
+func (h *PurchasingHandler) GetSupplierSpend(c *gin.Context) {
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+
+	query := h.db.WithContext(c).Table("expenses").
+		Select(`suppliers.id AS supplier_id, suppliers.name AS supplier_name,
+			COUNT(DISTINCT purchase_orders.id) AS order_count,
+			COUNT(expenses.id) AS receipt_count,
+			COALESCE(SUM(expenses.amount), 0) AS total_spend`).
+		Joins("JOIN purchase_orders ON expenses.purchase_order_id = purchase_orders.id").
+		Joins("JOIN suppliers ON purchase_orders.supplier_id = suppliers.id").
+		Where("expenses.deleted_at IS NULL")
+
+	if startDate != "" {
+		query = query.Where("expenses.date >= ?", startDate)
+	}
+	if endDate != "" {
+		query = query.Where("expenses.date < ?::date + INTERVAL '1 day'", endDate)
+	}
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		query = query.Where("suppliers.id = ?", supplierID)
+	}
+
+	var spend []struct {
+		SupplierID   uint    `json:"supplier_id"`
+		SupplierName string  `json:"supplier_name"`
+		OrderCount   int64   `json:"order_count"`
+		ReceiptCount int64   `json:"receipt_count"`
+		TotalSpend   float64 `json:"total_spend"`
+	}
+	if err := query.Group("suppliers.id, suppliers.name").Order("total_spend DESC").Scan(&spend).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier spend"})
+		return
+	}
+
+	var total float64
+	for _, row := range spend {
+		total += row.TotalSpend
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"suppliers":   spend,
+		"total_spend": total,
+	})
+}
+
+// Purchase orders
+func (h *PurchasingHandler) GetPurchaseOrders(c *gin.Context) {
+	var orders []models.PurchaseOrder
+
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	query := h.db.WithContext(c).Model(&models.PurchaseOrder{}).Preload("Supplier").Where(scope.clause("outlet_id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+
+	if err := query.Order("created_at DESC").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+func (h *PurchasingHandler) GetPurchaseOrder(c *gin.Context) {
+	var order models.PurchaseOrder
+	if err := preloadPurchaseOrder(h.db.WithContext(c)).First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *PurchasingHandler) CreatePurchaseOrder(c *gin.Context) {
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := h.db.WithContext(c).First(&supplier, req.SupplierID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier not found"})
+		return
+	}
+	if !supplier.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier is not active"})
+		return
+	}
+
+	outletID, err := resolveOutletID(c, h.db.WithContext(c), req.OutletID)
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	order := models.PurchaseOrder{
+		PONumber:   fmt.Sprintf("PO-%d", time.Now().Unix()),
+		SupplierID: supplier.ID,
+		OutletID:   &outletID,
+		Status:     "draft",
+		Notes:      req.Notes,
+		ExpectedAt: req.ExpectedAt,
+	}
+	if userID := currentUserID(c); userID != nil {
+		order.UserID = *userID
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Create(&order).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase order"})
+		return
+	}
+
+	if err := replacePurchaseOrderLines(tx, &order, req.Lines); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	preloadPurchaseOrder(h.db.WithContext(c)).First(&order, order.ID)
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func (h *PurchasingHandler) UpdatePurchaseOrder(c *gin.Context) {
+	var order models.PurchaseOrder
+	if err := h.db.WithContext(c).First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	if order.Status != "draft" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only draft purchase orders can be updated"})
+		return
+	}
+
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := h.db.WithContext(c).First(&supplier, req.SupplierID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	order.SupplierID = supplier.ID
+	order.Notes = req.Notes
+	order.ExpectedAt = req.ExpectedAt
+
+	tx := h.db.WithContext(c).Begin()
+	if err := replacePurchaseOrderLines(tx, &order, req.Lines); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	h.GetPurchaseOrder(c)
+}
+
+func (h *PurchasingHandler) DeletePurchaseOrder(c *gin.Context) {
+	var order models.PurchaseOrder
+	if err := h.db.WithContext(c).First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	if order.Status != "draft" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only draft purchase orders can be deleted"})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Where("purchase_order_id = ?", order.ID).Delete(&models.PurchaseOrderLine{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete purchase order"})
+		return
+	}
+	if err := tx.Delete(&order).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete purchase order"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Purchase order deleted successfully"})
+}
+
+// SendPurchaseOrder marks a draft purchase order as sent to the supplier
+func (h *PurchasingHandler) SendPurchaseOrder(c *gin.Context) {
+	var order models.PurchaseOrder
+	if err := h.db.WithContext(c).First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	if order.Status != "draft" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Purchase order has already been sent"})
+		return
+	}
+
+	now := time.Now()
+	if err := h.db.WithContext(c).Model(&order).Updates(map[string]interface{}{
+		"status":  "sent",
+		"sent_at": now,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order"})
+		return
+	}
+
+	h.GetPurchaseOrder(c)
+}
+
+// ReceivePurchaseOrder receives goods against a sent purchase order. Each line
+// records a purchase stock movement, and the receipt creates one raw material
+// expense linked to the purchase order.
+func (h *PurchasingHandler) ReceivePurchaseOrder(c *gin.Context) {
+	var req ReceivePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var order models.PurchaseOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Supplier").First(&order, c.Param("id")).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+
+	if order.Status != "sent" && order.Status != "partially_received" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only sent purchase orders can be received"})
+		return
+	}
+
+	var lines []models.PurchaseOrderLine
+	if err := tx.Preload("Ingredient").Where("purchase_order_id = ?", order.ID).Order("id").Find(&lines).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase order lines"})
+		return
+	}
+
+	lineIndex := make(map[uint]int, len(lines))
+	for i, line := range lines {
+		lineIndex[line.ID] = i
+	}
+
+	userID := currentUserID(c)
+	var amount float64
+	var received []string
+	var ingredientIDs []uint
+	for _, receiveReq := range req.Lines {
+		i, ok := lineIndex[receiveReq.LineID]
+		if !ok {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Line %d is not on this purchase order", receiveReq.LineID)})
+			return
+		}
+		line := &lines[i]
+
+		unitCost := line.UnitCost
+		if receiveReq.UnitCost != nil {
+			unitCost = *receiveReq.UnitCost
+		}
+
+		movement := models.StockMovement{
+			IngredientID:    line.IngredientID,
+			OutletID:        order.OutletID,
+			Type:            "purchase",
+			Quantity:        receiveReq.Quantity,
+			UnitCost:        unitCost,
+			Reason:          fmt.Sprintf("%s from %s", order.PONumber, order.Supplier.Name),
+			UserID:          userID,
+			PurchaseOrderID: &order.ID,
+		}
+		if err := recordStockMovement(tx, &movement); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock movement"})
+			return
+		}
+
+		line.ReceivedQty += receiveReq.Quantity
+		if err := tx.Model(line).Update("received_qty", line.ReceivedQty).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order line"})
+			return
+		}
+
+		amount += movement.TotalCost
+		received = append(received, fmt.Sprintf("%s %g %s", line.Ingredient.Name, receiveReq.Quantity, line.Ingredient.Unit))
+		ingredientIDs = append(ingredientIDs, line.IngredientID)
+	}
+
+	description := fmt.Sprintf("%s: %s", order.PONumber, strings.Join(received, ", "))
+	if req.Notes != "" {
+		description += " (" + req.Notes + ")"
+	}
+
+	expense := models.Expense{
+		Type:            "raw_material",
+		Category:        order.Supplier.Name,
+		Description:     description,
+		Amount:          amount,
+		Date:            time.Now(),
+		OutletID:        order.OutletID,
+		PurchaseOrderID: &order.ID,
+	}
+	if userID != nil {
+		expense.UserID = *userID
+	}
+	if err := tx.Create(&expense).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase expense"})
+		return
+	}
+
+	updates := map[string]interface{}{"status": models.ReceiptStatus(lines)}
+	if updates["status"] == "received" {
+		updates["received_at"] = time.Now()
+	}
+	if err := tx.Model(&order).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order"})
+		return
+	}
+
+	alerts, err := refreshStockStatus(tx, uniqueIDs(ingredientIDs))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock status"})
+		return
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
+	h.GetPurchaseOrder(c)
+}
+
+func applySupplierRequest(supplier *models.Supplier, req SupplierRequest) {
+	supplier.Name = req.Name
+	supplier.ContactName = req.ContactName
+	supplier.Phone = req.Phone
+	supplier.Email = req.Email
+	supplier.Address = req.Address
+	supplier.Notes = req.Notes
+	if req.IsActive != nil {
+		supplier.IsActive = *req.IsActive
+	}
+}
+
+func preloadPurchaseOrder(db *gorm.DB) *gorm.DB {
+	return db.Preload("Supplier").Preload("User").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Lines.Ingredient")
+}
+
+// replacePurchaseOrderLines replaces the lines of a draft purchase order and
+// saves the order with its new total
+func replacePurchaseOrderLines(tx *gorm.DB, order *models.PurchaseOrder, lines []PurchaseOrderLineRequest) error {
+	if err := tx.Where("purchase_order_id = ?", order.ID).Delete(&models.PurchaseOrderLine{}).Error; err != nil {
+		return err
+	}
+
+	var total float64
+	for _, lineReq := range lines {
+		var ingredient models.Ingredient
+		if err := tx.First(&ingredient, lineReq.IngredientID).Error; err != nil {
+			return fmt.Errorf("Ingredient %d not found", lineReq.IngredientID)
+		}
+
+		line := models.PurchaseOrderLine{
+			PurchaseOrderID: order.ID,
+			IngredientID:    ingredient.ID,
+			Quantity:        lineReq.Quantity,
+			UnitCost:        lineReq.UnitCost,
+		}
+		if err := tx.Create(&line).Error; err != nil {
+			return err
+		}
+		total += lineReq.Quantity * lineReq.UnitCost
+	}
+
+	order.Total = total
+	order.Lines = nil
+	return tx.Omit("Supplier", "User", "Lines").Save(order).Error
+}
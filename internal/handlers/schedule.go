@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"pos-system/pkg/schedule"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ScheduleRequest struct {
+	Name      string         `json:"name"`
+	Days      []time.Weekday `json:"days"`       // 0 = Sunday; empty means every day
+	StartTime string         `json:"start_time"` // HH:MM
+	EndTime   string         `json:"end_time"`   // HH:MM
+	StartDate string         `json:"start_date"` // YYYY-MM-DD
+	EndDate   string         `json:"end_date"`   // YYYY-MM-DD
+}
+
+type UpdateSchedulesRequest struct {
+	Schedules []ScheduleRequest `json:"schedules"`
+}
+
+// offSchedule holds the IDs of everything that has schedules but is outside
+// all of them at a given time
+type offSchedule struct {
+	menuItems  map[uint]bool
+	categories map[uint]bool
+	addOns     map[uint]bool
+}
+
+func (h *MenuHandler) GetMenuItemSchedules(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	respondSchedules(c, h.db.WithContext(c), "menu_item_id", menuItem.ID, h.location)
+}
+
+func (h *MenuHandler) UpdateMenuItemSchedules(c *gin.Context) {
+	var menuItem models.MenuItem
+	if err := h.db.WithContext(c).First(&menuItem, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu item not found"})
+		return
+	}
+
+	updateSchedules(c, h.db.WithContext(c), "menu_item_id", menuItem.ID, h.location)
+}
+
+func (h *MenuHandler) GetCategorySchedules(c *gin.Context) {
+	var category models.Category
+	if err := h.db.WithContext(c).First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	respondSchedules(c, h.db.WithContext(c), "category_id", category.ID, h.location)
+}
+
+func (h *MenuHandler) UpdateCategorySchedules(c *gin.Context) {
+	var category models.Category
+	if err := h.db.WithContext(c).First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	updateSchedules(c, h.db.WithContext(c), "category_id", category.ID, h.location)
+}
+
+func (h *AddOnHandler) GetAddOnSchedules(c *gin.Context) {
+	var addOn models.AddOn
+	if err := h.db.WithContext(c).First(&addOn, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Add-on not found"})
+		return
+	}
+
+	respondSchedules(c, h.db.WithContext(c), "add_on_id", addOn.ID, h.location)
+}
+
+func (h *AddOnHandler) UpdateAddOnSchedules(c *gin.Context) {
+	var addOn models.AddOn
+	if err := h.db.WithContext(c).First(&addOn, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Add-on not found"})
+		return
+	}
+
+	updateSchedules(c, h.db.WithContext(c), "add_on_id", addOn.ID, h.location)
+}
+
+func respondSchedules(c *gin.Context, db *gorm.DB, ownerColumn string, ownerID uint, location *time.Location) {
+	var schedules []models.AvailabilitySchedule
+	if err := db.Where(ownerColumn+" = ?", ownerID).Order("id").Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedules": schedules,
+		"timezone":  location.String(),
+		"open_now":  schedule.Open(scheduleWindows(schedules), time.Now().In(location)),
+	})
+}
+
+// updateSchedules replaces the schedules owned by ownerColumn = ownerID
+func updateSchedules(c *gin.Context, db *gorm.DB, ownerColumn string, ownerID uint, location *time.Location) {
+	var req UpdateSchedulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedules := make([]models.AvailabilitySchedule, len(req.Schedules))
+	for i, scheduleReq := range req.Schedules {
+		id := ownerID
+		schedules[i] = models.AvailabilitySchedule{
+			Name:      scheduleReq.Name,
+			Days:      scheduleReq.Days,
+			StartTime: scheduleReq.StartTime,
+			EndTime:   scheduleReq.EndTime,
+			StartDate: scheduleReq.StartDate,
+			EndDate:   scheduleReq.EndDate,
+		}
+		switch ownerColumn {
+		case "menu_item_id":
+			schedules[i].MenuItemID = &id
+		case "category_id":
+			schedules[i].CategoryID = &id
+		case "add_on_id":
+			schedules[i].AddOnID = &id
+		}
+
+		if err := schedules[i].Window().Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Schedule %d: %v", i+1, err)})
+			return
+		}
+	}
+
+	tx := db.Begin()
+	if err := tx.Where(ownerColumn+" = ?", ownerID).Delete(&models.AvailabilitySchedule{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedules"})
+		return
+	}
+	if len(schedules) > 0 {
+		if err := tx.Create(&schedules).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedules"})
+			return
+		}
+	}
+	tx.Commit()
+
+	respondSchedules(c, db, ownerColumn, ownerID, location)
+}
+
+func scheduleWindows(schedules []models.AvailabilitySchedule) []schedule.Window {
+	windows := make([]schedule.Window, len(schedules))
+	for i, s := range schedules {
+		windows[i] = s.Window()
+	}
+	return windows
+}
+
+// loadOffSchedule evaluates every availability schedule at now, which must be
+// in the outlet timezone
+func loadOffSchedule(db *gorm.DB, now time.Time) (offSchedule, error) {
+	var schedules []models.AvailabilitySchedule
+	if err := db.Find(&schedules).Error; err != nil {
+		return offSchedule{}, err
+	}
+
+	menuItems := make(map[uint][]schedule.Window)
+	categories := make(map[uint][]schedule.Window)
+	addOns := make(map[uint][]schedule.Window)
+	for _, s := range schedules {
+		switch {
+		case s.MenuItemID != nil:
+			menuItems[*s.MenuItemID] = append(menuItems[*s.MenuItemID], s.Window())
+		case s.CategoryID != nil:
+			categories[*s.CategoryID] = append(categories[*s.CategoryID], s.Window())
+		case s.AddOnID != nil:
+			addOns[*s.AddOnID] = append(addOns[*s.AddOnID], s.Window())
+		}
+	}
+
+	closed := func(windows map[uint][]schedule.Window) map[uint]bool {
+		ids := make(map[uint]bool)
+		for id, w := range windows {
+			if !schedule.Open(w, now) {
+				ids[id] = true
+			}
+		}
+		return ids
+	}
+
+	// A closed category closes its subcategories too
+	closedCategories := closed(categories)
+	if len(closedCategories) > 0 {
+		var all []models.Category
+		if err := db.Select("id, parent_id").Find(&all).Error; err != nil {
+			return offSchedule{}, err
+		}
+		closedCategories = models.WithDescendants(models.CategoryParents(all), closedCategories)
+	}
+
+	return offSchedule{
+		menuItems:  closed(menuItems),
+		categories: closedCategories,
+		addOns:     closed(addOns),
+	}, nil
+}
+
+// menuItemOffSchedule reports whether the menu item, its category or one of the
+// category's ancestors is outside its schedules
+func (o offSchedule) menuItemOffSchedule(menuItem models.MenuItem) bool {
+	return o.menuItems[menuItem.ID] || o.categories[menuItem.CategoryID]
+}
+
+func (o offSchedule) addOnOffSchedule(addOnID uint) bool {
+	return o.addOns[addOnID]
+}
+
+// checkComponentsOnSchedule returns an error for the first bundle component outside its schedules
+func checkComponentsOnSchedule(off offSchedule, components []bundleComponent) error {
+	for _, component := range components {
+		if off.menuItemOffSchedule(component.MenuItem) {
+			return fmt.Errorf("Menu item %s is not available at this time", component.MenuItem.Name)
+		}
+	}
+	return nil
+}
+
+// checkAddOnAvailable returns an error if the add-on is switched off or outside
+// its schedules
+func checkAddOnAvailable(off offSchedule, addOn models.AddOn) error {
+	if !addOn.IsAvailable {
+		return fmt.Errorf("Add-on %s is not available", addOn.Name)
+	}
+	if off.addOnOffSchedule(addOn.ID) {
+		return fmt.Errorf("Add-on %s is not available at this time", addOn.Name)
+	}
+	return nil
+}
+
+func idList(ids map[uint]bool) []uint {
+	list := make([]uint, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	return list
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"pos-system/internal/models"
+	"pos-system/pkg/textsearch"
+	"strings"
+)
+
+// searchHighlights marks the words of a menu item search result that match
+// the search terms. Name and description are always included; category and
+// tags only when they match.
+func searchHighlights(menuItem models.MenuItem, terms []string) map[string]string {
+	highlights := make(map[string]string, 4)
+	highlights["name"], _ = textsearch.Highlight(menuItem.Name, terms)
+	highlights["description"], _ = textsearch.Highlight(menuItem.Description, terms)
+
+	if category, matched := textsearch.Highlight(menuItem.Category.Name, terms); matched {
+		highlights["category"] = category
+	}
+
+	names := make([]string, len(menuItem.Tags))
+	for i, tag := range menuItem.Tags {
+		names[i] = tag.Name
+	}
+	if tags, matched := textsearch.Highlight(strings.Join(names, ", "), terms); matched {
+		highlights["tags"] = tags
+	}
+
+	return highlights
+}
@@ -0,0 +1,704 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"pos-system/pkg/inventory"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CreateStockMovementRequest struct {
+	IngredientID uint    `json:"ingredient_id" binding:"required"`
+	Type         string  `json:"type" binding:"required,oneof=purchase wastage transfer adjustment"`
+	Quantity     float64 `json:"quantity" binding:"required"` // Positive for purchase and wastage; signed for transfer and adjustment
+	UnitCost     float64 `json:"unit_cost" binding:"min=0"`   // Purchase price per unit; required for purchases
+	Reason       string  `json:"reason"`
+	OutletID     *uint   `json:"outlet_id"` // Defaults to the X-Outlet-ID header or the user's only outlet
+}
+
+type StockTakeLineRequest struct {
+	IngredientID uint     `json:"ingredient_id" binding:"required"`
+	CountedQty   *float64 `json:"counted_qty" binding:"required,min=0"`
+}
+
+type StockTakeRequest struct {
+	OutletID *uint                  `json:"outlet_id"` // Outlet being counted; ignored on update
+	Notes    string                 `json:"notes"`
+	Lines    []StockTakeLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type StockTransferRequest struct {
+	FromOutletID uint                      `json:"from_outlet_id" binding:"required"`
+	ToOutletID   uint                      `json:"to_outlet_id" binding:"required,nefield=FromOutletID"`
+	Reason       string                    `json:"reason"`
+	Lines        []StockTransferLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type StockTransferLineRequest struct {
+	IngredientID uint    `json:"ingredient_id" binding:"required"`
+	Quantity     float64 `json:"quantity" binding:"required,gt=0"`
+}
+
+// Stock movements
+func (h *InventoryHandler) GetStockMovements(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	var movements []models.StockMovement
+	var total int64
+
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	query := h.db.WithContext(c).Model(&models.StockMovement{}).Preload("Ingredient").Preload("User").Where(scope.clause("outlet_id"))
+
+	if ingredientID := c.Query("ingredient_id"); ingredientID != "" {
+		query = query.Where("ingredient_id = ?", ingredientID)
+	}
+	if movementType := c.Query("type"); movementType != "" {
+		query = query.Where("type = ?", movementType)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("created_at < ?::date + INTERVAL '1 day'", endDate)
+	}
+
+	query.Count(&total)
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  movements,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// CreateStockMovement records a manual stock change. Purchases also create the
+// matching raw material expense, so stock purchases should no longer be
+// entered as expenses by hand.
+func (h *InventoryHandler) CreateStockMovement(c *gin.Context) {
+	var req CreateStockMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (req.Type == "purchase" || req.Type == "wastage") && req.Quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be positive for " + req.Type})
+		return
+	}
+	if req.Type != "purchase" && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is required for " + req.Type})
+		return
+	}
+
+	var ingredient models.Ingredient
+	if err := h.db.WithContext(c).First(&ingredient, req.IngredientID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ingredient not found"})
+		return
+	}
+
+	outletID, err := resolveOutletID(c, h.db.WithContext(c), req.OutletID)
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	userID := currentUserID(c)
+	movement := models.StockMovement{
+		IngredientID: ingredient.ID,
+		OutletID:     &outletID,
+		Type:         req.Type,
+		Quantity:     req.Quantity,
+		Reason:       req.Reason,
+		UserID:       userID,
+	}
+	switch req.Type {
+	case "purchase":
+		movement.UnitCost = req.UnitCost
+	case "wastage":
+		movement.Quantity = -req.Quantity
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := recordStockMovement(tx, &movement); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock movement"})
+		return
+	}
+
+	if req.Type == "purchase" {
+		description := fmt.Sprintf("%s - %g %s", ingredient.Name, req.Quantity, ingredient.Unit)
+		if req.Reason != "" {
+			description += " (" + req.Reason + ")"
+		}
+
+		expense := models.Expense{
+			Type:            "raw_material",
+			Category:        ingredient.Name,
+			Description:     description,
+			Amount:          movement.TotalCost,
+			Date:            movement.CreatedAt,
+			OutletID:        &outletID,
+			StockMovementID: &movement.ID,
+		}
+		if userID != nil {
+			expense.UserID = *userID
+		}
+
+		if err := tx.Create(&expense).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase expense"})
+			return
+		}
+	}
+
+	alerts, err := refreshStockStatus(tx, []uint{ingredient.ID})
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock status"})
+		return
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
+	h.db.WithContext(c).Preload("Ingredient").Preload("User").First(&movement, movement.ID)
+
+	c.JSON(http.StatusCreated, movement)
+}
+
+// TransferStock moves stock from one outlet to another. Each line is written
+// to the ledger as a pair of transfer movements, out of one outlet and into
+// the other, so the total stock on hand is unchanged.
+func (h *InventoryHandler) TransferStock(c *gin.Context) {
+	var req StockTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fromID, err := resolveOutletID(c, h.db.WithContext(c), &req.FromOutletID)
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+	var to models.Outlet
+	if err := h.db.WithContext(c).Where("is_active = ?", true).First(&to, req.ToOutletID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Destination outlet not found"})
+		return
+	}
+
+	quantities := make(map[uint]float64)
+	for _, line := range req.Lines {
+		quantities[line.IngredientID] += line.Quantity
+	}
+	ingredientIDs := mapKeys(quantities)
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var ingredients []models.Ingredient
+	if err := tx.Where("id IN ?", ingredientIDs).Find(&ingredients).Error; err != nil || len(ingredients) != len(ingredientIDs) {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ingredient not found"})
+		return
+	}
+
+	var stock []models.OutletStock
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("outlet_id = ? AND ingredient_id IN ?", fromID, ingredientIDs).
+		Find(&stock).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlet stock"})
+		return
+	}
+	onHand := make(map[uint]float64, len(stock))
+	for _, row := range stock {
+		onHand[row.IngredientID] = row.StockQty
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "Stock transfer"
+	}
+	userID := currentUserID(c)
+	movements := make([]models.StockMovement, 0, 2*len(ingredients))
+	for _, ingredient := range ingredients {
+		quantity := quantities[ingredient.ID]
+		if onHand[ingredient.ID] < quantity {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Not enough %s to transfer: %g %s on hand", ingredient.Name, onHand[ingredient.ID], ingredient.Unit)})
+			return
+		}
+
+		out := models.StockMovement{
+			IngredientID: ingredient.ID,
+			OutletID:     &fromID,
+			Type:         "transfer",
+			Quantity:     -quantity,
+			Reason:       fmt.Sprintf("%s to %s", reason, to.Name),
+			UserID:       userID,
+		}
+		in := models.StockMovement{
+			IngredientID: ingredient.ID,
+			OutletID:     &to.ID,
+			Type:         "transfer",
+			Quantity:     quantity,
+			Reason:       reason,
+			UserID:       userID,
+		}
+		for _, movement := range []*models.StockMovement{&out, &in} {
+			if err := recordStockMovement(tx, movement); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock movement"})
+				return
+			}
+			movements = append(movements, *movement)
+		}
+	}
+
+	tx.Commit()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"from_outlet_id": fromID,
+		"to_outlet_id":   to.ID,
+		"movements":      movements,
+	})
+}
+
+// Stock takes
+func (h *InventoryHandler) GetStockTakes(c *gin.Context) {
+	var stockTakes []models.StockTake
+
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	query := h.db.WithContext(c).Model(&models.StockTake{}).Preload("User").Where(scope.clause("outlet_id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Order("created_at DESC").Find(&stockTakes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock takes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stockTakes)
+}
+
+func (h *InventoryHandler) GetStockTake(c *gin.Context) {
+	var stockTake models.StockTake
+	if err := preloadStockTake(h.db.WithContext(c)).First(&stockTake, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock take not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stockTake)
+}
+
+// CreateStockTake starts a stock count. Expected quantities are taken from the
+// current stock on hand and refreshed again when the count is posted.
+func (h *InventoryHandler) CreateStockTake(c *gin.Context) {
+	var req StockTakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	outletID, err := resolveOutletID(c, h.db.WithContext(c), req.OutletID)
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	stockTake := models.StockTake{
+		Status:   "draft",
+		OutletID: &outletID,
+		Notes:    req.Notes,
+	}
+	if userID := currentUserID(c); userID != nil {
+		stockTake.UserID = *userID
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Create(&stockTake).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stock take"})
+		return
+	}
+
+	if err := replaceStockTakeLines(tx, &stockTake, req.Lines); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	preloadStockTake(h.db.WithContext(c)).First(&stockTake, stockTake.ID)
+
+	c.JSON(http.StatusCreated, stockTake)
+}
+
+func (h *InventoryHandler) UpdateStockTake(c *gin.Context) {
+	var stockTake models.StockTake
+	if err := h.db.WithContext(c).First(&stockTake, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock take not found"})
+		return
+	}
+
+	if stockTake.Status != "draft" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only draft stock takes can be updated"})
+		return
+	}
+
+	var req StockTakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Model(&stockTake).Update("notes", req.Notes).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock take"})
+		return
+	}
+
+	if err := replaceStockTakeLines(tx, &stockTake, req.Lines); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	h.GetStockTake(c)
+}
+
+func (h *InventoryHandler) DeleteStockTake(c *gin.Context) {
+	var stockTake models.StockTake
+	if err := h.db.WithContext(c).First(&stockTake, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock take not found"})
+		return
+	}
+
+	if stockTake.Status != "draft" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Posted stock takes cannot be deleted"})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Where("stock_take_id = ?", stockTake.ID).Delete(&models.StockTakeLine{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete stock take"})
+		return
+	}
+	if err := tx.Delete(&stockTake).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete stock take"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Stock take deleted successfully"})
+}
+
+// PostStockTake compares each counted quantity with the stock on hand at the
+// time of posting and records an adjustment movement for the variance
+func (h *InventoryHandler) PostStockTake(c *gin.Context) {
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var stockTake models.StockTake
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&stockTake, c.Param("id")).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock take not found"})
+		return
+	}
+
+	if stockTake.Status != "draft" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock take already posted"})
+		return
+	}
+
+	var lines []models.StockTakeLine
+	if err := tx.Where("stock_take_id = ?", stockTake.ID).Order("id").Find(&lines).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock take lines"})
+		return
+	}
+
+	userID := currentUserID(c)
+	ingredientIDs := make([]uint, 0, len(lines))
+	for _, line := range lines {
+		var ingredient models.Ingredient
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ingredient, line.IngredientID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Ingredient %d not found", line.IngredientID)})
+			return
+		}
+
+		expected, err := stockOnHand(tx, stockTake.OutletID, &ingredient)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlet stock"})
+			return
+		}
+
+		ingredientIDs = append(ingredientIDs, ingredient.ID)
+		variance := line.CountedQty - expected
+		if err := tx.Model(&line).Updates(map[string]interface{}{
+			"expected_qty": expected,
+			"variance":     variance,
+			"unit_cost":    ingredient.UnitCost,
+		}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock take line"})
+			return
+		}
+
+		if variance == 0 {
+			continue
+		}
+
+		movement := models.StockMovement{
+			IngredientID: ingredient.ID,
+			OutletID:     stockTake.OutletID,
+			Type:         "adjustment",
+			Quantity:     variance,
+			Reason:       fmt.Sprintf("Stock take #%d", stockTake.ID),
+			UserID:       userID,
+			StockTakeID:  &stockTake.ID,
+		}
+		if err := recordStockMovement(tx, &movement); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock adjustment"})
+			return
+		}
+	}
+
+	now := time.Now()
+	if err := tx.Model(&stockTake).Updates(map[string]interface{}{
+		"status":    "posted",
+		"posted_by": userID,
+		"posted_at": now,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post stock take"})
+		return
+	}
+
+	alerts, err := refreshStockStatus(tx, ingredientIDs)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock status"})
+		return
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
+	h.GetStockTake(c)
+}
+
+// GetStockValuation values the stock on hand of every ingredient from the
+// movement ledger, using FIFO or weighted average cost
+func (h *InventoryHandler) GetStockValuation(c *gin.Context) {
+	method := c.DefaultQuery("method", "average")
+	if method != "fifo" && method != "average" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Method must be fifo or average"})
+		return
+	}
+
+	var ingredients []models.Ingredient
+	if err := h.db.WithContext(c).Order("name").Find(&ingredients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+
+	// With ?outlet_id= only that outlet's stock is valued, from its own movements
+	var outletID *uint
+	var outletStock map[uint]float64
+	if requestedOutlet(c) != "" {
+		scope, err := readOutletScope(c, h.db.WithContext(c))
+		if err != nil {
+			respondOutletError(c, err)
+			return
+		}
+		outletID = &scope.ids[0]
+		if outletStock, err = outletStockQty(h.db.WithContext(c), *outletID, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlet stock"})
+			return
+		}
+	}
+
+	movementQuery := h.db.WithContext(c).Select("ingredient_id, quantity, unit_cost").Order("created_at, id")
+	if outletID != nil {
+		movementQuery = movementQuery.Where("outlet_id = ?", *outletID)
+	}
+	var movements []models.StockMovement
+	if err := movementQuery.Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+		return
+	}
+
+	ledger := make(map[uint][]inventory.Movement)
+	for _, movement := range movements {
+		ledger[movement.IngredientID] = append(ledger[movement.IngredientID], inventory.Movement{
+			Quantity: movement.Quantity,
+			UnitCost: movement.UnitCost,
+		})
+	}
+
+	type ingredientValuation struct {
+		IngredientID uint   `json:"ingredient_id"`
+		Name         string `json:"name"`
+		Unit         string `json:"unit"`
+		inventory.Valuation
+	}
+
+	results := make([]ingredientValuation, 0, len(ingredients))
+	var totalValue float64
+	for _, ingredient := range ingredients {
+		entries := ledger[ingredient.ID]
+
+		// Stock that predates the ledger is valued as an opening balance at the current unit cost
+		var recorded float64
+		for _, entry := range entries {
+			recorded += entry.Quantity
+		}
+		onHand := ingredient.StockQty
+		if outletID != nil {
+			onHand = outletStock[ingredient.ID]
+		}
+		if opening := onHand - recorded; opening != 0 {
+			entries = append([]inventory.Movement{{Quantity: opening, UnitCost: ingredient.UnitCost}}, entries...)
+		}
+
+		var valuation inventory.Valuation
+		if method == "fifo" {
+			valuation = inventory.FIFO(entries)
+		} else {
+			valuation = inventory.WeightedAverage(entries)
+		}
+
+		totalValue += valuation.Value
+		results = append(results, ingredientValuation{
+			IngredientID: ingredient.ID,
+			Name:         ingredient.Name,
+			Unit:         ingredient.Unit,
+			Valuation:    valuation,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"method":      method,
+		"outlet_id":   outletID,
+		"ingredients": results,
+		"total_value": totalValue,
+	})
+}
+
+func preloadStockTake(db *gorm.DB) *gorm.DB {
+	return db.Preload("User").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Lines.Ingredient")
+}
+
+// replaceStockTakeLines replaces the counted lines of a draft stock take
+func replaceStockTakeLines(tx *gorm.DB, stockTake *models.StockTake, lines []StockTakeLineRequest) error {
+	if err := tx.Where("stock_take_id = ?", stockTake.ID).Delete(&models.StockTakeLine{}).Error; err != nil {
+		return err
+	}
+
+	seen := make(map[uint]bool, len(lines))
+	for _, lineReq := range lines {
+		if seen[lineReq.IngredientID] {
+			return fmt.Errorf("Ingredient %d is counted more than once", lineReq.IngredientID)
+		}
+		seen[lineReq.IngredientID] = true
+
+		var ingredient models.Ingredient
+		if err := tx.First(&ingredient, lineReq.IngredientID).Error; err != nil {
+			return fmt.Errorf("Ingredient %d not found", lineReq.IngredientID)
+		}
+
+		expected, err := stockOnHand(tx, stockTake.OutletID, &ingredient)
+		if err != nil {
+			return err
+		}
+
+		line := models.StockTakeLine{
+			StockTakeID:  stockTake.ID,
+			IngredientID: ingredient.ID,
+			ExpectedQty:  expected,
+			CountedQty:   *lineReq.CountedQty,
+			Variance:     *lineReq.CountedQty - expected,
+			UnitCost:     ingredient.UnitCost,
+		}
+		if err := tx.Create(&line).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stockOnHand returns the stock on hand of an ingredient at an outlet, or in
+// total when outletID is nil
+func stockOnHand(tx *gorm.DB, outletID *uint, ingredient *models.Ingredient) (float64, error) {
+	if outletID == nil {
+		return ingredient.StockQty, nil
+	}
+	stock, err := outletStockQty(tx, *outletID, []uint{ingredient.ID})
+	if err != nil {
+		return 0, err
+	}
+	return stock[ingredient.ID], nil
+}
+
+// currentUserID returns the ID of the authenticated user, if any
+func currentUserID(c *gin.Context) *uint {
+	if value, exists := c.Get("user_id"); exists {
+		if userID, ok := value.(uint); ok {
+			return &userID
+		}
+	}
+	return nil
+}
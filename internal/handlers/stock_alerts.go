@@ -0,0 +1,560 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pos-system/internal/events"
+	"pos-system/internal/models"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// outletIngredient is the stock position of an ingredient at one outlet
+type outletIngredient struct {
+	OutletID          uint    `json:"outlet_id"`
+	IngredientID      uint    `json:"ingredient_id"`
+	Name              string  `json:"name"`
+	Unit              string  `json:"unit"`
+	StockQty          float64 `json:"stock_qty"`
+	LowStockThreshold float64 `json:"low_stock_threshold"`
+	LowStock          bool    `json:"low_stock"`
+}
+
+// menuItemStock is the stock position of a menu item with a recipe at one
+// outlet
+type menuItemStock struct {
+	OutletID          uint   `json:"outlet_id"`
+	ID                uint   `json:"id"`
+	Name              string `json:"name"`
+	IsAvailable       bool   `json:"is_available"`
+	SoldOut           bool   `json:"sold_out"`
+	AvailablePortions int    `json:"available_portions"`
+	LowStockThreshold int    `json:"low_stock_threshold"`
+}
+
+// GetLowStock lists, for each active outlet in scope, the ingredients at or
+// below their threshold and the menu items that are sold out or running low
+// there, from that outlet's own stock
+func (h *InventoryHandler) GetLowStock(c *gin.Context) {
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	var outlets []models.Outlet
+	if err := h.db.WithContext(c).Where("is_active = ?", true).Where(scope.clause("id")).Order("name").Find(&outlets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlets"})
+		return
+	}
+
+	var ingredients []models.Ingredient
+	if err := h.db.WithContext(c).Order("name").Find(&ingredients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+
+	var menuItems []models.MenuItem
+	if err := h.db.WithContext(c).Preload("Recipe").
+		Where("id IN (SELECT menu_item_id FROM recipe_lines WHERE menu_item_id IS NOT NULL)").
+		Order("name").
+		Find(&menuItems).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch menu items"})
+		return
+	}
+
+	stock, err := stockAtOutlets(h.db.WithContext(c), outletIDsOf(outlets), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlet stock"})
+		return
+	}
+
+	lowIngredients := make([]outletIngredient, 0)
+	lowItems := make([]menuItemStock, 0)
+	for _, outlet := range outlets {
+		for _, ingredient := range ingredients {
+			qty := stock[outlet.ID][ingredient.ID]
+			if qty > ingredient.LowStockThreshold {
+				continue
+			}
+			lowIngredients = append(lowIngredients, outletIngredient{
+				OutletID:          outlet.ID,
+				IngredientID:      ingredient.ID,
+				Name:              ingredient.Name,
+				Unit:              ingredient.Unit,
+				StockQty:          qty,
+				LowStockThreshold: ingredient.LowStockThreshold,
+				LowStock:          true,
+			})
+		}
+
+		for _, menuItem := range menuItems {
+			portions, _ := models.AvailablePortions(withStock(menuItem.Recipe, stock[outlet.ID]))
+			if portions > 0 && portions > menuItem.LowStockThreshold {
+				continue
+			}
+
+			lowItems = append(lowItems, menuItemStock{
+				OutletID:          outlet.ID,
+				ID:                menuItem.ID,
+				Name:              menuItem.Name,
+				IsAvailable:       menuItem.IsAvailable,
+				SoldOut:           portions == 0,
+				AvailablePortions: portions,
+				LowStockThreshold: menuItem.LowStockThreshold,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"outlets":     outlets,
+		"ingredients": lowIngredients,
+		"menu_items":  lowItems,
+	})
+}
+
+// refreshStockStatus updates the low-stock flags of the given ingredients and
+// the stock status of every menu item and add-on whose recipe uses them, at
+// each active outlet from that outlet's own stock, alerting once per outlet
+// when something drops low, sells out or is restocked. An item sold out at
+// every outlet is also marked sold out and unavailable on the shared menu, and
+// made available again once any outlet can make it; items switched off by
+// hand are left alone and not alerted on. It returns the alerts to publish
+// once the DB transaction commits.
+func refreshStockStatus(tx *gorm.DB, ingredientIDs []uint) ([]events.Event, error) {
+	if len(ingredientIDs) == 0 {
+		return nil, nil
+	}
+
+	var alerts []events.Event
+
+	var outlets []models.Outlet
+	if err := tx.Where("is_active = ?", true).Order("id").Find(&outlets).Error; err != nil {
+		return nil, err
+	}
+	outletIDs := outletIDsOf(outlets)
+
+	var ingredients []models.Ingredient
+	if err := tx.Where("id IN ?", ingredientIDs).Find(&ingredients).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Ingredient, len(ingredients))
+	for _, ingredient := range ingredients {
+		byID[ingredient.ID] = ingredient
+
+		// The total's flag is only for the consolidated view; alerts follow each outlet
+		if low := ingredient.IsLowStock(); low != ingredient.LowStock {
+			if err := tx.Model(&ingredient).Update("low_stock", low).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var outletStocks []models.OutletStock
+	if err := tx.Where("ingredient_id IN ? AND outlet_id IN ?", ingredientIDs, outletIDs).Find(&outletStocks).Error; err != nil {
+		return nil, err
+	}
+	for _, outletStock := range outletStocks {
+		ingredient, ok := byID[outletStock.IngredientID]
+		if !ok {
+			continue
+		}
+		low := outletStock.StockQty <= ingredient.LowStockThreshold
+		if low == outletStock.LowStock {
+			continue
+		}
+		if err := tx.Model(&outletStock).Update("low_stock", low).Error; err != nil {
+			return nil, err
+		}
+		if low {
+			alerts = append(alerts, events.New(events.IngredientLowStock, gin.H{
+				"outlet_id":           outletStock.OutletID,
+				"ingredient_id":       ingredient.ID,
+				"name":                ingredient.Name,
+				"unit":                ingredient.Unit,
+				"stock_qty":           outletStock.StockQty,
+				"low_stock_threshold": ingredient.LowStockThreshold,
+			}))
+		}
+	}
+
+	var menuItemIDs, addOnIDs []uint
+	if err := tx.Model(&models.RecipeLine{}).
+		Where("ingredient_id IN ? AND menu_item_id IS NOT NULL", ingredientIDs).
+		Distinct().Pluck("menu_item_id", &menuItemIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.RecipeLine{}).
+		Where("ingredient_id IN ? AND add_on_id IS NOT NULL", ingredientIDs).
+		Distinct().Pluck("add_on_id", &addOnIDs).Error; err != nil {
+		return nil, err
+	}
+
+	if len(menuItemIDs) > 0 {
+		var menuItems []models.MenuItem
+		if err := tx.Preload("Recipe").Where("id IN ?", menuItemIDs).Find(&menuItems).Error; err != nil {
+			return nil, err
+		}
+		recipes := make([][]models.RecipeLine, len(menuItems))
+		for i, menuItem := range menuItems {
+			recipes[i] = menuItem.Recipe
+		}
+		stock, err := stockAtOutlets(tx, outletIDs, recipeIngredients(recipes...))
+		if err != nil {
+			return nil, err
+		}
+
+		var rows []models.OutletItemStock
+		if err := tx.Where("menu_item_id IN ?", menuItemIDs).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		current := make(map[[2]uint]models.OutletItemStock, len(rows))
+		for _, row := range rows {
+			current[[2]uint{row.OutletID, row.MenuItemID}] = row
+		}
+
+		for _, menuItem := range menuItems {
+			portions, tracked := outletPortions(outlets, stock, menuItem.Recipe)
+			if !tracked {
+				continue
+			}
+			switchedOff := !menuItem.IsAvailable && !menuItem.SoldOut
+
+			soldOutEverywhere, lowAnywhere := true, false
+			for _, outlet := range outlets {
+				status := current[[2]uint{outlet.ID, menuItem.ID}]
+				soldOut := portions[outlet.ID] == 0
+				low := menuItem.LowStockThreshold > 0 && portions[outlet.ID] <= menuItem.LowStockThreshold
+				soldOutEverywhere = soldOutEverywhere && soldOut
+				lowAnywhere = lowAnywhere || low
+				if soldOut == status.SoldOut && low == status.LowStock {
+					continue
+				}
+
+				if !switchedOff {
+					data := gin.H{
+						"outlet_id":          outlet.ID,
+						"menu_item_id":       menuItem.ID,
+						"name":               menuItem.Name,
+						"available_portions": portions[outlet.ID],
+					}
+					if soldOut && !status.SoldOut {
+						alerts = append(alerts, events.New(events.MenuItemSoldOut, data))
+					} else if !soldOut && status.SoldOut {
+						alerts = append(alerts, events.New(events.MenuItemRestocked, data))
+					}
+					if low && !status.LowStock && !soldOut {
+						alerts = append(alerts, events.New(events.MenuItemLowStock, gin.H{
+							"outlet_id":           outlet.ID,
+							"menu_item_id":        menuItem.ID,
+							"name":                menuItem.Name,
+							"available_portions":  portions[outlet.ID],
+							"low_stock_threshold": menuItem.LowStockThreshold,
+						}))
+					}
+				}
+
+				if err := saveOutletItemStock(tx, models.OutletItemStock{
+					OutletID:   outlet.ID,
+					MenuItemID: menuItem.ID,
+					SoldOut:    soldOut,
+					LowStock:   low,
+				}); err != nil {
+					return nil, err
+				}
+			}
+
+			updates := map[string]interface{}{}
+
+			availabilityChanged := false
+			if soldOutEverywhere && menuItem.IsAvailable {
+				updates["is_available"] = false
+				updates["sold_out"] = true
+				availabilityChanged = true
+			} else if !soldOutEverywhere && menuItem.SoldOut {
+				updates["is_available"] = true
+				updates["sold_out"] = false
+				availabilityChanged = true
+			}
+			if lowAnywhere != menuItem.LowStock {
+				updates["low_stock"] = lowAnywhere
+			}
+
+			if len(updates) == 0 {
+				continue
+			}
+			if err := tx.Model(&menuItem).Updates(updates).Error; err != nil {
+				return nil, err
+			}
+
+			// Choice slots of bundles are costed from available items only
+			if availabilityChanged {
+				if err := recalculateBundlesUsing(tx, menuItem, nil); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if len(addOnIDs) > 0 {
+		var addOns []models.AddOn
+		if err := tx.Preload("Recipe").Where("id IN ?", addOnIDs).Find(&addOns).Error; err != nil {
+			return nil, err
+		}
+		recipes := make([][]models.RecipeLine, len(addOns))
+		for i, addOn := range addOns {
+			recipes[i] = addOn.Recipe
+		}
+		stock, err := stockAtOutlets(tx, outletIDs, recipeIngredients(recipes...))
+		if err != nil {
+			return nil, err
+		}
+
+		var rows []models.OutletItemStock
+		if err := tx.Where("add_on_id IN ?", addOnIDs).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		current := make(map[[2]uint]models.OutletItemStock, len(rows))
+		for _, row := range rows {
+			current[[2]uint{row.OutletID, row.AddOnID}] = row
+		}
+
+		for _, addOn := range addOns {
+			portions, tracked := outletPortions(outlets, stock, addOn.Recipe)
+			if !tracked {
+				continue
+			}
+			switchedOff := !addOn.IsAvailable && !addOn.SoldOut
+
+			soldOutEverywhere := true
+			for _, outlet := range outlets {
+				status := current[[2]uint{outlet.ID, addOn.ID}]
+				soldOut := portions[outlet.ID] == 0
+				soldOutEverywhere = soldOutEverywhere && soldOut
+				if soldOut == status.SoldOut {
+					continue
+				}
+
+				if !switchedOff {
+					data := gin.H{
+						"outlet_id":          outlet.ID,
+						"add_on_id":          addOn.ID,
+						"name":               addOn.Name,
+						"available_portions": portions[outlet.ID],
+					}
+					if soldOut {
+						alerts = append(alerts, events.New(events.AddOnSoldOut, data))
+					} else {
+						alerts = append(alerts, events.New(events.AddOnRestocked, data))
+					}
+				}
+
+				if err := saveOutletItemStock(tx, models.OutletItemStock{
+					OutletID: outlet.ID,
+					AddOnID:  addOn.ID,
+					SoldOut:  soldOut,
+				}); err != nil {
+					return nil, err
+				}
+			}
+
+			if soldOutEverywhere && addOn.IsAvailable {
+				if err := tx.Model(&addOn).Updates(map[string]interface{}{"is_available": false, "sold_out": true}).Error; err != nil {
+					return nil, err
+				}
+			} else if !soldOutEverywhere && addOn.SoldOut {
+				if err := tx.Model(&addOn).Updates(map[string]interface{}{"is_available": true, "sold_out": false}).Error; err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return alerts, nil
+}
+
+// saveOutletItemStock records the stock status of a menu item or add-on at an
+// outlet
+func saveOutletItemStock(tx *gorm.DB, status models.OutletItemStock) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "outlet_id"}, {Name: "menu_item_id"}, {Name: "add_on_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"sold_out", "low_stock", "updated_at"}),
+	}).Create(&status).Error
+}
+
+// soldOutAt holds the IDs of the menu items and add-ons whose recipes cannot
+// be made from the stock on hand at one outlet
+type soldOutAt struct {
+	menuItems map[uint]bool
+	addOns    map[uint]bool
+}
+
+// loadSoldOut works out what is sold out at the outlet a menu is read for: the
+// requested outlet, else the user's only outlet or the only outlet there is.
+// It counts portions the way checkStockAvailable checks a sale there. Without
+// an outlet to go by it is empty, and only the shared menu's flags apply.
+func loadSoldOut(c *gin.Context, db *gorm.DB) (soldOutAt, error) {
+	soldOut := soldOutAt{menuItems: map[uint]bool{}, addOns: map[uint]bool{}}
+
+	outletID, err := resolveOutlet(c, db, "")
+	if errors.Is(err, errOutletRequired) {
+		return soldOut, nil
+	}
+	if err != nil {
+		return soldOut, err
+	}
+
+	var lines []models.RecipeLine
+	if err := db.Find(&lines).Error; err != nil {
+		return soldOut, err
+	}
+	stock, err := outletStockQty(db, outletID, nil)
+	if err != nil {
+		return soldOut, err
+	}
+
+	menuItemRecipes := make(map[uint][]models.RecipeLine)
+	addOnRecipes := make(map[uint][]models.RecipeLine)
+	for _, line := range lines {
+		switch {
+		case line.MenuItemID != nil:
+			menuItemRecipes[*line.MenuItemID] = append(menuItemRecipes[*line.MenuItemID], line)
+		case line.AddOnID != nil:
+			addOnRecipes[*line.AddOnID] = append(addOnRecipes[*line.AddOnID], line)
+		}
+	}
+	for id, recipe := range menuItemRecipes {
+		if portions, tracked := models.AvailablePortions(withStock(recipe, stock)); tracked && portions == 0 {
+			soldOut.menuItems[id] = true
+		}
+	}
+	for id, recipe := range addOnRecipes {
+		if portions, tracked := models.AvailablePortions(withStock(recipe, stock)); tracked && portions == 0 {
+			soldOut.addOns[id] = true
+		}
+	}
+
+	return soldOut, nil
+}
+
+// outletPortions returns how many portions of a recipe each outlet can make
+// from its own stock. The second result is false for an empty recipe, or when
+// there is no outlet to track it at.
+func outletPortions(outlets []models.Outlet, stock map[uint]map[uint]float64, recipe []models.RecipeLine) (map[uint]int, bool) {
+	if len(outlets) == 0 {
+		return nil, false
+	}
+
+	portions := make(map[uint]int, len(outlets))
+	for _, outlet := range outlets {
+		n, tracked := models.AvailablePortions(withStock(recipe, stock[outlet.ID]))
+		if !tracked {
+			return nil, false
+		}
+		portions[outlet.ID] = n
+	}
+	return portions, true
+}
+
+// withStock returns a copy of recipe lines whose ingredients have the given
+// stock on hand, keyed by ingredient ID, so AvailablePortions counts what one
+// outlet can make
+func withStock(lines []models.RecipeLine, stock map[uint]float64) []models.RecipeLine {
+	stocked := make([]models.RecipeLine, len(lines))
+	for i, line := range lines {
+		line.Ingredient.StockQty = stock[line.IngredientID]
+		stocked[i] = line
+	}
+	return stocked
+}
+
+// stockAtOutlets returns the stock on hand at each of the given outlets, keyed
+// by outlet and then ingredient ID. A nil ingredientIDs returns every
+// ingredient stocked there.
+func stockAtOutlets(db *gorm.DB, outletIDs, ingredientIDs []uint) (map[uint]map[uint]float64, error) {
+	stock := make(map[uint]map[uint]float64, len(outletIDs))
+	for _, outletID := range outletIDs {
+		stock[outletID] = make(map[uint]float64)
+	}
+	if len(outletIDs) == 0 {
+		return stock, nil
+	}
+
+	query := db.Where("outlet_id IN ?", outletIDs)
+	if ingredientIDs != nil {
+		query = query.Where("ingredient_id IN ?", ingredientIDs)
+	}
+	var rows []models.OutletStock
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		stock[row.OutletID][row.IngredientID] = row.StockQty
+	}
+	return stock, nil
+}
+
+// recipeIngredients returns the IDs of the ingredients the recipes use
+func recipeIngredients(recipes ...[]models.RecipeLine) []uint {
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0)
+	for _, recipe := range recipes {
+		for _, line := range recipe {
+			if !seen[line.IngredientID] {
+				seen[line.IngredientID] = true
+				ids = append(ids, line.IngredientID)
+			}
+		}
+	}
+	return ids
+}
+
+func outletIDsOf(outlets []models.Outlet) []uint {
+	ids := make([]uint, len(outlets))
+	for i, outlet := range outlets {
+		ids[i] = outlet.ID
+	}
+	return ids
+}
+
+// checkStockAvailable returns an error naming the first ingredient whose stock
+// on hand at the transaction's outlet cannot cover every line of a pending
+// transaction
+func checkStockAvailable(tx *gorm.DB, transaction *models.Transaction) error {
+	usage, err := ingredientUsage(tx, transaction.ID)
+	if err != nil {
+		return err
+	}
+	if len(usage) == 0 {
+		return nil
+	}
+
+	var ingredients []models.Ingredient
+	if err := tx.Where("id IN ?", mapKeys(usage)).Find(&ingredients).Error; err != nil {
+		return err
+	}
+	sort.Slice(ingredients, func(i, j int) bool { return ingredients[i].Name < ingredients[j].Name })
+
+	if transaction.OutletID != nil {
+		stock, err := outletStockQty(tx, *transaction.OutletID, mapKeys(usage))
+		if err != nil {
+			return err
+		}
+		for i := range ingredients {
+			ingredients[i].StockQty = stock[ingredients[i].ID]
+		}
+	}
+
+	for _, ingredient := range ingredients {
+		if needed := usage[ingredient.ID]; needed > ingredient.StockQty {
+			return fmt.Errorf("Not enough %s in stock: %g %s needed, %g %s available",
+				ingredient.Name, needed, ingredient.Unit, ingredient.StockQty, ingredient.Unit)
+		}
+	}
+
+	return nil
+}
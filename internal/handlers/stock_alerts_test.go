@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+
+	"pos-system/internal/models"
+)
+
+func TestOutletPortionsUseEachOutletsStock(t *testing.T) {
+	recipe := []models.RecipeLine{
+		{IngredientID: 1, Quantity: 18, Ingredient: models.Ingredient{ID: 1, StockQty: 1000}},
+		{IngredientID: 2, Quantity: 150, Ingredient: models.Ingredient{ID: 2, StockQty: 5000}},
+	}
+	outlets := []models.Outlet{{ID: 10}, {ID: 20}}
+	stock := map[uint]map[uint]float64{
+		10: {1: 90, 2: 300},
+		20: {1: 500},
+	}
+
+	portions, tracked := outletPortions(outlets, stock, recipe)
+	if !tracked {
+		t.Fatal("recipe should be tracked")
+	}
+	if portions[10] != 2 {
+		t.Errorf("outlet 10 portions = %d, want 2", portions[10])
+	}
+	// The total would make 27 portions, but outlet 20 has no milk
+	if portions[20] != 0 {
+		t.Errorf("outlet 20 portions = %d, want 0", portions[20])
+	}
+	if recipe[0].Ingredient.StockQty != 1000 {
+		t.Error("recipe lines should not be changed")
+	}
+
+	if _, tracked := outletPortions(nil, stock, recipe); tracked {
+		t.Error("nothing should be tracked without an outlet")
+	}
+}
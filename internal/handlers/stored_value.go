@@ -0,0 +1,631 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"pos-system/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Payment method codes for stored-value tenders
+const (
+	giftCardPaymentMethod = "gift_card"
+	balancePaymentMethod  = "balance"
+)
+
+// splitPaymentMethod is the payment method of a transaction paid with more
+// than one tender; its payments list the tenders
+const splitPaymentMethod = "split"
+
+// giftCardAlphabet leaves out characters that are easy to misread: 0, O, 1, I
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var errInsufficientBalance = errors.New("Insufficient balance")
+
+type StoredValueHandler struct {
+	db *gorm.DB
+}
+
+type IssueGiftCardRequest struct {
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	PaymentMethod string  `json:"payment_method" binding:"required"` // How the card was paid for
+	Code          string  `json:"code"`                              // Code of a pre-printed card; generated when empty
+	CustomerID    *uint   `json:"customer_id"`                       // Buyer, if known
+	Note          string  `json:"note"`
+}
+
+type TopUpRequest struct {
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	PaymentMethod string  `json:"payment_method" binding:"required"`
+	Note          string  `json:"note"`
+}
+
+type AdjustBalanceRequest struct {
+	Amount float64 `json:"amount" binding:"required"` // Positive to add, negative to take away
+	Note   string  `json:"note" binding:"required"`
+}
+
+type VoidGiftCardRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// StoredValueResponse is an account with its ledger, newest first
+type StoredValueResponse struct {
+	models.StoredValueAccount
+	FormattedCode string                    `json:"formatted_code,omitempty"` // Code grouped for printing on the card
+	Entries       []models.StoredValueEntry `json:"entries"`
+}
+
+func NewStoredValueHandler(db *gorm.DB) *StoredValueHandler {
+	return &StoredValueHandler{db: db}
+}
+
+func (h *StoredValueHandler) GetGiftCards(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := h.db.WithContext(c).Model(&models.StoredValueAccount{}).Where("type = ?", models.StoredValueGiftCard)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if code := models.NormalizeGiftCardCode(c.Query("code")); code != "" {
+		query = query.Where("code LIKE ?", "%"+code+"%")
+	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+
+	var total int64
+	var cards []models.StoredValueAccount
+	query.Count(&total)
+	if err := query.Preload("Customer").Order("id DESC").Offset(offset).Limit(limit).Find(&cards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift cards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  cards,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetGiftCard checks the balance of a gift card by its code
+func (h *StoredValueHandler) GetGiftCard(c *gin.Context) {
+	var card models.StoredValueAccount
+	if err := h.db.WithContext(c).Preload("Customer").
+		Where("type = ? AND code = ?", models.StoredValueGiftCard, models.NormalizeGiftCardCode(c.Param("code"))).
+		First(&card).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	h.respondAccount(c, http.StatusOK, card)
+}
+
+// IssueGiftCard sells a new gift card. The money received is a liability
+// until the card is spent, so it is not recorded as a sale.
+func (h *StoredValueHandler) IssueGiftCard(c *gin.Context) {
+	var req IssueGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkFundingMethod(h.db.WithContext(c), req.PaymentMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.CustomerID != nil {
+		if _, err := loadCustomer(h.db.WithContext(c), *req.CustomerID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	code := models.NormalizeGiftCardCode(req.Code)
+	if code == "" {
+		var err error
+		if code, err = h.newGiftCardCode(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate gift card code"})
+			return
+		}
+	} else {
+		var existing int64
+		h.db.WithContext(c).Model(&models.StoredValueAccount{}).Where("code = ?", code).Count(&existing)
+		if existing > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "A gift card with this code already exists"})
+			return
+		}
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	card := models.StoredValueAccount{
+		Type:       models.StoredValueGiftCard,
+		Code:       code,
+		CustomerID: req.CustomerID,
+		Status:     "active",
+	}
+	if err := tx.Create(&card).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+
+	if _, err := postStoredValue(tx, &card, models.StoredValueEntry{
+		Type:          models.StoredValueIssue,
+		Amount:        req.Amount,
+		PaymentMethod: req.PaymentMethod,
+		Note:          req.Note,
+		UserID:        currentUserID(c),
+	}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+	tx.Commit()
+
+	h.respondAccount(c, http.StatusCreated, card)
+}
+
+func (h *StoredValueHandler) TopUpGiftCard(c *gin.Context) {
+	var req TopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkFundingMethod(h.db.WithContext(c), req.PaymentMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.postToAccount(c, func(tx *gorm.DB) (*models.StoredValueAccount, error) {
+		return lockGiftCard(tx, c.Param("code"))
+	}, models.StoredValueEntry{
+		Type:          models.StoredValueTopUp,
+		Amount:        req.Amount,
+		PaymentMethod: req.PaymentMethod,
+		Note:          req.Note,
+	})
+}
+
+// VoidGiftCard cancels a gift card, e.g. when it is reported stolen. Its
+// remaining balance is written off.
+func (h *StoredValueHandler) VoidGiftCard(c *gin.Context) {
+	var req VoidGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	card, err := lockGiftCard(tx, c.Param("code"))
+	if err == nil && card.Status != "active" {
+		err = &tenderError{"Gift card has already been voided"}
+	}
+	if err != nil {
+		tx.Rollback()
+		respondStoredValueError(c, err)
+		return
+	}
+
+	if card.Balance > 0 {
+		if _, err := postStoredValue(tx, card, models.StoredValueEntry{
+			Type:   models.StoredValueVoid,
+			Amount: -card.Balance,
+			Note:   req.Reason,
+			UserID: currentUserID(c),
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void gift card"})
+			return
+		}
+	}
+	if err := tx.Model(card).Update("status", "void").Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void gift card"})
+		return
+	}
+	tx.Commit()
+
+	h.respondAccount(c, http.StatusOK, *card)
+}
+
+// GetCustomerBalance shows a customer's prepaid balance and its ledger
+func (h *StoredValueHandler) GetCustomerBalance(c *gin.Context) {
+	var customer models.Customer
+	if err := h.db.WithContext(c).First(&customer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	var accounts []models.StoredValueAccount
+	if err := h.db.WithContext(c).Where("type = ? AND customer_id = ?", models.StoredValueCustomer, customer.ID).Limit(1).Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch balance"})
+		return
+	}
+	if len(accounts) == 0 {
+		// No money was ever put on the balance
+		c.JSON(http.StatusOK, StoredValueResponse{
+			StoredValueAccount: models.StoredValueAccount{Type: models.StoredValueCustomer, CustomerID: &customer.ID, Status: "active"},
+			Entries:            []models.StoredValueEntry{},
+		})
+		return
+	}
+
+	h.respondAccount(c, http.StatusOK, accounts[0])
+}
+
+func (h *StoredValueHandler) TopUpCustomerBalance(c *gin.Context) {
+	var req TopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkFundingMethod(h.db.WithContext(c), req.PaymentMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.postToAccount(c, func(tx *gorm.DB) (*models.StoredValueAccount, error) {
+		return lockCustomerBalance(tx, c.Param("id"), true)
+	}, models.StoredValueEntry{
+		Type:          models.StoredValueTopUp,
+		Amount:        req.Amount,
+		PaymentMethod: req.PaymentMethod,
+		Note:          req.Note,
+	})
+}
+
+// AdjustCustomerBalance corrects a customer's balance by hand
+func (h *StoredValueHandler) AdjustCustomerBalance(c *gin.Context) {
+	var req AdjustBalanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.postToAccount(c, func(tx *gorm.DB) (*models.StoredValueAccount, error) {
+		return lockCustomerBalance(tx, c.Param("id"), true)
+	}, models.StoredValueEntry{
+		Type:   models.StoredValueAdjust,
+		Amount: req.Amount,
+		Note:   req.Note,
+	})
+}
+
+// postToAccount adds entry to the account lock returns, in a DB transaction
+func (h *StoredValueHandler) postToAccount(c *gin.Context, lock func(tx *gorm.DB) (*models.StoredValueAccount, error), entry models.StoredValueEntry) {
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	account, err := lock(tx)
+	if err == nil && account.Status != "active" {
+		err = &tenderError{"Gift card has been voided"}
+	}
+	if err != nil {
+		tx.Rollback()
+		respondStoredValueError(c, err)
+		return
+	}
+
+	entry.UserID = currentUserID(c)
+	if _, err := postStoredValue(tx, account, entry); err != nil {
+		tx.Rollback()
+		respondStoredValueError(c, err)
+		return
+	}
+	tx.Commit()
+
+	h.respondAccount(c, http.StatusOK, *account)
+}
+
+func (h *StoredValueHandler) respondAccount(c *gin.Context, status int, account models.StoredValueAccount) {
+	entries := []models.StoredValueEntry{}
+	if err := h.db.WithContext(c).Where("account_id = ?", account.ID).Order("id DESC").Limit(50).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch balance history"})
+		return
+	}
+
+	c.JSON(status, StoredValueResponse{
+		StoredValueAccount: account,
+		FormattedCode:      models.FormatGiftCardCode(account.Code),
+		Entries:            entries,
+	})
+}
+
+// newGiftCardCode returns a random 16 character code that no card has yet
+func (h *StoredValueHandler) newGiftCardCode(c *gin.Context) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		var b strings.Builder
+		for i := 0; i < 16; i++ {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(giftCardAlphabet))))
+			if err != nil {
+				return "", err
+			}
+			b.WriteByte(giftCardAlphabet[n.Int64()])
+		}
+
+		var existing int64
+		h.db.WithContext(c).Model(&models.StoredValueAccount{}).Where("code = ?", b.String()).Count(&existing)
+		if existing == 0 {
+			return b.String(), nil
+		}
+	}
+	return "", errors.New("no unused gift card code found")
+}
+
+// recordTenders records the tenders of a transaction being paid. Gift cards
+// and customer balances are locked and spent in the payment's DB transaction,
+// so two orders cannot spend the same balance.
+func recordTenders(tx *gorm.DB, transaction *models.Transaction, tenders []TenderRequest, userID *uint) error {
+	for _, tender := range tenders {
+		var account *models.StoredValueAccount
+		var err error
+		switch tender.PaymentMethod {
+		case giftCardPaymentMethod:
+			if tender.GiftCardCode == "" {
+				return &tenderError{"gift_card_code is required to pay with a gift card"}
+			}
+			account, err = lockGiftCard(tx, tender.GiftCardCode)
+			if err == nil && account.Status != "active" {
+				err = &tenderError{"Gift card has been voided"}
+			}
+		case balancePaymentMethod:
+			if transaction.CustomerID == nil {
+				return &tenderError{"Link a customer to pay with their balance"}
+			}
+			account, err = lockCustomerBalance(tx, *transaction.CustomerID, false)
+		}
+		if err != nil {
+			return err
+		}
+
+		payment := models.TransactionPayment{
+			TransactionID: transaction.ID,
+			PaymentMethod: tender.PaymentMethod,
+			Amount:        tender.Amount,
+		}
+		if tender.PaymentMethod == accountPaymentMethod {
+			houseAccount, err := chargeHouseAccount(tx, transaction, tender.Amount, userID)
+			if err != nil {
+				return err
+			}
+			payment.HouseAccountID = &houseAccount.ID
+		}
+		if account != nil {
+			if tender.Amount > 0 {
+				if _, err := postStoredValue(tx, account, models.StoredValueEntry{
+					Type:          models.StoredValueRedeem,
+					Amount:        -tender.Amount,
+					TransactionID: &transaction.ID,
+					UserID:        userID,
+				}); err != nil {
+					return err
+				}
+			}
+			payment.StoredValueAccountID = &account.ID
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundTenders credits the gift cards and balances a refunded transaction
+// was paid with, and takes back house account charges
+func refundTenders(tx *gorm.DB, transaction *models.Transaction, userID *uint) error {
+	var payments []models.TransactionPayment
+	if err := tx.Where("transaction_id = ? AND (stored_value_account_id IS NOT NULL OR house_account_id IS NOT NULL)", transaction.ID).
+		Order("id").Find(&payments).Error; err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		if payment.Amount <= 0 {
+			continue
+		}
+		if payment.HouseAccountID != nil {
+			var houseAccount models.HouseAccount
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&houseAccount, *payment.HouseAccountID).Error; err != nil {
+				return err
+			}
+			if err := postHouseAccount(tx, &houseAccount, models.HouseAccountEntry{
+				Type:          models.AccountReverse,
+				Amount:        -payment.Amount,
+				TransactionID: &transaction.ID,
+				UserID:        userID,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var account models.StoredValueAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, *payment.StoredValueAccountID).Error; err != nil {
+			return err
+		}
+		if _, err := postStoredValue(tx, &account, models.StoredValueEntry{
+			Type:          models.StoredValueRefund,
+			Amount:        payment.Amount,
+			TransactionID: &transaction.ID,
+			UserID:        userID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeStoredValue moves a merged customer's balance and gift cards to the
+// customer they were merged into. The balance moves through the ledger when
+// both customers have one.
+func mergeStoredValue(tx *gorm.DB, fromID, intoID uint, userID *uint) error {
+	if err := tx.Model(&models.StoredValueAccount{}).
+		Where("type = ? AND customer_id = ?", models.StoredValueGiftCard, fromID).
+		Update("customer_id", intoID).Error; err != nil {
+		return err
+	}
+
+	var from models.StoredValueAccount
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("type = ? AND customer_id = ?", models.StoredValueCustomer, fromID).
+		First(&from).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	into, err := lockCustomerBalance(tx, intoID, false)
+	if errors.Is(err, errInsufficientBalance) {
+		// The customer has no balance yet, so theirs becomes the merged one
+		return tx.Model(&from).Update("customer_id", intoID).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if amount := from.Balance; amount > 0 {
+		note := fmt.Sprintf("Merged customer #%d", fromID)
+		if _, err := postStoredValue(tx, &from, models.StoredValueEntry{Type: models.StoredValueAdjust, Amount: -amount, Note: note, UserID: userID}); err != nil {
+			return err
+		}
+		if _, err := postStoredValue(tx, into, models.StoredValueEntry{Type: models.StoredValueAdjust, Amount: amount, Note: note, UserID: userID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tenderError is a problem with a payment that the client can fix
+type tenderError struct {
+	message string
+}
+
+func (e *tenderError) Error() string {
+	return e.message
+}
+
+// postStoredValue adds an entry to a locked account and applies it to the
+// balance. It fails with errInsufficientBalance rather than let the balance
+// go negative.
+func postStoredValue(tx *gorm.DB, account *models.StoredValueAccount, entry models.StoredValueEntry) (*models.StoredValueEntry, error) {
+	balance := account.Balance + entry.Amount
+	if balance < -0.005 {
+		return nil, errInsufficientBalance
+	}
+	if balance < 0 {
+		balance = 0
+	}
+
+	entry.AccountID = account.ID
+	entry.BalanceAfter = balance
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(account).Update("balance", balance).Error; err != nil {
+		return nil, err
+	}
+	account.Balance = balance
+	return &entry, nil
+}
+
+// lockGiftCard finds a gift card by code and locks it for the rest of the
+// DB transaction, so concurrent redemptions cannot spend the same balance
+func lockGiftCard(tx *gorm.DB, code string) (*models.StoredValueAccount, error) {
+	var card models.StoredValueAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("type = ? AND code = ?", models.StoredValueGiftCard, models.NormalizeGiftCardCode(code)).
+		First(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &tenderError{"Gift card not found"}
+		}
+		return nil, err
+	}
+	return &card, nil
+}
+
+// lockCustomerBalance finds a customer's balance and locks it, creating it
+// if create is set
+func lockCustomerBalance(tx *gorm.DB, customerID interface{}, create bool) (*models.StoredValueAccount, error) {
+	var customer models.Customer
+	if err := tx.First(&customer, customerID).Error; err != nil {
+		return nil, &tenderError{"Customer not found"}
+	}
+
+	if create {
+		account := models.StoredValueAccount{Type: models.StoredValueCustomer, CustomerID: &customer.ID, Status: "active"}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var account models.StoredValueAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("type = ? AND customer_id = ?", models.StoredValueCustomer, customer.ID).
+		First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInsufficientBalance
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// checkFundingMethod checks that a gift card, top-up or house account
+// settlement is paid for with an active payment method that brings in money
+func checkFundingMethod(db *gorm.DB, code string) error {
+	switch code {
+	case giftCardPaymentMethod, balancePaymentMethod, loyaltyPaymentMethod, accountPaymentMethod:
+		return fmt.Errorf("Payment method %s cannot be used to pay this", code)
+	}
+	var method models.PaymentMethod
+	if err := db.Where("code = ? AND is_active = ?", code, true).First(&method).Error; err != nil {
+		return errors.New("Invalid payment method")
+	}
+	return nil
+}
+
+func respondStoredValueError(c *gin.Context, err error) {
+	var tenderErr *tenderError
+	switch {
+	case errors.As(err, &tenderErr):
+		status := http.StatusBadRequest
+		if strings.HasSuffix(tenderErr.message, "not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update balance"})
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pos-system/internal/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TagsRequest carries the tags of a menu item or add-on. A nil slice leaves the
+// existing tags untouched; an empty slice clears them.
+type TagsRequest struct {
+	TagIDs *[]uint `json:"tag_ids"`
+}
+
+// GetTags lists tags, optionally of one kind
+func (h *MenuHandler) GetTags(c *gin.Context) {
+	query := h.db.WithContext(c).Order("kind, name")
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var tags []models.Tag
+	if err := query.Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tags})
+}
+
+func (h *MenuHandler) CreateTag(c *gin.Context) {
+	var tag models.Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tag.ID = 0
+
+	if message := h.validateTag(c, &tag); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	if err := h.db.WithContext(c).Create(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+func (h *MenuHandler) UpdateTag(c *gin.Context) {
+	var tag models.Tag
+	if err := h.db.WithContext(c).First(&tag, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+
+	id := tag.ID
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tag.ID = id
+
+	if message := h.validateTag(c, &tag); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	if err := tx.Save(&tag).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+	if err := models.RefreshSearchText(tx, "id IN (SELECT menu_item_id FROM menu_item_tags WHERE tag_id = ?)", tag.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag deletes a tag and removes it from every menu item and add-on
+func (h *MenuHandler) DeleteTag(c *gin.Context) {
+	var tag models.Tag
+	if err := h.db.WithContext(c).First(&tag, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+
+	var menuItemIDs []uint
+	if err := h.db.WithContext(c).Table("menu_item_tags").Where("tag_id = ?", tag.ID).Pluck("menu_item_id", &menuItemIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	for _, table := range []string{"menu_item_tags", "add_on_tags"} {
+		if err := tx.Exec("DELETE FROM "+table+" WHERE tag_id = ?", tag.ID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+			return
+		}
+	}
+	if err := tx.Delete(&tag).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+	if len(menuItemIDs) > 0 {
+		if err := models.RefreshSearchText(tx, "id IN ?", menuItemIDs); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+			return
+		}
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+// validateTag normalizes a tag before saving and returns an error message if
+// it is invalid. The slug is derived from the name unless given.
+func (h *MenuHandler) validateTag(c *gin.Context, tag *models.Tag) string {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return "Name is required"
+	}
+	if tag.Slug == "" {
+		tag.Slug = tag.Name
+	}
+	tag.Slug = models.TagSlug(tag.Slug)
+	if tag.Slug == "" {
+		return "Slug must contain letters or digits"
+	}
+	if tag.Kind == "" {
+		tag.Kind = models.TagKindTag
+	}
+	if !models.ValidTagKind(tag.Kind) {
+		return "Kind must be tag, dietary or allergen"
+	}
+
+	var count int64
+	h.db.WithContext(c).Model(&models.Tag{}).Where("slug = ? AND id <> ?", tag.Slug, tag.ID).Count(&count)
+	if count > 0 {
+		return "Slug is already in use"
+	}
+	return ""
+}
+
+// replaceTags replaces the tags of a menu item or add-on
+func replaceTags(tx *gorm.DB, owner interface{}, tagIDs *[]uint) error {
+	if tagIDs == nil {
+		return nil
+	}
+
+	var tags []models.Tag
+	if len(*tagIDs) > 0 {
+		if err := tx.Where("id IN ?", *tagIDs).Find(&tags).Error; err != nil {
+			return err
+		}
+		if len(tags) != len(uniqueIDs(*tagIDs)) {
+			return fmt.Errorf("one or more tags not found")
+		}
+	}
+	return tx.Model(owner).Association("Tags").Replace(tags)
+}
+
+// tagSlugsParam resolves a comma-separated list of tag slugs from a query
+// parameter, limited to one kind unless kind is empty
+func tagSlugsParam(db *gorm.DB, value, kind string) ([]models.Tag, error) {
+	var slugs []string
+	for _, slug := range strings.Split(value, ",") {
+		if slug = models.TagSlug(slug); slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+	if len(slugs) == 0 {
+		return nil, nil
+	}
+
+	query := db.Where("slug IN ?", slugs)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	var tags []models.Tag
+	if err := query.Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		found[tag.Slug] = true
+	}
+	for _, slug := range slugs {
+		if !found[slug] {
+			if kind != "" {
+				return nil, fmt.Errorf("Unknown %s: %s", kind, slug)
+			}
+			return nil, fmt.Errorf("Unknown tag: %s", slug)
+		}
+	}
+	return tags, nil
+}
+
+// addOnTagRow is a single (add-on, tag) pair returned by loadAddOnTags
+type addOnTagRow struct {
+	AddOnID uint
+	models.Tag
+}
+
+// loadAddOnTags loads the tags of the given add-ons in one query, keyed by
+// add-on ID
+func loadAddOnTags(db *gorm.DB, addOnIDs []uint) (map[uint][]models.Tag, error) {
+	result := make(map[uint][]models.Tag, len(addOnIDs))
+	if len(addOnIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []addOnTagRow
+	if err := db.Table("tags").
+		Select("add_on_tags.add_on_id, tags.*").
+		Joins("JOIN add_on_tags ON add_on_tags.tag_id = tags.id").
+		Where("add_on_tags.add_on_id IN ?", addOnIDs).
+		Order("tags.name").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		result[row.AddOnID] = append(result[row.AddOnID], row.Tag)
+	}
+	return result, nil
+}
+
+// withAddOnTags attaches their tags to add-ons and leaves out add-ons that
+// contain any of the excluded allergens
+func withAddOnTags(addOns []models.AddOn, tags map[uint][]models.Tag, excludedAllergens map[uint]bool) []models.AddOn {
+	result := make([]models.AddOn, 0, len(addOns))
+next:
+	for _, addOn := range addOns {
+		addOn.Tags = tags[addOn.ID]
+		for _, tag := range addOn.Tags {
+			if excludedAllergens[tag.ID] {
+				continue next
+			}
+		}
+		result = append(result, addOn)
+	}
+	return result
+}
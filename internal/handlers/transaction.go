@@ -1,32 +1,46 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"pos-system/internal/events"
 	"pos-system/internal/models"
+	"pos-system/pkg/loyalty"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TransactionHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	events   *events.Dispatcher
+	location *time.Location // Outlet timezone for availability schedules
+	program  loyalty.Program
 }
 
 type CreateTransactionRequest struct {
 	CustomerName string                   `json:"customer_name"`
+	CustomerID   *uint                    `json:"customer_id"` // Links the order to a customer; customer_name defaults to theirs
+	OutletID     *uint                    `json:"outlet_id"`   // Defaults to the X-Outlet-ID header or the user's only outlet
+	OrderType    string                   `json:"order_type" binding:"omitempty,oneof=dine_in takeaway delivery"` // Defaults to dine_in
+	Channel      string                   `json:"channel"`                                                        // Defaults to pos
+	PriceListID  *uint                    `json:"price_list_id"`                                                  // Overrides the price list picked from channel and order type
 	Items        []TransactionItemRequest `json:"items" binding:"required"`
 	Tax          float64                  `json:"tax"`
 	Discount     float64                  `json:"discount"`
 }
 
 type TransactionItemRequest struct {
-	MenuItemID uint                      `json:"menu_item_id" binding:"required"`
-	Quantity   int                       `json:"quantity" binding:"required,min=1"`
-	AddOns     []TransactionItemAddOnRequest `json:"add_ons,omitempty"`
+	MenuItemID    uint                      `json:"menu_item_id" binding:"required"`
+	Quantity      int                       `json:"quantity" binding:"required,min=1"`
+	AddOns        []TransactionItemAddOnRequest `json:"add_ons,omitempty"`
+	BundleChoices []BundleChoiceRequest     `json:"bundle_choices,omitempty"` // Choices for category slots of a bundle
 }
 
 type TransactionItemAddOnRequest struct {
@@ -35,19 +49,39 @@ type TransactionItemAddOnRequest struct {
 }
 
 type PayTransactionRequest struct {
-	PaymentMethod string `json:"payment_method" binding:"required"`
+	PaymentMethod string          `json:"payment_method"`                    // Pays the whole total; omit when giving payments
+	GiftCardCode  string          `json:"gift_card_code"`                    // With payment_method gift_card
+	Payments      []TenderRequest `json:"payments" binding:"omitempty,dive"` // Split payment, must add up to the total
+}
+
+type TenderRequest struct {
+	PaymentMethod string  `json:"payment_method" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	GiftCardCode  string  `json:"gift_card_code"` // With payment method gift_card
+}
+
+type RefundTransactionRequest struct {
+	Reason  string `json:"reason" binding:"required"`
+	Restock *bool  `json:"restock"` // Reverse ingredient consumption, defaults to true
 }
 
 type UpdateTransactionRequest struct {
 	CustomerName string  `json:"customer_name"`
+	CustomerID   *uint   `json:"customer_id"` // Omit to keep the linked customer, 0 to unlink
 	Tax          float64 `json:"tax"`
 	Discount     float64 `json:"discount"`
 }
 
+type LinkCustomerRequest struct {
+	CustomerID *uint `json:"customer_id"` // null unlinks the customer
+}
+
 type AddTransactionItemRequest struct {
-	MenuItemID uint                      `json:"menu_item_id" binding:"required"`
-	Quantity   int                       `json:"quantity" binding:"required,min=1"`
-	AddOns     []TransactionItemAddOnRequest `json:"add_ons,omitempty"`
+	MenuItemID    uint                      `json:"menu_item_id"`
+	Barcode       string                    `json:"barcode"` // Scanned barcode or SKU, instead of menu_item_id
+	Quantity      int                       `json:"quantity" binding:"required,min=1"`
+	AddOns        []TransactionItemAddOnRequest `json:"add_ons,omitempty"`
+	BundleChoices []BundleChoiceRequest     `json:"bundle_choices,omitempty"`
 }
 
 type UpdateTransactionItemRequest struct {
@@ -55,8 +89,53 @@ type UpdateTransactionItemRequest struct {
 	AddOns   []TransactionItemAddOnRequest `json:"add_ons,omitempty"`
 }
 
-func NewTransactionHandler(db *gorm.DB) *TransactionHandler {
-	return &TransactionHandler{db: db}
+func NewTransactionHandler(db *gorm.DB, dispatcher *events.Dispatcher, location *time.Location, program loyalty.Program) *TransactionHandler {
+	return &TransactionHandler{db: db, events: dispatcher, location: location, program: program}
+}
+
+// recalculateTransactionTotals recomputes the subtotal and total of a transaction
+// from its top-level lines. Bundle component lines only carry allocated revenue.
+func recalculateTransactionTotals(tx *gorm.DB, transaction *models.Transaction) error {
+	var items []models.TransactionItem
+	if err := tx.Preload("AddOns.AddOn").
+		Where("transaction_id = ? AND parent_item_id IS NULL", transaction.ID).
+		Find(&items).Error; err != nil {
+		return err
+	}
+
+	var total float64
+	for _, item := range items {
+		// Lines keep the price they were added at, which may come from a price list
+		itemTotal := item.UnitPrice * float64(item.Quantity)
+
+		for _, addOn := range item.AddOns {
+			// Use the stored TotalPrice which already includes menu item quantity
+			itemTotal += addOn.TotalPrice
+		}
+		total += itemTotal
+	}
+
+	transaction.SubTotal = total
+	transaction.Total = total + transaction.Tax - transaction.Discount - transaction.LoyaltyDiscount
+	return nil
+}
+
+// preloadTransactionDetails loads the lines of a transaction, with bundle component
+// lines nested under their bundle line. Menu items and add-ons carry their tags
+// so receipts can list allergens.
+func preloadTransactionDetails(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items", "parent_item_id IS NULL").
+		Preload("Items.MenuItem").
+		Preload("Items.MenuItem.Tags").
+		Preload("Items.AddOns.AddOn").
+		Preload("Items.AddOns.AddOn.Tags").
+		Preload("Items.Components.MenuItem").
+		Preload("Items.Components.MenuItem.Tags").
+		Preload("PriceList").
+		Preload("Customer").
+		Preload("Outlet").
+		Preload("Payments").
+		Preload("User")
 }
 
 func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
@@ -67,9 +146,15 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
+
+	outletID, err := resolveOutletID(c, h.db.WithContext(c), req.OutletID)
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
 	
 	// Start transaction
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -79,20 +164,70 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 	// Generate transaction number
 	transactionNo := fmt.Sprintf("TRX-%d", time.Now().Unix())
 
+	orderType := req.OrderType
+	if orderType == "" {
+		orderType = "dine_in"
+	}
+	channel := normalizeChannel(req.Channel)
+	if channel == "" {
+		channel = "pos"
+	}
+
+	priceList, err := resolvePriceList(tx, req.PriceListID, channel, orderType)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Create transaction
 	transaction := models.Transaction{
 		TransactionNo: transactionNo,
 		UserID:        userID.(uint),
+		OutletID:      &outletID,
 		CustomerName:  req.CustomerName,
+		OrderType:     orderType,
+		Channel:       channel,
 		Status:        "pending",
 		Tax:           req.Tax,
 		Discount:      req.Discount,
 	}
+	if priceList != nil {
+		transaction.PriceListID = &priceList.ID
+	}
+
+	if req.CustomerID != nil {
+		customer, err := loadCustomer(tx, *req.CustomerID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		transaction.CustomerID = &customer.ID
+		if transaction.CustomerName == "" {
+			transaction.CustomerName = customer.Name
+		}
+	}
+
+	off, err := loadOffSchedule(tx, time.Now().In(h.location))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability schedules"})
+		return
+	}
+
+	hidden, err := loadHiddenOnChannel(tx, transaction.Channel)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
 
 	var subTotal float64
+	bundleComponents := make([][]bundleComponent, len(req.Items))
 
 	// Calculate subtotal and validate items
-	for _, itemReq := range req.Items {
+	for i, itemReq := range req.Items {
 		var menuItem models.MenuItem
 		if err := tx.First(&menuItem, itemReq.MenuItemID).Error; err != nil {
 			tx.Rollback()
@@ -106,7 +241,34 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 			return
 		}
 
-		itemTotal := menuItem.Price * float64(itemReq.Quantity)
+		if off.menuItemOffSchedule(menuItem) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Menu item %s is not available at this time", menuItem.Name)})
+			return
+		}
+
+		if hidden.menuItemHidden(menuItem) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Menu item %s is not sold on %s", menuItem.Name, transaction.Channel)})
+			return
+		}
+
+		if menuItem.ItemType == "bundle" {
+			components, err := resolveBundleComponents(tx, menuItem, itemReq.BundleChoices)
+			if err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := checkComponentsOnSchedule(off, components); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			bundleComponents[i] = components
+		}
+
+		itemTotal := priceList.MenuItemPrice(menuItem) * float64(itemReq.Quantity)
 
 		// Validate and calculate add-ons
 		for _, addOnReq := range itemReq.AddOns {
@@ -117,13 +279,13 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 				return
 			}
 
-			if !addOn.IsAvailable {
+			if err := checkAddOnAvailable(off, addOn); err != nil {
 				tx.Rollback()
-				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Add-on %s is not available", addOn.Name)})
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
 
-			itemTotal += addOn.Price * float64(addOnReq.Quantity) * float64(itemReq.Quantity)
+			itemTotal += priceList.AddOnPrice(addOn) * float64(addOnReq.Quantity) * float64(itemReq.Quantity)
 		}
 
 		subTotal += itemTotal
@@ -139,25 +301,26 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 	}
 
 	// Create transaction items and add-ons
-	for _, itemReq := range req.Items {
+	for i, itemReq := range req.Items {
 		var menuItem models.MenuItem
 		tx.First(&menuItem, itemReq.MenuItemID)
 
-		totalPrice := menuItem.Price * float64(itemReq.Quantity)
+		unitPrice := priceList.MenuItemPrice(menuItem)
+		totalPrice := unitPrice * float64(itemReq.Quantity)
 
 		// Calculate add-ons total for this item
 		var addOnsTotal float64
 		for _, addOnReq := range itemReq.AddOns {
 			var addOn models.AddOn
 			tx.First(&addOn, addOnReq.AddOnID)
-			addOnsTotal += addOn.Price * float64(addOnReq.Quantity) * float64(itemReq.Quantity)
+			addOnsTotal += priceList.AddOnPrice(addOn) * float64(addOnReq.Quantity) * float64(itemReq.Quantity)
 		}
 
 		transactionItem := models.TransactionItem{
 			TransactionID: transaction.ID,
 			MenuItemID:    itemReq.MenuItemID,
 			Quantity:      itemReq.Quantity,
-			UnitPrice:     menuItem.Price,
+			UnitPrice:     unitPrice,
 			TotalPrice:    totalPrice + addOnsTotal,
 		}
 
@@ -167,17 +330,27 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 			return
 		}
 
+		// Expand bundles into component lines
+		if bundleComponents[i] != nil {
+			if err := createBundleComponentLines(tx, transactionItem, bundleComponents[i]); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bundle component items"})
+				return
+			}
+		}
+
 		// Create add-ons for this item
 		for _, addOnReq := range itemReq.AddOns {
 			var addOn models.AddOn
 			tx.First(&addOn, addOnReq.AddOnID)
+			addOnPrice := priceList.AddOnPrice(addOn)
 
 			transactionItemAddOn := models.TransactionItemAddOn{
 				TransactionItemID: transactionItem.ID,
 				AddOnID:           addOnReq.AddOnID,
 				Quantity:          addOnReq.Quantity,
-				UnitPrice:         addOn.Price,
-				TotalPrice:        addOn.Price * float64(addOnReq.Quantity) * float64(itemReq.Quantity),
+				UnitPrice:         addOnPrice,
+				TotalPrice:        addOnPrice * float64(addOnReq.Quantity) * float64(itemReq.Quantity),
 			}
 
 			if err := tx.Create(&transactionItemAddOn).Error; err != nil {
@@ -188,13 +361,17 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 		}
 	}
 
+	// Refuse orders the ingredients on hand cannot cover
+	if err := checkStockAvailable(tx, &transaction); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	tx.Commit()
 
 	// Reload with associations
-	h.db.Preload("Items.MenuItem").
-		Preload("Items.AddOns.AddOn").
-		Preload("User").
-		First(&transaction, transaction.ID)
+	preloadTransactionDetails(h.db.WithContext(c)).First(&transaction, transaction.ID)
 
 	c.JSON(http.StatusCreated, transaction)
 }
@@ -209,41 +386,210 @@ func (h *TransactionHandler) PayTransaction(c *gin.Context) {
 		return
 	}
 	
+	if req.PaymentMethod == "" && len(req.Payments) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payment_method or payments is required"})
+		return
+	}
+
 	log.Printf("PayTransaction: Processing payment for transaction %s with method %s", id, req.PaymentMethod)
 
+	// Validate payment methods
+	methods := []string{req.PaymentMethod}
+	if len(req.Payments) > 0 {
+		methods = methods[:0]
+		for _, tender := range req.Payments {
+			methods = append(methods, tender.PaymentMethod)
+		}
+	}
+	for _, method := range methods {
+		var paymentMethod models.PaymentMethod
+		if err := h.db.WithContext(c).Where("code = ? AND is_active = ?", method, true).First(&paymentMethod).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment method"})
+			return
+		}
+	}
+
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	// Start transaction; the row lock keeps concurrent payments from consuming stock twice
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
 	var transaction models.Transaction
-	if err := h.db.First(&transaction, id).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(scope.clause("outlet_id")).First(&transaction, id).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
 
 	if transaction.Status == "paid" {
+		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Transaction already paid"})
 		return
 	}
 
-	// Validate payment method
-	var paymentMethod models.PaymentMethod
-	if err := h.db.Where("code = ? AND is_active = ?", req.PaymentMethod, true).First(&paymentMethod).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment method"})
+	if transaction.Status == "refunded" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transaction has been refunded"})
+		return
+	}
+
+	if transaction.Total < 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Redeemed points are worth more than the order total"})
+		return
+	}
+
+	tenders := req.Payments
+	if len(tenders) == 0 {
+		tenders = []TenderRequest{{PaymentMethod: req.PaymentMethod, Amount: transaction.Total, GiftCardCode: req.GiftCardCode}}
+	}
+	tendered := 0.0
+	pointsTender := 0.0
+	for _, tender := range tenders {
+		tendered += tender.Amount
+		if tender.PaymentMethod == loyaltyPaymentMethod {
+			pointsTender += tender.Amount
+		}
+	}
+	if math.Abs(tendered-transaction.Total) > 0.005 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Payments add up to %.2f but the total is %.2f", tendered, transaction.Total)})
 		return
 	}
 
 	now := time.Now()
 	transaction.Status = "paid"
-	transaction.PaymentMethod = req.PaymentMethod
+	transaction.PaymentMethod = tenders[0].PaymentMethod
+	if len(tenders) > 1 {
+		transaction.PaymentMethod = splitPaymentMethod
+	}
 	transaction.PaidAt = &now
 
-	if err := h.db.Save(&transaction).Error; err != nil {
+	// Take redeemed points and credit earned points in the same DB transaction as the payment
+	if err := settleLoyalty(tx, &transaction, h.program, pointsTender, currentUserID(c)); err != nil {
+		tx.Rollback()
+		if errors.Is(err, errNoLoyaltyCustomer) || errors.Is(err, errInsufficientPoints) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loyalty points"})
+		return
+	}
+
+	if err := tx.Save(&transaction).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
 		return
 	}
 
+	// Spend gift cards and balances under a row lock, so they cannot be spent twice
+	if err := recordTenders(tx, &transaction, tenders, currentUserID(c)); err != nil {
+		tx.Rollback()
+		respondStoredValueError(c, err)
+		return
+	}
+
+	// Consume recipe ingredients in the same DB transaction as the payment
+	alerts, err := consumeIngredients(tx, &transaction, currentUserID(c))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ingredient stock"})
+		return
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
 	// Reload with associations
-	h.db.Preload("Items.MenuItem").
-		Preload("Items.AddOns.AddOn").
-		Preload("User").
-		First(&transaction, transaction.ID)
+	preloadTransactionDetails(h.db.WithContext(c)).First(&transaction, transaction.ID)
+
+	c.JSON(http.StatusOK, transaction)
+}
+
+// RefundTransaction refunds a paid transaction. Ingredient consumption is
+// reversed unless restock is false (e.g. the order was already prepared).
+func (h *TransactionHandler) RefundTransaction(c *gin.Context) {
+	id := c.Param("id")
+
+	var req RefundTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var transaction models.Transaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(scope.clause("outlet_id")).First(&transaction, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+
+	if transaction.Status != "paid" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only paid transactions can be refunded"})
+		return
+	}
+
+	now := time.Now()
+	transaction.Status = "refunded"
+	transaction.RefundedAt = &now
+	transaction.RefundReason = req.Reason
+
+	if err := tx.Save(&transaction).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
+		return
+	}
+
+	if err := reverseLoyalty(tx, &transaction, h.program, currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse loyalty points"})
+		return
+	}
+
+	if err := refundTenders(tx, &transaction, currentUserID(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund payments"})
+		return
+	}
+
+	var alerts []events.Event
+	if req.Restock == nil || *req.Restock {
+		var err error
+		if alerts, err = reverseConsumption(tx, &transaction, currentUserID(c), req.Reason); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore ingredient stock"})
+			return
+		}
+	}
+
+	tx.Commit()
+	h.events.Publish(alerts...)
+
+	// Reload with associations
+	preloadTransactionDetails(h.db.WithContext(c)).First(&transaction, transaction.ID)
 
 	c.JSON(http.StatusOK, transaction)
 }
@@ -257,14 +603,20 @@ func (h *TransactionHandler) GetTransactions(c *gin.Context) {
 	var transactions []models.Transaction
 	var total int64
 
-	query := h.db.Model(&models.Transaction{}).
-		Preload("Items.MenuItem").
-		Preload("Items.AddOns.AddOn").
-		Preload("User")
+	scope, err := readOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	query := preloadTransactionDetails(h.db.WithContext(c).Model(&models.Transaction{})).Where(scope.clause("outlet_id"))
 	
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
 
 	query.Count(&total)
 	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&transactions).Error; err != nil {
@@ -283,11 +635,14 @@ func (h *TransactionHandler) GetTransactions(c *gin.Context) {
 func (h *TransactionHandler) GetTransaction(c *gin.Context) {
 	id := c.Param("id")
 	
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
 	var transaction models.Transaction
-	if err := h.db.Preload("Items.MenuItem").
-		Preload("Items.AddOns.AddOn").
-		Preload("User").
-		First(&transaction, id).Error; err != nil {
+	if err := preloadTransactionDetails(h.db.WithContext(c)).Where(scope.clause("outlet_id")).First(&transaction, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
@@ -298,8 +653,14 @@ func (h *TransactionHandler) GetTransaction(c *gin.Context) {
 func (h *TransactionHandler) DeleteTransaction(c *gin.Context) {
 	id := c.Param("id")
 	
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
 	var transaction models.Transaction
-	if err := h.db.First(&transaction, id).Error; err != nil {
+	if err := h.db.WithContext(c).Where(scope.clause("outlet_id")).First(&transaction, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
@@ -310,7 +671,7 @@ func (h *TransactionHandler) DeleteTransaction(c *gin.Context) {
 	// }
 
 	// Start transaction to delete all related records
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -348,14 +709,21 @@ func (h *TransactionHandler) DeleteTransaction(c *gin.Context) {
 func (h *TransactionHandler) UpdateTransaction(c *gin.Context) {
 	id := c.Param("id")
 	
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
 	var transaction models.Transaction
-	if err := h.db.First(&transaction, id).Error; err != nil {
+	if err := h.db.WithContext(c).Where(scope.clause("outlet_id")).First(&transaction, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
 
-	if transaction.Status == "paid" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot update paid transaction"})
+	// Paid and refunded orders have had their stock and loyalty settled
+	if transaction.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot update " + transaction.Status + " transaction"})
 		return
 	}
 
@@ -365,6 +733,25 @@ func (h *TransactionHandler) UpdateTransaction(c *gin.Context) {
 		return
 	}
 
+	if req.CustomerID != nil {
+		previous := transaction.CustomerID
+		if *req.CustomerID == 0 {
+			transaction.CustomerID = nil
+		} else {
+			customer, err := loadCustomer(h.db.WithContext(c), *req.CustomerID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			transaction.CustomerID = &customer.ID
+		}
+		// Redeemed points belong to the customer they were redeemed for
+		if previous == nil || transaction.CustomerID == nil || *previous != *transaction.CustomerID {
+			transaction.PointsRedeemed = 0
+			transaction.LoyaltyDiscount = 0
+		}
+	}
+
 	// Update transaction fields
 	transaction.CustomerName = req.CustomerName
 	transaction.Tax = req.Tax
@@ -372,34 +759,100 @@ func (h *TransactionHandler) UpdateTransaction(c *gin.Context) {
 	transaction.UpdatedAt = time.Now()
 
 	// Recalculate total
-	var total float64
-	var items []models.TransactionItem
-	if err := h.db.Preload("AddOns.AddOn").Where("transaction_id = ?", id).Find(&items).Error; err != nil {
+	if err := recalculateTransactionTotals(h.db.WithContext(c), &transaction); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction items"})
 		return
 	}
 
-	for _, item := range items {
-		var menuItem models.MenuItem
-		if err := h.db.First(&menuItem, item.MenuItemID).Error; err != nil {
-			continue
+	if err := h.db.WithContext(c).Save(&transaction).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transaction)
+}
+
+// LinkTransactionCustomer links a transaction to a customer, or unlinks it.
+// Paid and refunded transactions can be linked too, for customers who give
+// their phone number after paying; a paid order linked this way earns its
+// points. Points redeemed on a pending order are dropped when the customer
+// changes.
+func (h *TransactionHandler) LinkTransactionCustomer(c *gin.Context) {
+	var req LinkCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
+	tx := h.db.WithContext(c).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
 		}
-		itemTotal := menuItem.Price * float64(item.Quantity)
-		
-		for _, addOn := range item.AddOns {
-			// Use the stored TotalPrice which already includes menu item quantity
-			itemTotal += addOn.TotalPrice
+	}()
+
+	var transaction models.Transaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(scope.clause("outlet_id")).First(&transaction, c.Param("id")).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+
+	if transaction.Status != "pending" && (transaction.PointsEarned > 0 || transaction.PointsRedeemed > 0) {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Loyalty points were already settled for this transaction"})
+		return
+	}
+
+	transaction.CustomerID = nil
+	if req.CustomerID != nil {
+		customer, err := loadCustomer(tx, *req.CustomerID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		transaction.CustomerID = &customer.ID
+		if transaction.CustomerName == "" {
+			transaction.CustomerName = customer.Name
 		}
-		total += itemTotal
 	}
 
-	transaction.SubTotal = total
-	transaction.Total = total + transaction.Tax - transaction.Discount
+	if transaction.PointsRedeemed > 0 {
+		transaction.PointsRedeemed = 0
+		transaction.LoyaltyDiscount = 0
+		if err := recalculateTransactionTotals(tx, &transaction); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction items"})
+			return
+		}
+	}
+
+	if transaction.Status == "paid" {
+		if err := settleLoyalty(tx, &transaction, h.program, 0, currentUserID(c)); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loyalty points"})
+			return
+		}
+	}
 
-	if err := h.db.Save(&transaction).Error; err != nil {
+	if err := tx.Save(&transaction).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
 		return
 	}
+	tx.Commit()
+
+	if err := preloadTransactionDetails(h.db.WithContext(c)).First(&transaction, transaction.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction"})
+		return
+	}
 
 	c.JSON(http.StatusOK, transaction)
 }
@@ -408,14 +861,21 @@ func (h *TransactionHandler) UpdateTransaction(c *gin.Context) {
 func (h *TransactionHandler) AddTransactionItem(c *gin.Context) {
 	transactionID := c.Param("id")
 	
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
 	var transaction models.Transaction
-	if err := h.db.First(&transaction, transactionID).Error; err != nil {
+	if err := h.db.WithContext(c).Where(scope.clause("outlet_id")).First(&transaction, transactionID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
 
-	if transaction.Status == "paid" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot modify paid transaction"})
+	// Paid and refunded orders have had their stock and loyalty settled
+	if transaction.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot modify " + transaction.Status + " transaction"})
 		return
 	}
 
@@ -425,15 +885,77 @@ func (h *TransactionHandler) AddTransactionItem(c *gin.Context) {
 		return
 	}
 
-	// Verify menu item exists
+	// Resolve the menu item from its ID or a scanned code
 	var menuItem models.MenuItem
-	if err := h.db.First(&menuItem, req.MenuItemID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Menu item not found"})
+	switch {
+	case req.Barcode != "":
+		found, _, err := findMenuItemByCode(h.db.WithContext(c), req.Barcode)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("No menu item found for barcode %s", req.Barcode)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up barcode"})
+			return
+		}
+		menuItem = found
+	case req.MenuItemID != 0:
+		if err := h.db.WithContext(c).First(&menuItem, req.MenuItemID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Menu item not found"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "menu_item_id or barcode is required"})
+		return
+	}
+
+	if !menuItem.IsAvailable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Menu item %s is not available", menuItem.Name)})
+		return
+	}
+
+	off, err := loadOffSchedule(h.db.WithContext(c), time.Now().In(h.location))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability schedules"})
+		return
+	}
+
+	// Price added lines with the list the order was created with
+	priceList, err := transactionPriceList(h.db.WithContext(c), transaction)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price list"})
 		return
 	}
 
+	if off.menuItemOffSchedule(menuItem) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Menu item %s is not available at this time", menuItem.Name)})
+		return
+	}
+
+	hidden, err := loadHiddenOnChannel(h.db.WithContext(c), transaction.Channel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+	if hidden.menuItemHidden(menuItem) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Menu item %s is not sold on %s", menuItem.Name, transaction.Channel)})
+		return
+	}
+
+	var components []bundleComponent
+	if menuItem.ItemType == "bundle" {
+		if components, err = resolveBundleComponents(h.db.WithContext(c), menuItem, req.BundleChoices); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkComponentsOnSchedule(off, components); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Start transaction
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -443,10 +965,10 @@ func (h *TransactionHandler) AddTransactionItem(c *gin.Context) {
 	// Create transaction item
 	transactionItem := models.TransactionItem{
 		TransactionID: transaction.ID,
-		MenuItemID:    req.MenuItemID,
+		MenuItemID:    menuItem.ID,
 		Quantity:      req.Quantity,
-		UnitPrice:     menuItem.Price,
-		TotalPrice:    menuItem.Price * float64(req.Quantity),
+		UnitPrice:     priceList.MenuItemPrice(menuItem),
+		TotalPrice:    priceList.MenuItemPrice(menuItem) * float64(req.Quantity),
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
@@ -457,6 +979,15 @@ func (h *TransactionHandler) AddTransactionItem(c *gin.Context) {
 		return
 	}
 
+	// Expand bundles into component lines
+	if components != nil {
+		if err := createBundleComponentLines(tx, transactionItem, components); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bundle component items"})
+			return
+		}
+	}
+
 	// Create transaction item add-ons if provided
 	for _, addOnReq := range req.AddOns {
 		var addOn models.AddOn
@@ -466,12 +997,18 @@ func (h *TransactionHandler) AddTransactionItem(c *gin.Context) {
 			return
 		}
 
+		if err := checkAddOnAvailable(off, addOn); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		transactionItemAddOn := models.TransactionItemAddOn{
 			TransactionItemID: transactionItem.ID,
 			AddOnID:          addOnReq.AddOnID,
 			Quantity:         addOnReq.Quantity,
-			UnitPrice:        addOn.Price,
-			TotalPrice:       addOn.Price * float64(addOnReq.Quantity) * float64(req.Quantity),
+			UnitPrice:        priceList.AddOnPrice(addOn),
+			TotalPrice:       priceList.AddOnPrice(addOn) * float64(addOnReq.Quantity) * float64(req.Quantity),
 			CreatedAt:        time.Now(),
 			UpdatedAt:        time.Now(),
 		}
@@ -484,29 +1021,11 @@ func (h *TransactionHandler) AddTransactionItem(c *gin.Context) {
 	}
 
 	// Recalculate transaction totals
-	var total float64
-	var items []models.TransactionItem
-	if err := tx.Preload("AddOns.AddOn").Where("transaction_id = ?", transactionID).Find(&items).Error; err != nil {
+	if err := recalculateTransactionTotals(tx, &transaction); err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate totals"})
 		return
 	}
-
-	for _, item := range items {
-		var itemMenuItem models.MenuItem
-		if err := tx.First(&itemMenuItem, item.MenuItemID).Error; err != nil {
-			continue
-		}
-		itemTotal := itemMenuItem.Price * float64(item.Quantity)
-		
-		for _, addOn := range item.AddOns {
-			itemTotal += addOn.TotalPrice
-		}
-		total += itemTotal
-	}
-
-	transaction.SubTotal = total
-	transaction.Total = total + transaction.Tax - transaction.Discount
 	transaction.UpdatedAt = time.Now()
 
 	if err := tx.Save(&transaction).Error; err != nil {
@@ -515,6 +1034,12 @@ func (h *TransactionHandler) AddTransactionItem(c *gin.Context) {
 		return
 	}
 
+	if err := checkStockAvailable(tx, &transaction); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	tx.Commit()
 
 	c.JSON(http.StatusCreated, transactionItem)
@@ -525,19 +1050,26 @@ func (h *TransactionHandler) UpdateTransactionItem(c *gin.Context) {
 	transactionID := c.Param("id")
 	itemID := c.Param("item_id")
 	
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
 	var transaction models.Transaction
-	if err := h.db.First(&transaction, transactionID).Error; err != nil {
+	if err := h.db.WithContext(c).Where(scope.clause("outlet_id")).First(&transaction, transactionID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
 
-	if transaction.Status == "paid" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot modify paid transaction"})
+	// Paid and refunded orders have had their stock and loyalty settled
+	if transaction.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot modify " + transaction.Status + " transaction"})
 		return
 	}
 
 	var transactionItem models.TransactionItem
-	if err := h.db.Where("id = ? AND transaction_id = ?", itemID, transactionID).First(&transactionItem).Error; err != nil {
+	if err := h.db.WithContext(c).Where("id = ? AND transaction_id = ? AND parent_item_id IS NULL", itemID, transactionID).First(&transactionItem).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction item not found"})
 		return
 	}
@@ -548,8 +1080,20 @@ func (h *TransactionHandler) UpdateTransactionItem(c *gin.Context) {
 		return
 	}
 
+	priceList, err := transactionPriceList(h.db.WithContext(c), transaction)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price list"})
+		return
+	}
+
+	off, err := loadOffSchedule(h.db.WithContext(c), time.Now().In(h.location))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability schedules"})
+		return
+	}
+
 	// Start transaction
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -557,6 +1101,7 @@ func (h *TransactionHandler) UpdateTransactionItem(c *gin.Context) {
 	}()
 
 	// Update transaction item quantity
+	oldQuantity := transactionItem.Quantity
 	transactionItem.Quantity = req.Quantity
 	transactionItem.UpdatedAt = time.Now()
 
@@ -566,6 +1111,13 @@ func (h *TransactionHandler) UpdateTransactionItem(c *gin.Context) {
 		return
 	}
 
+	// Keep bundle component lines in step with the bundle quantity
+	if err := rescaleBundleComponentLines(tx, transactionItem, oldQuantity); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bundle component items"})
+		return
+	}
+
 	// Delete existing add-ons
 	if err := tx.Where("transaction_item_id = ?", itemID).Delete(&models.TransactionItemAddOn{}).Error; err != nil {
 		tx.Rollback()
@@ -582,12 +1134,18 @@ func (h *TransactionHandler) UpdateTransactionItem(c *gin.Context) {
 			return
 		}
 
+		if err := checkAddOnAvailable(off, addOn); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		transactionItemAddOn := models.TransactionItemAddOn{
 			TransactionItemID: transactionItem.ID,
 			AddOnID:          addOnReq.AddOnID,
 			Quantity:         addOnReq.Quantity,
-			UnitPrice:        addOn.Price,
-			TotalPrice:       addOn.Price * float64(addOnReq.Quantity) * float64(transactionItem.Quantity),
+			UnitPrice:        priceList.AddOnPrice(addOn),
+			TotalPrice:       priceList.AddOnPrice(addOn) * float64(addOnReq.Quantity) * float64(transactionItem.Quantity),
 			CreatedAt:        time.Now(),
 			UpdatedAt:        time.Now(),
 		}
@@ -600,29 +1158,11 @@ func (h *TransactionHandler) UpdateTransactionItem(c *gin.Context) {
 	}
 
 	// Recalculate transaction totals
-	var total float64
-	var items []models.TransactionItem
-	if err := tx.Preload("AddOns.AddOn").Where("transaction_id = ?", transactionID).Find(&items).Error; err != nil {
+	if err := recalculateTransactionTotals(tx, &transaction); err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate totals"})
 		return
 	}
-
-	for _, item := range items {
-		var itemMenuItem models.MenuItem
-		if err := tx.First(&itemMenuItem, item.MenuItemID).Error; err != nil {
-			continue
-		}
-		itemTotal := itemMenuItem.Price * float64(item.Quantity)
-		
-		for _, addOn := range item.AddOns {
-			itemTotal += addOn.TotalPrice
-		}
-		total += itemTotal
-	}
-
-	transaction.SubTotal = total
-	transaction.Total = total + transaction.Tax - transaction.Discount
 	transaction.UpdatedAt = time.Now()
 
 	if err := tx.Save(&transaction).Error; err != nil {
@@ -631,6 +1171,12 @@ func (h *TransactionHandler) UpdateTransactionItem(c *gin.Context) {
 		return
 	}
 
+	if err := checkStockAvailable(tx, &transaction); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	tx.Commit()
 
 	c.JSON(http.StatusOK, transactionItem)
@@ -641,25 +1187,32 @@ func (h *TransactionHandler) DeleteTransactionItem(c *gin.Context) {
 	transactionID := c.Param("id")
 	itemID := c.Param("item_id")
 	
+	scope, err := userOutletScope(c, h.db.WithContext(c))
+	if err != nil {
+		respondOutletError(c, err)
+		return
+	}
+
 	var transaction models.Transaction
-	if err := h.db.First(&transaction, transactionID).Error; err != nil {
+	if err := h.db.WithContext(c).Where(scope.clause("outlet_id")).First(&transaction, transactionID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
 
-	if transaction.Status == "paid" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot modify paid transaction"})
+	// Paid and refunded orders have had their stock and loyalty settled
+	if transaction.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot modify " + transaction.Status + " transaction"})
 		return
 	}
 
 	var transactionItem models.TransactionItem
-	if err := h.db.Where("id = ? AND transaction_id = ?", itemID, transactionID).First(&transactionItem).Error; err != nil {
+	if err := h.db.WithContext(c).Where("id = ? AND transaction_id = ? AND parent_item_id IS NULL", itemID, transactionID).First(&transactionItem).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction item not found"})
 		return
 	}
 
 	// Start transaction
-	tx := h.db.Begin()
+	tx := h.db.WithContext(c).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -673,6 +1226,13 @@ func (h *TransactionHandler) DeleteTransactionItem(c *gin.Context) {
 		return
 	}
 
+	// Delete bundle component lines
+	if err := tx.Where("parent_item_id = ?", itemID).Delete(&models.TransactionItem{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bundle component items"})
+		return
+	}
+
 	// Delete transaction item
 	if err := tx.Delete(&transactionItem).Error; err != nil {
 		tx.Rollback()
@@ -681,29 +1241,11 @@ func (h *TransactionHandler) DeleteTransactionItem(c *gin.Context) {
 	}
 
 	// Recalculate transaction totals
-	var total float64
-	var items []models.TransactionItem
-	if err := tx.Preload("AddOns.AddOn").Where("transaction_id = ?", transactionID).Find(&items).Error; err != nil {
+	if err := recalculateTransactionTotals(tx, &transaction); err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate totals"})
 		return
 	}
-
-	for _, item := range items {
-		var itemMenuItem models.MenuItem
-		if err := tx.First(&itemMenuItem, item.MenuItemID).Error; err != nil {
-			continue
-		}
-		itemTotal := itemMenuItem.Price * float64(item.Quantity)
-		
-		for _, addOn := range item.AddOns {
-			itemTotal += addOn.TotalPrice
-		}
-		total += itemTotal
-	}
-
-	transaction.SubTotal = total
-	transaction.Total = total + transaction.Tax - transaction.Discount
 	transaction.UpdatedAt = time.Now()
 
 	if err := tx.Save(&transaction).Error; err != nil {
@@ -719,7 +1261,7 @@ func (h *TransactionHandler) DeleteTransactionItem(c *gin.Context) {
 
 func (h *TransactionHandler) GetPaymentMethods(c *gin.Context) {
 	var paymentMethods []models.PaymentMethod
-	if err := h.db.Where("is_active = ?", true).Find(&paymentMethods).Error; err != nil {
+	if err := h.db.WithContext(c).Where("is_active = ?", true).Find(&paymentMethods).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment methods"})
 		return
 	}
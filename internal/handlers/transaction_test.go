@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pos-system/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTransactionsByIDAreLimitedToUserOutlets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=pos_test"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	// The cashier works at outlet 1 only; nothing else is stored
+	var selects []*gorm.Statement
+	if err := db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		switch tx.Statement.Table {
+		case "user_outlets":
+			if ids, ok := tx.Statement.Dest.(*[]uint); ok {
+				*ids = []uint{1}
+			}
+		case "transactions":
+			selects = append(selects, tx.Statement)
+		}
+	}); err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+
+	h := &TransactionHandler{db: db}
+	handlers := map[string]gin.HandlerFunc{
+		"GetTransaction":    h.GetTransaction,
+		"DeleteTransaction": h.DeleteTransaction,
+		"GetKitchenTicket":  h.GetKitchenTicket,
+	}
+	for name, handler := range handlers {
+		for _, role := range []string{"cashier", "admin"} {
+			selects = nil
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/v1/transactions/5", nil)
+			c.Params = gin.Params{{Key: "id", Value: "5"}}
+			c.Set("user_id", uint(9))
+			c.Set("role", role)
+
+			handler(c)
+
+			if len(selects) == 0 {
+				t.Fatalf("%s as %s: expected the transaction to be loaded", name, role)
+			}
+			sql := selects[0].SQL.String()
+			limited := strings.Contains(sql, "outlet_id IN ($")
+			if role == "cashier" && !limited {
+				t.Errorf("%s as cashier: expected the load to be limited to outlet 1, got %q", name, sql)
+			}
+			if role == "admin" && limited {
+				t.Errorf("%s as admin: expected every outlet, got %q", name, sql)
+			}
+			if role == "cashier" && (len(selects[0].Vars) == 0 || selects[0].Vars[0] != uint(1)) {
+				t.Errorf("%s as cashier: expected outlet 1 to be bound, got %v", name, selects[0].Vars)
+			}
+		}
+	}
+}
+
+func TestUpdateTransactionItemChecksAddOnAvailability(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: dryRunPool{}}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	addOnID := uint(4)
+	var addOn models.AddOn
+	var schedules []models.AvailabilitySchedule
+	if err := db.Callback().Query().After("gorm:query").Register("test:load", func(tx *gorm.DB) {
+		switch dest := tx.Statement.Dest.(type) {
+		case *models.Transaction:
+			*dest = models.Transaction{ID: 5, Status: "pending"}
+		case *models.TransactionItem:
+			*dest = models.TransactionItem{ID: 8, TransactionID: 5, MenuItemID: 2, Quantity: 1}
+		case *models.AddOn:
+			*dest = addOn
+		case *[]models.AvailabilitySchedule:
+			*dest = schedules
+		}
+	}); err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+	var created bool
+	if err := db.Callback().Create().After("gorm:create").Register("test:capture", func(tx *gorm.DB) {
+		if tx.Statement.Table == "transaction_item_add_ons" {
+			created = true
+		}
+	}); err != nil {
+		t.Fatalf("Failed to register callback: %v", err)
+	}
+
+	h := &TransactionHandler{db: db, location: time.UTC}
+	cases := []struct {
+		name      string
+		addOn     models.AddOn
+		schedules []models.AvailabilitySchedule
+		want      string
+	}{
+		{"switched off", models.AddOn{ID: addOnID, Name: "Oat milk"}, nil, "Add-on Oat milk is not available"},
+		{"off schedule", models.AddOn{ID: addOnID, Name: "Oat milk", IsAvailable: true},
+			[]models.AvailabilitySchedule{{AddOnID: &addOnID, EndDate: "2000-01-01"}}, "Add-on Oat milk is not available at this time"},
+	}
+	for _, tc := range cases {
+		addOn, schedules, created = tc.addOn, tc.schedules, false
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("PUT", "/api/v1/transactions/5/items/8", strings.NewReader(`{"quantity": 1, "add_ons": [{"add_on_id": 4, "quantity": 1}]}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "5"}, {Key: "item_id", Value: "8"}}
+		c.Set("role", "admin")
+
+		h.UpdateTransactionItem(c)
+
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s: expected 400 %q, got %d %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+		if created {
+			t.Errorf("%s: expected the add-on not to be added", tc.name)
+		}
+	}
+}
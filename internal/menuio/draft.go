@@ -0,0 +1,334 @@
+package menuio
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change actions in a diff
+const (
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+	ActionChange = "change"
+)
+
+// Change is a difference between two menus for one row
+type Change struct {
+	Kind   string        `json:"type"`
+	Name   string        `json:"name"`
+	SKU    string        `json:"sku,omitempty"`
+	Action string        `json:"action"`           // add, remove, change
+	Fields []FieldChange `json:"fields,omitempty"` // Changed fields, for changed rows
+}
+
+// FieldChange is one changed field of a row
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RowRefs names rows of a menu: categories by name, menu items and add-ons
+// by SKU or name
+type RowRefs struct {
+	Categories []string `json:"categories"`
+	MenuItems  []string `json:"menu_items"`
+	AddOns     []string `json:"add_ons"`
+}
+
+// ClearAvailability leaves the availability of every menu item and add-on
+// unset, so applying the menu keeps whatever is live. Availability changes
+// during service, so drafts should not carry a stale copy of it.
+func (m *Menu) ClearAvailability() {
+	for i := range m.MenuItems {
+		m.MenuItems[i].IsAvailable = nil
+	}
+	for i := range m.AddOns {
+		m.AddOns[i].IsAvailable = nil
+	}
+}
+
+// Upsert adds the rows of other to the menu, replacing rows with the same
+// name (categories) or the same SKU or name (menu items and add-ons)
+func (m *Menu) Upsert(other Menu) {
+	for _, row := range other.Categories {
+		if i := findCategory(m.Categories, row.Name); i >= 0 {
+			m.Categories[i] = row
+		} else {
+			m.Categories = append(m.Categories, row)
+		}
+	}
+	for _, row := range other.MenuItems {
+		if i := findMenuItem(m.MenuItems, row.SKU, row.Name); i >= 0 {
+			m.MenuItems[i] = row
+		} else {
+			m.MenuItems = append(m.MenuItems, row)
+		}
+	}
+	for _, row := range other.AddOns {
+		if i := findAddOn(m.AddOns, row.SKU, row.Name); i >= 0 {
+			m.AddOns[i] = row
+		} else {
+			m.AddOns = append(m.AddOns, row)
+		}
+	}
+}
+
+// Remove deletes the named rows from the menu. Nothing is removed if any of
+// them is not in the menu.
+func (m *Menu) Remove(refs RowRefs) error {
+	remove := func(kind string, refs []string, find func(ref string) int) (map[int]bool, error) {
+		indexes := make(map[int]bool, len(refs))
+		for _, ref := range refs {
+			i := find(ref)
+			if i < 0 {
+				return nil, fmt.Errorf("%s %q not found", strings.ReplaceAll(kind, "_", " "), ref)
+			}
+			indexes[i] = true
+		}
+		return indexes, nil
+	}
+
+	categories, err := remove(KindCategory, refs.Categories, func(ref string) int {
+		return findCategory(m.Categories, ref)
+	})
+	if err != nil {
+		return err
+	}
+	menuItems, err := remove(KindMenuItem, refs.MenuItems, func(ref string) int {
+		return findRef(len(m.MenuItems), func(i int) (string, string) { return m.MenuItems[i].SKU, m.MenuItems[i].Name }, ref)
+	})
+	if err != nil {
+		return err
+	}
+	addOns, err := remove(KindAddOn, refs.AddOns, func(ref string) int {
+		return findRef(len(m.AddOns), func(i int) (string, string) { return m.AddOns[i].SKU, m.AddOns[i].Name }, ref)
+	})
+	if err != nil {
+		return err
+	}
+
+	keptCategories := m.Categories[:0]
+	for i, row := range m.Categories {
+		if !categories[i] {
+			keptCategories = append(keptCategories, row)
+		}
+	}
+	m.Categories = keptCategories
+
+	keptMenuItems := m.MenuItems[:0]
+	for i, row := range m.MenuItems {
+		if !menuItems[i] {
+			keptMenuItems = append(keptMenuItems, row)
+		}
+	}
+	m.MenuItems = keptMenuItems
+
+	keptAddOns := m.AddOns[:0]
+	for i, row := range m.AddOns {
+		if !addOns[i] {
+			keptAddOns = append(keptAddOns, row)
+		}
+	}
+	m.AddOns = keptAddOns
+
+	return nil
+}
+
+// CheckReferences reports rows that refer to categories or menu items that
+// are not in the menu. A menu that replaces the whole live menu must be
+// complete, since rows left out of it are removed.
+func CheckReferences(menu *Menu) []Issue {
+	var issues []Issue
+
+	for i, item := range menu.MenuItems {
+		if item.Category != "" && findCategory(menu.Categories, item.Category) < 0 {
+			issues = append(issues, Issue{Kind: KindMenuItem, Row: i + 1, Name: item.Name,
+				Message: fmt.Sprintf("category %q is not in the menu", item.Category)})
+		}
+	}
+
+	for i, addOn := range menu.AddOns {
+		for _, ref := range addOn.MenuItems {
+			if findRef(len(menu.MenuItems), func(j int) (string, string) { return menu.MenuItems[j].SKU, menu.MenuItems[j].Name }, ref) < 0 {
+				issues = append(issues, Issue{Kind: KindAddOn, Row: i + 1, Name: addOn.Name,
+					Message: fmt.Sprintf("menu item %q is not in the menu", ref)})
+			}
+		}
+		for _, name := range addOn.Categories {
+			if findCategory(menu.Categories, name) < 0 {
+				issues = append(issues, Issue{Kind: KindAddOn, Row: i + 1, Name: addOn.Name,
+					Message: fmt.Sprintf("category %q is not in the menu", name)})
+			}
+		}
+	}
+
+	return issues
+}
+
+// Diff lists what applying to as a complete menu would change in from:
+// rows added, rows removed and changed fields. Rows are matched as Apply
+// matches them. Availability is only compared where to sets it.
+func Diff(from, to *Menu) []Change {
+	changes := []Change{}
+
+	matched := make(map[int]bool)
+	for _, row := range to.Categories {
+		i := findCategory(from.Categories, row.Name)
+		if i < 0 {
+			changes = append(changes, Change{Kind: KindCategory, Name: row.Name, Action: ActionAdd})
+			continue
+		}
+		matched[i] = true
+		if fields := diffFields(from.Categories[i], row); len(fields) > 0 {
+			changes = append(changes, Change{Kind: KindCategory, Name: row.Name, Action: ActionChange, Fields: fields})
+		}
+	}
+	for i, row := range from.Categories {
+		if !matched[i] {
+			changes = append(changes, Change{Kind: KindCategory, Name: row.Name, Action: ActionRemove})
+		}
+	}
+
+	matched = make(map[int]bool)
+	for _, row := range to.MenuItems {
+		i := findMenuItem(from.MenuItems, row.SKU, row.Name)
+		if i < 0 {
+			changes = append(changes, Change{Kind: KindMenuItem, Name: row.Name, SKU: row.SKU, Action: ActionAdd})
+			continue
+		}
+		matched[i] = true
+		if row.IsAvailable == nil {
+			row.IsAvailable = from.MenuItems[i].IsAvailable
+		}
+		if row.ItemType == "" {
+			row.ItemType = "item"
+		}
+		if fields := diffFields(from.MenuItems[i], row); len(fields) > 0 {
+			changes = append(changes, Change{Kind: KindMenuItem, Name: row.Name, SKU: row.SKU, Action: ActionChange, Fields: fields})
+		}
+	}
+	for i, row := range from.MenuItems {
+		if !matched[i] {
+			changes = append(changes, Change{Kind: KindMenuItem, Name: row.Name, SKU: row.SKU, Action: ActionRemove})
+		}
+	}
+
+	matched = make(map[int]bool)
+	for _, row := range to.AddOns {
+		i := findAddOn(from.AddOns, row.SKU, row.Name)
+		if i < 0 {
+			changes = append(changes, Change{Kind: KindAddOn, Name: row.Name, SKU: row.SKU, Action: ActionAdd})
+			continue
+		}
+		matched[i] = true
+		if row.IsAvailable == nil {
+			row.IsAvailable = from.AddOns[i].IsAvailable
+		}
+		if fields := diffFields(from.AddOns[i], row); len(fields) > 0 {
+			changes = append(changes, Change{Kind: KindAddOn, Name: row.Name, SKU: row.SKU, Action: ActionChange, Fields: fields})
+		}
+	}
+	for i, row := range from.AddOns {
+		if !matched[i] {
+			changes = append(changes, Change{Kind: KindAddOn, Name: row.Name, SKU: row.SKU, Action: ActionRemove})
+		}
+	}
+
+	return changes
+}
+
+// diffFields compares two rows of the same type field by field, using the
+// JSON field names. Lists are compared as sets.
+func diffFields(from, to interface{}) []FieldChange {
+	var fields []FieldChange
+	a, b := reflect.ValueOf(from), reflect.ValueOf(to)
+	for i := 0; i < a.NumField(); i++ {
+		name := strings.Split(a.Type().Field(i).Tag.Get("json"), ",")[0]
+		x, y := a.Field(i).Interface(), b.Field(i).Interface()
+
+		switch x := x.(type) {
+		case *bool:
+			y := y.(*bool)
+			if (x == nil) != (y == nil) || (x != nil && *x != *y) {
+				fields = append(fields, FieldChange{Field: name, From: x, To: y})
+			}
+		case []string:
+			if !sameRefs(x, y.([]string)) {
+				fields = append(fields, FieldChange{Field: name, From: x, To: y})
+			}
+		default:
+			if x != y {
+				fields = append(fields, FieldChange{Field: name, From: x, To: y})
+			}
+		}
+	}
+	return fields
+}
+
+func sameRefs(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, ref := range a {
+		set[strings.ToLower(ref)] = true
+	}
+	other := make(map[string]bool, len(b))
+	for _, ref := range b {
+		if !set[strings.ToLower(ref)] {
+			return false
+		}
+		other[strings.ToLower(ref)] = true
+	}
+	return len(set) == len(other)
+}
+
+func findCategory(categories []Category, name string) int {
+	for i, category := range categories {
+		if strings.EqualFold(category.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func findMenuItem(menuItems []MenuItem, sku, name string) int {
+	return findKey(len(menuItems), func(i int) (string, string) { return menuItems[i].SKU, menuItems[i].Name }, sku, name)
+}
+
+func findAddOn(addOns []AddOn, sku, name string) int {
+	return findKey(len(addOns), func(i int) (string, string) { return addOns[i].SKU, addOns[i].Name }, sku, name)
+}
+
+// findKey finds the row with the given SKU or, failing that, the row with the
+// given name and no other SKU, as Apply does
+func findKey(count int, row func(i int) (sku, name string), sku, name string) int {
+	if sku != "" {
+		for i := 0; i < count; i++ {
+			if rowSKU, _ := row(i); rowSKU == sku {
+				return i
+			}
+		}
+	}
+	for i := 0; i < count; i++ {
+		if rowSKU, rowName := row(i); strings.EqualFold(rowName, name) && (rowSKU == "" || rowSKU == sku) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findRef finds the row a reference points to: a SKU, or a name as used by
+// the links of add-ons
+func findRef(count int, row func(i int) (sku, name string), ref string) int {
+	for i := 0; i < count; i++ {
+		if sku, _ := row(i); sku != "" && sku == ref {
+			return i
+		}
+	}
+	for i := 0; i < count; i++ {
+		if _, name := row(i); strings.EqualFold(name, ref) {
+			return i
+		}
+	}
+	return -1
+}
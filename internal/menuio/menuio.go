@@ -0,0 +1,399 @@
+// Package menuio reads and writes categories, menu items and add-ons as CSV
+// or JSON for bulk import and export
+package menuio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Kinds of rows, as used in the type column of a CSV file
+const (
+	KindCategory = "category"
+	KindMenuItem = "menu_item"
+	KindAddOn    = "add_on"
+)
+
+// listSeparator separates the entries of list columns in CSV files
+const listSeparator = "|"
+
+var csvHeader = []string{
+	"type", "sku", "name", "category", "description", "price", "cogs",
+	"item_type", "is_available", "image_url", "menu_items", "categories",
+}
+
+// Menu is the file representation of a menu. Rows refer to each other by
+// name or SKU rather than by ID, so a file can move between outlets.
+type Menu struct {
+	Categories []Category `json:"categories"`
+	MenuItems  []MenuItem `json:"menu_items"`
+	AddOns     []AddOn    `json:"add_ons"`
+}
+
+type Category struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type MenuItem struct {
+	SKU         string  `json:"sku,omitempty"`
+	Name        string  `json:"name"`
+	Category    string  `json:"category"` // Category name
+	Description string  `json:"description,omitempty"`
+	Price       float64 `json:"price"`
+	COGS        float64 `json:"cogs"`                   // Ignored for items with a recipe and for bundles
+	ItemType    string  `json:"item_type,omitempty"`    // item, bundle; defaults to item
+	IsAvailable *bool   `json:"is_available,omitempty"` // Defaults to true for new items and leaves existing ones unchanged
+	ImageURL    string  `json:"image_url,omitempty"`
+}
+
+type AddOn struct {
+	SKU         string   `json:"sku,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Price       float64  `json:"price"`
+	COGS        float64  `json:"cogs"` // Ignored for add-ons with a recipe
+	IsAvailable *bool    `json:"is_available,omitempty"`
+	MenuItems   []string `json:"menu_items,omitempty"` // SKUs or names of linked menu items
+	Categories  []string `json:"categories,omitempty"` // Names of linked categories; no links makes the add-on global
+}
+
+// Issue is a problem with one row of an import
+type Issue struct {
+	Kind    string `json:"type"`
+	Row     int    `json:"row"` // 1-based position among the rows of its kind
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (i Issue) Error() string {
+	return fmt.Sprintf("%s %d (%s): %s", i.Kind, i.Row, i.Name, i.Message)
+}
+
+// Read decodes a menu in the given format
+func Read(r io.Reader, format string) (*Menu, error) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatJSON:
+		return ReadJSON(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// Write encodes a menu in the given format
+func Write(w io.Writer, format string, menu *Menu) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, menu)
+	case FormatJSON:
+		return WriteJSON(w, menu)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func ReadJSON(r io.Reader) (*Menu, error) {
+	var menu Menu
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&menu); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return &menu, nil
+}
+
+func WriteJSON(w io.Writer, menu *Menu) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(menu)
+}
+
+// ReadCSV decodes a menu from a single CSV file with one row per category,
+// menu item or add-on, told apart by the type column. Columns may come in any
+// order; unknown columns are an error.
+func ReadCSV(r io.Reader) (*Menu, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &Menu{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !knownColumn(name) {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["type"]; !ok {
+		return nil, fmt.Errorf("CSV is missing the type column")
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("CSV is missing the name column")
+	}
+
+	menu := &Menu{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		price, err := parseNumber(field("price"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price: %w", line, err)
+		}
+		cogs, err := parseNumber(field("cogs"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid cogs: %w", line, err)
+		}
+		isAvailable, err := parseOptionalBool(field("is_available"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid is_available: %w", line, err)
+		}
+
+		switch kind := field("type"); kind {
+		case KindCategory:
+			menu.Categories = append(menu.Categories, Category{
+				Name:        field("name"),
+				Description: field("description"),
+			})
+		case KindMenuItem:
+			menu.MenuItems = append(menu.MenuItems, MenuItem{
+				SKU:         field("sku"),
+				Name:        field("name"),
+				Category:    field("category"),
+				Description: field("description"),
+				Price:       price,
+				COGS:        cogs,
+				ItemType:    field("item_type"),
+				IsAvailable: isAvailable,
+				ImageURL:    field("image_url"),
+			})
+		case KindAddOn:
+			menu.AddOns = append(menu.AddOns, AddOn{
+				SKU:         field("sku"),
+				Name:        field("name"),
+				Description: field("description"),
+				Price:       price,
+				COGS:        cogs,
+				IsAvailable: isAvailable,
+				MenuItems:   splitList(field("menu_items")),
+				Categories:  splitList(field("categories")),
+			})
+		case "":
+			// Skip blank lines
+			if strings.Join(record, "") != "" {
+				return nil, fmt.Errorf("line %d: missing type", line)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown type %q", line, kind)
+		}
+	}
+
+	return menu, nil
+}
+
+func WriteCSV(w io.Writer, menu *Menu) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, category := range menu.Categories {
+		if err := writer.Write([]string{
+			KindCategory, "", category.Name, "", category.Description, "", "", "", "", "", "", "",
+		}); err != nil {
+			return err
+		}
+	}
+	for _, item := range menu.MenuItems {
+		if err := writer.Write([]string{
+			KindMenuItem, item.SKU, item.Name, item.Category, item.Description,
+			formatNumber(item.Price), formatNumber(item.COGS), item.ItemType,
+			formatOptionalBool(item.IsAvailable), item.ImageURL, "", "",
+		}); err != nil {
+			return err
+		}
+	}
+	for _, addOn := range menu.AddOns {
+		if err := writer.Write([]string{
+			KindAddOn, addOn.SKU, addOn.Name, "", addOn.Description,
+			formatNumber(addOn.Price), formatNumber(addOn.COGS), "",
+			formatOptionalBool(addOn.IsAvailable), "",
+			strings.Join(addOn.MenuItems, listSeparator), strings.Join(addOn.Categories, listSeparator),
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Validate checks the rows of a menu on their own, without looking at the
+// database: required fields, ranges and duplicate keys within the file
+func Validate(menu *Menu) []Issue {
+	var issues []Issue
+
+	categoryNames := make(map[string]bool)
+	for i, category := range menu.Categories {
+		issue := func(message string) {
+			issues = append(issues, Issue{Kind: KindCategory, Row: i + 1, Name: category.Name, Message: message})
+		}
+		if category.Name == "" {
+			issue("name is required")
+			continue
+		}
+		if key := strings.ToLower(category.Name); categoryNames[key] {
+			issue("duplicate category name")
+		} else {
+			categoryNames[key] = true
+		}
+	}
+
+	menuItemKeys := make(map[string]bool)
+	for i, item := range menu.MenuItems {
+		issue := func(message string) {
+			issues = append(issues, Issue{Kind: KindMenuItem, Row: i + 1, Name: item.Name, Message: message})
+		}
+		if item.Name == "" {
+			issue("name is required")
+		}
+		if item.Category == "" {
+			issue("category is required")
+		}
+		if item.Price < 0 {
+			issue("price cannot be negative")
+		}
+		if item.COGS < 0 {
+			issue("cogs cannot be negative")
+		}
+		if item.ItemType != "" && item.ItemType != "item" && item.ItemType != "bundle" {
+			issue(fmt.Sprintf("invalid item_type %q", item.ItemType))
+		}
+		if key := Key(item.SKU, item.Name); key != "" {
+			if menuItemKeys[key] {
+				issue("duplicate SKU or name")
+			}
+			menuItemKeys[key] = true
+		}
+	}
+
+	addOnKeys := make(map[string]bool)
+	for i, addOn := range menu.AddOns {
+		issue := func(message string) {
+			issues = append(issues, Issue{Kind: KindAddOn, Row: i + 1, Name: addOn.Name, Message: message})
+		}
+		if addOn.Name == "" {
+			issue("name is required")
+		}
+		if addOn.Price < 0 {
+			issue("price cannot be negative")
+		}
+		if addOn.COGS < 0 {
+			issue("cogs cannot be negative")
+		}
+		if key := Key(addOn.SKU, addOn.Name); key != "" {
+			if addOnKeys[key] {
+				issue("duplicate SKU or name")
+			}
+			addOnKeys[key] = true
+		}
+	}
+
+	return issues
+}
+
+// Key identifies a menu item or add-on in a file: its SKU if it has one,
+// otherwise its case-insensitive name
+func Key(sku, name string) string {
+	if sku != "" {
+		return "sku:" + sku
+	}
+	if name != "" {
+		return "name:" + strings.ToLower(name)
+	}
+	return ""
+}
+
+func knownColumn(name string) bool {
+	for _, column := range csvHeader {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNumber(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func parseOptionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func formatOptionalBool(value *bool) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*value)
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var list []string
+	for _, entry := range strings.Split(value, listSeparator) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
@@ -0,0 +1,185 @@
+package menuio
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	available := false
+	menu := &Menu{
+		Categories: []Category{{Name: "Coffee", Description: "Hot and iced, with milk"}},
+		MenuItems: []MenuItem{
+			{SKU: "ESP-01", Name: "Espresso", Category: "Coffee", Price: 25000, COGS: 8000.5, ItemType: "item"},
+			{Name: "Iced Latte", Category: "Coffee", Price: 32000, IsAvailable: &available},
+		},
+		AddOns: []AddOn{
+			{SKU: "SHOT", Name: "Extra Shot", Price: 5000, COGS: 2000, MenuItems: []string{"ESP-01", "Iced Latte"}, Categories: []string{"Coffee"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, menu); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	decoded, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatalf("ReadCSV failed: %v", err)
+	}
+	if !reflect.DeepEqual(menu, decoded) {
+		t.Errorf("Expected %+v, got %+v", menu, decoded)
+	}
+}
+
+func TestReadCSVColumnsInAnyOrder(t *testing.T) {
+	input := "name,type,price,category\nLatte,menu_item,30000,Coffee\n\nCoffee,category,,\n"
+
+	menu, err := ReadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadCSV failed: %v", err)
+	}
+	if len(menu.MenuItems) != 1 || menu.MenuItems[0].Price != 30000 || menu.MenuItems[0].Category != "Coffee" {
+		t.Errorf("Unexpected menu items: %+v", menu.MenuItems)
+	}
+	if len(menu.Categories) != 1 || menu.Categories[0].Name != "Coffee" {
+		t.Errorf("Unexpected categories: %+v", menu.Categories)
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown column": "type,name,colour\nmenu_item,Latte,brown\n",
+		"missing type":   "name,price\nLatte,30000\n",
+		"unknown type":   "type,name\ndrink,Latte\n",
+		"invalid price":  "type,name,price\nmenu_item,Latte,abc\n",
+	}
+
+	for name, input := range tests {
+		if _, err := ReadCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	menu := &Menu{
+		Categories: []Category{{Name: "Coffee"}, {Name: "coffee"}},
+		MenuItems: []MenuItem{
+			{SKU: "ESP-01", Name: "Espresso", Category: "Coffee", Price: 25000},
+			{SKU: "ESP-01", Name: "Double Espresso", Category: "Coffee", Price: 30000},
+			{Name: "Latte", Price: -1, ItemType: "combo"},
+		},
+		AddOns: []AddOn{{Name: "Extra Shot"}, {Name: "extra shot"}},
+	}
+
+	issues := Validate(menu)
+
+	expected := []string{
+		"category 2 (coffee): duplicate category name",
+		"menu_item 2 (Double Espresso): duplicate SKU or name",
+		"menu_item 3 (Latte): category is required",
+		"menu_item 3 (Latte): price cannot be negative",
+		`menu_item 3 (Latte): invalid item_type "combo"`,
+		"add_on 2 (extra shot): duplicate SKU or name",
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %d: %v", len(expected), len(issues), issues)
+	}
+	for i, issue := range issues {
+		if issue.Error() != expected[i] {
+			t.Errorf("Expected issue %q, got %q", expected[i], issue.Error())
+		}
+	}
+}
+
+func TestUpsertAndRemove(t *testing.T) {
+	menu := &Menu{
+		Categories: []Category{{Name: "Coffee"}},
+		MenuItems:  []MenuItem{{SKU: "ESP-01", Name: "Espresso", Category: "Coffee", Price: 25000}},
+	}
+
+	menu.Upsert(Menu{
+		Categories: []Category{{Name: "coffee", Description: "Hot"}},
+		MenuItems: []MenuItem{
+			{SKU: "ESP-01", Name: "Double Espresso", Category: "Coffee", Price: 30000},
+			{Name: "Latte", Category: "Coffee", Price: 32000},
+		},
+	})
+	if len(menu.Categories) != 1 || menu.Categories[0].Description != "Hot" {
+		t.Errorf("Expected category to be replaced, got %+v", menu.Categories)
+	}
+	if len(menu.MenuItems) != 2 || menu.MenuItems[0].Price != 30000 {
+		t.Errorf("Expected espresso replaced by SKU and latte added, got %+v", menu.MenuItems)
+	}
+
+	if err := menu.Remove(RowRefs{MenuItems: []string{"latte", "Mocha"}}); err == nil {
+		t.Error("Expected error for a missing row")
+	}
+	if len(menu.MenuItems) != 2 {
+		t.Errorf("Expected nothing removed after an error, got %+v", menu.MenuItems)
+	}
+
+	if err := menu.Remove(RowRefs{MenuItems: []string{"latte"}}); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(menu.MenuItems) != 1 || menu.MenuItems[0].SKU != "ESP-01" {
+		t.Errorf("Expected only espresso left, got %+v", menu.MenuItems)
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	menu := &Menu{
+		Categories: []Category{{Name: "Coffee"}},
+		MenuItems:  []MenuItem{{SKU: "ESP-01", Name: "Espresso", Category: "Tea"}},
+		AddOns:     []AddOn{{Name: "Extra Shot", MenuItems: []string{"ESP-01", "Latte"}, Categories: []string{"coffee"}}},
+	}
+
+	issues := CheckReferences(menu)
+	if len(issues) != 2 {
+		t.Fatalf("Expected 2 issues, got %+v", issues)
+	}
+	if issues[0].Kind != KindMenuItem || issues[1].Kind != KindAddOn {
+		t.Errorf("Unexpected issues: %+v", issues)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	available, unavailable := true, false
+	live := &Menu{
+		Categories: []Category{{Name: "Coffee"}, {Name: "Tea"}},
+		MenuItems: []MenuItem{
+			{SKU: "ESP-01", Name: "Espresso", Category: "Coffee", Price: 25000, ItemType: "item", IsAvailable: &unavailable},
+			{Name: "Green Tea", Category: "Tea", Price: 20000, ItemType: "item", IsAvailable: &available},
+		},
+		AddOns: []AddOn{{Name: "Extra Shot", Price: 5000, MenuItems: []string{"ESP-01"}, IsAvailable: &available}},
+	}
+	draft := &Menu{
+		Categories: []Category{{Name: "Coffee"}, {Name: "Pastries"}},
+		MenuItems: []MenuItem{
+			// Unset availability and item type keep what is live
+			{SKU: "ESP-01", Name: "Espresso", Category: "Coffee", Price: 27000},
+		},
+		AddOns: []AddOn{{Name: "extra shot", Price: 5000, MenuItems: []string{"esp-01"}, IsAvailable: &available}},
+	}
+
+	changes := Diff(live, draft)
+	expected := []Change{
+		{Kind: KindCategory, Name: "Pastries", Action: ActionAdd},
+		{Kind: KindCategory, Name: "Tea", Action: ActionRemove},
+		{Kind: KindMenuItem, Name: "Espresso", SKU: "ESP-01", Action: ActionChange,
+			Fields: []FieldChange{{Field: "price", From: 25000.0, To: 27000.0}}},
+		{Kind: KindMenuItem, Name: "Green Tea", Action: ActionRemove},
+		{Kind: KindAddOn, Name: "extra shot", Action: ActionChange,
+			Fields: []FieldChange{{Field: "name", From: "Extra Shot", To: "extra shot"}}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+
+	if changes := Diff(live, live); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+}
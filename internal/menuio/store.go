@@ -0,0 +1,596 @@
+package menuio
+
+import (
+	"fmt"
+	"pos-system/internal/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Report describes what an import did, or would do for a dry run
+type Report struct {
+	DryRun     bool     `json:"dry_run"`
+	Applied    bool     `json:"applied"`
+	Categories Summary  `json:"categories"`
+	MenuItems  Summary  `json:"menu_items"`
+	AddOns     Summary  `json:"add_ons"`
+	Rows       []Result `json:"rows"`
+	Errors     []Issue  `json:"errors"`
+	Changed    []uint   `json:"-"` // Menu items created or updated, for bundle recalculation
+	Images     []string `json:"-"` // Storage keys of uploaded images replaced by another image_url, to remove once applied
+}
+
+type Summary struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Removed   int `json:"removed,omitempty"` // Left out of a complete menu; see Prune
+}
+
+// Result is the outcome of one row
+type Result struct {
+	Kind   string `json:"type"`
+	Row    int    `json:"row"`
+	Name   string `json:"name"`
+	ID     uint   `json:"id,omitempty"` // Not kept for rows created by a dry run
+	Action string `json:"action"`       // create, update, unchanged
+}
+
+// Valid reports whether the import had no row errors
+func (r *Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Export reads every category, menu item and add-on, ordered by name
+func Export(db *gorm.DB) (*Menu, error) {
+	var categories []models.Category
+	if err := db.Order("name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	var menuItems []models.MenuItem
+	if err := db.Preload("Category").Order("name").Find(&menuItems).Error; err != nil {
+		return nil, err
+	}
+	var addOns []models.AddOn
+	if err := db.Preload("MenuItems").Preload("Categories").Order("name").Find(&addOns).Error; err != nil {
+		return nil, err
+	}
+
+	menu := &Menu{
+		Categories: make([]Category, len(categories)),
+		MenuItems:  make([]MenuItem, len(menuItems)),
+		AddOns:     make([]AddOn, len(addOns)),
+	}
+	for i, category := range categories {
+		menu.Categories[i] = Category{Name: category.Name, Description: category.Description}
+	}
+	for i, item := range menuItems {
+		isAvailable := item.IsAvailable
+		menu.MenuItems[i] = MenuItem{
+			SKU:         item.SKU,
+			Name:        item.Name,
+			Category:    item.Category.Name,
+			Description: item.Description,
+			Price:       item.Price,
+			COGS:        item.COGS,
+			ItemType:    item.ItemType,
+			IsAvailable: &isAvailable,
+			ImageURL:    item.ImageURL,
+		}
+	}
+	for i, addOn := range addOns {
+		isAvailable := addOn.IsAvailable
+		row := AddOn{
+			SKU:         addOn.SKU,
+			Name:        addOn.Name,
+			Description: addOn.Description,
+			Price:       addOn.Price,
+			COGS:        addOn.COGS,
+			IsAvailable: &isAvailable,
+		}
+		for _, item := range addOn.MenuItems {
+			row.MenuItems = append(row.MenuItems, firstNonEmpty(item.SKU, item.Name))
+		}
+		for _, category := range addOn.Categories {
+			row.Categories = append(row.Categories, category.Name)
+		}
+		menu.AddOns[i] = row
+	}
+
+	return menu, nil
+}
+
+// Apply upserts a menu inside tx: categories by name, menu items and add-ons
+// by SKU, or by name when the file row has no SKU or no row has that SKU yet.
+// It carries on past row errors so the report lists all of them; the caller
+// must roll tx back unless the report is valid. The returned error is for
+// database failures only.
+func Apply(tx *gorm.DB, menu *Menu, userID *uint) (*Report, error) {
+	report := &Report{Rows: []Result{}, Errors: Validate(menu)}
+	if !report.Valid() {
+		return report, nil
+	}
+
+	categoryIDs := make(map[string]uint)
+	var updatedCategories []uint
+	for i, row := range menu.Categories {
+		id, action, err := applyCategory(tx, row)
+		if err != nil {
+			return nil, err
+		}
+		if action == "update" {
+			updatedCategories = append(updatedCategories, id)
+		}
+		categoryIDs[strings.ToLower(row.Name)] = id
+		report.record(&report.Categories, Result{Kind: KindCategory, Row: i + 1, Name: row.Name, ID: id, Action: action})
+	}
+
+	findCategory := func(name string) (uint, error) {
+		if id, ok := categoryIDs[strings.ToLower(name)]; ok {
+			return id, nil
+		}
+		var categories []models.Category
+		if err := tx.Where("LOWER(name) = LOWER(?)", name).Find(&categories).Error; err != nil {
+			return 0, err
+		}
+		if len(categories) != 1 {
+			return 0, nil
+		}
+		categoryIDs[strings.ToLower(name)] = categories[0].ID
+		return categories[0].ID, nil
+	}
+
+	for i, row := range menu.MenuItems {
+		issue := func(message string) {
+			report.Errors = append(report.Errors, Issue{Kind: KindMenuItem, Row: i + 1, Name: row.Name, Message: message})
+		}
+
+		categoryID, err := findCategory(row.Category)
+		if err != nil {
+			return nil, err
+		}
+		if categoryID == 0 {
+			issue(fmt.Sprintf("category %q not found", row.Category))
+			continue
+		}
+
+		var existing models.MenuItem
+		found, err := findByKey(tx, &existing, row.SKU, row.Name)
+		if err != nil {
+			if err == errAmbiguous {
+				issue("name matches more than one menu item; add a SKU")
+				continue
+			}
+			return nil, err
+		}
+
+		id, action, err := applyMenuItem(tx, row, categoryID, found, existing, userID)
+		if err != nil {
+			if rowErr, ok := err.(rowError); ok {
+				issue(string(rowErr))
+				continue
+			}
+			return nil, err
+		}
+		if action != "unchanged" {
+			report.Changed = append(report.Changed, id)
+		}
+		if found && existing.ImageKey != "" && existing.ImageURL != row.ImageURL {
+			report.Images = append(report.Images, existing.ImageKey)
+		}
+		report.record(&report.MenuItems, Result{Kind: KindMenuItem, Row: i + 1, Name: row.Name, ID: id, Action: action})
+	}
+
+	for i, row := range menu.AddOns {
+		issue := func(message string) {
+			report.Errors = append(report.Errors, Issue{Kind: KindAddOn, Row: i + 1, Name: row.Name, Message: message})
+		}
+
+		var menuItems []models.MenuItem
+		for _, ref := range row.MenuItems {
+			var menuItem models.MenuItem
+			found, err := findByKey(tx, &menuItem, ref, ref)
+			if err == errAmbiguous {
+				issue(fmt.Sprintf("menu item %q matches more than one menu item; use its SKU", ref))
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				issue(fmt.Sprintf("menu item %q not found", ref))
+				continue
+			}
+			menuItems = append(menuItems, menuItem)
+		}
+
+		var categories []models.Category
+		for _, name := range row.Categories {
+			categoryID, err := findCategory(name)
+			if err != nil {
+				return nil, err
+			}
+			if categoryID == 0 {
+				issue(fmt.Sprintf("category %q not found", name))
+				continue
+			}
+			categories = append(categories, models.Category{ID: categoryID})
+		}
+
+		var existing models.AddOn
+		found, err := findByKey(tx, &existing, row.SKU, row.Name)
+		if err != nil {
+			if err == errAmbiguous {
+				issue("name matches more than one add-on; add a SKU")
+				continue
+			}
+			return nil, err
+		}
+
+		id, action, err := applyAddOn(tx, row, found, existing, menuItems, categories, userID)
+		if err != nil {
+			return nil, err
+		}
+		report.record(&report.AddOns, Result{Kind: KindAddOn, Row: i + 1, Name: row.Name, ID: id, Action: action})
+	}
+
+	// Items are searched by their own and their category's names
+	if len(report.Changed) > 0 {
+		if err := models.RefreshSearchText(tx, "id IN ?", report.Changed); err != nil {
+			return nil, err
+		}
+	}
+	if len(updatedCategories) > 0 {
+		if err := models.RefreshSearchText(tx, "category_id IN ?", updatedCategories); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// Prune deletes the categories, menu items and add-ons that a menu applied
+// with Apply left out, so the live menu matches it exactly. It must run in
+// the same transaction, after a valid Apply. Deleted menu items lose their
+// barcodes and uploaded images, whose keys are added to the report for
+// removal; deleted add-ons lose their links and deleted categories' children
+// move to the top level, as when deleting through the menu endpoints.
+func Prune(tx *gorm.DB, report *Report) error {
+	keep := map[string][]uint{KindCategory: {0}, KindMenuItem: {0}, KindAddOn: {0}}
+	for _, row := range report.Rows {
+		keep[row.Kind] = append(keep[row.Kind], row.ID)
+	}
+
+	var menuItems []models.MenuItem
+	if err := tx.Where("id NOT IN ?", keep[KindMenuItem]).Find(&menuItems).Error; err != nil {
+		return err
+	}
+	for _, menuItem := range menuItems {
+		if err := tx.Delete(&menuItem).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("menu_item_id = ?", menuItem.ID).Delete(&models.Barcode{}).Error; err != nil {
+			return err
+		}
+		if menuItem.ImageKey != "" {
+			report.Images = append(report.Images, menuItem.ImageKey)
+			if err := tx.Unscoped().Model(&menuItem).Updates(map[string]interface{}{"image_url": "", "thumbnail_url": "", "image_key": ""}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	report.MenuItems.Removed = len(menuItems)
+
+	var addOns []models.AddOn
+	if err := tx.Where("id NOT IN ?", keep[KindAddOn]).Find(&addOns).Error; err != nil {
+		return err
+	}
+	for _, addOn := range addOns {
+		if err := tx.Model(&addOn).Association("MenuItems").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(&addOn).Association("Categories").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Delete(&addOn).Error; err != nil {
+			return err
+		}
+	}
+	report.AddOns.Removed = len(addOns)
+
+	var categories []models.Category
+	if err := tx.Where("id NOT IN ?", keep[KindCategory]).Find(&categories).Error; err != nil {
+		return err
+	}
+	for _, category := range categories {
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&category).Error; err != nil {
+			return err
+		}
+	}
+	report.Categories.Removed = len(categories)
+
+	return nil
+}
+
+func (r *Report) record(summary *Summary, result Result) {
+	switch result.Action {
+	case "create":
+		summary.Created++
+	case "update":
+		summary.Updated++
+	default:
+		summary.Unchanged++
+	}
+	r.Rows = append(r.Rows, result)
+}
+
+// rowError is a problem with a file row that should be reported rather than
+// abort the import
+type rowError string
+
+func (e rowError) Error() string { return string(e) }
+
+var errAmbiguous = fmt.Errorf("ambiguous name")
+
+// findByKey loads the menu item or add-on with the given SKU or, failing that,
+// the only one with the given name, provided it has no other SKU
+func findByKey(tx *gorm.DB, dest interface{}, sku, name string) (bool, error) {
+	if sku != "" {
+		result := tx.Where("sku = ?", sku).Limit(1).Find(dest)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return true, nil
+		}
+	}
+	if name == "" {
+		return false, nil
+	}
+
+	var count int64
+	if err := tx.Model(dest).Where("LOWER(name) = LOWER(?)", name).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 1 {
+		return false, errAmbiguous
+	}
+
+	result := tx.Where("LOWER(name) = LOWER(?) AND (sku = '' OR sku IS NULL OR sku = ?)", name, sku).
+		Limit(1).
+		Find(dest)
+	return result.RowsAffected > 0, result.Error
+}
+
+func applyCategory(tx *gorm.DB, row Category) (uint, string, error) {
+	var category models.Category
+	result := tx.Where("LOWER(name) = LOWER(?)", row.Name).Limit(1).Find(&category)
+	if result.Error != nil {
+		return 0, "", result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		category = models.Category{Name: row.Name, Description: row.Description}
+		if err := tx.Create(&category).Error; err != nil {
+			return 0, "", err
+		}
+		return category.ID, "create", nil
+	}
+
+	if category.Name == row.Name && category.Description == row.Description {
+		return category.ID, "unchanged", nil
+	}
+	category.Name = row.Name
+	category.Description = row.Description
+	if err := tx.Omit(clause.Associations).Save(&category).Error; err != nil {
+		return 0, "", err
+	}
+	return category.ID, "update", nil
+}
+
+func applyMenuItem(tx *gorm.DB, row MenuItem, categoryID uint, found bool, menuItem models.MenuItem, userID *uint) (uint, string, error) {
+	itemType := row.ItemType
+	if itemType == "" {
+		itemType = "item"
+	}
+
+	if !found {
+		menuItem = models.MenuItem{IsAvailable: true, ItemType: itemType}
+	} else if menuItem.ItemType != itemType {
+		var slotCount int64
+		tx.Model(&models.BundleSlot{}).Where("bundle_id = ? OR menu_item_id = ?", menuItem.ID, menuItem.ID).Count(&slotCount)
+		if slotCount > 0 {
+			return 0, "", rowError("cannot change the type of a menu item used in bundle slots")
+		}
+	}
+	before := menuItem
+
+	// Recipes and bundle components decide COGS for the items that have them
+	var recipeLines int64
+	if found {
+		tx.Model(&models.RecipeLine{}).Where("menu_item_id = ?", menuItem.ID).Count(&recipeLines)
+	}
+	if recipeLines == 0 && itemType != "bundle" {
+		menuItem.COGS = row.COGS
+	}
+
+	menuItem.SKU = row.SKU
+	menuItem.Name = row.Name
+	menuItem.CategoryID = categoryID
+	menuItem.Description = row.Description
+	menuItem.Price = row.Price
+	menuItem.ItemType = itemType
+	if menuItem.ImageURL != row.ImageURL {
+		menuItem.ImageURL = row.ImageURL
+		menuItem.ThumbnailURL = ""
+		menuItem.ImageKey = ""
+	}
+	if row.IsAvailable != nil {
+		// Switching availability by hand overrides sold out, as in the menu endpoints
+		if *row.IsAvailable != menuItem.IsAvailable {
+			menuItem.SoldOut = false
+		}
+		menuItem.IsAvailable = *row.IsAvailable
+	}
+
+	action := "update"
+	if !found {
+		action = "create"
+		if err := tx.Omit(clause.Associations).Create(&menuItem).Error; err != nil {
+			return 0, "", err
+		}
+	} else {
+		after := menuItem
+		if after.SKU == before.SKU && after.Name == before.Name && after.CategoryID == before.CategoryID &&
+			after.Description == before.Description && after.Price == before.Price && after.COGS == before.COGS &&
+			after.ItemType == before.ItemType && after.ImageURL == before.ImageURL &&
+			after.IsAvailable == before.IsAvailable && after.SoldOut == before.SoldOut {
+			return menuItem.ID, "unchanged", nil
+		}
+		if err := tx.Omit(clause.Associations).Save(&menuItem).Error; err != nil {
+			return 0, "", err
+		}
+	}
+
+	if !found || menuItem.Price != before.Price || menuItem.COGS != before.COGS {
+		entry := models.PriceHistory{
+			MenuItemID: &menuItem.ID,
+			Price:      menuItem.Price,
+			COGS:       menuItem.COGS,
+			Source:     "import",
+			UserID:     userID,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return 0, "", err
+		}
+	}
+
+	return menuItem.ID, action, nil
+}
+
+func applyAddOn(tx *gorm.DB, row AddOn, found bool, addOn models.AddOn, menuItems []models.MenuItem, categories []models.Category, userID *uint) (uint, string, error) {
+	if !found {
+		addOn = models.AddOn{IsAvailable: true}
+	}
+	before := addOn
+
+	var recipeLines int64
+	if found {
+		tx.Model(&models.RecipeLine{}).Where("add_on_id = ?", addOn.ID).Count(&recipeLines)
+	}
+	if recipeLines == 0 {
+		addOn.COGS = row.COGS
+	}
+
+	addOn.SKU = row.SKU
+	addOn.Name = row.Name
+	addOn.Description = row.Description
+	addOn.Price = row.Price
+	if row.IsAvailable != nil {
+		if *row.IsAvailable != addOn.IsAvailable {
+			addOn.SoldOut = false
+		}
+		addOn.IsAvailable = *row.IsAvailable
+	}
+
+	linksChanged := true
+	if found {
+		var err error
+		if linksChanged, err = addOnLinksChanged(tx, addOn.ID, menuItems, categories); err != nil {
+			return 0, "", err
+		}
+	}
+
+	action := "update"
+	if !found {
+		action = "create"
+		if err := tx.Omit(clause.Associations).Create(&addOn).Error; err != nil {
+			return 0, "", err
+		}
+	} else {
+		if addOn.SKU == before.SKU && addOn.Name == before.Name && addOn.Description == before.Description &&
+			addOn.Price == before.Price && addOn.COGS == before.COGS &&
+			addOn.IsAvailable == before.IsAvailable && addOn.SoldOut == before.SoldOut && !linksChanged {
+			return addOn.ID, "unchanged", nil
+		}
+		if err := tx.Omit(clause.Associations).Save(&addOn).Error; err != nil {
+			return 0, "", err
+		}
+	}
+
+	if linksChanged {
+		if err := tx.Model(&addOn).Association("MenuItems").Replace(menuItems); err != nil {
+			return 0, "", err
+		}
+		if err := tx.Model(&addOn).Association("Categories").Replace(categories); err != nil {
+			return 0, "", err
+		}
+	}
+
+	if !found || addOn.Price != before.Price || addOn.COGS != before.COGS {
+		entry := models.PriceHistory{
+			AddOnID: &addOn.ID,
+			Price:   addOn.Price,
+			COGS:    addOn.COGS,
+			Source:  "import",
+			UserID:  userID,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return 0, "", err
+		}
+	}
+
+	return addOn.ID, action, nil
+}
+
+// addOnLinksChanged reports whether the add-on is linked to a different set of
+// menu items or categories than given
+func addOnLinksChanged(tx *gorm.DB, addOnID uint, menuItems []models.MenuItem, categories []models.Category) (bool, error) {
+	var menuItemIDs, categoryIDs []uint
+	if err := tx.Table("add_on_menu_items").Where("add_on_id = ?", addOnID).Pluck("menu_item_id", &menuItemIDs).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Table("add_on_categories").Where("add_on_id = ?", addOnID).Pluck("category_id", &categoryIDs).Error; err != nil {
+		return false, err
+	}
+
+	wantMenuItems := make([]uint, len(menuItems))
+	for i, item := range menuItems {
+		wantMenuItems[i] = item.ID
+	}
+	wantCategories := make([]uint, len(categories))
+	for i, category := range categories {
+		wantCategories[i] = category.ID
+	}
+
+	return !sameIDs(menuItemIDs, wantMenuItems) || !sameIDs(categoryIDs, wantCategories), nil
+}
+
+func sameIDs(a, b []uint) bool {
+	set := make(map[uint]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	other := make(map[uint]bool, len(b))
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+		other[id] = true
+	}
+	return len(set) == len(other)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -1,14 +1,22 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"pos-system/internal/models"
 	"pos-system/pkg/auth"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
+// AuthMiddleware accepts the access tokens of active users that have not
+// been revoked. The role is read from the user, so role changes, like
+// deactivation and revocation, take effect at once. Tokens from a PIN login
+// are only accepted with the token of their device, which must still be
+// registered.
+func AuthMiddleware(jwtService *auth.JWTService, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -24,20 +32,79 @@ func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
 			return
 		}
 
+		// A token is only valid at the tenant it was issued by. Tokens from
+		// before sessions cannot be revoked, so they are refused.
 		claims, err := jwtService.ValidateToken(tokenString)
-		if err != nil {
+		if err != nil || claims.TenantID != c.GetUint("tenant_id") || claims.SessionID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		var user models.User
+		if err := db.WithContext(c).Select("id", "role", "is_active", "token_version").First(&user, claims.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+			}
+			c.Abort()
+			return
+		}
+		if !user.IsActive || user.TokenVersion != claims.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		var revoked int64
+		if err := db.WithContext(c).Model(&models.RevokedToken{}).
+			Where("token_id IN ?", []string{claims.ID, claims.SessionID}).
+			Count(&revoked).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+			c.Abort()
+			return
+		}
+		if revoked > 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		if claims.DeviceID != 0 {
+			var devices int64
+			if err := db.WithContext(c).Model(&models.Device{}).
+				Where("id = ? AND token_hash = ? AND revoked_at IS NULL", claims.DeviceID, auth.HashToken(c.GetHeader(auth.DeviceTokenHeader))).
+				Count(&devices).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+				c.Abort()
+				return
+			}
+			if devices == 0 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token is only valid on its device"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("claims", claims)
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
+		c.Set("role", user.Role)
 		c.Next()
 	}
 }
 
+// bearerToken returns the token of the Authorization header, if any
+func bearerToken(c *gin.Context) string {
+	authHeader := c.GetHeader("Authorization")
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return ""
+	}
+	return tokenString
+}
+
 func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("role")
@@ -63,7 +130,7 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Outlet-ID, X-Device-Token")
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"pos-system/internal/tenancy"
+	"pos-system/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantMiddleware finds the tenant a request is for: the subdomain it was
+// sent to, else the tenant of its token (even an expired one, so it can be
+// refreshed), else the default tenant. Database
+// queries made with the request's context only see that tenant's data, so
+// the router needs ContextWithFallback.
+func TenantMiddleware(resolver *tenancy.Resolver, jwtService *auth.JWTService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := resolver.FromHost(c.Request.Host)
+		if err == nil && tenant == nil {
+			if tenantID, claimErr := jwtService.TenantOf(bearerToken(c)); claimErr == nil {
+				tenant, err = resolver.ByID(tenantID)
+			} else {
+				tenant, err = resolver.Default()
+			}
+		}
+
+		switch {
+		case errors.Is(err, tenancy.ErrTenantNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			c.Abort()
+			return
+		case errors.Is(err, tenancy.ErrTenantRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tenant required"})
+			c.Abort()
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find tenant"})
+			c.Abort()
+			return
+		case !tenant.IsActive:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Tenant is suspended"})
+			c.Abort()
+			return
+		}
+
+		c.Set("tenant_id", tenant.ID)
+		c.Set("tenant_slug", tenant.Slug)
+		c.Request = c.Request.WithContext(tenancy.WithTenant(c.Request.Context(), tenant.ID))
+		c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Barcode is a scannable code for a menu item, such as the EAN-13 on a bag of
+// beans. An item can have several, e.g. for different suppliers or pack runs.
+type Barcode struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TenantID   uint      `json:"-" gorm:"not null;default:0;index;index:idx_barcodes_tenant_code,unique"`
+	MenuItemID uint      `json:"menu_item_id" gorm:"not null;index"`
+	Code       string    `json:"code" gorm:"not null;index:idx_barcodes_tenant_code,unique"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var (
+	ErrInvalidBarcode  = errors.New("barcode may only contain letters, digits and dashes")
+	ErrBarcodeChecksum = errors.New("barcode check digit is wrong")
+)
+
+// NormalizeBarcode trims a scanned or typed code and checks it. Codes of 8,
+// 12, 13 or 14 digits are GTINs (EAN-8, UPC-A, EAN-13, GTIN-14) and must have
+// a valid check digit, which catches most typing mistakes.
+func NormalizeBarcode(code string) (string, error) {
+	code = strings.ToUpper(strings.Join(strings.Fields(code), ""))
+	if code == "" || len(code) > 64 {
+		return "", ErrInvalidBarcode
+	}
+
+	numeric := true
+	for _, r := range code {
+		switch {
+		case r >= '0' && r <= '9':
+		case r >= 'A' && r <= 'Z', r == '-':
+			numeric = false
+		default:
+			return "", ErrInvalidBarcode
+		}
+	}
+
+	if numeric {
+		switch len(code) {
+		case 8, 12, 13, 14:
+			if !validGTIN(code) {
+				return "", ErrBarcodeChecksum
+			}
+		}
+	}
+	return code, nil
+}
+
+// validGTIN checks the mod-10 check digit: digits are weighted 3 and 1
+// alternately from the right, starting next to the check digit
+func validGTIN(code string) bool {
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		digit := int(code[i] - '0')
+		if (len(code)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return (10-sum%10)%10 == int(code[len(code)-1]-'0')
+}
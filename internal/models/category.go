@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Channels lists the sales channels something is shown on, stored as JSON.
+// An empty list shows it on every channel.
+type Channels []string
+
+func (c Channels) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(c))
+	return string(data), err
+}
+
+func (c *Channels) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Channels", value)
+	}
+	return json.Unmarshal(data, (*[]string)(c))
+}
+
+// Includes reports whether channel is one of the channels, which an empty
+// list always is
+func (c Channels) Includes(channel string) bool {
+	if len(c) == 0 {
+		return true
+	}
+	for _, ch := range c {
+		if ch == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// CategoryParents maps each category ID to its parent ID, nil for top-level
+// categories
+func CategoryParents(categories []Category) map[uint]*uint {
+	parents := make(map[uint]*uint, len(categories))
+	for _, category := range categories {
+		parents[category.ID] = category.ParentID
+	}
+	return parents
+}
+
+// WithDescendants returns the given categories together with every category
+// below them
+func WithDescendants(parents map[uint]*uint, ids map[uint]bool) map[uint]bool {
+	result := make(map[uint]bool, len(ids))
+	for id := range ids {
+		result[id] = true
+	}
+	if len(ids) == 0 {
+		return result
+	}
+
+	for id := range parents {
+		// Walk up to the root; the step limit guards against cycles in bad data
+		for ancestor, steps := &id, 0; ancestor != nil && steps <= len(parents); ancestor, steps = parents[*ancestor], steps+1 {
+			if ids[*ancestor] {
+				result[id] = true
+				break
+			}
+		}
+	}
+	return result
+}
+
+// CreatesCycle reports whether putting category id under parentID would make
+// the category its own ancestor
+func CreatesCycle(parents map[uint]*uint, id, parentID uint) bool {
+	for ancestor, steps := &parentID, 0; ancestor != nil; ancestor, steps = parents[*ancestor], steps+1 {
+		if *ancestor == id || steps > len(parents) {
+			return true
+		}
+	}
+	return false
+}
+
+// HiddenCategories returns the categories not shown on channel: those whose
+// channels leave it out, and everything below them
+func HiddenCategories(categories []Category, channel string) map[uint]bool {
+	hidden := make(map[uint]bool)
+	for _, category := range categories {
+		if !category.Channels.Includes(channel) {
+			hidden[category.ID] = true
+		}
+	}
+	return WithDescendants(CategoryParents(categories), hidden)
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// Customer is a person who orders, recognised by phone or email across visits
+type Customer struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	TenantID       uint           `json:"-" gorm:"not null;default:0;index;index:idx_customers_tenant_phone,unique;index:idx_customers_tenant_email,unique"`
+	Name           string         `json:"name" gorm:"not null"`
+	Phone          string         `json:"phone" gorm:"default:'';index:idx_customers_tenant_phone,unique,where:phone <> '' AND deleted_at IS NULL"` // E.164, e.g. +6281234567890
+	Email          string         `json:"email" gorm:"default:'';index:idx_customers_tenant_email,unique,where:email <> '' AND deleted_at IS NULL"` // Lowercase
+	Notes          string         `json:"notes"`
+	Points         int            `json:"points" gorm:"not null;default:0"`          // Loyalty points balance, kept in step with the ledger
+	LifetimePoints int            `json:"lifetime_points" gorm:"not null;default:0"` // Points earned ever, less reversals; decides the tier
+	TierID         *uint          `json:"tier_id"`
+	MergedIntoID   *uint          `json:"merged_into_id,omitempty" gorm:"index"` // Customer this duplicate was merged into
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+	Tier           *LoyaltyTier   `json:"tier,omitempty"`
+}
+
+// NormalizePhone turns a phone number as typed at the till into E.164 form,
+// so the same number always matches. Spaces, dashes, dots and brackets are
+// dropped. Numbers starting with 0 are local and get countryCode; numbers
+// starting with + or 00 already have a calling code, as do bare numbers
+// starting with countryCode. An empty phone stays empty.
+func NormalizePhone(phone, countryCode string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	if phone == "" {
+		return "", nil
+	}
+
+	international := strings.HasPrefix(phone, "+")
+	var digits strings.Builder
+	for i, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case international:
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case strings.HasPrefix(number, "0"):
+		number = countryCode + number[1:]
+	case !strings.HasPrefix(number, countryCode):
+		number = countryCode + number
+	}
+
+	// E.164 allows at most 15 digits; anything under 8 is too short to dial
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
+
+// NormalizeEmail trims and lowercases an email address
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Device is a terminal registered by a manager, e.g. a tablet shared by the
+// cashiers of an outlet. Users can only log in with their PIN on a
+// registered device, and the tokens they get only work together with the
+// device's token. Only the hash of the device token is stored.
+type Device struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	TenantID          uint       `json:"-" gorm:"not null;default:0;index"`
+	Name              string     `json:"name" gorm:"not null"`
+	OutletID          *uint      `json:"outlet_id" gorm:"index"` // Only users working at the outlet can log in; empty for any
+	TokenHash         string     `json:"-" gorm:"not null;uniqueIndex"`
+	RegisteredByID    uint       `json:"registered_by_id"`
+	FailedPINAttempts int        `json:"failed_pin_attempts" gorm:"not null;default:0"` // Wrong PINs since the last lockout or login
+	LockedUntil       *time.Time `json:"locked_until"`                                  // PIN logins are refused until then
+	LastUsedAt        *time.Time `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"revoked_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	Outlet            *Outlet    `json:"outlet,omitempty"`
+}
+
+// PINLocked reports whether PIN logins on the device are refused at the
+// given time
+func (d Device) PINLocked(now time.Time) bool {
+	return d.LockedUntil != nil && now.Before(*d.LockedUntil)
+}
+
+// PINFailed records a wrong PIN. The maxAttempts-th in a row locks PIN
+// logins on the device for lockout; it reports whether it did.
+func (d *Device) PINFailed(now time.Time, maxAttempts int, lockout time.Duration) bool {
+	d.FailedPINAttempts++
+	if d.FailedPINAttempts < maxAttempts {
+		return false
+	}
+	lockedUntil := now.Add(lockout)
+	d.LockedUntil = &lockedUntil
+	d.FailedPINAttempts = 0
+	return true
+}
+
+// PINSucceeded records a PIN login, which resets the failed attempts
+func (d *Device) PINSucceeded(now time.Time) {
+	d.FailedPINAttempts = 0
+	d.LockedUntil = nil
+	d.LastUsedAt = &now
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// House account ledger entry types
+const (
+	AccountCharge  = "charge"  // Order charged to the account
+	AccountPayment = "payment" // Settlement paid by the customer
+	AccountReverse = "reverse" // Charge taken back when its order is refunded
+	AccountAdjust  = "adjust"  // Manual correction
+)
+
+// HouseAccount lets a customer, usually a corporate client, order on credit
+// and settle later. Balance is what they owe, kept in step with the ledger.
+type HouseAccount struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TenantID    uint      `json:"-" gorm:"not null;default:0;index"`
+	CustomerID  uint      `json:"customer_id" gorm:"not null;uniqueIndex"`
+	CreditLimit float64   `json:"credit_limit" gorm:"not null;default:0"` // Most the customer may owe
+	Balance     float64   `json:"balance" gorm:"not null;default:0"`
+	Status      string    `json:"status" gorm:"not null;default:'active'"` // active, suspended
+	Notes       string    `json:"notes"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Customer    *Customer `json:"customer,omitempty"`
+}
+
+// HouseAccountEntry is an entry in a house account's ledger
+type HouseAccountEntry struct {
+	ID             uint         `json:"id" gorm:"primaryKey"`
+	TenantID       uint         `json:"-" gorm:"not null;default:0;index"`
+	HouseAccountID uint         `json:"house_account_id" gorm:"not null;index"`
+	Type           string       `json:"type" gorm:"not null"`   // charge, payment, reverse, adjust
+	Amount         float64      `json:"amount" gorm:"not null"` // Positive adds to what is owed
+	BalanceAfter   float64      `json:"balance_after" gorm:"not null"`
+	TransactionID  *uint        `json:"transaction_id" gorm:"index"` // Order charged or refunded
+	PaymentMethod  string       `json:"payment_method"`              // How a settlement was paid
+	Reference      string       `json:"reference"`                   // E.g. bank transfer reference
+	Note           string       `json:"note"`
+	UserID         *uint        `json:"user_id"`
+	CreatedAt      time.Time    `json:"created_at" gorm:"index"`
+	Transaction    *Transaction `json:"transaction,omitempty"`
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ingredient represents a raw material tracked in stock
+type Ingredient struct {
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	TenantID          uint           `json:"-" gorm:"not null;default:0;index"`
+	Name              string         `json:"name" gorm:"not null"`
+	Unit              string         `json:"unit" gorm:"not null"`                // g, ml, pcs
+	UnitCost          float64        `json:"unit_cost" gorm:"not null;default:0"` // Cost per unit
+	StockQty          float64        `json:"stock_qty" gorm:"not null;default:0"` // Quantity on hand, in Unit
+	LowStockThreshold float64        `json:"low_stock_threshold" gorm:"not null;default:0"`
+	LowStock          bool           `json:"low_stock" gorm:"default:false"` // Set while at or below the threshold, so each drop alerts once
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// IsLowStock reports whether the stock on hand is at or below the low-stock threshold
+func (i Ingredient) IsLowStock() bool {
+	return i.StockQty <= i.LowStockThreshold
+}
+
+// RecipeLine defines how much of an ingredient one menu item or add-on consumes
+type RecipeLine struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	TenantID     uint       `json:"-" gorm:"not null;default:0;index"`
+	MenuItemID   *uint      `json:"menu_item_id" gorm:"index"`
+	AddOnID      *uint      `json:"add_on_id" gorm:"index"`
+	IngredientID uint       `json:"ingredient_id" gorm:"not null;index"`
+	Quantity     float64    `json:"quantity" gorm:"not null"` // In the ingredient's unit
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Ingredient   Ingredient `json:"ingredient,omitempty"`
+}
+
+// StockMovement records a single change in ingredient stock. Movements form
+// the inventory ledger and are never updated or deleted.
+type StockMovement struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	TenantID        uint       `json:"-" gorm:"not null;default:0;index"`
+	IngredientID    uint       `json:"ingredient_id" gorm:"not null;index"`
+	OutletID        *uint      `json:"outlet_id" gorm:"index"`     // Outlet whose stock moved
+	Type            string     `json:"type" gorm:"not null;index"` // purchase, sale, refund, wastage, transfer, adjustment
+	Quantity        float64    `json:"quantity" gorm:"not null"`   // Signed: negative when stock leaves
+	UnitCost        float64    `json:"unit_cost" gorm:"not null;default:0"`
+	TotalCost       float64    `json:"total_cost" gorm:"not null;default:0"` // Signed like Quantity
+	Reason          string     `json:"reason" gorm:"default:''"`
+	UserID          *uint      `json:"user_id" gorm:"index"`
+	TransactionID   *uint      `json:"transaction_id" gorm:"index"`
+	StockTakeID     *uint      `json:"stock_take_id" gorm:"index"`
+	PurchaseOrderID *uint      `json:"purchase_order_id" gorm:"index"`
+	CreatedAt       time.Time  `json:"created_at" gorm:"index"`
+	Ingredient      Ingredient `json:"ingredient,omitempty"`
+	User            *User      `json:"user,omitempty"`
+}
+
+// StockTake represents a stock count (stock opname). Posting it records an
+// adjustment movement for every line whose count differs from the stock on hand.
+type StockTake struct {
+	ID        uint            `json:"id" gorm:"primaryKey"`
+	TenantID  uint            `json:"-" gorm:"not null;default:0;index"`
+	Status    string          `json:"status" gorm:"not null;default:'draft'"` // draft, posted
+	OutletID  *uint           `json:"outlet_id" gorm:"index"`                 // Outlet whose stock was counted
+	Notes     string          `json:"notes"`
+	UserID    uint            `json:"user_id"`
+	PostedBy  *uint           `json:"posted_by"`
+	PostedAt  *time.Time      `json:"posted_at"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	User      User            `json:"user,omitempty"`
+	Lines     []StockTakeLine `json:"lines,omitempty"`
+}
+
+// StockTakeLine is the counted quantity of one ingredient in a stock take
+type StockTakeLine struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	TenantID     uint       `json:"-" gorm:"not null;default:0;index"`
+	StockTakeID  uint       `json:"stock_take_id" gorm:"not null;index"`
+	IngredientID uint       `json:"ingredient_id" gorm:"not null"`
+	ExpectedQty  float64    `json:"expected_qty"` // Stock on hand when counted, refreshed on posting
+	CountedQty   float64    `json:"counted_qty" gorm:"not null"`
+	Variance     float64    `json:"variance"` // CountedQty - ExpectedQty
+	UnitCost     float64    `json:"unit_cost"`
+	Ingredient   Ingredient `json:"ingredient,omitempty"`
+}
+
+// AvailablePortions returns how many whole portions of a recipe the StockQty of
+// its lines' Ingredient allows. That is the total across outlets unless the
+// caller sets it to one outlet's stock, as availability is worked out per
+// outlet. The second result is false for an empty recipe, whose stock is not
+// tracked.
+func AvailablePortions(lines []RecipeLine) (int, bool) {
+	if len(lines) == 0 {
+		return 0, false
+	}
+
+	portions := math.Inf(1)
+	for _, line := range lines {
+		if line.Quantity <= 0 {
+			continue
+		}
+		portions = math.Min(portions, math.Floor(line.Ingredient.StockQty/line.Quantity))
+	}
+
+	if math.IsInf(portions, 1) {
+		return 0, false
+	}
+	if portions < 0 {
+		return 0, true
+	}
+	return int(portions), true
+}
+
+// RecipeCost returns the cost of a recipe from its lines' ingredient unit costs
+func RecipeCost(lines []RecipeLine) float64 {
+	var cost float64
+	for _, line := range lines {
+		cost += line.Quantity * line.Ingredient.UnitCost
+	}
+	return cost
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Invitation status values
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationExpired  = "expired"
+	InvitationRevoked  = "revoked"
+)
+
+// UserRoles are the roles a user can have
+var UserRoles = []string{"admin", "manager", "cashier"}
+
+// Invitation lets someone create their own account, with the role chosen by
+// the admin who invited them. Only the hash of its token is stored; it can
+// be accepted once, before it expires.
+type Invitation struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	TenantID    uint       `json:"-" gorm:"not null;default:0;index"`
+	Email       string     `json:"email" gorm:"not null;index"` // Lowercase
+	Role        string     `json:"role" gorm:"not null"`
+	TokenHash   string     `json:"-" gorm:"not null;uniqueIndex"`
+	InvitedByID uint       `json:"invited_by_id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	UserID      *uint      `json:"user_id"` // Account created by accepting it
+	RevokedAt   *time.Time `json:"revoked_at"`
+	Status      string     `json:"status" gorm:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	InvitedBy   *User      `json:"invited_by,omitempty" gorm:"foreignKey:InvitedByID"`
+}
+
+// CurrentStatus returns whether the invitation is pending, accepted, expired
+// or revoked at the given time
+func (i Invitation) CurrentStatus(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+// ValidUserRole reports whether role is one of UserRoles
+func ValidUserRole(role string) bool {
+	for _, valid := range UserRoles {
+		if role == valid {
+			return true
+		}
+	}
+	return false
+}
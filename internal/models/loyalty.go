@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Loyalty ledger entry types
+const (
+	PointsEarn    = "earn"    // Earned by a paid order
+	PointsRedeem  = "redeem"  // Spent on an order
+	PointsExpire  = "expire"  // Earned points that were not spent in time
+	PointsReverse = "reverse" // Undoes the earning or spending of a refunded order
+	PointsAdjust  = "adjust"  // Manual correction
+)
+
+// LoyaltyTier is a membership level reached by lifetime points earned
+type LoyaltyTier struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	TenantID       uint      `json:"-" gorm:"not null;default:0;index;index:idx_loyalty_tiers_tenant_name,unique"`
+	Name           string    `json:"name" gorm:"index:idx_loyalty_tiers_tenant_name,unique;not null"`
+	MinPoints      int       `json:"min_points" gorm:"not null;default:0"`      // Lifetime points needed to reach the tier
+	EarnMultiplier float64   `json:"earn_multiplier" gorm:"not null;default:1"` // Applied to the points earned per order
+	ExpiryMonths   *int      `json:"expiry_months"`                             // Months before points earned in the tier expire; null uses the programme default, 0 never expires
+	Benefits       string    `json:"benefits"`                                  // Shown to staff, e.g. "Free birthday drink"
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// LoyaltyEarnRule awards points for spend or for buying a menu item
+type LoyaltyEarnRule struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TenantID    uint      `json:"-" gorm:"not null;default:0;index"`
+	Name        string    `json:"name" gorm:"not null"`
+	Type        string    `json:"type" gorm:"not null"`          // spend, item
+	SpendAmount float64   `json:"spend_amount" gorm:"default:0"` // Spend rules: points are awarded for every full amount
+	MenuItemID  *uint     `json:"menu_item_id" gorm:"index"`     // Item rules: points are awarded for every unit bought
+	Points      int       `json:"points" gorm:"not null"`
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	MenuItem    *MenuItem `json:"menu_item,omitempty"`
+}
+
+// LoyaltyEntry is an entry in a customer's points ledger. Entries are never
+// changed except for Remaining: positive entries are lots of points that are
+// spent, reversed or expired soonest to expire first.
+type LoyaltyEntry struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	TenantID      uint       `json:"-" gorm:"not null;default:0;index"`
+	CustomerID    uint       `json:"customer_id" gorm:"not null;index"`
+	TransactionID *uint      `json:"transaction_id" gorm:"index"`
+	Type          string     `json:"type" gorm:"not null"`                // earn, redeem, expire, reverse, adjust
+	Points        int        `json:"points" gorm:"not null"`              // Signed
+	Remaining     int        `json:"remaining" gorm:"not null;default:0"` // Unspent points of a positive entry
+	ExpiresAt     *time.Time `json:"expires_at" gorm:"index"`
+	Note          string     `json:"note"`
+	UserID        *uint      `json:"user_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
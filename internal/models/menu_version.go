@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Menu version statuses
+const (
+	MenuVersionDraft     = "draft"
+	MenuVersionPublished = "published"
+	MenuVersionDiscarded = "discarded"
+)
+
+// MenuVersion is a complete menu of categories, menu items and add-ons. A
+// draft is a workspace where changes are staged without affecting the live
+// menu; publishing makes the live menu match it exactly. Published versions
+// keep a snapshot of the live menu they produced, to roll back to.
+type MenuVersion struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	TenantID      uint       `json:"-" gorm:"not null;default:0;index"`
+	Name          string     `json:"name" gorm:"not null"`
+	Status        string     `json:"status" gorm:"not null;default:'draft';index"` // draft, published, discarded
+	Document      string     `json:"-" gorm:"type:jsonb;not null"`                 // The menu in the JSON import format
+	BaseVersionID *uint      `json:"base_version_id"`                              // Published version that was live when the draft was started
+	RollbackOfID  *uint      `json:"rollback_of_id"`                               // Published version this version restored
+	CreatedBy     *uint      `json:"created_by"`
+	PublishedBy   *uint      `json:"published_by"`
+	PublishedAt   *time.Time `json:"published_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -1,29 +1,39 @@
 package models
 
 import (
+	"math"
 	"time"
 	"gorm.io/gorm"
 )
 
 // User represents users in the system
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Username  string         `json:"username" gorm:"uniqueIndex;not null"`
-	Email     string         `json:"email" gorm:"uniqueIndex;default:''"`
-	FullName  string         `json:"full_name" gorm:"default:''"`
-	Password  string         `json:"-" gorm:"not null"`
-	Role      string         `json:"role" gorm:"not null;default:'cashier'"` // admin, manager, cashier
-	IsActive  bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	TenantID     uint           `json:"-" gorm:"not null;default:0;index;index:idx_users_tenant_username,unique;index:idx_users_tenant_email,unique"`
+	Username     string         `json:"username" gorm:"index:idx_users_tenant_username,unique;not null"`
+	Email        string         `json:"email" gorm:"index:idx_users_tenant_email,unique;default:''"`
+	FullName     string         `json:"full_name" gorm:"default:''"`
+	Password     string         `json:"-" gorm:"not null"`
+	PINHash      string         `json:"-" gorm:"not null;default:''"` // Quick login on registered devices; empty for none
+	Role         string         `json:"role" gorm:"not null;default:'cashier'"` // admin, manager, cashier
+	IsActive     bool           `json:"is_active" gorm:"default:true"`
+	TokenVersion int            `json:"-" gorm:"not null;default:0"` // Bumped to revoke every token issued to the user
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+	Outlets      []Outlet       `json:"outlets,omitempty" gorm:"many2many:user_outlets;"` // Outlets the user works at; none means all
 }
 
 // Category represents menu categories
 type Category struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
+	TenantID    uint           `json:"-" gorm:"not null;default:0;index"`
+	ParentID    *uint          `json:"parent_id" gorm:"index"` // Empty for top-level categories
 	Name        string         `json:"name" gorm:"not null"`
 	Description string         `json:"description"`
+	SortOrder   int            `json:"sort_order" gorm:"default:0"`
+	Channels    Channels       `json:"channels" gorm:"type:jsonb;default:'[]'"` // Sales channels it is shown on; empty shows it everywhere
+	ItemCount   int64          `json:"item_count" gorm:"-"`                     // Menu items directly in the category
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -32,76 +42,176 @@ type Category struct {
 
 // MenuItem represents menu items
 type MenuItem struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	CategoryID  uint           `json:"category_id"`
-	Name        string         `json:"name" gorm:"not null"`
-	Description string         `json:"description"`
-	Price       float64        `json:"price" gorm:"not null"`
-	COGS        float64        `json:"cogs" gorm:"not null"` // Cost of Goods Sold (HPP)
-	Margin      float64        `json:"margin" gorm:"-"`      // Calculated field
-	IsAvailable bool           `json:"is_available" gorm:"default:true"`
-	ImageURL    string         `json:"image_url"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
-	Category    Category       `json:"category,omitempty"`
-	AddOns      []AddOn        `json:"add_ons,omitempty" gorm:"foreignKey:MenuItemID"` // Menu-specific add-ons
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	TenantID          uint           `json:"-" gorm:"not null;default:0;index;index:idx_menu_items_tenant_sku,unique"`
+	CategoryID        uint           `json:"category_id"`
+	SKU               string         `json:"sku" gorm:"default:'';index:idx_menu_items_tenant_sku,unique,where:sku <> '' AND deleted_at IS NULL"` // Optional stock keeping unit, used by menu import
+	Name              string         `json:"name" gorm:"not null"`
+	Description       string         `json:"description"`
+	Price             float64        `json:"price" gorm:"not null"`
+	COGS              float64        `json:"cogs" gorm:"not null"`                     // Cost of Goods Sold (HPP)
+	Margin            float64        `json:"margin" gorm:"-"`                          // Calculated field
+	ItemType          string         `json:"item_type" gorm:"not null;default:'item'"` // item, bundle
+	IsAvailable       bool           `json:"is_available" gorm:"default:true"`
+	SoldOut           bool           `json:"sold_out" gorm:"default:false"` // Made unavailable automatically because its recipe ran out of stock
+	LowStock          bool           `json:"low_stock" gorm:"default:false"`
+	LowStockThreshold int            `json:"low_stock_threshold" gorm:"default:0"` // In portions; 0 disables low-stock alerts
+	SortOrder         int            `json:"sort_order" gorm:"default:0"`
+	Channels          Channels       `json:"channels" gorm:"type:jsonb;default:'[]'"` // Sales channels it is shown on; empty shows it everywhere
+	ImageURL          string         `json:"image_url"`
+	ThumbnailURL      string         `json:"thumbnail_url" gorm:"default:''"` // Set by image upload
+	ImageKey          string         `json:"-" gorm:"default:''"`             // Storage key prefix of an uploaded image; empty for external URLs
+	SearchText        string         `json:"-" gorm:"default:''"`             // Name, category, tags and description; see RefreshSearchText
+	SearchRank        float64        `json:"search_rank,omitempty" gorm:"->;-:migration"` // Relevance to the search query, only set in search results
+	Highlights        map[string]string `json:"highlights,omitempty" gorm:"-"`          // Matches in search results, as HTML with <mark> tags
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+	Category          Category       `json:"category,omitempty"`
+	AddOns            []AddOn        `json:"add_ons,omitempty" gorm:"-"`                        // Effective add-ons, resolved from add-on links
+	BundleSlots       []BundleSlot   `json:"bundle_slots,omitempty" gorm:"foreignKey:BundleID"` // Components of a bundle
+	Recipe            []RecipeLine   `json:"recipe,omitempty" gorm:"foreignKey:MenuItemID"`     // Ingredients consumed per item
+	Barcodes          []Barcode      `json:"barcodes,omitempty" gorm:"foreignKey:MenuItemID"`   // Managed through the barcodes endpoint
+	Tags              []Tag          `json:"tags,omitempty" gorm:"many2many:menu_item_tags;"`   // Dietary, allergen and other tags; set with tag_ids
 }
 
-// AddOn represents available add-ons for specific menu items
+// BundleSlot represents a component slot of a bundle menu item.
+// A slot is either a fixed menu item or a choice from a category.
+type BundleSlot struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TenantID   uint      `json:"-" gorm:"not null;default:0;index"`
+	BundleID   uint      `json:"bundle_id" gorm:"index;not null"`
+	Name       string    `json:"name"`
+	MenuItemID *uint     `json:"menu_item_id"` // Fixed component
+	CategoryID *uint     `json:"category_id"`  // Choice from this category
+	Quantity   int       `json:"quantity" gorm:"not null;default:1"`
+	SortOrder  int       `json:"sort_order" gorm:"default:0"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	MenuItem   *MenuItem `json:"menu_item,omitempty"`
+	Category   *Category `json:"category,omitempty"`
+}
+
+// IsChoice reports whether the customer picks the component from a category
+func (s BundleSlot) IsChoice() bool {
+	return s.MenuItemID == nil && s.CategoryID != nil
+}
+
+// AllocateBundleRevenue splits a bundle's revenue across its components in
+// proportion to their weights (usually list price times quantity). Components
+// are weighted equally when no weight is positive. The last share absorbs rounding.
+func AllocateBundleRevenue(revenue float64, weights []float64) []float64 {
+	shares := make([]float64, len(weights))
+	if len(weights) == 0 {
+		return shares
+	}
+
+	var totalWeight float64
+	for _, w := range weights {
+		if w > 0 {
+			totalWeight += w
+		}
+	}
+
+	var allocated float64
+	for i, w := range weights {
+		if i == len(weights)-1 {
+			shares[i] = revenue - allocated
+			break
+		}
+		if totalWeight > 0 {
+			if w > 0 {
+				shares[i] = math.Round(revenue*w/totalWeight*100) / 100
+			}
+		} else {
+			shares[i] = math.Round(revenue/float64(len(weights))*100) / 100
+		}
+		allocated += shares[i]
+	}
+
+	return shares
+}
+
+// AddOn represents available add-ons. An add-on can be linked to any set of
+// menu items and/or whole categories; an add-on without links is global.
 type AddOn struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
-	MenuItemID  *uint          `json:"menu_item_id" gorm:"index"` // Foreign key to MenuItem (nullable for global add-ons)
+	TenantID    uint           `json:"-" gorm:"not null;default:0;index;index:idx_add_ons_tenant_sku,unique"`
+	SKU         string         `json:"sku" gorm:"default:'';index:idx_add_ons_tenant_sku,unique,where:sku <> '' AND deleted_at IS NULL"` // Optional stock keeping unit, used by menu import
 	Name        string         `json:"name" gorm:"not null"`
 	Description string         `json:"description"`
 	Price       float64        `json:"price" gorm:"not null"`
 	COGS        float64        `json:"cogs" gorm:"not null"`
 	Margin      float64        `json:"margin" gorm:"-"` // Calculated field
 	IsAvailable bool           `json:"is_available" gorm:"default:true"`
+	SoldOut     bool           `json:"sold_out" gorm:"default:false"` // Made unavailable automatically because its recipe ran out of stock
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
-	MenuItem    *MenuItem      `json:"menu_item,omitempty" gorm:"foreignKey:MenuItemID"` // Belongs to MenuItem
+	MenuItems   []MenuItem     `json:"menu_items,omitempty" gorm:"many2many:add_on_menu_items;"` // Linked menu items
+	Categories  []Category     `json:"categories,omitempty" gorm:"many2many:add_on_categories;"` // Linked categories
+	Recipe      []RecipeLine   `json:"recipe,omitempty" gorm:"foreignKey:AddOnID"`               // Ingredients consumed per add-on
+	Tags        []Tag          `json:"tags,omitempty" gorm:"many2many:add_on_tags;"`             // Dietary, allergen and other tags; set with tag_ids
 }
 
 // Transaction represents sales transactions
 type Transaction struct {
 	ID            uint                `json:"id" gorm:"primaryKey"`
-	TransactionNo string              `json:"transaction_no" gorm:"uniqueIndex;not null"`
+	TenantID      uint                `json:"-" gorm:"not null;default:0;index;index:idx_transactions_tenant_transaction_no,unique"`
+	TransactionNo string              `json:"transaction_no" gorm:"index:idx_transactions_tenant_transaction_no,unique;not null"`
 	UserID        uint                `json:"user_id"`
+	OutletID      *uint               `json:"outlet_id" gorm:"index"`                    // Outlet the order was taken at
 	CustomerName  string              `json:"customer_name" gorm:"default:''"`           // Customer name for the order
-	Status        string              `json:"status" gorm:"not null;default:'pending'"` // pending, paid
-	PaymentMethod string              `json:"payment_method"`                           // cash, card, digital_wallet
+	CustomerID    *uint               `json:"customer_id" gorm:"index"`                     // Customer the order was linked to
+	OrderType     string              `json:"order_type" gorm:"not null;default:'dine_in'"` // dine_in, takeaway, delivery
+	Channel       string              `json:"channel" gorm:"not null;default:'pos'"`        // pos, gofood, grabfood, ...
+	PriceListID   *uint               `json:"price_list_id"`                                // Price list the order was priced with
+	Status        string              `json:"status" gorm:"not null;default:'pending'"` // pending, paid, refunded
+	PaymentMethod string              `json:"payment_method"`                           // cash, card, digital_wallet, or split when paid with several tenders
 	SubTotal      float64             `json:"sub_total" gorm:"not null"`
 	Tax           float64             `json:"tax" gorm:"default:0"`
 	Discount      float64             `json:"discount" gorm:"default:0"`
+	LoyaltyDiscount float64           `json:"loyalty_discount" gorm:"default:0"` // Value of the points redeemed as a discount
+	PointsRedeemed  int               `json:"points_redeemed" gorm:"default:0"`  // Points spent on the order, as a discount or as payment
+	PointsEarned    int               `json:"points_earned" gorm:"default:0"`
 	Total         float64             `json:"total" gorm:"not null"`
 	PaidAt        *time.Time          `json:"paid_at"`
+	RefundedAt    *time.Time          `json:"refunded_at"`
+	RefundReason  string              `json:"refund_reason" gorm:"default:''"`
 	CreatedAt     time.Time           `json:"created_at"`
 	UpdatedAt     time.Time           `json:"updated_at"`
 	DeletedAt     gorm.DeletedAt      `json:"-" gorm:"index"`
 	User          User                `json:"user,omitempty"`
+	PriceList     *PriceList          `json:"price_list,omitempty"`
+	Customer      *Customer           `json:"customer,omitempty"`
+	Outlet        *Outlet             `json:"outlet,omitempty"`
 	Items         []TransactionItem   `json:"items,omitempty"`
+	Payments      []TransactionPayment `json:"payments,omitempty"`
 }
 
 // TransactionItem represents items in a transaction
 type TransactionItem struct {
 	ID            uint                      `json:"id" gorm:"primaryKey"`
+	TenantID      uint                      `json:"-" gorm:"not null;default:0;index"`
 	TransactionID uint                      `json:"transaction_id"`
 	MenuItemID    uint                      `json:"menu_item_id"`
+	ParentItemID  *uint                     `json:"parent_item_id" gorm:"index"` // Bundle line this component line belongs to
+	BundleSlotID  *uint                     `json:"bundle_slot_id"`
 	Quantity      int                       `json:"quantity" gorm:"not null"`
-	UnitPrice     float64                   `json:"unit_price" gorm:"not null"`
-	TotalPrice    float64                   `json:"total_price" gorm:"not null"`
+	UnitPrice     float64                   `json:"unit_price" gorm:"not null"`  // Allocated bundle revenue for component lines
+	TotalPrice    float64                   `json:"total_price" gorm:"not null"` // Not part of the subtotal for component lines
 	CreatedAt     time.Time                 `json:"created_at"`
 	UpdatedAt     time.Time                 `json:"updated_at"`
 	MenuItem      MenuItem                  `json:"menu_item,omitempty"`
 	Transaction   Transaction               `json:"transaction,omitempty"`
 	AddOns        []TransactionItemAddOn    `json:"add_ons,omitempty"`
+	Components    []TransactionItem         `json:"components,omitempty" gorm:"foreignKey:ParentItemID"` // Component lines of a bundle
 }
 
 // TransactionItemAddOn represents add-ons for transaction items
 type TransactionItemAddOn struct {
 	ID                uint            `json:"id" gorm:"primaryKey"`
+	TenantID          uint            `json:"-" gorm:"not null;default:0;index"`
 	TransactionItemID uint            `json:"transaction_item_id"`
 	AddOnID           uint            `json:"add_on_id"`
 	Quantity          int             `json:"quantity" gorm:"not null;default:1"`
@@ -115,24 +225,29 @@ type TransactionItemAddOn struct {
 
 // Expense represents business expenses
 type Expense struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Type        string         `json:"type" gorm:"not null"` // raw_material, operational
-	Category    string         `json:"category" gorm:"not null"`
-	Description string         `json:"description" gorm:"not null"`
-	Amount      float64        `json:"amount" gorm:"not null"`
-	Date        time.Time      `json:"date" gorm:"not null"`
-	UserID      uint           `json:"user_id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
-	User        User           `json:"user,omitempty"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	TenantID        uint           `json:"-" gorm:"not null;default:0;index"`
+	Type            string         `json:"type" gorm:"not null"`           // raw_material, operational
+	Category        string         `json:"category" gorm:"not null"`
+	Description     string         `json:"description" gorm:"not null"`
+	Amount          float64        `json:"amount" gorm:"not null"`
+	Date            time.Time      `json:"date" gorm:"not null"`
+	UserID          uint           `json:"user_id"`
+	OutletID        *uint          `json:"outlet_id" gorm:"index"`
+	StockMovementID *uint          `json:"stock_movement_id" gorm:"index"` // Purchase receipt this raw material expense was created from
+	PurchaseOrderID *uint          `json:"purchase_order_id" gorm:"index"` // Purchase order whose receipt created this expense
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+	User            User           `json:"user,omitempty"`
 }
 
 // PaymentMethod represents available payment methods
 type PaymentMethod struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
+	TenantID  uint      `json:"-" gorm:"not null;default:0;index;index:idx_payment_methods_tenant_code,unique"`
 	Name      string    `json:"name" gorm:"not null"`
-	Code      string    `json:"code" gorm:"uniqueIndex;not null"`
+	Code      string    `json:"code" gorm:"index:idx_payment_methods_tenant_code,unique;not null"`
 	IsActive  bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -62,6 +62,60 @@ func TestAddOnMarginCalculation(t *testing.T) {
 	}
 }
 
+func TestRecipeCost(t *testing.T) {
+	recipe := []RecipeLine{
+		{Quantity: 18, Ingredient: Ingredient{Name: "Espresso Beans", Unit: "g", UnitCost: 250}},
+		{Quantity: 150, Ingredient: Ingredient{Name: "Milk", Unit: "ml", UnitCost: 20}},
+	}
+
+	// 18g * 250 + 150ml * 20
+	if cost := RecipeCost(recipe); cost != 7500 {
+		t.Errorf("Expected recipe cost to be 7500, got %f", cost)
+	}
+}
+
+func TestAvailablePortions(t *testing.T) {
+	recipe := []RecipeLine{
+		{Quantity: 18, Ingredient: Ingredient{Name: "Espresso Beans", StockQty: 1000}},
+		{Quantity: 150, Ingredient: Ingredient{Name: "Milk", StockQty: 800}},
+	}
+
+	// Milk runs out first: 800ml / 150ml
+	portions, tracked := AvailablePortions(recipe)
+	if !tracked || portions != 5 {
+		t.Errorf("Expected 5 tracked portions, got %d (tracked %v)", portions, tracked)
+	}
+
+	recipe[1].Ingredient.StockQty = -30
+	if portions, _ := AvailablePortions(recipe); portions != 0 {
+		t.Errorf("Expected 0 portions with negative stock, got %d", portions)
+	}
+
+	if _, tracked := AvailablePortions(nil); tracked {
+		t.Error("Expected an empty recipe not to be tracked")
+	}
+}
+
+func TestAllocateBundleRevenue(t *testing.T) {
+	// Coffee (25000) + croissant (15000) sold as a 35000 bundle
+	shares := AllocateBundleRevenue(35000, []float64{25000, 15000})
+
+	if shares[0] != 21875 {
+		t.Errorf("Expected coffee share to be 21875, got %f", shares[0])
+	}
+
+	if shares[1] != 13125 {
+		t.Errorf("Expected croissant share to be 13125, got %f", shares[1])
+	}
+
+	// Components without a list price are weighted equally
+	shares = AllocateBundleRevenue(10000, []float64{0, 0, 0})
+	total := shares[0] + shares[1] + shares[2]
+	if total != 10000 {
+		t.Errorf("Expected shares to add up to 10000, got %f", total)
+	}
+}
+
 func TestTransactionModel(t *testing.T) {
 	transaction := Transaction{
 		TransactionNo: "TXN-001",
@@ -103,3 +157,286 @@ func TestExpenseModel(t *testing.T) {
 		t.Errorf("Expected amount to be 500000, got %f", expense.Amount)
 	}
 }
+
+func TestReceiptStatus(t *testing.T) {
+	lines := []PurchaseOrderLine{
+		{Quantity: 5000, ReceivedQty: 0},
+		{Quantity: 20, ReceivedQty: 0},
+	}
+
+	if status := ReceiptStatus(lines); status != "sent" {
+		t.Errorf("Expected status to be sent, got %s", status)
+	}
+
+	lines[0].ReceivedQty = 5000
+	if status := ReceiptStatus(lines); status != "partially_received" {
+		t.Errorf("Expected status to be partially_received, got %s", status)
+	}
+
+	// Over-delivery still completes the line
+	lines[1].ReceivedQty = 24
+	if status := ReceiptStatus(lines); status != "received" {
+		t.Errorf("Expected status to be received, got %s", status)
+	}
+}
+
+func TestPriceListPrices(t *testing.T) {
+	menuItemID, addOnID := uint(1), uint(7)
+	list := &PriceList{
+		Items: []PriceListItem{
+			{MenuItemID: &menuItemID, Price: 32000},
+			{AddOnID: &addOnID, Price: 6000},
+		},
+	}
+
+	if price := list.MenuItemPrice(MenuItem{ID: 1, Price: 25000}); price != 32000 {
+		t.Errorf("Expected overridden price to be 32000, got %f", price)
+	}
+	if price := list.MenuItemPrice(MenuItem{ID: 2, Price: 18000}); price != 18000 {
+		t.Errorf("Expected base price to be 18000, got %f", price)
+	}
+	if price := list.AddOnPrice(AddOn{ID: 7, Price: 5000}); price != 6000 {
+		t.Errorf("Expected overridden add-on price to be 6000, got %f", price)
+	}
+
+	// Without a price list base prices apply
+	var none *PriceList
+	if price := none.MenuItemPrice(MenuItem{ID: 1, Price: 25000}); price != 25000 {
+		t.Errorf("Expected base price to be 25000, got %f", price)
+	}
+}
+
+func TestSelectPriceList(t *testing.T) {
+	lists := []PriceList{
+		{ID: 1, Name: "Takeaway", OrderType: "takeaway", IsActive: true},
+		{ID: 2, Name: "GoFood", Channel: "gofood", IsActive: true},
+		{ID: 3, Name: "GoFood Pickup", Channel: "gofood", OrderType: "takeaway", IsActive: true},
+		{ID: 4, Name: "GrabFood", Channel: "grabfood", IsActive: false},
+	}
+
+	tests := []struct {
+		channel, orderType string
+		expected           uint
+	}{
+		{"gofood", "delivery", 2},
+		{"gofood", "takeaway", 3},
+		{"pos", "takeaway", 1},
+		{"pos", "dine_in", 0},
+		{"grabfood", "delivery", 0}, // Inactive lists are skipped
+	}
+
+	for _, tt := range tests {
+		var id uint
+		if list := SelectPriceList(lists, tt.channel, tt.orderType); list != nil {
+			id = list.ID
+		}
+		if id != tt.expected {
+			t.Errorf("%s/%s: expected price list %d, got %d", tt.channel, tt.orderType, tt.expected, id)
+		}
+	}
+}
+
+func TestNormalizeBarcode(t *testing.T) {
+	valid := map[string]string{
+		"4006381333931": "4006381333931", // EAN-13
+		" 9638 5074 ":   "96385074",      // EAN-8 with spaces
+		"036000291452":  "036000291452",  // UPC-A
+		"beans-250g":    "BEANS-250G",    // Internal code
+		"12345":         "12345",         // Too short to be a GTIN
+	}
+	for input, want := range valid {
+		got, err := NormalizeBarcode(input)
+		if err != nil {
+			t.Errorf("Expected %q to be valid, got %v", input, err)
+		} else if got != want {
+			t.Errorf("Expected %q to normalize to %q, got %q", input, want, got)
+		}
+	}
+
+	if _, err := NormalizeBarcode("4006381333932"); err != ErrBarcodeChecksum {
+		t.Errorf("Expected ErrBarcodeChecksum for a wrong check digit, got %v", err)
+	}
+
+	for _, input := range []string{"", "   ", "beans/250g", "kopi_susu"} {
+		if _, err := NormalizeBarcode(input); err != ErrInvalidBarcode {
+			t.Errorf("Expected ErrInvalidBarcode for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestCategoryTree(t *testing.T) {
+	id := func(v uint) *uint { return &v }
+
+	// Drinks (1) > Coffee (2) > Manual Brew (3); Food (4)
+	categories := []Category{
+		{ID: 1, Name: "Drinks"},
+		{ID: 2, Name: "Coffee", ParentID: id(1)},
+		{ID: 3, Name: "Manual Brew", ParentID: id(2), Channels: Channels{"pos"}},
+		{ID: 4, Name: "Food", Channels: Channels{"pos", "gofood"}},
+	}
+	parents := CategoryParents(categories)
+
+	below := WithDescendants(parents, map[uint]bool{1: true})
+	if len(below) != 3 || !below[1] || !below[2] || !below[3] {
+		t.Errorf("Expected Drinks and everything below it, got %v", below)
+	}
+
+	if !CreatesCycle(parents, 1, 3) {
+		t.Error("Expected moving Drinks under Manual Brew to create a cycle")
+	}
+	if !CreatesCycle(parents, 2, 2) {
+		t.Error("Expected a category under itself to create a cycle")
+	}
+	if CreatesCycle(parents, 3, 4) {
+		t.Error("Expected moving Manual Brew under Food to be fine")
+	}
+
+	hidden := HiddenCategories(categories, "gofood")
+	if len(hidden) != 1 || !hidden[3] {
+		t.Errorf("Expected only Manual Brew hidden on gofood, got %v", hidden)
+	}
+
+	// Hiding a parent hides its subtree
+	categories[0].Channels = Channels{"pos"}
+	hidden = HiddenCategories(categories, "gofood")
+	if len(hidden) != 3 || hidden[4] {
+		t.Errorf("Expected the Drinks subtree hidden on gofood, got %v", hidden)
+	}
+
+	if len(HiddenCategories(categories, "pos")) != 0 {
+		t.Error("Expected nothing hidden on pos")
+	}
+}
+
+func TestTagSlug(t *testing.T) {
+	cases := map[string]string{
+		"Vegan":            "vegan",
+		"Tree Nuts":        "tree-nuts",
+		"  Gluten-Free!  ": "gluten-free",
+		"Sesame & Soy":     "sesame-soy",
+		"!!!":              "",
+	}
+	for name, expected := range cases {
+		if slug := TagSlug(name); slug != expected {
+			t.Errorf("TagSlug(%q): expected %q, got %q", name, expected, slug)
+		}
+	}
+}
+
+func TestTagNames(t *testing.T) {
+	milk := Tag{Name: "Milk", Kind: TagKindAllergen}
+	nuts := Tag{Name: "Nuts", Kind: TagKindAllergen}
+	vegan := Tag{Name: "Vegan", Kind: TagKindDietary}
+
+	allergens := TagNames(TagKindAllergen, []Tag{nuts, vegan}, []Tag{milk, nuts}, nil)
+	if len(allergens) != 2 || allergens[0] != "Milk" || allergens[1] != "Nuts" {
+		t.Errorf("Expected [Milk Nuts], got %v", allergens)
+	}
+
+	if names := TagNames(TagKindAllergen, []Tag{vegan}); names == nil || len(names) != 0 {
+		t.Errorf("Expected an empty list, got %v", names)
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	cases := map[string]string{
+		"0812-3456-7890":     "+6281234567890",
+		"+62 812 3456 7890":  "+6281234567890",
+		"0062 812 3456 7890": "+6281234567890",
+		"6281234567890":      "+6281234567890",
+		"812 3456 7890":      "+6281234567890",
+		"+1 (415) 555-0100":  "+14155550100",
+		"":                   "",
+	}
+	for phone, expected := range cases {
+		normalized, err := NormalizePhone(phone, "62")
+		if err != nil || normalized != expected {
+			t.Errorf("NormalizePhone(%q): expected %q, got %q (%v)", phone, expected, normalized, err)
+		}
+	}
+
+	for _, phone := range []string{"0812-ABC", "123", "+0812345678", "08123456789012345"} {
+		if _, err := NormalizePhone(phone, "62"); err != ErrInvalidPhone {
+			t.Errorf("NormalizePhone(%q): expected ErrInvalidPhone, got %v", phone, err)
+		}
+	}
+}
+
+func TestGiftCardCode(t *testing.T) {
+	if code := NormalizeGiftCardCode(" abcd-efgh 2345-6789 "); code != "ABCDEFGH23456789" {
+		t.Errorf("Expected ABCDEFGH23456789, got %q", code)
+	}
+	if code := FormatGiftCardCode("ABCDEFGH23456789"); code != "ABCD-EFGH-2345-6789" {
+		t.Errorf("Expected ABCD-EFGH-2345-6789, got %q", code)
+	}
+	if code := FormatGiftCardCode("ABCDEF"); code != "ABCD-EF" {
+		t.Errorf("Expected ABCD-EF, got %q", code)
+	}
+	if code := FormatGiftCardCode(NormalizeGiftCardCode(FormatGiftCardCode("ABCDEFGH"))); code != "ABCD-EFGH" {
+		t.Errorf("Expected formatting to round-trip, got %q", code)
+	}
+}
+
+func TestInvitationStatus(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	accepted := now.Add(-time.Hour)
+
+	cases := []struct {
+		invitation Invitation
+		expected   string
+	}{
+		{Invitation{ExpiresAt: now.Add(time.Hour)}, InvitationPending},
+		{Invitation{ExpiresAt: now}, InvitationExpired},
+		{Invitation{ExpiresAt: now.Add(time.Hour), RevokedAt: &accepted}, InvitationRevoked},
+		{Invitation{ExpiresAt: now.Add(-time.Hour), AcceptedAt: &accepted}, InvitationAccepted},
+	}
+	for i, c := range cases {
+		if status := c.invitation.CurrentStatus(now); status != c.expected {
+			t.Errorf("Case %d: expected %s, got %s", i, c.expected, status)
+		}
+	}
+}
+
+func TestValidUserRole(t *testing.T) {
+	for _, role := range []string{"admin", "manager", "cashier"} {
+		if !ValidUserRole(role) {
+			t.Errorf("Expected %s to be a valid role", role)
+		}
+	}
+	for _, role := range []string{"", "owner", "Admin"} {
+		if ValidUserRole(role) {
+			t.Errorf("Expected %q to be invalid", role)
+		}
+	}
+}
+
+func TestDevicePINLockout(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	device := Device{}
+
+	for i := 1; i < 5; i++ {
+		if device.PINFailed(now, 5, 15*time.Minute) {
+			t.Fatalf("Expected attempt %d not to lock the device", i)
+		}
+	}
+	if device.PINLocked(now) {
+		t.Fatal("Expected the device to be unlocked after 4 wrong PINs")
+	}
+
+	if !device.PINFailed(now, 5, 15*time.Minute) {
+		t.Fatal("Expected the 5th wrong PIN to lock the device")
+	}
+	if !device.PINLocked(now.Add(14*time.Minute)) || device.PINLocked(now.Add(15*time.Minute)) {
+		t.Errorf("Expected the device to be locked for 15 minutes, locked until %v", device.LockedUntil)
+	}
+	if device.FailedPINAttempts != 0 {
+		t.Errorf("Expected the attempts to restart after a lockout, got %d", device.FailedPINAttempts)
+	}
+
+	// A correct PIN forgets the wrong ones
+	device.PINFailed(now, 5, 15*time.Minute)
+	device.PINSucceeded(now)
+	if device.FailedPINAttempts != 0 || device.LockedUntil != nil || device.LastUsedAt == nil {
+		t.Errorf("Expected a login to reset the device, got %+v", device)
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Outlet is a store (branch) of the business. Sales, expenses and stock
+// belong to an outlet; the menu and payment methods are shared.
+type Outlet struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	TenantID  uint           `json:"-" gorm:"not null;default:0;index;index:idx_outlets_tenant_code,unique"`
+	Name      string         `json:"name" gorm:"not null"`
+	Code      string         `json:"code" gorm:"not null;index:idx_outlets_tenant_code,unique,where:deleted_at IS NULL"` // Short code, e.g. for receipts
+	Address   string         `json:"address"`
+	Phone     string         `json:"phone"`
+	IsActive  bool           `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// OutletStock is the stock on hand of an ingredient at one outlet. The
+// ingredient's own StockQty is the total across outlets.
+type OutletStock struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	TenantID     uint       `json:"-" gorm:"not null;default:0;index"`
+	OutletID     uint       `json:"outlet_id" gorm:"not null;uniqueIndex:idx_outlet_stocks_outlet_ingredient"`
+	IngredientID uint       `json:"ingredient_id" gorm:"not null;uniqueIndex:idx_outlet_stocks_outlet_ingredient"`
+	StockQty     float64    `json:"stock_qty" gorm:"not null;default:0"`
+	LowStock     bool       `json:"low_stock" gorm:"default:false"` // Set while at or below the ingredient's threshold, so each drop alerts once
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Ingredient   Ingredient `json:"ingredient,omitempty"`
+}
+
+// OutletItemStock is the stock status of a menu item or add-on with a recipe
+// at one outlet, kept so each sell-out and low-stock drop alerts once. Exactly
+// one of MenuItemID and AddOnID is set; the other is 0.
+type OutletItemStock struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TenantID   uint      `json:"-" gorm:"not null;default:0;index"`
+	OutletID   uint      `json:"outlet_id" gorm:"not null;uniqueIndex:idx_outlet_item_stocks_item"`
+	MenuItemID uint      `json:"menu_item_id" gorm:"not null;default:0;uniqueIndex:idx_outlet_item_stocks_item"`
+	AddOnID    uint      `json:"add_on_id" gorm:"not null;default:0;uniqueIndex:idx_outlet_item_stocks_item"`
+	SoldOut    bool      `json:"sold_out" gorm:"default:false"`
+	LowStock   bool      `json:"low_stock" gorm:"default:false"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PriceList holds prices that override the base prices of menu items and
+// add-ons for a sales channel or order type, e.g. GoFood delivery
+type PriceList struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	TenantID    uint            `json:"-" gorm:"not null;default:0;index;index:idx_price_lists_tenant_name,unique"`
+	Name        string          `json:"name" gorm:"index:idx_price_lists_tenant_name,unique;not null"`
+	Description string          `json:"description"`
+	Channel     string          `json:"channel" gorm:"index"` // e.g. gofood, grabfood; empty matches every channel
+	OrderType   string          `json:"order_type"`           // dine_in, takeaway, delivery; empty matches every order type
+	IsActive    bool            `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt  `json:"-" gorm:"index"`
+	Items       []PriceListItem `json:"items,omitempty"`
+}
+
+// PriceListItem is the price of one menu item or add-on in a price list
+type PriceListItem struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TenantID    uint      `json:"-" gorm:"not null;default:0;index"`
+	PriceListID uint      `json:"price_list_id" gorm:"not null;index"`
+	MenuItemID  *uint     `json:"menu_item_id" gorm:"index"`
+	AddOnID     *uint     `json:"add_on_id" gorm:"index"`
+	Price       float64   `json:"price" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	MenuItem    *MenuItem `json:"menu_item,omitempty"`
+	AddOn       *AddOn    `json:"add_on,omitempty"`
+}
+
+// MenuItemPrice returns the price of a menu item in the list, falling back to
+// its base price. A nil list uses base prices.
+func (p *PriceList) MenuItemPrice(menuItem MenuItem) float64 {
+	if p != nil {
+		for _, item := range p.Items {
+			if item.MenuItemID != nil && *item.MenuItemID == menuItem.ID {
+				return item.Price
+			}
+		}
+	}
+	return menuItem.Price
+}
+
+// AddOnPrice returns the price of an add-on in the list, falling back to its
+// base price. A nil list uses base prices.
+func (p *PriceList) AddOnPrice(addOn AddOn) float64 {
+	if p != nil {
+		for _, item := range p.Items {
+			if item.AddOnID != nil && *item.AddOnID == addOn.ID {
+				return item.Price
+			}
+		}
+	}
+	return addOn.Price
+}
+
+// SelectPriceList returns the active list that best fits an order, or nil to
+// use base prices. A list fits when its channel and order type are empty or
+// equal to the order's; a matching channel outranks a matching order type, and
+// ties go to the oldest list.
+func SelectPriceList(lists []PriceList, channel, orderType string) *PriceList {
+	var best *PriceList
+	bestScore := -1
+	for i := range lists {
+		list := &lists[i]
+		if !list.IsActive {
+			continue
+		}
+
+		score := 0
+		if list.Channel != "" {
+			if list.Channel != channel {
+				continue
+			}
+			score += 2
+		}
+		if list.OrderType != "" {
+			if list.OrderType != orderType {
+				continue
+			}
+			score++
+		}
+
+		if score > bestScore || (score == bestScore && list.ID < best.ID) {
+			best, bestScore = list, score
+		}
+	}
+	return best
+}
+
+// PriceChange is a future-dated price for a menu item or add-on, applied
+// automatically once EffectiveAt has passed
+type PriceChange struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	TenantID    uint       `json:"-" gorm:"not null;default:0;index"`
+	MenuItemID  *uint      `json:"menu_item_id" gorm:"index"`
+	AddOnID     *uint      `json:"add_on_id" gorm:"index"`
+	Price       float64    `json:"price" gorm:"not null"`
+	EffectiveAt time.Time  `json:"effective_at" gorm:"not null;index"`
+	Status      string     `json:"status" gorm:"not null;default:'pending'"` // pending, applied, cancelled
+	Notes       string     `json:"notes"`
+	AppliedAt   *time.Time `json:"applied_at"`
+	UserID      *uint      `json:"user_id"` // Who scheduled the change
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	MenuItem    *MenuItem  `json:"menu_item,omitempty"`
+	AddOn       *AddOn     `json:"add_on,omitempty"`
+	User        *User      `json:"user,omitempty"`
+}
+
+// PriceHistory records the price and COGS of a menu item or add-on each time
+// either of them changes
+type PriceHistory struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TenantID      uint      `json:"-" gorm:"not null;default:0;index"`
+	MenuItemID    *uint     `json:"menu_item_id" gorm:"index"`
+	AddOnID       *uint     `json:"add_on_id" gorm:"index"`
+	Price         float64   `json:"price" gorm:"not null"`
+	COGS          float64   `json:"cogs" gorm:"not null"`
+	Margin        float64   `json:"margin" gorm:"-"`        // Calculated field
+	Source        string    `json:"source" gorm:"not null"` // created, manual, scheduled, recipe, bundle, import
+	PriceChangeID *uint     `json:"price_change_id"`        // Scheduled change that set the price
+	UserID        *uint     `json:"user_id"`                // Empty for automatic changes
+	CreatedAt     time.Time `json:"created_at" gorm:"index"`
+	User          *User     `json:"user,omitempty"`
+}
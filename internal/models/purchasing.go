@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Supplier represents a vendor raw materials are bought from
+type Supplier struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	TenantID    uint           `json:"-" gorm:"not null;default:0;index"`
+	Name        string         `json:"name" gorm:"not null"`
+	ContactName string         `json:"contact_name"`
+	Phone       string         `json:"phone"`
+	Email       string         `json:"email"`
+	Address     string         `json:"address"`
+	Notes       string         `json:"notes"`
+	IsActive    bool           `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// PurchaseOrder represents an order of ingredients from a supplier
+type PurchaseOrder struct {
+	ID         uint                `json:"id" gorm:"primaryKey"`
+	TenantID   uint                `json:"-" gorm:"not null;default:0;index;index:idx_purchase_orders_tenant_po_number,unique"`
+	PONumber   string              `json:"po_number" gorm:"index:idx_purchase_orders_tenant_po_number,unique;not null"`
+	SupplierID uint                `json:"supplier_id" gorm:"not null;index"`
+	OutletID   *uint               `json:"outlet_id" gorm:"index"` // Outlet the goods are delivered to
+	Status     string              `json:"status" gorm:"not null;default:'draft'"` // draft, sent, partially_received, received
+	Notes      string              `json:"notes"`
+	Total      float64             `json:"total" gorm:"not null;default:0"` // Ordered value
+	ExpectedAt *time.Time          `json:"expected_at"`
+	SentAt     *time.Time          `json:"sent_at"`
+	ReceivedAt *time.Time          `json:"received_at"` // When the last outstanding line was received
+	UserID     uint                `json:"user_id"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+	Supplier   Supplier            `json:"supplier,omitempty"`
+	User       User                `json:"user,omitempty"`
+	Lines      []PurchaseOrderLine `json:"lines,omitempty"`
+}
+
+// PurchaseOrderLine is the ordered and received quantity of one ingredient
+type PurchaseOrderLine struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	TenantID        uint       `json:"-" gorm:"not null;default:0;index"`
+	PurchaseOrderID uint       `json:"purchase_order_id" gorm:"not null;index"`
+	IngredientID    uint       `json:"ingredient_id" gorm:"not null"`
+	Quantity        float64    `json:"quantity" gorm:"not null"` // In the ingredient's unit
+	UnitCost        float64    `json:"unit_cost" gorm:"not null"`
+	ReceivedQty     float64    `json:"received_qty" gorm:"not null;default:0"`
+	Ingredient      Ingredient `json:"ingredient,omitempty"`
+}
+
+// Outstanding returns the quantity still to be received
+func (l PurchaseOrderLine) Outstanding() float64 {
+	if l.ReceivedQty >= l.Quantity {
+		return 0
+	}
+	return l.Quantity - l.ReceivedQty
+}
+
+// ReceiptStatus returns the status of a sent purchase order given its lines
+func ReceiptStatus(lines []PurchaseOrderLine) string {
+	var received, outstanding bool
+	for _, line := range lines {
+		if line.ReceivedQty > 0 {
+			received = true
+		}
+		if line.Outstanding() > 0 {
+			outstanding = true
+		}
+	}
+
+	switch {
+	case !outstanding:
+		return "received"
+	case received:
+		return "partially_received"
+	default:
+		return "sent"
+	}
+}
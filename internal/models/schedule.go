@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"pos-system/pkg/schedule"
+	"time"
+)
+
+// Weekdays is a list of days of the week (0 = Sunday), stored as JSON
+type Weekdays []time.Weekday
+
+func (w Weekdays) Value() (driver.Value, error) {
+	if w == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]time.Weekday(w))
+	return string(data), err
+}
+
+func (w *Weekdays) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*w = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Weekdays", value)
+	}
+	return json.Unmarshal(data, (*[]time.Weekday)(w))
+}
+
+// AvailabilitySchedule is a window in which a menu item, category or add-on
+// can be ordered. Something with schedules is orderable only inside one of
+// them; something without schedules is always orderable.
+type AvailabilitySchedule struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TenantID   uint      `json:"-" gorm:"not null;default:0;index"`
+	MenuItemID *uint     `json:"menu_item_id" gorm:"index"`
+	CategoryID *uint     `json:"category_id" gorm:"index"`
+	AddOnID    *uint     `json:"add_on_id" gorm:"index"`
+	Name       string    `json:"name"`                      // e.g. Breakfast
+	Days       Weekdays  `json:"days" gorm:"type:jsonb"`    // Empty means every day
+	StartTime  string    `json:"start_time" gorm:"size:5"`  // HH:MM in the outlet timezone
+	EndTime    string    `json:"end_time" gorm:"size:5"`    // HH:MM, exclusive; before start_time runs past midnight
+	StartDate  string    `json:"start_date" gorm:"size:10"` // YYYY-MM-DD, inclusive
+	EndDate    string    `json:"end_date" gorm:"size:10"`   // YYYY-MM-DD, inclusive
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Window returns the schedule as a schedule window
+func (s AvailabilitySchedule) Window() schedule.Window {
+	return schedule.Window{
+		Days:      s.Days,
+		StartTime: s.StartTime,
+		EndTime:   s.EndTime,
+		StartDate: s.StartDate,
+		EndDate:   s.EndDate,
+	}
+}
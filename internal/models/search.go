@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// menuItemSearchText is the SQL expression for the text menu item search
+// matches: the item's name, its category, its tags and its description
+const menuItemSearchText = `concat_ws(' ', menu_items.name,
+	(SELECT categories.name FROM categories WHERE categories.id = menu_items.category_id),
+	(SELECT string_agg(tags.name, ' ') FROM tags JOIN menu_item_tags ON menu_item_tags.tag_id = tags.id WHERE menu_item_tags.menu_item_id = menu_items.id),
+	menu_items.description)`
+
+// RefreshSearchText recomputes the search text of the menu items matching the
+// condition. Call it after changing their name, description, category or
+// tags, or renaming their category or one of their tags.
+func RefreshSearchText(db *gorm.DB, query interface{}, args ...interface{}) error {
+	return db.Model(&MenuItem{}).Where(query, args...).UpdateColumn("search_text", gorm.Expr(menuItemSearchText)).Error
+}
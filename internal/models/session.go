@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// RefreshToken is a long-lived credential a client trades for a new access
+// token. Only its hash is stored. Every refresh replaces it with a new one;
+// all the refresh tokens of one login share a SessionID.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TenantID  uint       `json:"-" gorm:"not null;default:0;index"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	SessionID string     `json:"session_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at"`                // Set when traded; trading it again means it was stolen
+	RevokedAt *time.Time `json:"revoked_at"`             // Set on logout and revocation
+	DeviceID  *uint      `json:"device_id" gorm:"index"` // Device of a PIN login; refreshing needs its device token
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RevokedToken stops access tokens before they expire: the token with the
+// ID, or every token of the session with the ID. Entries are removed once
+// those tokens have expired anyway.
+type RevokedToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TenantID  uint      `json:"-" gorm:"not null;default:0;index"`
+	TokenID   string    `json:"token_id" gorm:"not null;uniqueIndex"` // Token ID (jti) or session ID (sid)
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
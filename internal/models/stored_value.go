@@ -0,0 +1,88 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Stored-value account types
+const (
+	StoredValueGiftCard = "gift_card" // Card identified by its code
+	StoredValueCustomer = "customer"  // Prepaid balance of a customer
+)
+
+// Stored-value ledger entry types
+const (
+	StoredValueIssue  = "issue"  // Gift card sold
+	StoredValueTopUp  = "top_up" // Money added
+	StoredValueRedeem = "redeem" // Spent on an order
+	StoredValueRefund = "refund" // Returned from a refunded order
+	StoredValueAdjust = "adjust" // Manual correction
+	StoredValueVoid   = "void"   // Remaining balance written off when a gift card is cancelled
+)
+
+// StoredValueAccount is a gift card or a customer's prepaid balance. Balance
+// is kept in step with the ledger and only changes with a new entry.
+type StoredValueAccount struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TenantID   uint      `json:"-" gorm:"not null;default:0;index;index:idx_stored_value_accounts_tenant_code,unique"`
+	Type       string    `json:"type" gorm:"not null;index"`                                                                    // gift_card, customer
+	Code       string    `json:"code,omitempty" gorm:"default:'';index:idx_stored_value_accounts_tenant_code,unique,where:code <> ''"` // Gift cards only, uppercase without dashes
+	CustomerID *uint     `json:"customer_id" gorm:"index:idx_stored_value_accounts_customer,unique,where:type = 'customer'"`    // Owner of a customer balance, or buyer of a gift card
+	Balance    float64   `json:"balance" gorm:"not null;default:0"`
+	Status     string    `json:"status" gorm:"not null;default:'active'"` // active, void
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Customer   *Customer `json:"customer,omitempty"`
+}
+
+// StoredValueEntry is an entry in the stored-value ledger. Entries are only
+// ever inserted; the database rejects updates and deletes.
+type StoredValueEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TenantID      uint      `json:"-" gorm:"not null;default:0;index"`
+	AccountID     uint      `json:"account_id" gorm:"not null;index"`
+	Type          string    `json:"type" gorm:"not null"`   // issue, top_up, redeem, refund, adjust, void
+	Amount        float64   `json:"amount" gorm:"not null"` // Signed
+	BalanceAfter  float64   `json:"balance_after" gorm:"not null"`
+	TransactionID *uint     `json:"transaction_id" gorm:"index"` // Order the balance was spent on or refunded from
+	PaymentMethod string    `json:"payment_method"`              // How an issue or top-up was paid for
+	Note          string    `json:"note"`
+	UserID        *uint     `json:"user_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// TransactionPayment is one tender of a paid transaction
+type TransactionPayment struct {
+	ID                   uint      `json:"id" gorm:"primaryKey"`
+	TenantID             uint      `json:"-" gorm:"not null;default:0;index"`
+	TransactionID        uint      `json:"transaction_id" gorm:"not null;index"`
+	PaymentMethod        string    `json:"payment_method" gorm:"not null"`
+	Amount               float64   `json:"amount" gorm:"not null"`
+	StoredValueAccountID *uint     `json:"stored_value_account_id"` // Gift card or customer balance the tender was taken from
+	HouseAccountID       *uint     `json:"house_account_id"`        // House account the tender was charged to
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// NormalizeGiftCardCode uppercases a gift card code and drops the spaces and
+// dashes it is printed or typed with
+func NormalizeGiftCardCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// FormatGiftCardCode groups a normalized gift card code in fours for printing
+func FormatGiftCardCode(code string) string {
+	var b strings.Builder
+	for i, r := range code {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tag kinds
+const (
+	TagKindTag      = "tag"      // General label, e.g. spicy or new
+	TagKindDietary  = "dietary"  // Diet the item suits, e.g. vegan or halal
+	TagKindAllergen = "allergen" // Allergen the item contains, e.g. nuts or dairy
+)
+
+// Tag labels menu items and add-ons with dietary information, allergens or
+// anything else customers may filter by
+type Tag struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TenantID    uint      `json:"-" gorm:"not null;default:0;index;index:idx_tags_tenant_slug,unique"`
+	Name        string    `json:"name" gorm:"not null"`
+	Slug        string    `json:"slug" gorm:"index:idx_tags_tenant_slug,unique;not null"`   // Used in menu filters, e.g. tag=vegan
+	Kind        string    `json:"kind" gorm:"not null;default:'tag'"` // tag, dietary, allergen
+	Description string    `json:"description" gorm:"default:''"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ValidTagKind reports whether kind is one of the tag kinds
+func ValidTagKind(kind string) bool {
+	return kind == TagKindTag || kind == TagKindDietary || kind == TagKindAllergen
+}
+
+// TagSlug derives a slug from a tag name: lowercase letters and digits, with
+// every other run of characters replaced by a single hyphen
+func TagSlug(name string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(r)
+		} else {
+			pendingHyphen = true
+		}
+	}
+	return b.String()
+}
+
+// TagNames returns the names of the tags of the given kind across all sets,
+// without duplicates and sorted, e.g. the allergens of an order line and its
+// add-ons
+func TagNames(kind string, sets ...[]Tag) []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, tags := range sets {
+		for _, tag := range tags {
+			if tag.Kind == kind && !seen[tag.Name] {
+				seen[tag.Name] = true
+				names = append(names, tag.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
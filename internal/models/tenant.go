@@ -0,0 +1,33 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTenantSlug = errors.New("tenant slug must be 2-63 lowercase letters, digits or dashes")
+
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Tenant is a business hosted on a shared deployment. Every other model
+// carries a TenantID, and queries only ever see the current tenant's rows.
+type Tenant struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"not null;uniqueIndex"` // Subdomain, e.g. kopi-senja.pos.example.com
+	IsActive  bool      `json:"is_active" gorm:"default:true"`    // Suspended tenants cannot be used
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NormalizeTenantSlug lowercases a slug and checks it can be used as a
+// subdomain label
+func NormalizeTenantSlug(slug string) (string, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if len(slug) < 2 || !tenantSlugPattern.MatchString(slug) {
+		return "", ErrInvalidTenantSlug
+	}
+	return slug, nil
+}
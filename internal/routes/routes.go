@@ -1,41 +1,66 @@
 package routes
 
 import (
+	"pos-system/internal/events"
 	"pos-system/internal/handlers"
 	"pos-system/internal/middleware"
+	"pos-system/internal/tenancy"
 	"pos-system/pkg/auth"
+	"pos-system/pkg/loyalty"
+	"pos-system/pkg/storage"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
+func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService, resolver *tenancy.Resolver, dispatcher *events.Dispatcher, location *time.Location, store storage.Storage, mediaURL string, countryCode string, program loyalty.Program, inviteURL string, inviteTTL time.Duration, pinLimit int, pinLockout time.Duration) {
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, jwtService)
-	menuHandler := handlers.NewMenuHandler(db)
-	addOnHandler := handlers.NewAddOnHandler(db)
-	transactionHandler := handlers.NewTransactionHandler(db)
+	authHandler := handlers.NewAuthHandler(db, jwtService, dispatcher, inviteURL, inviteTTL, pinLimit, pinLockout)
+	menuHandler := handlers.NewMenuHandler(db, location, store, mediaURL)
+	addOnHandler := handlers.NewAddOnHandler(db, location)
+	transactionHandler := handlers.NewTransactionHandler(db, dispatcher, location, program)
 	expenseHandler := handlers.NewExpenseHandler(db)
 	dashboardHandler := handlers.NewDashboardHandler(db)
+	inventoryHandler := handlers.NewInventoryHandler(db, dispatcher)
+	purchasingHandler := handlers.NewPurchasingHandler(db, dispatcher)
+	priceListHandler := handlers.NewPriceListHandler(db)
+	priceChangeHandler := handlers.NewPriceChangeHandler(db)
+	mediaHandler := handlers.NewMediaHandler(store)
+	customerHandler := handlers.NewCustomerHandler(db, countryCode)
+	loyaltyHandler := handlers.NewLoyaltyHandler(db, program)
+	storedValueHandler := handlers.NewStoredValueHandler(db)
+	houseAccountHandler := handlers.NewHouseAccountHandler(db)
+	outletHandler := handlers.NewOutletHandler(db)
+	deviceHandler := handlers.NewDeviceHandler(db)
 
 	// Apply CORS middleware
 	router.Use(middleware.CORSMiddleware())
 
 	// Public routes
 	api := router.Group("/api/v1")
+	api.Use(middleware.TenantMiddleware(resolver, jwtService))
 	{
 		// Auth routes
 		auth := api.Group("/auth")
 		{
 			auth.POST("/login", authHandler.Login)
-			auth.POST("/register", authHandler.Register)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/invitations/accept", authHandler.AcceptInvitation)
+			auth.POST("/bootstrap", authHandler.Bootstrap) // Only works while there are no users
+
+			// PIN logins on registered devices (X-Device-Token header)
+			auth.GET("/device/users", authHandler.GetDeviceUsers)
+			auth.POST("/switch-user", authHandler.SwitchUser)
 		}
 
 		// Public menu routes (for POS display)
 		public := api.Group("/public")
 		{
 			public.GET("/menu/categories", menuHandler.GetCategories)
-			public.GET("/menu/items", menuHandler.GetMenuItems)
+			public.GET("/menu/tree", menuHandler.GetOrderableMenuTree)
+			public.GET("/menu/tags", menuHandler.GetTags)
+			public.GET("/menu/items", menuHandler.GetOrderableMenuItems)
 			public.GET("/menu/items/:id", menuHandler.GetMenuItem)
 			public.GET("/add-ons", addOnHandler.GetAddOns)
 			public.GET("/add-ons/:id", addOnHandler.GetAddOn)
@@ -51,23 +76,46 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
 
 	// Protected routes
 	protected := api.Group("/")
-	protected.Use(middleware.AuthMiddleware(jwtService))
+	protected.Use(middleware.AuthMiddleware(jwtService, db))
 	{
+		// Ends the session of the token used
+		protected.POST("/auth/logout", authHandler.Logout)
+
 		// Profile routes
 		profile := protected.Group("/profile")
 		{
 			profile.GET("", authHandler.GetProfile)
 			profile.PUT("", authHandler.UpdateProfile)
+			profile.PUT("/pin", authHandler.SetPIN)
+			profile.DELETE("/pin", authHandler.ClearPIN)
 		}
 
 		// Menu management routes
 		menu := protected.Group("/menu")
 		{
+			// Bulk import and export
+			menu.GET("/export", middleware.RequireRole("admin", "manager"), menuHandler.ExportMenu)
+			menu.POST("/import", middleware.RequireRole("admin", "manager"), menuHandler.ImportMenu)
+
+			// Drafts and published versions
+			menu.GET("/versions", middleware.RequireRole("admin", "manager"), menuHandler.GetMenuVersions)
+			menu.POST("/versions", middleware.RequireRole("admin", "manager"), menuHandler.CreateMenuDraft)
+			menu.GET("/versions/:id", middleware.RequireRole("admin", "manager"), menuHandler.GetMenuVersion)
+			menu.PUT("/versions/:id", middleware.RequireRole("admin", "manager"), menuHandler.UpdateMenuDraft)
+			menu.DELETE("/versions/:id", middleware.RequireRole("admin", "manager"), menuHandler.DiscardMenuDraft)
+			menu.POST("/versions/:id/changes", middleware.RequireRole("admin", "manager"), menuHandler.ChangeMenuDraft)
+			menu.GET("/versions/:id/diff", middleware.RequireRole("admin", "manager"), menuHandler.GetMenuVersionDiff)
+			menu.POST("/versions/:id/publish", middleware.RequireRole("admin", "manager"), menuHandler.PublishMenuDraft)
+			menu.POST("/versions/:id/rollback", middleware.RequireRole("admin", "manager"), menuHandler.RollbackMenuVersion)
+
 			// Categories
 			menu.GET("/categories", menuHandler.GetCategories)
 			menu.POST("/categories", menuHandler.CreateCategory)
 			menu.PUT("/categories/:id", menuHandler.UpdateCategory)
 			menu.DELETE("/categories/:id", menuHandler.DeleteCategory)
+			menu.PUT("/categories/reorder", middleware.RequireRole("admin", "manager"), menuHandler.ReorderCategories)
+			menu.GET("/categories/:id/schedules", menuHandler.GetCategorySchedules)
+			menu.PUT("/categories/:id/schedules", middleware.RequireRole("admin", "manager"), menuHandler.UpdateCategorySchedules)
 
 			// Menu items
 			menu.GET("/items", menuHandler.GetMenuItems)
@@ -75,6 +123,40 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
 			menu.POST("/items", menuHandler.CreateMenuItem)
 			menu.PUT("/items/:id", menuHandler.UpdateMenuItem)
 			menu.DELETE("/items/:id", menuHandler.DeleteMenuItem)
+			menu.PUT("/items/reorder", middleware.RequireRole("admin", "manager"), menuHandler.ReorderMenuItems)
+
+			// Dietary, allergen and other tags
+			menu.GET("/tags", menuHandler.GetTags)
+			menu.POST("/tags", middleware.RequireRole("admin", "manager"), menuHandler.CreateTag)
+			menu.PUT("/tags/:id", middleware.RequireRole("admin", "manager"), menuHandler.UpdateTag)
+			menu.DELETE("/tags/:id", middleware.RequireRole("admin", "manager"), menuHandler.DeleteTag)
+
+			// Category hierarchy with menu items
+			menu.GET("/tree", menuHandler.GetMenuTree)
+
+			// Barcode and SKU lookup for scanning
+			menu.GET("/lookup", menuHandler.LookupMenuItem)
+			menu.GET("/items/:id/barcodes", menuHandler.GetMenuItemBarcodes)
+			menu.PUT("/items/:id/barcodes", middleware.RequireRole("admin", "manager"), menuHandler.UpdateMenuItemBarcodes)
+
+			// Images
+			menu.POST("/items/:id/image", middleware.RequireRole("admin", "manager"), menuHandler.UploadMenuItemImage)
+			menu.DELETE("/items/:id/image", middleware.RequireRole("admin", "manager"), menuHandler.DeleteMenuItemImage)
+
+			// Bundle components
+			menu.GET("/items/:id/bundle-slots", menuHandler.GetBundleSlots)
+			menu.PUT("/items/:id/bundle-slots", menuHandler.UpdateBundleSlots)
+
+			// Availability schedules
+			menu.GET("/items/:id/schedules", menuHandler.GetMenuItemSchedules)
+			menu.PUT("/items/:id/schedules", middleware.RequireRole("admin", "manager"), menuHandler.UpdateMenuItemSchedules)
+
+			// Price history
+			menu.GET("/items/:id/price-history", priceChangeHandler.GetMenuItemPriceHistory)
+
+			// Recipes
+			menu.GET("/items/:id/recipe", inventoryHandler.GetMenuItemRecipe)
+			menu.PUT("/items/:id/recipe", middleware.RequireRole("admin", "manager"), inventoryHandler.UpdateMenuItemRecipe)
 		}
 
 		// Add-on management routes
@@ -85,6 +167,29 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
 			addOns.POST("", addOnHandler.CreateAddOn)
 			addOns.PUT("/:id", addOnHandler.UpdateAddOn)
 			addOns.DELETE("/:id", addOnHandler.DeleteAddOn)
+			addOns.GET("/:id/recipe", inventoryHandler.GetAddOnRecipe)
+			addOns.PUT("/:id/recipe", middleware.RequireRole("admin", "manager"), inventoryHandler.UpdateAddOnRecipe)
+			addOns.GET("/:id/schedules", addOnHandler.GetAddOnSchedules)
+			addOns.PUT("/:id/schedules", middleware.RequireRole("admin", "manager"), addOnHandler.UpdateAddOnSchedules)
+			addOns.GET("/:id/price-history", priceChangeHandler.GetAddOnPriceHistory)
+		}
+
+		// Price list routes
+		priceLists := protected.Group("/price-lists")
+		{
+			priceLists.GET("", priceListHandler.GetPriceLists)
+			priceLists.GET("/:id", priceListHandler.GetPriceList)
+			priceLists.POST("", middleware.RequireRole("admin", "manager"), priceListHandler.CreatePriceList)
+			priceLists.PUT("/:id", middleware.RequireRole("admin", "manager"), priceListHandler.UpdatePriceList)
+			priceLists.DELETE("/:id", middleware.RequireRole("admin", "manager"), priceListHandler.DeletePriceList)
+		}
+
+		// Scheduled price change routes
+		priceChanges := protected.Group("/price-changes")
+		{
+			priceChanges.GET("", priceChangeHandler.GetPriceChanges)
+			priceChanges.POST("", middleware.RequireRole("admin", "manager"), priceChangeHandler.CreatePriceChange)
+			priceChanges.DELETE("/:id", middleware.RequireRole("admin", "manager"), priceChangeHandler.CancelPriceChange)
 		}
 
 		// Menu item add-ons routes
@@ -98,9 +203,13 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
 		{
 			transactions.GET("", transactionHandler.GetTransactions)
 			transactions.GET("/:id", transactionHandler.GetTransaction)
+			transactions.GET("/:id/kitchen-ticket", transactionHandler.GetKitchenTicket)
 			transactions.POST("", transactionHandler.CreateTransaction)
 			transactions.PUT("/:id", transactionHandler.UpdateTransaction)
+			transactions.PUT("/:id/customer", transactionHandler.LinkTransactionCustomer)
+			transactions.PUT("/:id/redeem-points", transactionHandler.RedeemPoints)
 			transactions.PUT("/:id/pay", transactionHandler.PayTransaction)
+			transactions.PUT("/:id/refund", middleware.RequireRole("admin", "manager"), transactionHandler.RefundTransaction)
 			transactions.DELETE("/:id", transactionHandler.DeleteTransaction)
 			
 			// Transaction item routes
@@ -109,9 +218,131 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
 			transactions.DELETE("/:id/items/:item_id", transactionHandler.DeleteTransactionItem)
 		}
 
+		// Customer directory
+		customers := protected.Group("/customers")
+		{
+			customers.GET("", customerHandler.GetCustomers)
+			customers.GET("/lookup", customerHandler.LookupCustomer)
+			customers.GET("/duplicates", middleware.RequireRole("admin", "manager"), customerHandler.GetDuplicateCustomers)
+			customers.GET("/:id", customerHandler.GetCustomer)
+			customers.GET("/:id/profile", customerHandler.GetCustomerProfile)
+			customers.POST("", customerHandler.CreateCustomer)
+			customers.PUT("/:id", customerHandler.UpdateCustomer)
+			customers.DELETE("/:id", middleware.RequireRole("admin", "manager"), customerHandler.DeleteCustomer)
+			customers.POST("/:id/merge", middleware.RequireRole("admin", "manager"), customerHandler.MergeCustomers)
+			customers.GET("/:id/points", loyaltyHandler.GetCustomerPoints)
+			customers.POST("/:id/points", middleware.RequireRole("admin", "manager"), loyaltyHandler.AdjustCustomerPoints)
+			customers.GET("/:id/balance", storedValueHandler.GetCustomerBalance)
+			customers.POST("/:id/balance/top-up", storedValueHandler.TopUpCustomerBalance)
+			customers.POST("/:id/balance/adjust", middleware.RequireRole("admin", "manager"), storedValueHandler.AdjustCustomerBalance)
+			customers.GET("/:id/account", houseAccountHandler.GetHouseAccount)
+			customers.PUT("/:id/account", middleware.RequireRole("admin", "manager"), houseAccountHandler.SaveHouseAccount)
+			customers.GET("/:id/account/statement", houseAccountHandler.GetAccountStatement)
+			customers.POST("/:id/account/payments", houseAccountHandler.RecordAccountPayment)
+			customers.POST("/:id/account/adjust", middleware.RequireRole("admin", "manager"), houseAccountHandler.AdjustHouseAccount)
+		}
+
+		// House accounts (accounts receivable)
+		houseAccounts := protected.Group("/house-accounts")
+		houseAccounts.Use(middleware.RequireRole("admin", "manager"))
+		{
+			houseAccounts.GET("", houseAccountHandler.GetHouseAccounts)
+		}
+
+		// Gift card routes
+		giftCards := protected.Group("/gift-cards")
+		{
+			giftCards.GET("", storedValueHandler.GetGiftCards)
+			giftCards.GET("/:code", storedValueHandler.GetGiftCard)
+			giftCards.POST("", storedValueHandler.IssueGiftCard)
+			giftCards.POST("/:code/top-up", storedValueHandler.TopUpGiftCard)
+			giftCards.POST("/:code/void", middleware.RequireRole("admin", "manager"), storedValueHandler.VoidGiftCard)
+		}
+
+		// Loyalty programme
+		loyaltyProgram := protected.Group("/loyalty")
+		{
+			loyaltyProgram.GET("/tiers", loyaltyHandler.GetTiers)
+			loyaltyProgram.POST("/tiers", middleware.RequireRole("admin", "manager"), loyaltyHandler.CreateTier)
+			loyaltyProgram.PUT("/tiers/:id", middleware.RequireRole("admin", "manager"), loyaltyHandler.UpdateTier)
+			loyaltyProgram.DELETE("/tiers/:id", middleware.RequireRole("admin", "manager"), loyaltyHandler.DeleteTier)
+			loyaltyProgram.GET("/rules", loyaltyHandler.GetEarnRules)
+			loyaltyProgram.POST("/rules", middleware.RequireRole("admin", "manager"), loyaltyHandler.CreateEarnRule)
+			loyaltyProgram.PUT("/rules/:id", middleware.RequireRole("admin", "manager"), loyaltyHandler.UpdateEarnRule)
+			loyaltyProgram.DELETE("/rules/:id", middleware.RequireRole("admin", "manager"), loyaltyHandler.DeleteEarnRule)
+		}
+
+		// Outlet routes
+		outlets := protected.Group("/outlets")
+		{
+			outlets.GET("", outletHandler.GetOutlets)
+			outlets.GET("/:id", outletHandler.GetOutlet)
+			outlets.GET("/:id/stock", outletHandler.GetOutletStock)
+			outlets.POST("", middleware.RequireRole("admin"), outletHandler.CreateOutlet)
+			outlets.PUT("/:id", middleware.RequireRole("admin"), outletHandler.UpdateOutlet)
+			outlets.DELETE("/:id", middleware.RequireRole("admin"), outletHandler.DeleteOutlet)
+		}
+
+		// Devices cashiers log in on with a PIN
+		devices := protected.Group("/devices")
+		devices.Use(middleware.RequireRole("admin", "manager"))
+		{
+			devices.GET("", deviceHandler.GetDevices)
+			devices.POST("", deviceHandler.RegisterDevice)
+			devices.POST("/:id/unlock", deviceHandler.UnlockDevice)
+			devices.DELETE("/:id", deviceHandler.RevokeDevice)
+		}
+
 		// Payment methods
 		protected.GET("/payment-methods", transactionHandler.GetPaymentMethods)
 
+		// Inventory routes
+		inventory := protected.Group("/inventory")
+		{
+			inventory.GET("/ingredients", inventoryHandler.GetIngredients)
+			inventory.GET("/ingredients/:id", inventoryHandler.GetIngredient)
+			inventory.POST("/ingredients", middleware.RequireRole("admin", "manager"), inventoryHandler.CreateIngredient)
+			inventory.PUT("/ingredients/:id", middleware.RequireRole("admin", "manager"), inventoryHandler.UpdateIngredient)
+			inventory.DELETE("/ingredients/:id", middleware.RequireRole("admin", "manager"), inventoryHandler.DeleteIngredient)
+
+			inventory.GET("/movements", inventoryHandler.GetStockMovements)
+			inventory.POST("/movements", middleware.RequireRole("admin", "manager"), inventoryHandler.CreateStockMovement)
+			inventory.POST("/transfers", middleware.RequireRole("admin", "manager"), inventoryHandler.TransferStock)
+
+			inventory.GET("/stock-takes", inventoryHandler.GetStockTakes)
+			inventory.GET("/stock-takes/:id", inventoryHandler.GetStockTake)
+			inventory.POST("/stock-takes", inventoryHandler.CreateStockTake)
+			inventory.PUT("/stock-takes/:id", inventoryHandler.UpdateStockTake)
+			inventory.DELETE("/stock-takes/:id", middleware.RequireRole("admin", "manager"), inventoryHandler.DeleteStockTake)
+			inventory.POST("/stock-takes/:id/post", middleware.RequireRole("admin", "manager"), inventoryHandler.PostStockTake)
+
+			inventory.GET("/valuation", middleware.RequireRole("admin", "manager"), inventoryHandler.GetStockValuation)
+			inventory.GET("/low-stock", inventoryHandler.GetLowStock)
+		}
+
+		// Supplier routes
+		suppliers := protected.Group("/suppliers")
+		{
+			suppliers.GET("", purchasingHandler.GetSuppliers)
+			suppliers.GET("/:id", purchasingHandler.GetSupplier)
+			suppliers.POST("", middleware.RequireRole("admin", "manager"), purchasingHandler.CreateSupplier)
+			suppliers.PUT("/:id", middleware.RequireRole("admin", "manager"), purchasingHandler.UpdateSupplier)
+			suppliers.DELETE("/:id", middleware.RequireRole("admin", "manager"), purchasingHandler.DeleteSupplier)
+			suppliers.GET("/spend", middleware.RequireRole("admin", "manager"), purchasingHandler.GetSupplierSpend)
+		}
+
+		// Purchase order routes
+		purchaseOrders := protected.Group("/purchase-orders")
+		{
+			purchaseOrders.GET("", purchasingHandler.GetPurchaseOrders)
+			purchaseOrders.GET("/:id", purchasingHandler.GetPurchaseOrder)
+			purchaseOrders.POST("", middleware.RequireRole("admin", "manager"), purchasingHandler.CreatePurchaseOrder)
+			purchaseOrders.PUT("/:id", middleware.RequireRole("admin", "manager"), purchasingHandler.UpdatePurchaseOrder)
+			purchaseOrders.DELETE("/:id", middleware.RequireRole("admin", "manager"), purchasingHandler.DeletePurchaseOrder)
+			purchaseOrders.POST("/:id/send", middleware.RequireRole("admin", "manager"), purchasingHandler.SendPurchaseOrder)
+			purchaseOrders.POST("/:id/receive", purchasingHandler.ReceivePurchaseOrder)
+		}
+
 		// Expense routes
 		expenses := protected.Group("/expenses")
 		{
@@ -130,6 +361,9 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
 			dashboard.GET("/stats", dashboardHandler.GetDashboardStats)
 			dashboard.GET("/sales-report", dashboardHandler.GetSalesReport)
 			dashboard.GET("/profit-analysis", dashboardHandler.GetProfitAnalysis)
+			dashboard.GET("/stored-value", dashboardHandler.GetStoredValueReport)
+			dashboard.GET("/receivables-aging", dashboardHandler.GetReceivablesAging)
+			dashboard.GET("/cash-flow", dashboardHandler.GetCashFlow)
 		}
 
 		// User management routes (admin only)
@@ -137,13 +371,21 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
 		users.Use(middleware.RequireRole("admin"))
 		{
 			users.GET("", authHandler.GetUsers)
+			users.GET("/invitations", authHandler.GetInvitations)
+			users.POST("/invitations", authHandler.InviteUser)
+			users.DELETE("/invitations/:id", authHandler.RevokeInvitation)
 			users.GET("/:id", authHandler.GetUser)
 			users.PUT("/:id", authHandler.UpdateUser)
 			users.PUT("/:id/role", authHandler.UpdateUserRole)
+			users.PUT("/:id/outlets", outletHandler.SetUserOutlets)
+			users.POST("/:id/revoke-tokens", authHandler.RevokeUserTokens)
 			users.DELETE("/:id", authHandler.DeleteUser)
 		}
 	}
 
+	// Uploaded images
+	router.GET("/media/*key", mediaHandler.ServeMedia)
+
 	// Serve static files for admin dashboard
 	router.Static("/static", "./web/static")
 	router.LoadHTMLGlob("web/templates/*")
@@ -156,6 +398,11 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, jwtService *auth.JWTService) {
 				"title": "POS System - Login",
 			})
 		})
+		admin.GET("/accept-invite", func(c *gin.Context) {
+			c.HTML(200, "accept-invite.html", gin.H{
+				"title": "POS System - Accept Invitation",
+			})
+		})
 		admin.GET("/dashboard", func(c *gin.Context) {
 			c.HTML(200, "dashboard.html", gin.H{
 				"title": "POS System - Dashboard",
@@ -0,0 +1,87 @@
+package tenancy
+
+import (
+	"errors"
+	"net"
+	"pos-system/internal/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantRequired = errors.New("tenant required")
+)
+
+// Resolver finds the tenant a request is for
+type Resolver struct {
+	db            *gorm.DB
+	baseDomain    string // Tenants are served from <slug>.<baseDomain>; empty disables subdomains
+	defaultTenant string // Slug used when a request names no tenant; empty requires one
+}
+
+func NewResolver(db *gorm.DB, baseDomain, defaultTenant string) *Resolver {
+	return &Resolver{
+		db:            db,
+		baseDomain:    strings.ToLower(strings.Trim(baseDomain, ".")),
+		defaultTenant: defaultTenant,
+	}
+}
+
+// SubdomainSlug returns the tenant slug of a host under baseDomain, e.g.
+// "kopi-senja" for kopi-senja.pos.example.com:8080, or "" when the host is
+// not a direct subdomain of baseDomain
+func SubdomainSlug(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	slug, found := strings.CutSuffix(host, "."+strings.ToLower(baseDomain))
+	if !found || slug == "" || strings.Contains(slug, ".") {
+		return ""
+	}
+	return slug
+}
+
+// FromHost returns the tenant whose subdomain the host is, or nil when the
+// host names no tenant
+func (r *Resolver) FromHost(host string) (*models.Tenant, error) {
+	slug := SubdomainSlug(host, r.baseDomain)
+	if slug == "" {
+		return nil, nil
+	}
+	return r.BySlug(slug)
+}
+
+// Default returns the tenant of requests that name none, or
+// ErrTenantRequired when every request must name one
+func (r *Resolver) Default() (*models.Tenant, error) {
+	if r.defaultTenant == "" {
+		return nil, ErrTenantRequired
+	}
+	return r.BySlug(r.defaultTenant)
+}
+
+func (r *Resolver) BySlug(slug string) (*models.Tenant, error) {
+	return r.find("slug = ?", strings.ToLower(slug))
+}
+
+func (r *Resolver) ByID(id uint) (*models.Tenant, error) {
+	return r.find("id = ?", id)
+}
+
+func (r *Resolver) find(query string, arg interface{}) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := r.db.Where(query, arg).First(&tenant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTenantNotFound
+		}
+		return nil, err
+	}
+	return &tenant, nil
+}
@@ -0,0 +1,276 @@
+// Package tenancy keeps the data of businesses sharing a deployment apart.
+// Every tenant-owned table has a tenant_id column; once Register is called,
+// GORM adds the current tenant to every query, update and delete on those
+// tables and stamps it on every new row. The current tenant travels in the
+// statement's context, so handlers must use db.WithContext.
+//
+// Raw SQL is not rewritten: add Clause to its WHERE.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pos-system/internal/models"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrNoTenant    = errors.New("tenant not set")
+	ErrWrongTenant = errors.New("record belongs to another tenant")
+)
+
+// Column is the tenant column of every tenant-owned table
+const Column = "tenant_id"
+
+type tenantKey struct{}
+
+type allTenantsKey struct{}
+
+// WithTenant returns a context whose queries only see the given tenant
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// AllTenants returns a context whose queries see every tenant, for
+// migrations and provisioning. Rows created with it must have their
+// TenantID set.
+func AllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allTenantsKey{}, true)
+}
+
+// FromContext returns the current tenant
+func FromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	tenantID, ok := ctx.Value(tenantKey{}).(uint)
+	return tenantID, ok && tenantID != 0
+}
+
+func isAllTenants(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	all, _ := ctx.Value(allTenantsKey{}).(bool)
+	return all
+}
+
+// Clause returns a condition limiting column to the current tenant, for raw
+// SQL. Without a tenant it matches nothing.
+func Clause(ctx context.Context, column string) clause.Expr {
+	if tenantID, ok := FromContext(ctx); ok {
+		return clause.Expr{SQL: column + " = ?", Vars: []interface{}{tenantID}}
+	}
+	if isAllTenants(ctx) {
+		return clause.Expr{SQL: "TRUE"}
+	}
+	return clause.Expr{SQL: "FALSE"}
+}
+
+// plugin holds the tenant-owned tables
+type plugin struct {
+	tables map[string]bool
+}
+
+// Register makes every query on the tables of the given models tenant
+// scoped. Each model must have a TenantID field.
+func Register(db *gorm.DB, tenantModels ...interface{}) error {
+	p := &plugin{tables: make(map[string]bool, len(tenantModels))}
+	for _, model := range tenantModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		if stmt.Schema.LookUpField(Column) == nil {
+			return fmt.Errorf("%s has no %s column", stmt.Schema.Name, Column)
+		}
+		p.tables[stmt.Schema.Table] = true
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("tenancy:create", p.assign); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("tenancy:query", p.scope); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenancy:row", p.scope); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenancy:update", p.assignAndScope); err != nil {
+		return err
+	}
+	return callbacks.Delete().Before("gorm:delete").Register("tenancy:delete", p.scope)
+}
+
+// scope adds the current tenant to the WHERE of a statement on a
+// tenant-owned table, or fails it when there is no tenant
+func (p *plugin) scope(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.SQL.Len() > 0 || !p.tables[stmt.Table] {
+		return
+	}
+
+	tenantID, ok := FromContext(stmt.Context)
+	if !ok {
+		if !isAllTenants(stmt.Context) {
+			db.AddError(ErrNoTenant)
+		}
+		return
+	}
+
+	// Count followed by Find runs the same statement twice
+	if isScoped(stmt) {
+		return
+	}
+
+	// Like soft delete, keep "a OR b" from becoming "a OR (b AND tenant)"
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 1 {
+			for _, expr := range where.Exprs {
+				if _, ok := expr.(clause.OrConditions); ok {
+					where.Exprs = []clause.Expression{clause.And(where.Exprs...)}
+					c.Expression = where
+					stmt.Clauses["WHERE"] = c
+					break
+				}
+			}
+		}
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: tenantColumn, Value: tenantID},
+	}})
+}
+
+var tenantColumn = clause.Column{Table: clause.CurrentTable, Name: Column}
+
+// isScoped reports whether the tenant condition is already in the WHERE
+func isScoped(stmt *gorm.Statement) bool {
+	where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where)
+	if !ok {
+		return false
+	}
+	for _, expr := range where.Exprs {
+		if eq, ok := expr.(clause.Eq); ok && eq.Column == tenantColumn {
+			return true
+		}
+	}
+	return false
+}
+
+// assign stamps the current tenant on the rows of a create, and rejects rows
+// of another tenant
+func (p *plugin) assign(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.SQL.Len() > 0 || !p.tables[stmt.Table] {
+		return
+	}
+
+	tenantID, ok := FromContext(stmt.Context)
+	if !ok && !isAllTenants(stmt.Context) {
+		db.AddError(ErrNoTenant)
+		return
+	}
+
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		db.AddError(assignMap(dest, tenantID))
+		return
+	case *map[string]interface{}:
+		db.AddError(assignMap(*dest, tenantID))
+		return
+	case []map[string]interface{}:
+		for _, row := range dest {
+			if err := assignMap(row, tenantID); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+		return
+	}
+
+	if stmt.Schema == nil {
+		return
+	}
+	field := stmt.Schema.LookUpField(Column)
+	if field == nil {
+		return
+	}
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			if err := assignRow(stmt.Context, field, reflect.Indirect(stmt.ReflectValue.Index(i)), tenantID); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		db.AddError(assignRow(stmt.Context, field, stmt.ReflectValue, tenantID))
+	}
+}
+
+// assignAndScope stamps the tenant on a saved struct, so a struct built by
+// hand cannot move a row out of its tenant, and scopes the update
+func (p *plugin) assignAndScope(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error == nil && stmt.SQL.Len() == 0 && p.tables[stmt.Table] && stmt.Schema != nil {
+		if field := stmt.Schema.LookUpField(Column); field != nil && stmt.ReflectValue.Kind() == reflect.Struct && stmt.ReflectValue.CanAddr() {
+			if tenantID, ok := FromContext(stmt.Context); ok {
+				db.AddError(assignRow(stmt.Context, field, stmt.ReflectValue, tenantID))
+			}
+		}
+	}
+	p.scope(db)
+}
+
+func assignRow(ctx context.Context, field *schema.Field, row reflect.Value, tenantID uint) error {
+	value, zero := field.ValueOf(ctx, row)
+	if zero {
+		if tenantID == 0 || !row.CanAddr() {
+			return ErrNoTenant
+		}
+		return field.Set(ctx, row, tenantID)
+	}
+	if tenantID != 0 && value != tenantID {
+		return ErrWrongTenant
+	}
+	return nil
+}
+
+func assignMap(row map[string]interface{}, tenantID uint) error {
+	if value, ok := row[Column]; ok {
+		if tenantID != 0 && value != tenantID {
+			return ErrWrongTenant
+		}
+		return nil
+	}
+	if tenantID == 0 {
+		return ErrNoTenant
+	}
+	row[Column] = tenantID
+	return nil
+}
+
+// ForEach calls fn with a handle on the database scoped to each active
+// tenant in turn, for background jobs. A failing tenant does not stop the
+// others; their errors are returned together.
+func ForEach(db *gorm.DB, fn func(tenant models.Tenant, db *gorm.DB) error) error {
+	var tenants []models.Tenant
+	if err := db.Where("is_active = ?", true).Order("id").Find(&tenants).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, tenant := range tenants {
+		if err := fn(tenant, db.WithContext(WithTenant(context.Background(), tenant.ID))); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant.Slug, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,227 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"pos-system/internal/models"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	tenantA uint = 1
+	tenantB uint = 2
+)
+
+// openDryRun returns a database that builds SQL without running it
+func openDryRun(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=pos_test"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := Register(db, &models.Transaction{}, &models.TransactionItem{}, &models.User{}); err != nil {
+		t.Fatalf("Failed to register tenancy: %v", err)
+	}
+	return db
+}
+
+func asTenant(db *gorm.DB, tenantID uint) *gorm.DB {
+	return db.WithContext(WithTenant(context.Background(), tenantID))
+}
+
+// expectTenantCondition checks a statement is limited to exactly one tenant
+func expectTenantCondition(t *testing.T, stmt *gorm.Statement, table string, tenantID uint) {
+	t.Helper()
+	sql := stmt.SQL.String()
+	condition := `"` + table + `"."tenant_id" = $`
+	if strings.Count(sql, condition) != 1 {
+		t.Fatalf("Expected one %s condition in %q", condition, sql)
+	}
+
+	// Every tenant the statement is bound to must be this one
+	bound := false
+	for _, v := range stmt.Vars {
+		if id, ok := v.(uint); ok && (id == tenantA || id == tenantB) {
+			if id != tenantID {
+				t.Errorf("Expected the query to be bound to tenant %d only, got %v", tenantID, stmt.Vars)
+			}
+			bound = true
+		}
+	}
+	if !bound {
+		t.Errorf("Expected the query to be bound to tenant %d, got %v", tenantID, stmt.Vars)
+	}
+}
+
+func TestTenantCannotReadAnotherTenantsTransactions(t *testing.T) {
+	db := openDryRun(t)
+
+	var transactions []models.Transaction
+	stmt := asTenant(db, tenantA).Where("status = ?", "paid").Find(&transactions).Statement
+	expectTenantCondition(t, stmt, "transactions", tenantA)
+
+	// Asking for a row of tenant B by ID still only looks in tenant A
+	var transaction models.Transaction
+	stmt = asTenant(db, tenantA).First(&transaction, 42).Statement
+	expectTenantCondition(t, stmt, "transactions", tenantA)
+
+	// Unscoped drops the soft delete filter, not the tenant
+	stmt = asTenant(db, tenantA).Unscoped().Find(&transactions).Statement
+	expectTenantCondition(t, stmt, "transactions", tenantA)
+
+	// Reports that read a table by name are scoped too
+	var total float64
+	stmt = asTenant(db, tenantB).Table("transaction_items").
+		Select("COALESCE(SUM(total_price), 0)").
+		Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
+		Scan(&total).Statement
+	expectTenantCondition(t, stmt, "transaction_items", tenantB)
+}
+
+func TestOrConditionsStayInsideTenant(t *testing.T) {
+	db := openDryRun(t)
+
+	var transactions []models.Transaction
+	stmt := asTenant(db, tenantA).Where("status = ?", "pending").Or("status = ?", "paid").Find(&transactions).Statement
+	expectTenantCondition(t, stmt, "transactions", tenantA)
+	if sql := stmt.SQL.String(); !strings.Contains(sql, `(status = $1 OR status = $2) AND "transactions"."tenant_id" = $3`) {
+		t.Errorf("Expected the OR to be grouped before the tenant condition, got %q", sql)
+	}
+}
+
+func TestCountThenFindScopedOnce(t *testing.T) {
+	db := openDryRun(t)
+
+	var count int64
+	var transactions []models.Transaction
+	query := asTenant(db, tenantA).Model(&models.Transaction{}).Where("status = ?", "pending")
+	query.Count(&count)
+	stmt := query.Find(&transactions).Statement
+	expectTenantCondition(t, stmt, "transactions", tenantA)
+}
+
+func TestUpdateAndDeleteScoped(t *testing.T) {
+	db := openDryRun(t)
+
+	stmt := asTenant(db, tenantA).Model(&models.Transaction{ID: 7}).Update("status", "cancelled").Statement
+	expectTenantCondition(t, stmt, "transactions", tenantA)
+
+	stmt = asTenant(db, tenantB).Where("status = ?", "pending").Delete(&models.Transaction{}).Statement
+	expectTenantCondition(t, stmt, "transactions", tenantB)
+
+	// A struct built by hand is saved into the current tenant
+	transaction := models.Transaction{ID: 7, TransactionNo: "TXN-7"}
+	stmt = asTenant(db, tenantA).Save(&transaction).Statement
+	expectTenantCondition(t, stmt, "transactions", tenantA)
+	if transaction.TenantID != tenantA {
+		t.Errorf("Expected saved transaction in tenant %d, got %d", tenantA, transaction.TenantID)
+	}
+}
+
+func TestCreateStampsTenant(t *testing.T) {
+	db := openDryRun(t)
+
+	transaction := models.Transaction{
+		TransactionNo: "TXN-1",
+		Items:         []models.TransactionItem{{MenuItemID: 1, Quantity: 1}},
+	}
+	if err := asTenant(db, tenantB).Create(&transaction).Error; err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	if transaction.TenantID != tenantB {
+		t.Errorf("Expected transaction in tenant %d, got %d", tenantB, transaction.TenantID)
+	}
+
+	// Rows of another tenant cannot be written
+	foreign := models.Transaction{TenantID: tenantA, TransactionNo: "TXN-2"}
+	if err := asTenant(db, tenantB).Create(&foreign).Error; !errors.Is(err, ErrWrongTenant) {
+		t.Errorf("Expected ErrWrongTenant, got %v", err)
+	}
+
+	users := []models.User{{Username: "a"}, {Username: "b"}}
+	if err := asTenant(db, tenantA).Create(&users).Error; err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+	for _, user := range users {
+		if user.TenantID != tenantA {
+			t.Errorf("Expected user %s in tenant %d, got %d", user.Username, tenantA, user.TenantID)
+		}
+	}
+}
+
+func TestNoTenantFailsClosed(t *testing.T) {
+	db := openDryRun(t)
+
+	var transactions []models.Transaction
+	if err := db.Find(&transactions).Error; !errors.Is(err, ErrNoTenant) {
+		t.Errorf("Expected ErrNoTenant reading without a tenant, got %v", err)
+	}
+	if err := db.Create(&models.Transaction{TransactionNo: "TXN-3"}).Error; !errors.Is(err, ErrNoTenant) {
+		t.Errorf("Expected ErrNoTenant creating without a tenant, got %v", err)
+	}
+	if err := db.Model(&models.Transaction{}).Where("id = ?", 1).Update("status", "paid").Error; !errors.Is(err, ErrNoTenant) {
+		t.Errorf("Expected ErrNoTenant updating without a tenant, got %v", err)
+	}
+
+	// Migrations and provisioning may see every tenant, but must say which one they write to
+	all := db.WithContext(AllTenants(context.Background()))
+	if err := all.Find(&transactions).Error; err != nil {
+		t.Errorf("Expected reading all tenants to work, got %v", err)
+	}
+	if err := all.Create(&models.Transaction{TransactionNo: "TXN-4"}).Error; !errors.Is(err, ErrNoTenant) {
+		t.Errorf("Expected ErrNoTenant creating a row with no tenant, got %v", err)
+	}
+	if err := all.Create(&models.Transaction{TenantID: tenantB, TransactionNo: "TXN-5"}).Error; err != nil {
+		t.Errorf("Expected creating a row for a given tenant to work, got %v", err)
+	}
+}
+
+func TestClause(t *testing.T) {
+	ctx := WithTenant(context.Background(), tenantA)
+	if expr := Clause(ctx, "transactions.tenant_id"); expr.SQL != "transactions.tenant_id = ?" || len(expr.Vars) != 1 || expr.Vars[0] != tenantA {
+		t.Errorf("Unexpected clause %+v", expr)
+	}
+	if expr := Clause(context.Background(), "transactions.tenant_id"); expr.SQL != "FALSE" {
+		t.Errorf("Expected no rows without a tenant, got %+v", expr)
+	}
+
+	// Raw SQL is bound to the tenant through the clause
+	db := openDryRun(t)
+	var total float64
+	stmt := asTenant(db, tenantB).Raw("SELECT SUM(total) FROM transactions WHERE status = 'paid' AND ?",
+		Clause(ctx, "transactions.tenant_id")).Scan(&total).Statement
+	if !strings.Contains(stmt.SQL.String(), "transactions.tenant_id = $1") {
+		t.Errorf("Expected the raw query to be limited to a tenant, got %q", stmt.SQL.String())
+	}
+}
+
+func TestSubdomainSlug(t *testing.T) {
+	tests := []struct {
+		host, baseDomain, want string
+	}{
+		{"kopi-senja.pos.example.com", "pos.example.com", "kopi-senja"},
+		{"Kopi-Senja.POS.example.com:8080", "pos.example.com", "kopi-senja"},
+		{"kopi-senja.pos.example.com.", "pos.example.com", "kopi-senja"},
+		{"pos.example.com", "pos.example.com", ""},
+		{"a.b.pos.example.com", "pos.example.com", ""},
+		{"kopi-senja.evil.com", "pos.example.com", ""},
+		{"kopi-senjapos.example.com", "pos.example.com", ""},
+		{"kopi-senja.pos.example.com", "", ""},
+		{"acme.localhost:8080", "localhost", "acme"},
+	}
+	for _, tt := range tests {
+		if got := SubdomainSlug(tt.host, tt.baseDomain); got != tt.want {
+			t.Errorf("SubdomainSlug(%q, %q) = %q, want %q", tt.host, tt.baseDomain, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+-- Migration: Replace add_ons.menu_item_id with many-to-many add-on links
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+-- Link tables (also created by GORM AutoMigrate)
+CREATE TABLE IF NOT EXISTS add_on_menu_items (
+    add_on_id BIGINT NOT NULL REFERENCES add_ons(id) ON DELETE CASCADE,
+    menu_item_id BIGINT NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    PRIMARY KEY (add_on_id, menu_item_id)
+);
+
+CREATE TABLE IF NOT EXISTS add_on_categories (
+    add_on_id BIGINT NOT NULL REFERENCES add_ons(id) ON DELETE CASCADE,
+    category_id BIGINT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    PRIMARY KEY (add_on_id, category_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_add_on_menu_items_menu_item_id ON add_on_menu_items(menu_item_id);
+CREATE INDEX IF NOT EXISTS idx_add_on_categories_category_id ON add_on_categories(category_id);
+
+-- Carry existing menu-specific add-ons over to the link table
+INSERT INTO add_on_menu_items (add_on_id, menu_item_id)
+SELECT id, menu_item_id FROM add_ons WHERE menu_item_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+-- Add-ons without links remain global, as before
+ALTER TABLE add_ons DROP CONSTRAINT IF EXISTS fk_add_ons_menu_item;
+DROP INDEX IF EXISTS idx_add_ons_menu_item_id;
+ALTER TABLE add_ons DROP COLUMN IF EXISTS menu_item_id;
@@ -0,0 +1,27 @@
+-- Migration: Add bundle (combo meal) support
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+-- Menu items are either regular items or bundles
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS item_type VARCHAR(20) NOT NULL DEFAULT 'item';
+
+-- Component slots of a bundle: a fixed menu item or a choice from a category
+CREATE TABLE IF NOT EXISTS bundle_slots (
+    id BIGSERIAL PRIMARY KEY,
+    bundle_id BIGINT NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name TEXT,
+    menu_item_id BIGINT REFERENCES menu_items(id),
+    category_id BIGINT REFERENCES categories(id),
+    quantity BIGINT NOT NULL DEFAULT 1,
+    sort_order BIGINT DEFAULT 0,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_bundle_slots_bundle_id ON bundle_slots(bundle_id);
+
+-- Component lines of a sold bundle point at the bundle line
+ALTER TABLE transaction_items ADD COLUMN IF NOT EXISTS parent_item_id BIGINT;
+ALTER TABLE transaction_items ADD COLUMN IF NOT EXISTS bundle_slot_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_transaction_items_parent_item_id ON transaction_items(parent_item_id);
+
+COMMENT ON COLUMN transaction_items.parent_item_id IS 'Bundle line this component line belongs to. Component lines carry allocated revenue and are excluded from the subtotal';
@@ -0,0 +1,8 @@
+-- Migration: Add refund tracking to transactions
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMPTZ;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refund_reason TEXT DEFAULT '';
+
+COMMENT ON COLUMN transactions.status IS 'pending, paid or refunded';
@@ -0,0 +1,39 @@
+-- Migration: Add stock movement ledger details and stock takes
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+-- Every stock change is recorded with its cost and the user who made it
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS unit_cost NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS total_cost NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS reason TEXT DEFAULT '';
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS user_id BIGINT REFERENCES users(id);
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS stock_take_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_stock_movements_type ON stock_movements(type);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_created_at ON stock_movements(created_at);
+
+-- Stock takes (stock opname)
+CREATE TABLE IF NOT EXISTS stock_takes (
+    id BIGSERIAL PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    notes TEXT,
+    user_id BIGINT REFERENCES users(id),
+    posted_by BIGINT REFERENCES users(id),
+    posted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS stock_take_lines (
+    id BIGSERIAL PRIMARY KEY,
+    stock_take_id BIGINT NOT NULL REFERENCES stock_takes(id) ON DELETE CASCADE,
+    ingredient_id BIGINT NOT NULL REFERENCES ingredients(id),
+    expected_qty NUMERIC,
+    counted_qty NUMERIC NOT NULL,
+    variance NUMERIC,
+    unit_cost NUMERIC
+);
+CREATE INDEX IF NOT EXISTS idx_stock_take_lines_stock_take_id ON stock_take_lines(stock_take_id);
+
+-- Raw material expenses created from a purchase receipt point at its movement
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS stock_movement_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_expenses_stock_movement_id ON expenses(stock_movement_id);
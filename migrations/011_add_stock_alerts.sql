@@ -0,0 +1,16 @@
+-- Migration: Add low-stock thresholds and automatic sold-out flags
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+ALTER TABLE ingredients ADD COLUMN IF NOT EXISTS low_stock_threshold NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE ingredients ADD COLUMN IF NOT EXISTS low_stock BOOLEAN DEFAULT false;
+
+-- Menu items whose recipe runs out of stock are switched off automatically and
+-- flagged sold_out, so they can be switched back on when stock is received
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS sold_out BOOLEAN DEFAULT false;
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS low_stock BOOLEAN DEFAULT false;
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS low_stock_threshold BIGINT DEFAULT 0;
+
+ALTER TABLE add_ons ADD COLUMN IF NOT EXISTS sold_out BOOLEAN DEFAULT false;
+
+COMMENT ON COLUMN menu_items.low_stock_threshold IS 'Alert when the ingredients on hand cover this many portions or fewer; 0 disables';
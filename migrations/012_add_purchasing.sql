@@ -0,0 +1,51 @@
+-- Migration: Add suppliers and purchase orders
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS suppliers (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    contact_name TEXT,
+    phone TEXT,
+    email TEXT,
+    address TEXT,
+    notes TEXT,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_suppliers_deleted_at ON suppliers(deleted_at);
+
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id BIGSERIAL PRIMARY KEY,
+    po_number TEXT NOT NULL,
+    supplier_id BIGINT NOT NULL REFERENCES suppliers(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    notes TEXT,
+    total NUMERIC NOT NULL DEFAULT 0,
+    expected_at TIMESTAMPTZ,
+    sent_at TIMESTAMPTZ,
+    received_at TIMESTAMPTZ,
+    user_id BIGINT REFERENCES users(id),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchase_orders_po_number ON purchase_orders(po_number);
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_supplier_id ON purchase_orders(supplier_id);
+
+CREATE TABLE IF NOT EXISTS purchase_order_lines (
+    id BIGSERIAL PRIMARY KEY,
+    purchase_order_id BIGINT NOT NULL REFERENCES purchase_orders(id) ON DELETE CASCADE,
+    ingredient_id BIGINT NOT NULL REFERENCES ingredients(id),
+    quantity NUMERIC NOT NULL,
+    unit_cost NUMERIC NOT NULL,
+    received_qty NUMERIC NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_purchase_order_id ON purchase_order_lines(purchase_order_id);
+
+-- Receipts against a purchase order are traceable from the stock ledger and expenses
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS purchase_order_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_stock_movements_purchase_order_id ON stock_movements(purchase_order_id);
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS purchase_order_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_expenses_purchase_order_id ON expenses(purchase_order_id);
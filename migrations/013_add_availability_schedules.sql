@@ -0,0 +1,21 @@
+-- Migration: Add availability schedules for menu items, categories and add-ons
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS availability_schedules (
+    id BIGSERIAL PRIMARY KEY,
+    menu_item_id BIGINT REFERENCES menu_items(id) ON DELETE CASCADE,
+    category_id BIGINT REFERENCES categories(id) ON DELETE CASCADE,
+    add_on_id BIGINT REFERENCES add_ons(id) ON DELETE CASCADE,
+    name TEXT,
+    days JSONB NOT NULL DEFAULT '[]',
+    start_time VARCHAR(5),
+    end_time VARCHAR(5),
+    start_date VARCHAR(10),
+    end_date VARCHAR(10),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_availability_schedules_menu_item_id ON availability_schedules(menu_item_id);
+CREATE INDEX IF NOT EXISTS idx_availability_schedules_category_id ON availability_schedules(category_id);
+CREATE INDEX IF NOT EXISTS idx_availability_schedules_add_on_id ON availability_schedules(add_on_id);
@@ -0,0 +1,35 @@
+-- Migration: Add channel-specific price lists
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS price_lists (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT,
+    channel TEXT,
+    order_type TEXT,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_price_lists_name ON price_lists(name);
+CREATE INDEX IF NOT EXISTS idx_price_lists_channel ON price_lists(channel);
+CREATE INDEX IF NOT EXISTS idx_price_lists_deleted_at ON price_lists(deleted_at);
+
+CREATE TABLE IF NOT EXISTS price_list_items (
+    id BIGSERIAL PRIMARY KEY,
+    price_list_id BIGINT NOT NULL REFERENCES price_lists(id) ON DELETE CASCADE,
+    menu_item_id BIGINT REFERENCES menu_items(id) ON DELETE CASCADE,
+    add_on_id BIGINT REFERENCES add_ons(id) ON DELETE CASCADE,
+    price NUMERIC NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_price_list_items_price_list_id ON price_list_items(price_list_id);
+CREATE INDEX IF NOT EXISTS idx_price_list_items_menu_item_id ON price_list_items(menu_item_id);
+CREATE INDEX IF NOT EXISTS idx_price_list_items_add_on_id ON price_list_items(add_on_id);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS order_type VARCHAR(20) NOT NULL DEFAULT 'dine_in';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS channel VARCHAR(50) NOT NULL DEFAULT 'pos';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS price_list_id BIGINT REFERENCES price_lists(id);
@@ -0,0 +1,44 @@
+-- Migration: Add scheduled price changes and price history
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS price_changes (
+    id BIGSERIAL PRIMARY KEY,
+    menu_item_id BIGINT REFERENCES menu_items(id),
+    add_on_id BIGINT REFERENCES add_ons(id),
+    price NUMERIC NOT NULL,
+    effective_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    notes TEXT,
+    applied_at TIMESTAMPTZ,
+    user_id BIGINT REFERENCES users(id),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_price_changes_menu_item_id ON price_changes(menu_item_id);
+CREATE INDEX IF NOT EXISTS idx_price_changes_add_on_id ON price_changes(add_on_id);
+CREATE INDEX IF NOT EXISTS idx_price_changes_effective_at ON price_changes(effective_at);
+
+CREATE TABLE IF NOT EXISTS price_histories (
+    id BIGSERIAL PRIMARY KEY,
+    menu_item_id BIGINT REFERENCES menu_items(id),
+    add_on_id BIGINT REFERENCES add_ons(id),
+    price NUMERIC NOT NULL,
+    cogs NUMERIC NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    price_change_id BIGINT REFERENCES price_changes(id),
+    user_id BIGINT REFERENCES users(id),
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_price_histories_menu_item_id ON price_histories(menu_item_id);
+CREATE INDEX IF NOT EXISTS idx_price_histories_add_on_id ON price_histories(add_on_id);
+CREATE INDEX IF NOT EXISTS idx_price_histories_created_at ON price_histories(created_at);
+
+-- Start the history from current prices
+INSERT INTO price_histories (menu_item_id, price, cogs, source, created_at)
+SELECT id, price, cogs, 'manual', NOW() FROM menu_items
+WHERE deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM price_histories WHERE price_histories.menu_item_id = menu_items.id);
+
+INSERT INTO price_histories (add_on_id, price, cogs, source, created_at)
+SELECT id, price, cogs, 'manual', NOW() FROM add_ons
+WHERE deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM price_histories WHERE price_histories.add_on_id = add_ons.id);
@@ -0,0 +1,10 @@
+-- Migration: Add SKUs to menu items and add-ons for menu import
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS sku TEXT DEFAULT '';
+ALTER TABLE add_ons ADD COLUMN IF NOT EXISTS sku TEXT DEFAULT '';
+
+-- SKUs are optional, so only non-empty SKUs of live rows must be unique
+CREATE UNIQUE INDEX IF NOT EXISTS idx_menu_items_sku ON menu_items(sku) WHERE sku <> '' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_add_ons_sku ON add_ons(sku) WHERE sku <> '' AND deleted_at IS NULL;
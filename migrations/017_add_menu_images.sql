@@ -0,0 +1,6 @@
+-- Migration: Add uploaded image fields to menu items
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS thumbnail_url TEXT DEFAULT '';
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS image_key TEXT DEFAULT '';
@@ -0,0 +1,12 @@
+-- Migration: Add barcodes to menu items for scanning retail items
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS barcodes (
+    id BIGSERIAL PRIMARY KEY,
+    menu_item_id BIGINT NOT NULL REFERENCES menu_items(id),
+    code TEXT NOT NULL,
+    created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_barcodes_code ON barcodes(code);
+CREATE INDEX IF NOT EXISTS idx_barcodes_menu_item_id ON barcodes(menu_item_id);
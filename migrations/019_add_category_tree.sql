@@ -0,0 +1,11 @@
+-- Migration: Add nested categories, sort order and channel visibility
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id BIGINT REFERENCES categories(id);
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS sort_order INTEGER DEFAULT 0;
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS channels JSONB DEFAULT '[]';
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);
+
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS sort_order INTEGER DEFAULT 0;
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS channels JSONB DEFAULT '[]';
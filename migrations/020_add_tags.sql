@@ -0,0 +1,41 @@
+-- Migration: Add dietary, allergen and other tags to menu items and add-ons
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL,
+    kind TEXT NOT NULL DEFAULT 'tag',
+    description TEXT DEFAULT '',
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_slug ON tags(slug);
+
+CREATE TABLE IF NOT EXISTS menu_item_tags (
+    menu_item_id BIGINT NOT NULL REFERENCES menu_items(id),
+    tag_id BIGINT NOT NULL REFERENCES tags(id),
+    PRIMARY KEY (menu_item_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_menu_item_tags_tag_id ON menu_item_tags(tag_id);
+
+CREATE TABLE IF NOT EXISTS add_on_tags (
+    add_on_id BIGINT NOT NULL REFERENCES add_ons(id),
+    tag_id BIGINT NOT NULL REFERENCES tags(id),
+    PRIMARY KEY (add_on_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_add_on_tags_tag_id ON add_on_tags(tag_id);
+
+INSERT INTO tags (name, slug, kind, created_at, updated_at) VALUES
+    ('Milk', 'milk', 'allergen', NOW(), NOW()),
+    ('Eggs', 'eggs', 'allergen', NOW(), NOW()),
+    ('Peanuts', 'peanuts', 'allergen', NOW(), NOW()),
+    ('Tree Nuts', 'tree-nuts', 'allergen', NOW(), NOW()),
+    ('Gluten', 'gluten', 'allergen', NOW(), NOW()),
+    ('Soy', 'soy', 'allergen', NOW(), NOW()),
+    ('Sesame', 'sesame', 'allergen', NOW(), NOW()),
+    ('Vegan', 'vegan', 'dietary', NOW(), NOW()),
+    ('Vegetarian', 'vegetarian', 'dietary', NOW(), NOW()),
+    ('Dairy-Free', 'dairy-free', 'dietary', NOW(), NOW())
+ON CONFLICT (slug) DO NOTHING;
@@ -0,0 +1,15 @@
+-- Migration: Add full-text and fuzzy menu search
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS search_text TEXT DEFAULT '';
+
+UPDATE menu_items SET search_text = concat_ws(' ', menu_items.name,
+    (SELECT categories.name FROM categories WHERE categories.id = menu_items.category_id),
+    (SELECT string_agg(tags.name, ' ') FROM tags JOIN menu_item_tags ON menu_item_tags.tag_id = tags.id WHERE menu_item_tags.menu_item_id = menu_items.id),
+    menu_items.description);
+
+CREATE INDEX IF NOT EXISTS idx_menu_items_search_fts ON menu_items USING GIN (to_tsvector('simple', search_text));
+CREATE INDEX IF NOT EXISTS idx_menu_items_search_trgm ON menu_items USING GIN (search_text gin_trgm_ops);
@@ -0,0 +1,18 @@
+-- Migration: Add menu drafts and published menu versions
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS menu_versions (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'draft',
+    document JSONB NOT NULL,
+    base_version_id BIGINT REFERENCES menu_versions(id),
+    rollback_of_id BIGINT REFERENCES menu_versions(id),
+    created_by BIGINT REFERENCES users(id),
+    published_by BIGINT REFERENCES users(id),
+    published_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_menu_versions_status ON menu_versions(status);
@@ -0,0 +1,56 @@
+-- Migration: Add loyalty points, earn rules and membership tiers
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS loyalty_tiers (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    min_points BIGINT NOT NULL DEFAULT 0,
+    earn_multiplier NUMERIC NOT NULL DEFAULT 1,
+    expiry_months BIGINT,
+    benefits TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_tiers_name ON loyalty_tiers(name);
+
+CREATE TABLE IF NOT EXISTS loyalty_earn_rules (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    spend_amount NUMERIC DEFAULT 0,
+    menu_item_id BIGINT REFERENCES menu_items(id),
+    points BIGINT NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_loyalty_earn_rules_menu_item_id ON loyalty_earn_rules(menu_item_id);
+
+CREATE TABLE IF NOT EXISTS loyalty_entries (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT NOT NULL REFERENCES customers(id),
+    transaction_id BIGINT REFERENCES transactions(id),
+    type TEXT NOT NULL,
+    points BIGINT NOT NULL,
+    remaining BIGINT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ,
+    note TEXT,
+    user_id BIGINT REFERENCES users(id),
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_loyalty_entries_customer_id ON loyalty_entries(customer_id);
+CREATE INDEX IF NOT EXISTS idx_loyalty_entries_transaction_id ON loyalty_entries(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_loyalty_entries_expires_at ON loyalty_entries(expires_at);
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS points BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS lifetime_points BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS tier_id BIGINT REFERENCES loyalty_tiers(id);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS loyalty_discount NUMERIC DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS points_redeemed BIGINT DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS points_earned BIGINT DEFAULT 0;
+
+INSERT INTO payment_methods (name, code, is_active, created_at, updated_at)
+SELECT 'Loyalty Points', 'points', TRUE, NOW(), NOW()
+WHERE NOT EXISTS (SELECT 1 FROM payment_methods WHERE code = 'points');
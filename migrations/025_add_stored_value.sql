@@ -0,0 +1,62 @@
+-- Migration: Add gift cards, customer balances and split payments
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS stored_value_accounts (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    code TEXT DEFAULT '',
+    customer_id BIGINT REFERENCES customers(id),
+    balance NUMERIC NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'active',
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_stored_value_accounts_type ON stored_value_accounts(type);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stored_value_accounts_code ON stored_value_accounts(code) WHERE code <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stored_value_accounts_customer ON stored_value_accounts(customer_id) WHERE type = 'customer';
+
+-- Ledger of every balance change; entries are never updated or deleted
+CREATE TABLE IF NOT EXISTS stored_value_entries (
+    id BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES stored_value_accounts(id),
+    type TEXT NOT NULL,
+    amount NUMERIC NOT NULL,
+    balance_after NUMERIC NOT NULL,
+    transaction_id BIGINT REFERENCES transactions(id),
+    payment_method TEXT,
+    note TEXT,
+    user_id BIGINT REFERENCES users(id),
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_stored_value_entries_account_id ON stored_value_entries(account_id);
+CREATE INDEX IF NOT EXISTS idx_stored_value_entries_transaction_id ON stored_value_entries(transaction_id);
+
+CREATE OR REPLACE FUNCTION reject_stored_value_entry_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'stored_value_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS stored_value_entries_append_only ON stored_value_entries;
+CREATE TRIGGER stored_value_entries_append_only
+BEFORE UPDATE OR DELETE ON stored_value_entries
+FOR EACH ROW EXECUTE FUNCTION reject_stored_value_entry_change();
+
+CREATE TABLE IF NOT EXISTS transaction_payments (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL REFERENCES transactions(id),
+    payment_method TEXT NOT NULL,
+    amount NUMERIC NOT NULL,
+    stored_value_account_id BIGINT REFERENCES stored_value_accounts(id),
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_transaction_payments_transaction_id ON transaction_payments(transaction_id);
+
+INSERT INTO payment_methods (name, code, is_active, created_at, updated_at)
+SELECT 'Gift Card', 'gift_card', TRUE, NOW(), NOW()
+WHERE NOT EXISTS (SELECT 1 FROM payment_methods WHERE code = 'gift_card');
+
+INSERT INTO payment_methods (name, code, is_active, created_at, updated_at)
+SELECT 'Customer Balance', 'balance', TRUE, NOW(), NOW()
+WHERE NOT EXISTS (SELECT 1 FROM payment_methods WHERE code = 'balance');
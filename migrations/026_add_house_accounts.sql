@@ -0,0 +1,38 @@
+-- Migration: Add house accounts for customers who order on credit
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS house_accounts (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT NOT NULL REFERENCES customers(id),
+    credit_limit NUMERIC NOT NULL DEFAULT 0,
+    balance NUMERIC NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'active',
+    notes TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_house_accounts_customer_id ON house_accounts(customer_id);
+
+CREATE TABLE IF NOT EXISTS house_account_entries (
+    id BIGSERIAL PRIMARY KEY,
+    house_account_id BIGINT NOT NULL REFERENCES house_accounts(id),
+    type TEXT NOT NULL,
+    amount NUMERIC NOT NULL,
+    balance_after NUMERIC NOT NULL,
+    transaction_id BIGINT REFERENCES transactions(id),
+    payment_method TEXT,
+    reference TEXT,
+    note TEXT,
+    user_id BIGINT REFERENCES users(id),
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_house_account_entries_house_account_id ON house_account_entries(house_account_id);
+CREATE INDEX IF NOT EXISTS idx_house_account_entries_transaction_id ON house_account_entries(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_house_account_entries_created_at ON house_account_entries(created_at);
+
+ALTER TABLE transaction_payments ADD COLUMN IF NOT EXISTS house_account_id BIGINT REFERENCES house_accounts(id);
+
+INSERT INTO payment_methods (name, code, is_active, created_at, updated_at)
+SELECT 'House Account', 'account', TRUE, NOW(), NOW()
+WHERE NOT EXISTS (SELECT 1 FROM payment_methods WHERE code = 'account');
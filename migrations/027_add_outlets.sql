@@ -0,0 +1,59 @@
+-- Migration: Add outlets and scope sales, expenses and stock to an outlet
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS outlets (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    code TEXT NOT NULL,
+    address TEXT,
+    phone TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outlets_code ON outlets(code) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outlets_deleted_at ON outlets(deleted_at);
+
+CREATE TABLE IF NOT EXISTS user_outlets (
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    outlet_id BIGINT NOT NULL REFERENCES outlets(id),
+    PRIMARY KEY (user_id, outlet_id)
+);
+
+CREATE TABLE IF NOT EXISTS outlet_stocks (
+    id BIGSERIAL PRIMARY KEY,
+    outlet_id BIGINT NOT NULL REFERENCES outlets(id),
+    ingredient_id BIGINT NOT NULL REFERENCES ingredients(id),
+    stock_qty NUMERIC NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outlet_stocks_outlet_ingredient ON outlet_stocks(outlet_id, ingredient_id);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS outlet_id BIGINT REFERENCES outlets(id);
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS outlet_id BIGINT REFERENCES outlets(id);
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS outlet_id BIGINT REFERENCES outlets(id);
+ALTER TABLE stock_takes ADD COLUMN IF NOT EXISTS outlet_id BIGINT REFERENCES outlets(id);
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS outlet_id BIGINT REFERENCES outlets(id);
+CREATE INDEX IF NOT EXISTS idx_transactions_outlet_id ON transactions(outlet_id);
+CREATE INDEX IF NOT EXISTS idx_expenses_outlet_id ON expenses(outlet_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_outlet_id ON stock_movements(outlet_id);
+CREATE INDEX IF NOT EXISTS idx_stock_takes_outlet_id ON stock_takes(outlet_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_outlet_id ON purchase_orders(outlet_id);
+
+-- Everything recorded so far belongs to the first outlet
+INSERT INTO outlets (name, code, is_active, created_at, updated_at)
+SELECT 'Main Outlet', 'MAIN', TRUE, NOW(), NOW()
+WHERE NOT EXISTS (SELECT 1 FROM outlets);
+
+UPDATE transactions SET outlet_id = (SELECT MIN(id) FROM outlets) WHERE outlet_id IS NULL;
+UPDATE expenses SET outlet_id = (SELECT MIN(id) FROM outlets) WHERE outlet_id IS NULL;
+UPDATE stock_movements SET outlet_id = (SELECT MIN(id) FROM outlets) WHERE outlet_id IS NULL;
+UPDATE stock_takes SET outlet_id = (SELECT MIN(id) FROM outlets) WHERE outlet_id IS NULL;
+UPDATE purchase_orders SET outlet_id = (SELECT MIN(id) FROM outlets) WHERE outlet_id IS NULL;
+
+INSERT INTO outlet_stocks (outlet_id, ingredient_id, stock_qty, updated_at)
+SELECT (SELECT MIN(id) FROM outlets), id, stock_qty, NOW()
+FROM ingredients
+WHERE deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM outlet_stocks);
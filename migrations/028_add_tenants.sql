@@ -0,0 +1,167 @@
+-- Migration: Add tenants and give every row a tenant
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenants_slug ON tenants(slug);
+
+-- Everything recorded so far belongs to the first tenant
+INSERT INTO tenants (name, slug, is_active, created_at, updated_at)
+SELECT 'Default', 'default', TRUE, NOW(), NOW()
+WHERE NOT EXISTS (SELECT 1 FROM tenants);
+
+ALTER TABLE outlets ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE barcodes ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE menu_versions ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE loyalty_tiers ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE loyalty_earn_rules ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE loyalty_entries ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE bundle_slots ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE add_ons ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE price_lists ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE price_list_items ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE price_changes ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE price_histories ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transaction_items ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transaction_item_add_ons ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transaction_payments ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE stored_value_accounts ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE stored_value_entries ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE house_accounts ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE house_account_entries ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payment_methods ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE ingredients ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE outlet_stocks ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE recipe_lines ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE stock_takes ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE stock_take_lines ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE suppliers ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE purchase_order_lines ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE availability_schedules ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+
+-- The stored-value ledger is append-only, except for this backfill
+ALTER TABLE stored_value_entries DISABLE TRIGGER stored_value_entries_append_only;
+UPDATE outlets SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE users SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE categories SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE menu_items SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE barcodes SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE tags SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE menu_versions SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE loyalty_tiers SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE customers SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE loyalty_earn_rules SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE loyalty_entries SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE bundle_slots SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE add_ons SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE price_lists SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE price_list_items SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE price_changes SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE price_histories SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE transactions SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE transaction_items SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE transaction_item_add_ons SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE transaction_payments SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE stored_value_accounts SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE stored_value_entries SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE house_accounts SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE house_account_entries SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE expenses SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE payment_methods SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE ingredients SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE outlet_stocks SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE recipe_lines SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE stock_movements SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE stock_takes SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE stock_take_lines SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE suppliers SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE purchase_orders SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE purchase_order_lines SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+UPDATE availability_schedules SET tenant_id = (SELECT MIN(id) FROM tenants) WHERE tenant_id = 0;
+ALTER TABLE stored_value_entries ENABLE TRIGGER stored_value_entries_append_only;
+
+CREATE INDEX IF NOT EXISTS idx_outlets_tenant_id ON outlets(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_users_tenant_id ON users(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_categories_tenant_id ON categories(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_menu_items_tenant_id ON menu_items(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_barcodes_tenant_id ON barcodes(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_tags_tenant_id ON tags(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_menu_versions_tenant_id ON menu_versions(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_loyalty_tiers_tenant_id ON loyalty_tiers(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_customers_tenant_id ON customers(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_loyalty_earn_rules_tenant_id ON loyalty_earn_rules(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_loyalty_entries_tenant_id ON loyalty_entries(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_bundle_slots_tenant_id ON bundle_slots(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_add_ons_tenant_id ON add_ons(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_price_lists_tenant_id ON price_lists(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_price_list_items_tenant_id ON price_list_items(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_price_changes_tenant_id ON price_changes(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_price_histories_tenant_id ON price_histories(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_tenant_id ON transactions(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_items_tenant_id ON transaction_items(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_item_add_ons_tenant_id ON transaction_item_add_ons(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_payments_tenant_id ON transaction_payments(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_stored_value_accounts_tenant_id ON stored_value_accounts(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_stored_value_entries_tenant_id ON stored_value_entries(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_house_accounts_tenant_id ON house_accounts(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_house_account_entries_tenant_id ON house_account_entries(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_expenses_tenant_id ON expenses(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_payment_methods_tenant_id ON payment_methods(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_ingredients_tenant_id ON ingredients(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_outlet_stocks_tenant_id ON outlet_stocks(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_lines_tenant_id ON recipe_lines(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_tenant_id ON stock_movements(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_stock_takes_tenant_id ON stock_takes(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_stock_take_lines_tenant_id ON stock_take_lines(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_suppliers_tenant_id ON suppliers(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_orders_tenant_id ON purchase_orders(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_order_lines_tenant_id ON purchase_order_lines(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_availability_schedules_tenant_id ON availability_schedules(tenant_id);
+
+-- Codes, numbers and names are now unique per tenant
+DROP INDEX IF EXISTS idx_barcodes_code;
+DROP INDEX IF EXISTS idx_customers_phone;
+DROP INDEX IF EXISTS idx_customers_email;
+DROP INDEX IF EXISTS idx_loyalty_tiers_name;
+DROP INDEX IF EXISTS idx_users_username;
+DROP INDEX IF EXISTS idx_users_email;
+DROP INDEX IF EXISTS idx_menu_items_sku;
+DROP INDEX IF EXISTS idx_add_ons_sku;
+DROP INDEX IF EXISTS idx_transactions_transaction_no;
+DROP INDEX IF EXISTS idx_payment_methods_code;
+DROP INDEX IF EXISTS idx_outlets_code;
+DROP INDEX IF EXISTS idx_price_lists_name;
+DROP INDEX IF EXISTS idx_purchase_orders_po_number;
+DROP INDEX IF EXISTS idx_stored_value_accounts_code;
+DROP INDEX IF EXISTS idx_tags_slug;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_barcodes_tenant_code ON barcodes(tenant_id, code);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_tenant_phone ON customers(tenant_id, phone) WHERE phone <> '' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_tenant_email ON customers(tenant_id, email) WHERE email <> '' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_tiers_tenant_name ON loyalty_tiers(tenant_id, name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username ON users(tenant_id, username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users(tenant_id, email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_menu_items_tenant_sku ON menu_items(tenant_id, sku) WHERE sku <> '' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_add_ons_tenant_sku ON add_ons(tenant_id, sku) WHERE sku <> '' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_tenant_transaction_no ON transactions(tenant_id, transaction_no);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_methods_tenant_code ON payment_methods(tenant_id, code);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outlets_tenant_code ON outlets(tenant_id, code) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_price_lists_tenant_name ON price_lists(tenant_id, name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchase_orders_tenant_po_number ON purchase_orders(tenant_id, po_number);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stored_value_accounts_tenant_code ON stored_value_accounts(tenant_id, code) WHERE code <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_tenant_slug ON tags(tenant_id, slug);
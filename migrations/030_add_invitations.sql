@@ -0,0 +1,21 @@
+-- Migration: Add user invitations
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+-- Users join by invitation; only the hash of the invitation token is stored
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    invited_by_id BIGINT REFERENCES users(id),
+    expires_at TIMESTAMPTZ,
+    accepted_at TIMESTAMPTZ,
+    user_id BIGINT REFERENCES users(id),
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_tenant_id ON invitations(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations(email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_token_hash ON invitations(token_hash);
@@ -0,0 +1,29 @@
+-- Migration: Add registered devices and PIN logins
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+-- Terminals cashiers log in on with a PIN; only the hash of the device token is stored
+CREATE TABLE IF NOT EXISTS devices (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    outlet_id BIGINT REFERENCES outlets(id),
+    token_hash TEXT NOT NULL,
+    registered_by_id BIGINT,
+    failed_pin_attempts BIGINT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_devices_tenant_id ON devices(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_devices_outlet_id ON devices(outlet_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_devices_token_hash ON devices(token_hash);
+
+-- Hashed like passwords; empty for users without a PIN
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pin_hash TEXT NOT NULL DEFAULT '';
+
+-- Sessions of a PIN login can only be refreshed from their device
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS device_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_device_id ON refresh_tokens(device_id);
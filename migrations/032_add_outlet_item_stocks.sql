@@ -0,0 +1,41 @@
+-- Migration: Track low stock and sold-out items per outlet
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+ALTER TABLE outlet_stocks ADD COLUMN IF NOT EXISTS low_stock BOOLEAN DEFAULT FALSE;
+
+UPDATE outlet_stocks
+SET low_stock = outlet_stocks.stock_qty <= ingredients.low_stock_threshold
+FROM ingredients
+WHERE ingredients.id = outlet_stocks.ingredient_id;
+
+-- Exactly one of menu_item_id and add_on_id is set; the other is 0
+CREATE TABLE IF NOT EXISTS outlet_item_stocks (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    outlet_id BIGINT NOT NULL REFERENCES outlets(id),
+    menu_item_id BIGINT NOT NULL DEFAULT 0,
+    add_on_id BIGINT NOT NULL DEFAULT 0,
+    sold_out BOOLEAN DEFAULT FALSE,
+    low_stock BOOLEAN DEFAULT FALSE,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_outlet_item_stocks_tenant_id ON outlet_item_stocks(tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outlet_item_stocks_item ON outlet_item_stocks(outlet_id, menu_item_id, add_on_id);
+
+-- Until now stock status followed the total, which was all at the first outlet
+INSERT INTO outlet_item_stocks (tenant_id, outlet_id, menu_item_id, sold_out, low_stock, updated_at)
+SELECT menu_items.tenant_id, (SELECT MIN(id) FROM outlets WHERE outlets.tenant_id = menu_items.tenant_id),
+       menu_items.id, menu_items.sold_out, menu_items.low_stock, NOW()
+FROM menu_items
+WHERE (menu_items.sold_out OR menu_items.low_stock)
+  AND EXISTS (SELECT 1 FROM outlets WHERE outlets.tenant_id = menu_items.tenant_id)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO outlet_item_stocks (tenant_id, outlet_id, add_on_id, sold_out, updated_at)
+SELECT add_ons.tenant_id, (SELECT MIN(id) FROM outlets WHERE outlets.tenant_id = add_ons.tenant_id),
+       add_ons.id, TRUE, NOW()
+FROM add_ons
+WHERE add_ons.sold_out
+  AND EXISTS (SELECT 1 FROM outlets WHERE outlets.tenant_id = add_ons.tenant_id)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,67 @@
+-- Migration: Add the ingredients, recipe_lines and stock_movements tables
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+-- These tables were only ever created by the application's auto-migration.
+-- Databases set up from these scripts alone get them here, with the columns
+-- later migrations added; elsewhere this does nothing.
+
+-- Raw materials tracked in stock
+CREATE TABLE IF NOT EXISTS ingredients (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    unit TEXT NOT NULL,
+    unit_cost NUMERIC NOT NULL DEFAULT 0,
+    stock_qty NUMERIC NOT NULL DEFAULT 0,
+    low_stock_threshold NUMERIC NOT NULL DEFAULT 0,
+    low_stock BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_ingredients_tenant_id ON ingredients(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_ingredients_deleted_at ON ingredients(deleted_at);
+
+-- How much of an ingredient one menu item or add-on consumes
+CREATE TABLE IF NOT EXISTS recipe_lines (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    menu_item_id BIGINT REFERENCES menu_items(id) ON DELETE CASCADE,
+    add_on_id BIGINT REFERENCES add_ons(id) ON DELETE CASCADE,
+    ingredient_id BIGINT NOT NULL REFERENCES ingredients(id),
+    quantity NUMERIC NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_recipe_lines_tenant_id ON recipe_lines(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_lines_menu_item_id ON recipe_lines(menu_item_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_lines_add_on_id ON recipe_lines(add_on_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_lines_ingredient_id ON recipe_lines(ingredient_id);
+
+-- Every change in ingredient stock; negative quantities are consumption
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    ingredient_id BIGINT NOT NULL REFERENCES ingredients(id),
+    outlet_id BIGINT REFERENCES outlets(id),
+    type TEXT NOT NULL,
+    quantity NUMERIC NOT NULL,
+    unit_cost NUMERIC NOT NULL DEFAULT 0,
+    total_cost NUMERIC NOT NULL DEFAULT 0,
+    reason TEXT DEFAULT '',
+    user_id BIGINT REFERENCES users(id),
+    transaction_id BIGINT REFERENCES transactions(id),
+    stock_take_id BIGINT,
+    purchase_order_id BIGINT,
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_tenant_id ON stock_movements(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_ingredient_id ON stock_movements(ingredient_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_outlet_id ON stock_movements(outlet_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_type ON stock_movements(type);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_user_id ON stock_movements(user_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_transaction_id ON stock_movements(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_stock_take_id ON stock_movements(stock_take_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_purchase_order_id ON stock_movements(purchase_order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_created_at ON stock_movements(created_at);
@@ -0,0 +1,8 @@
+-- Migration: Remove recipes attached to bundles
+-- Created: 2026-10-19
+-- Database: PostgreSQL
+
+-- A bundle's stock and COGS come from its components; a recipe of its own
+-- took the stock twice when sold
+DELETE FROM recipe_lines
+WHERE menu_item_id IN (SELECT id FROM menu_items WHERE item_type = 'bundle');
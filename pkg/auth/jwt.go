@@ -1,51 +1,97 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
+	"unicode"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type JWTService struct {
-	secretKey   string
-	expiryHours int
+	secretKey  string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
 }
 
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID       uint   `json:"user_id"`
+	TenantID     uint   `json:"tenant_id"` // Business the user belongs to; the token is only valid there
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	SessionID    string `json:"sid"`                 // Login the token was issued for; logging out revokes it
+	TokenVersion int    `json:"ver"`                 // Must match the user's; bumping it revokes all their tokens
+	DeviceID     uint   `json:"device_id,omitempty"` // Registered device a PIN login is bound to; the token only works with its device token
 	jwt.RegisteredClaims
 }
 
-func NewJWTService(secretKey string, expiryHours int) *JWTService {
+// NewJWTService signs access tokens valid for accessTTL. Clients keep using
+// the API past that by trading a refresh token, valid for refreshTTL.
+func NewJWTService(secretKey string, accessTTL, refreshTTL time.Duration) *JWTService {
 	return &JWTService{
-		secretKey:   secretKey,
-		expiryHours: expiryHours,
+		secretKey:  secretKey,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
 	}
 }
 
-func (j *JWTService) GenerateToken(userID uint, username, role string) (string, error) {
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * time.Duration(j.expiryHours))),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+func (j *JWTService) AccessTTL() time.Duration {
+	return j.accessTTL
+}
+
+func (j *JWTService) RefreshTTL() time.Duration {
+	return j.refreshTTL
+}
+
+// GenerateToken signs an access token for the user of the claims, with a
+// new token ID and an expiry of AccessTTL from now
+func (j *JWTService) GenerateToken(claims Claims) (string, error) {
+	id, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        id,
+		ExpiresAt: jwt.NewNumericDate(now.Add(j.accessTTL)),
+		IssuedAt:  jwt.NewNumericDate(now),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
 	return token.SignedString([]byte(j.secretKey))
 }
 
 func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
+	return j.parse(tokenString)
+}
+
+// TenantOf returns the tenant of a token signed by this service, even an
+// expired one, so that a client can refresh it
+func (j *JWTService) TenantOf(tokenString string) (uint, error) {
+	claims, err := j.ClaimsOf(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	return claims.TenantID, nil
+}
+
+// ClaimsOf returns the claims of a token signed by this service, even an
+// expired one. It must not be used to authenticate.
+func (j *JWTService) ClaimsOf(tokenString string) (*Claims, error) {
+	return j.parse(tokenString, jwt.WithoutClaimsValidation())
+}
+
+func (j *JWTService) parse(tokenString string, options ...jwt.ParserOption) (*Claims, error) {
+	options = append(options, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(j.secretKey), nil
-	})
+	}, options...)
 
 	if err != nil {
 		return nil, err
@@ -69,3 +115,73 @@ func HashPassword(password string) (string, error) {
 func CheckPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+// DeviceTokenHeader carries the token of a registered device
+const DeviceTokenHeader = "X-Device-Token"
+
+// PINs are short, so they are hashed like passwords and attempts are limited
+const (
+	MinPINLength = 4
+	MaxPINLength = 8
+)
+
+var ErrInvalidPIN = errors.New("PIN must be 4 to 8 digits")
+
+// HashPIN hashes a quick-login PIN after checking it is 4 to 8 digits
+func HashPIN(pin string) (string, error) {
+	if len(pin) < MinPINLength || len(pin) > MaxPINLength {
+		return "", ErrInvalidPIN
+	}
+	for _, r := range pin {
+		if !unicode.IsDigit(r) || r > unicode.MaxASCII {
+			return "", ErrInvalidPIN
+		}
+	}
+	return HashPassword(pin)
+}
+
+// CheckPIN compares a PIN with its hash. An empty hash, for a user without
+// a PIN, never matches.
+func CheckPIN(hashedPIN, pin string) error {
+	if hashedPIN == "" {
+		return bcrypt.ErrMismatchedHashAndPassword
+	}
+	return CheckPassword(hashedPIN, pin)
+}
+
+// NewTokenID returns a random ID for a token or session
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewRefreshToken returns a random refresh token for the client and the
+// hash to store in its place
+func NewRefreshToken() (token, hash string, err error) {
+	return newSecret()
+}
+
+// NewDeviceToken returns a random token identifying a registered device and
+// the hash to store in its place
+func NewDeviceToken() (token, hash string, err error) {
+	return newSecret()
+}
+
+func newSecret() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash a refresh, invitation or device token is stored
+// and looked up by. They are random, so a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
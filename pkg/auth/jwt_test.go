@@ -2,19 +2,27 @@ package auth
 
 import (
 	"testing"
+	"time"
 )
 
 func TestGenerateAndValidateToken(t *testing.T) {
 	secretKey := "test-secret-key"
-	expiryHours := 1
-	jwtService := NewJWTService(secretKey, expiryHours)
+	jwtService := NewJWTService(secretKey, time.Hour, 24*time.Hour)
 	
 	userID := uint(1)
+	tenantID := uint(3)
 	username := "testuser"
 	role := "cashier"
 
 	// Generate token
-	token, err := jwtService.GenerateToken(userID, username, role)
+	token, err := jwtService.GenerateToken(Claims{
+		UserID:       userID,
+		TenantID:     tenantID,
+		Username:     username,
+		Role:         role,
+		SessionID:    "session-1",
+		TokenVersion: 2,
+	})
 	if err != nil {
 		t.Fatalf("Failed to generate token: %v", err)
 	}
@@ -33,6 +41,10 @@ func TestGenerateAndValidateToken(t *testing.T) {
 		t.Errorf("Expected UserID to be %d, got %d", userID, claims.UserID)
 	}
 
+	if claims.TenantID != tenantID {
+		t.Errorf("Expected TenantID to be %d, got %d", tenantID, claims.TenantID)
+	}
+
 	if claims.Username != username {
 		t.Errorf("Expected Username to be %s, got %s", username, claims.Username)
 	}
@@ -40,12 +52,90 @@ func TestGenerateAndValidateToken(t *testing.T) {
 	if claims.Role != role {
 		t.Errorf("Expected Role to be %s, got %s", role, claims.Role)
 	}
+
+	if claims.SessionID != "session-1" || claims.TokenVersion != 2 {
+		t.Errorf("Expected session session-1 version 2, got %s version %d", claims.SessionID, claims.TokenVersion)
+	}
+
+	if claims.ID == "" {
+		t.Error("Expected the token to have an ID")
+	}
+
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != time.Hour {
+		t.Errorf("Expected the token to be valid for an hour, got %v", ttl)
+	}
+}
+
+func TestTokenIDsAreUnique(t *testing.T) {
+	jwtService := NewJWTService("test-secret-key", time.Hour, 24*time.Hour)
+
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		token, err := jwtService.GenerateToken(Claims{UserID: 1})
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		claims, err := jwtService.ValidateToken(token)
+		if err != nil {
+			t.Fatalf("Failed to validate token: %v", err)
+		}
+		if seen[claims.ID] {
+			t.Fatalf("Token ID %s issued twice", claims.ID)
+		}
+		seen[claims.ID] = true
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	jwtService := NewJWTService("test-secret-key", -time.Minute, 24*time.Hour)
+
+	token, err := jwtService.GenerateToken(Claims{UserID: 1, TenantID: 4})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	if _, err := jwtService.ValidateToken(token); err == nil {
+		t.Error("Expected an expired token to be rejected")
+	}
+
+	// The tenant of an expired token is still known, for refreshing it
+	tenantID, err := jwtService.TenantOf(token)
+	if err != nil || tenantID != 4 {
+		t.Errorf("Expected tenant 4, got %d (%v)", tenantID, err)
+	}
+
+	other := NewJWTService("other-secret-key", time.Hour, 24*time.Hour)
+	if _, err := other.TenantOf(token); err == nil {
+		t.Error("Expected a token signed with another key to be rejected")
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	token, hash, err := NewRefreshToken()
+	if err != nil {
+		t.Fatalf("Failed to generate refresh token: %v", err)
+	}
+
+	if len(token) < 40 {
+		t.Errorf("Expected a long random token, got %q", token)
+	}
+
+	if hash == token || hash != HashToken(token) {
+		t.Error("Expected the stored hash to be the hash of the token")
+	}
+
+	other, _, err := NewRefreshToken()
+	if err != nil {
+		t.Fatalf("Failed to generate refresh token: %v", err)
+	}
+	if other == token {
+		t.Error("Expected refresh tokens to be unique")
+	}
 }
 
 func TestValidateInvalidToken(t *testing.T) {
 	secretKey := "test-secret-key"
-	expiryHours := 1
-	jwtService := NewJWTService(secretKey, expiryHours)
+	jwtService := NewJWTService(secretKey, time.Hour, 24*time.Hour)
 	
 	invalidToken := "invalid.token.here"
 
@@ -102,3 +192,50 @@ func TestTokenClaims(t *testing.T) {
 		t.Errorf("Expected Role to be 'admin', got %s", claims.Role)
 	}
 }
+
+func TestHashAndCheckPIN(t *testing.T) {
+	hashedPIN, err := HashPIN("4821")
+	if err != nil {
+		t.Fatalf("Failed to hash PIN: %v", err)
+	}
+
+	if err := CheckPIN(hashedPIN, "4821"); err != nil {
+		t.Error("PIN verification should succeed with correct PIN")
+	}
+
+	if err := CheckPIN(hashedPIN, "4822"); err == nil {
+		t.Error("PIN verification should fail with incorrect PIN")
+	}
+
+	// Users without a PIN cannot log in with one
+	if err := CheckPIN("", ""); err == nil {
+		t.Error("PIN verification should fail without a PIN")
+	}
+
+	for _, pin := range []string{"", "123", "123456789", "12a4", "12 34", "١٢٣٤"} {
+		if _, err := HashPIN(pin); err != ErrInvalidPIN {
+			t.Errorf("Expected ErrInvalidPIN for %q, got %v", pin, err)
+		}
+	}
+}
+
+func TestDeviceTokenClaims(t *testing.T) {
+	jwtService := NewJWTService("test-secret-key", -time.Minute, time.Hour)
+
+	token, err := jwtService.GenerateToken(Claims{UserID: 4, SessionID: "session-1", DeviceID: 9})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	// Expired, but its device can still be read to end the session
+	if _, err := jwtService.ValidateToken(token); err == nil {
+		t.Error("Expected expired token to be rejected")
+	}
+	claims, err := jwtService.ClaimsOf(token)
+	if err != nil {
+		t.Fatalf("Failed to read expired token: %v", err)
+	}
+	if claims.DeviceID != 9 || claims.SessionID != "session-1" {
+		t.Errorf("Expected device 9 session session-1, got device %d session %s", claims.DeviceID, claims.SessionID)
+	}
+}
@@ -0,0 +1,216 @@
+// Package imaging decodes uploaded images and scales them to the sizes shown
+// on the POS and menu screens
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+
+	_ "image/gif" // Registered decoders for Decode
+	_ "image/png"
+)
+
+// MaxPixels bounds the size of a decoded image, so a small file that claims
+// huge dimensions cannot exhaust memory
+const MaxPixels = 40_000_000
+
+// ContentTypes lists the accepted upload types
+var ContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+var (
+	ErrUnsupportedType = errors.New("image must be JPEG, PNG or GIF")
+	ErrTooLarge        = errors.New("image dimensions are too large")
+)
+
+// Mode decides how an image is scaled into a bounding box
+type Mode int
+
+const (
+	// Fit scales the image to fit inside the box, keeping its aspect ratio
+	Fit Mode = iota
+	// Fill scales the image to cover the box and crops the overflow around the center
+	Fill
+)
+
+// ContentType sniffs the type of an image from its first bytes, ignoring
+// whatever the client claimed
+func ContentType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	for _, allowed := range ContentTypes {
+		if contentType == allowed {
+			return contentType, nil
+		}
+	}
+	return "", ErrUnsupportedType
+}
+
+// Decode checks the type and dimensions of an image before decoding it
+func Decode(data []byte) (image.Image, error) {
+	if _, err := ContentType(data); err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("invalid image: empty")
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	return img, nil
+}
+
+// Resize scales an image into a width x height box. Images are only ever made
+// smaller: a box larger than the image leaves it at its own size, cropped to
+// the box's aspect ratio for Fill.
+func Resize(img image.Image, width, height int, mode Mode) *image.RGBA {
+	src := img.Bounds()
+	srcW, srcH := src.Dx(), src.Dy()
+
+	crop := src
+	dstW, dstH := width, height
+	switch mode {
+	case Fill:
+		// Crop the source to the box's aspect ratio, then scale down
+		if srcW*height > srcH*width {
+			cropW := srcH * width / height
+			crop.Min.X += (srcW - cropW) / 2
+			crop.Max.X = crop.Min.X + cropW
+		} else {
+			cropH := srcW * height / width
+			crop.Min.Y += (srcH - cropH) / 2
+			crop.Max.Y = crop.Min.Y + cropH
+		}
+		if crop.Dx() < dstW {
+			dstW, dstH = crop.Dx(), crop.Dy()
+		}
+	default:
+		if srcW <= width && srcH <= height {
+			dstW, dstH = srcW, srcH
+		} else if srcW*height > srcH*width {
+			dstH = srcH * width / srcW
+		} else {
+			dstW = srcW * height / srcH
+		}
+	}
+	dstW, dstH = max(dstW, 1), max(dstH, 1)
+
+	return scale(toRGBA(img, crop), dstW, dstH)
+}
+
+// EncodeJPEG encodes an image as JPEG, flattening any transparency onto white
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toRGBA(img image.Image, r image.Rectangle) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, r.Min, draw.Src)
+	return rgba
+}
+
+// scale resizes with an area-averaging (box) filter in two passes, which keeps
+// downscaled photos smooth without the aliasing of nearest-neighbour sampling
+func scale(src *image.RGBA, width, height int) *image.RGBA {
+	srcW, srcH := src.Rect.Dx(), src.Rect.Dy()
+	if srcW == width && srcH == height {
+		return src
+	}
+
+	// Horizontal pass into a float buffer of width x srcH
+	xWeights := boxWeights(srcW, width)
+	tmp := make([]float64, width*srcH*4)
+	for y := 0; y < srcH; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, weights := range xWeights {
+			var sum [4]float64
+			for _, w := range weights {
+				p := row[w.index*4:]
+				for c := 0; c < 4; c++ {
+					sum[c] += float64(p[c]) * w.weight
+				}
+			}
+			copy(tmp[(y*width+x)*4:], sum[:])
+		}
+	}
+
+	// Vertical pass into the destination
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	yWeights := boxWeights(srcH, height)
+	for y, weights := range yWeights {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for _, w := range weights {
+				p := tmp[(w.index*width+x)*4:]
+				for c := 0; c < 4; c++ {
+					sum[c] += p[c] * w.weight
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			for c := 0; c < 4; c++ {
+				d[c] = clamp(sum[c])
+			}
+		}
+	}
+	return dst
+}
+
+type weight struct {
+	index  int
+	weight float64
+}
+
+// boxWeights maps each destination pixel to the source pixels it covers,
+// weighted by how much of each it covers. When enlarging, each destination
+// pixel takes the single source pixel under its center.
+func boxWeights(srcSize, dstSize int) [][]weight {
+	weights := make([][]weight, dstSize)
+	ratio := float64(srcSize) / float64(dstSize)
+	for i := range weights {
+		if ratio <= 1 {
+			weights[i] = []weight{{index: min(int((float64(i)+0.5)*ratio), srcSize-1), weight: 1}}
+			continue
+		}
+		start, end := float64(i)*ratio, float64(i+1)*ratio
+		for j := int(start); j < srcSize && float64(j) < end; j++ {
+			cover := min(end, float64(j+1)) - max(start, float64(j))
+			if cover > 0 {
+				weights[i] = append(weights[i], weight{index: j, weight: cover / ratio})
+			}
+		}
+	}
+	return weights
+}
+
+func clamp(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
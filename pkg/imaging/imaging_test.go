@@ -0,0 +1,114 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func solid(width, height int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResizeFit(t *testing.T) {
+	img := solid(1600, 900, color.RGBA{200, 100, 50, 255})
+
+	got := Resize(img, 800, 800, Fit).Bounds()
+	if got.Dx() != 800 || got.Dy() != 450 {
+		t.Errorf("Expected 800x450, got %dx%d", got.Dx(), got.Dy())
+	}
+
+	// Smaller images are never enlarged
+	got = Resize(solid(300, 200, color.White), 800, 800, Fit).Bounds()
+	if got.Dx() != 300 || got.Dy() != 200 {
+		t.Errorf("Expected 300x200, got %dx%d", got.Dx(), got.Dy())
+	}
+}
+
+func TestResizeFill(t *testing.T) {
+	// Left half red, right half blue; a square crop keeps the middle
+	img := solid(400, 100, color.RGBA{255, 0, 0, 255})
+	for y := 0; y < 100; y++ {
+		for x := 200; x < 400; x++ {
+			img.Set(x, y, color.RGBA{0, 0, 255, 255})
+		}
+	}
+
+	thumb := Resize(img, 50, 50, Fill)
+	if got := thumb.Bounds(); got.Dx() != 50 || got.Dy() != 50 {
+		t.Fatalf("Expected 50x50, got %dx%d", got.Dx(), got.Dy())
+	}
+	if c := thumb.RGBAAt(5, 25); c.R != 255 || c.B != 0 {
+		t.Errorf("Expected the left edge to be red, got %v", c)
+	}
+	if c := thumb.RGBAAt(45, 25); c.R != 0 || c.B != 255 {
+		t.Errorf("Expected the right edge to be blue, got %v", c)
+	}
+}
+
+func TestResizeAveragesColors(t *testing.T) {
+	// Alternating black and white columns average to grey
+	img := solid(100, 100, color.Black)
+	for y := 0; y < 100; y++ {
+		for x := 1; x < 100; x += 2 {
+			img.Set(x, y, color.White)
+		}
+	}
+
+	c := Resize(img, 10, 10, Fit).RGBAAt(5, 5)
+	if c.R < 120 || c.R > 135 {
+		t.Errorf("Expected grey, got %v", c)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	if _, err := Decode(encodePNG(t, solid(10, 10, color.White))); err != nil {
+		t.Errorf("Expected a PNG to decode, got %v", err)
+	}
+
+	if _, err := Decode([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>")); err != ErrUnsupportedType {
+		t.Errorf("Expected ErrUnsupportedType for SVG, got %v", err)
+	}
+
+	// A PNG header claiming 100000x100000 pixels is rejected before decoding
+	data := encodePNG(t, solid(1, 1, color.White))
+	huge := append([]byte{}, data...)
+	copy(huge[16:24], []byte{0, 1, 0x86, 0xa0, 0, 1, 0x86, 0xa0})
+	binary.BigEndian.PutUint32(huge[29:33], crc32.ChecksumIEEE(huge[12:29]))
+	if _, err := Decode(huge); err != ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestEncodeJPEGFlattensTransparency(t *testing.T) {
+	data, err := EncodeJPEG(solid(8, 8, color.Transparent), 85)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := img.At(4, 4).RGBA(); r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("Expected white, got %v", img.At(4, 4))
+	}
+}
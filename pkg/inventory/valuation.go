@@ -0,0 +1,96 @@
+package inventory
+
+// Movement is a stock change used for valuation. Quantity is signed: positive
+// for stock received, negative for stock leaving. UnitCost is only used for
+// inbound movements.
+type Movement struct {
+	Quantity float64
+	UnitCost float64
+}
+
+// Valuation is the quantity and value of stock on hand
+type Valuation struct {
+	Quantity float64 `json:"quantity"`
+	Value    float64 `json:"value"`
+	UnitCost float64 `json:"unit_cost"`
+}
+
+type lot struct {
+	quantity float64
+	unitCost float64
+}
+
+// FIFO values stock assuming the oldest units leave first. Movements must be in
+// chronological order.
+func FIFO(movements []Movement) Valuation {
+	var lots []lot
+	var shortfall float64 // Units that left before any stock was received
+
+	for _, m := range movements {
+		if m.Quantity > 0 {
+			quantity := m.Quantity
+			if shortfall > 0 {
+				settled := min(shortfall, quantity)
+				shortfall -= settled
+				quantity -= settled
+			}
+			if quantity > 0 {
+				lots = append(lots, lot{quantity: quantity, unitCost: m.UnitCost})
+			}
+			continue
+		}
+
+		out := -m.Quantity
+		for out > 0 && len(lots) > 0 {
+			taken := min(out, lots[0].quantity)
+			lots[0].quantity -= taken
+			out -= taken
+			if lots[0].quantity <= 0 {
+				lots = lots[1:]
+			}
+		}
+		shortfall += out
+	}
+
+	var v Valuation
+	for _, l := range lots {
+		v.Quantity += l.quantity
+		v.Value += l.quantity * l.unitCost
+	}
+	v.Quantity -= shortfall
+	if v.Quantity > 0 {
+		v.UnitCost = v.Value / v.Quantity
+	}
+	return v
+}
+
+// WeightedAverage values stock at a moving weighted average cost, recalculated
+// on every receipt. Movements must be in chronological order.
+func WeightedAverage(movements []Movement) Valuation {
+	var v Valuation
+
+	for _, m := range movements {
+		if m.Quantity > 0 {
+			v.UnitCost = MovingAverageCost(v.Quantity, v.UnitCost, m.Quantity, m.UnitCost)
+		}
+		v.Quantity += m.Quantity
+	}
+
+	if v.Quantity > 0 {
+		v.Value = v.Quantity * v.UnitCost
+	}
+	return v
+}
+
+// MovingAverageCost returns the unit cost after receiving quantity units at
+// unitCost into onHand units costed at currentCost. Negative stock on hand is
+// treated as empty.
+func MovingAverageCost(onHand, currentCost, quantity, unitCost float64) float64 {
+	if onHand < 0 {
+		onHand = 0
+	}
+	if onHand+quantity <= 0 {
+		return currentCost
+	}
+	return (onHand*currentCost + quantity*unitCost) / (onHand + quantity)
+}
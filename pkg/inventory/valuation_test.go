@@ -0,0 +1,75 @@
+package inventory
+
+import (
+	"testing"
+)
+
+func TestFIFO(t *testing.T) {
+	movements := []Movement{
+		{Quantity: 1000, UnitCost: 200}, // 1kg beans at 200/g
+		{Quantity: 1000, UnitCost: 250}, // 1kg beans at 250/g
+		{Quantity: -1500},               // Sold 1.5kg
+	}
+
+	v := FIFO(movements)
+
+	if v.Quantity != 500 {
+		t.Errorf("Expected quantity to be 500, got %f", v.Quantity)
+	}
+
+	// Remaining 500g come from the newest lot
+	if v.Value != 125000 {
+		t.Errorf("Expected value to be 125000, got %f", v.Value)
+	}
+}
+
+func TestFIFOIssueBeforeReceipt(t *testing.T) {
+	movements := []Movement{
+		{Quantity: -100},
+		{Quantity: 300, UnitCost: 10},
+	}
+
+	v := FIFO(movements)
+
+	if v.Quantity != 200 {
+		t.Errorf("Expected quantity to be 200, got %f", v.Quantity)
+	}
+
+	if v.Value != 2000 {
+		t.Errorf("Expected value to be 2000, got %f", v.Value)
+	}
+}
+
+func TestWeightedAverage(t *testing.T) {
+	movements := []Movement{
+		{Quantity: 1000, UnitCost: 200},
+		{Quantity: -500},
+		{Quantity: 500, UnitCost: 300},
+	}
+
+	v := WeightedAverage(movements)
+
+	if v.Quantity != 1000 {
+		t.Errorf("Expected quantity to be 1000, got %f", v.Quantity)
+	}
+
+	// (500 * 200 + 500 * 300) / 1000
+	if v.UnitCost != 250 {
+		t.Errorf("Expected unit cost to be 250, got %f", v.UnitCost)
+	}
+
+	if v.Value != 250000 {
+		t.Errorf("Expected value to be 250000, got %f", v.Value)
+	}
+}
+
+func TestMovingAverageCost(t *testing.T) {
+	if cost := MovingAverageCost(100, 10, 300, 20); cost != 17.5 {
+		t.Errorf("Expected unit cost to be 17.5, got %f", cost)
+	}
+
+	// Negative stock on hand does not drag the new cost down
+	if cost := MovingAverageCost(-50, 10, 200, 20); cost != 20 {
+		t.Errorf("Expected unit cost to be 20, got %f", cost)
+	}
+}
@@ -0,0 +1,106 @@
+// Package loyalty calculates the points customers earn and spend in the
+// loyalty programme.
+package loyalty
+
+import (
+	"math"
+	"time"
+)
+
+// Earn rule types
+const (
+	RuleSpend = "spend" // Points for every SpendAmount spent
+	RuleItem  = "item"  // Points for every unit of a menu item bought, like a stamp card
+)
+
+// Program holds the programme settings
+type Program struct {
+	PointValue   float64 // Currency a point is worth when redeemed
+	ExpiryMonths int     // Months before earned points expire, unless the tier sets its own; 0 never expires
+}
+
+// Rule is an earn rule
+type Rule struct {
+	Type        string
+	SpendAmount float64 // For spend rules
+	MenuItemID  uint    // For item rules
+	Points      int
+}
+
+// Line is a line of a paid order
+type Line struct {
+	MenuItemID uint
+	Quantity   int
+}
+
+// Earn returns the points earned by an order: spend rules count every full
+// SpendAmount of spend, item rules every unit bought, and the sum is
+// multiplied by the customer's tier multiplier and rounded down.
+func Earn(spend float64, lines []Line, rules []Rule, multiplier float64) int {
+	base := 0
+	for _, rule := range rules {
+		switch rule.Type {
+		case RuleSpend:
+			if rule.SpendAmount > 0 && spend > 0 {
+				base += int(math.Floor(spend/rule.SpendAmount)) * rule.Points
+			}
+		case RuleItem:
+			for _, line := range lines {
+				if line.MenuItemID == rule.MenuItemID {
+					base += line.Quantity * rule.Points
+				}
+			}
+		}
+	}
+
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	return int(math.Floor(float64(base)*multiplier + 1e-9))
+}
+
+// PointsFor returns the points needed to pay amount, rounded up
+func (p Program) PointsFor(amount float64) int {
+	if p.PointValue <= 0 || amount <= 0 {
+		return 0
+	}
+	return int(math.Ceil(amount/p.PointValue - 1e-9))
+}
+
+// Value returns what points are worth
+func (p Program) Value(points int) float64 {
+	return float64(points) * p.PointValue
+}
+
+// ExpiresAt returns when points earned at now expire, using the tier's
+// expiry months when it sets them. It returns nil if they never expire.
+func (p Program) ExpiresAt(now time.Time, tierMonths *int) *time.Time {
+	months := p.ExpiryMonths
+	if tierMonths != nil {
+		months = *tierMonths
+	}
+	if months <= 0 {
+		return nil
+	}
+	expiresAt := now.AddDate(0, months, 0)
+	return &expiresAt
+}
+
+// Allocate takes points from lots of unspent points, in order, and returns
+// how many points were taken from each lot and how many could not be
+// covered. Lots should be ordered soonest to expire first.
+func Allocate(lots []int, points int) (taken []int, shortfall int) {
+	taken = make([]int, len(lots))
+	for i, remaining := range lots {
+		if points <= 0 {
+			break
+		}
+		if remaining <= 0 {
+			continue
+		}
+		take := min(remaining, points)
+		taken[i] = take
+		points -= take
+	}
+	return taken, points
+}
@@ -0,0 +1,72 @@
+package loyalty
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEarn(t *testing.T) {
+	rules := []Rule{
+		{Type: RuleSpend, SpendAmount: 10000, Points: 1}, // 1 point per 10,000 spent
+		{Type: RuleItem, MenuItemID: 3, Points: 2},       // 2 bonus points per latte
+	}
+	lines := []Line{{MenuItemID: 3, Quantity: 2}, {MenuItemID: 5, Quantity: 1}}
+
+	if points := Earn(57000, lines, rules, 1); points != 9 {
+		t.Errorf("Expected 5 + 4 = 9 points, got %d", points)
+	}
+
+	// Gold members earn half as much again, rounded down
+	if points := Earn(57000, lines, rules, 1.5); points != 13 {
+		t.Errorf("Expected 13 points, got %d", points)
+	}
+
+	if points := Earn(9999, nil, rules, 0); points != 0 {
+		t.Errorf("Expected no points below the spend amount, got %d", points)
+	}
+}
+
+func TestProgramPoints(t *testing.T) {
+	program := Program{PointValue: 100}
+
+	if points := program.PointsFor(2550); points != 26 {
+		t.Errorf("Expected 26 points, got %d", points)
+	}
+	if points := program.PointsFor(2500); points != 25 {
+		t.Errorf("Expected 25 points, got %d", points)
+	}
+	if value := program.Value(25); value != 2500 {
+		t.Errorf("Expected 2500, got %f", value)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	taken, shortfall := Allocate([]int{30, 0, 50}, 60)
+	if shortfall != 0 || taken[0] != 30 || taken[1] != 0 || taken[2] != 30 {
+		t.Errorf("Unexpected allocation %v, shortfall %d", taken, shortfall)
+	}
+
+	taken, shortfall = Allocate([]int{10}, 25)
+	if shortfall != 15 || taken[0] != 10 {
+		t.Errorf("Expected shortfall 15, got %v, %d", taken, shortfall)
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	program := Program{ExpiryMonths: 12}
+	now := time.Date(2026, 1, 31, 10, 0, 0, 0, time.UTC)
+
+	if expiresAt := program.ExpiresAt(now, nil); expiresAt == nil || !expiresAt.Equal(time.Date(2027, 1, 31, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected expiry a year later, got %v", expiresAt)
+	}
+
+	never := 0
+	if expiresAt := program.ExpiresAt(now, &never); expiresAt != nil {
+		t.Errorf("Expected tier points never to expire, got %v", expiresAt)
+	}
+
+	six := 6
+	if expiresAt := program.ExpiresAt(now, &six); expiresAt == nil || expiresAt.Month() != time.July {
+		t.Errorf("Expected the tier's 6 months, got %v", expiresAt)
+	}
+}
@@ -0,0 +1,81 @@
+// Package receivables ages the amounts customers owe on house accounts.
+package receivables
+
+import "time"
+
+// Entry is a change to what a customer owes: positive for charges, negative
+// for payments and other credits
+type Entry struct {
+	Date   time.Time
+	Amount float64
+}
+
+// Aging splits what is owed by how long ago it was charged
+type Aging struct {
+	Current    float64 `json:"current"`      // 0-30 days
+	Days31To60 float64 `json:"days_31_60"`   // 31-60 days
+	Days61To90 float64 `json:"days_61_90"`   // 61-90 days
+	Over90     float64 `json:"days_over_90"` // More than 90 days
+	Credit     float64 `json:"credit"`       // Paid in advance, not yet used by a charge
+	Total      float64 `json:"total"`        // Owed in all, less credit
+}
+
+// Add adds another aging to a, e.g. to total a report
+func (a *Aging) Add(other Aging) {
+	a.Current += other.Current
+	a.Days31To60 += other.Days31To60
+	a.Days61To90 += other.Days61To90
+	a.Over90 += other.Over90
+	a.Credit += other.Credit
+	a.Total += other.Total
+}
+
+// Age returns the aging of entries as of asOf. Credits pay off the oldest
+// charges first. Entries must be in date order; entries after asOf are
+// ignored.
+func Age(entries []Entry, asOf time.Time) Aging {
+	type open struct {
+		date   time.Time
+		amount float64
+	}
+	var charges []open
+	credit := 0.0
+
+	for _, entry := range entries {
+		if entry.Date.After(asOf) {
+			break
+		}
+		if entry.Amount > 0 {
+			charges = append(charges, open{entry.Date, entry.Amount})
+		} else {
+			credit -= entry.Amount
+		}
+
+		// Pay off the oldest charges with whatever credit there is
+		for len(charges) > 0 && credit > 0 {
+			take := min(charges[0].amount, credit)
+			charges[0].amount -= take
+			credit -= take
+			if charges[0].amount <= 0.005 {
+				charges = charges[1:]
+			}
+		}
+	}
+
+	var aging Aging
+	for _, charge := range charges {
+		switch days := int(asOf.Sub(charge.date).Hours() / 24); {
+		case days <= 30:
+			aging.Current += charge.amount
+		case days <= 60:
+			aging.Days31To60 += charge.amount
+		case days <= 90:
+			aging.Days61To90 += charge.amount
+		default:
+			aging.Over90 += charge.amount
+		}
+	}
+	aging.Credit = credit
+	aging.Total = aging.Current + aging.Days31To60 + aging.Days61To90 + aging.Over90 - credit
+	return aging
+}
@@ -0,0 +1,57 @@
+package receivables
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAge(t *testing.T) {
+	asOf := time.Date(2026, 6, 30, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return asOf.AddDate(0, 0, -days) }
+
+	entries := []Entry{
+		{daysAgo(120), 100000}, // Paid off by the first payment
+		{daysAgo(75), 200000},  // Half paid
+		{daysAgo(50), 150000},
+		{daysAgo(45), -200000},
+		{daysAgo(10), 80000},
+		{daysAgo(2), 50000},
+	}
+
+	aging := Age(entries, asOf)
+	expected := Aging{Current: 130000, Days31To60: 150000, Days61To90: 100000, Total: 380000}
+	if aging != expected {
+		t.Errorf("Expected %+v, got %+v", expected, aging)
+	}
+}
+
+func TestAgeCredit(t *testing.T) {
+	asOf := time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	// A payment before any charge is credit until a charge uses it
+	aging := Age([]Entry{
+		{asOf.AddDate(0, 0, -20), -50000},
+		{asOf.AddDate(0, 0, -5), 30000},
+	}, asOf)
+	if aging.Current != 0 || math.Abs(aging.Credit-20000) > 0.001 || math.Abs(aging.Total+20000) > 0.001 {
+		t.Errorf("Expected 20000 credit, got %+v", aging)
+	}
+
+	// Entries after asOf are left out
+	aging = Age([]Entry{
+		{asOf.AddDate(0, 0, -40), 30000},
+		{asOf.AddDate(0, 0, 1), -30000},
+	}, asOf)
+	if aging.Days31To60 != 30000 || aging.Total != 30000 {
+		t.Errorf("Expected 30000 owed for 31-60 days, got %+v", aging)
+	}
+}
+
+func TestAgingAdd(t *testing.T) {
+	total := Aging{Current: 10, Total: 10}
+	total.Add(Aging{Over90: 5, Credit: 2, Total: 3})
+	if total.Current != 10 || total.Over90 != 5 || total.Credit != 2 || total.Total != 13 {
+		t.Errorf("Unexpected total %+v", total)
+	}
+}
@@ -0,0 +1,139 @@
+// Package schedule decides whether something is available at a given time
+// from a set of weekly time windows.
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	timeLayout = "15:04"
+	dateLayout = "2006-01-02"
+	endOfDay   = 24 * 60
+)
+
+// Window is a recurring period of availability. Times are wall-clock times in
+// the outlet's timezone.
+type Window struct {
+	Days      []time.Weekday // Days the window starts on; empty means every day
+	StartTime string         // "HH:MM"; empty means start of day
+	EndTime   string         // "HH:MM", exclusive; empty means end of day. Earlier than StartTime runs past midnight
+	StartDate string         // "YYYY-MM-DD", inclusive; optional
+	EndDate   string         // "YYYY-MM-DD", inclusive; optional
+}
+
+// Validate checks the window's fields
+func (w Window) Validate() error {
+	for _, day := range w.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("invalid day %d, expected 0 (Sunday) to 6 (Saturday)", day)
+		}
+	}
+
+	start, err := parseClock(w.StartTime, 0)
+	if err != nil {
+		return fmt.Errorf("invalid start time %q, expected HH:MM", w.StartTime)
+	}
+	end, err := parseClock(w.EndTime, endOfDay)
+	if err != nil {
+		return fmt.Errorf("invalid end time %q, expected HH:MM", w.EndTime)
+	}
+	if start == end {
+		return fmt.Errorf("start and end time must differ")
+	}
+
+	if w.StartDate != "" {
+		if _, err := time.Parse(dateLayout, w.StartDate); err != nil {
+			return fmt.Errorf("invalid start date %q, expected YYYY-MM-DD", w.StartDate)
+		}
+	}
+	if w.EndDate != "" {
+		if _, err := time.Parse(dateLayout, w.EndDate); err != nil {
+			return fmt.Errorf("invalid end date %q, expected YYYY-MM-DD", w.EndDate)
+		}
+	}
+	if w.StartDate != "" && w.EndDate != "" && w.EndDate < w.StartDate {
+		return fmt.Errorf("end date is before start date")
+	}
+
+	return nil
+}
+
+// Contains reports whether t falls inside the window. t must already be in
+// the outlet's timezone. Invalid windows contain nothing.
+func (w Window) Contains(t time.Time) bool {
+	start, err := parseClock(w.StartTime, 0)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.EndTime, endOfDay)
+	if err != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	if start < end {
+		return minute >= start && minute < end && w.activeOn(t)
+	}
+
+	// Overnight window: the part after midnight belongs to the previous day
+	if minute >= start {
+		return w.activeOn(t)
+	}
+	if minute < end {
+		return w.activeOn(t.AddDate(0, 0, -1))
+	}
+	return false
+}
+
+// activeOn reports whether the window starts on the given day
+func (w Window) activeOn(day time.Time) bool {
+	date := day.Format(dateLayout)
+	if w.StartDate != "" && date < w.StartDate {
+		return false
+	}
+	if w.EndDate != "" && date > w.EndDate {
+		return false
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, weekday := range w.Days {
+		if weekday == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether t falls inside any of the windows. Without windows
+// there is no restriction.
+func Open(windows []Window, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock returns the minutes since midnight of an "HH:MM" time, or
+// fallback when it is empty. "24:00" is accepted as the end of the day.
+func parseClock(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if value == "24:00" {
+		return endOfDay, nil
+	}
+	t, err := time.Parse(timeLayout, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,104 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func at(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestBreakfastWindow(t *testing.T) {
+	breakfast := Window{StartTime: "06:00", EndTime: "11:00"}
+
+	if !breakfast.Contains(at("2024-01-01 10:59")) {
+		t.Error("Expected 10:59 to be inside breakfast")
+	}
+
+	// End time is exclusive
+	if breakfast.Contains(at("2024-01-01 11:00")) {
+		t.Error("Expected 11:00 to be outside breakfast")
+	}
+}
+
+func TestWeekendWindow(t *testing.T) {
+	weekend := Window{Days: []time.Weekday{time.Saturday, time.Sunday}}
+
+	// 2024-01-06 is a Saturday
+	if !weekend.Contains(at("2024-01-06 15:00")) {
+		t.Error("Expected Saturday to be inside the weekend window")
+	}
+
+	if weekend.Contains(at("2024-01-08 15:00")) {
+		t.Error("Expected Monday to be outside the weekend window")
+	}
+}
+
+func TestOvernightWindow(t *testing.T) {
+	// Friday late night menu, 22:00 to 02:00
+	lateNight := Window{Days: []time.Weekday{time.Friday}, StartTime: "22:00", EndTime: "02:00"}
+
+	if !lateNight.Contains(at("2024-01-05 23:30")) {
+		t.Error("Expected Friday 23:30 to be inside the window")
+	}
+
+	// Saturday 01:00 is still Friday night
+	if !lateNight.Contains(at("2024-01-06 01:00")) {
+		t.Error("Expected Saturday 01:00 to be inside the window")
+	}
+
+	if lateNight.Contains(at("2024-01-06 23:30")) {
+		t.Error("Expected Saturday 23:30 to be outside the window")
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	ramadan := Window{StartDate: "2024-03-11", EndDate: "2024-04-09", StartTime: "17:00", EndTime: "19:00"}
+
+	if !ramadan.Contains(at("2024-04-09 18:00")) {
+		t.Error("Expected the end date to be inclusive")
+	}
+
+	if ramadan.Contains(at("2024-04-10 18:00")) {
+		t.Error("Expected the day after the end date to be outside the window")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	now := at("2024-01-01 12:00")
+
+	if !Open(nil, now) {
+		t.Error("Expected no windows to mean always open")
+	}
+
+	windows := []Window{
+		{StartTime: "06:00", EndTime: "11:00"},
+		{StartTime: "17:00", EndTime: "21:00"},
+	}
+	if Open(windows, now) {
+		t.Error("Expected 12:00 to be outside both windows")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []Window{
+		{StartTime: "25:00"},
+		{StartTime: "10:00", EndTime: "10:00"},
+		{Days: []time.Weekday{7}},
+		{StartDate: "2024-02-01", EndDate: "2024-01-01"},
+	}
+	for _, w := range invalid {
+		if err := w.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", w)
+		}
+	}
+
+	if err := (Window{StartTime: "22:00", EndTime: "02:00"}).Validate(); err != nil {
+		t.Errorf("Expected overnight window to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Package storage keeps uploaded files, such as menu images, on the local
+// filesystem or in an S3-compatible bucket
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: object not found")
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// Object describes a stored file
+type Object struct {
+	ContentType string
+	Size        int64
+	ETag        string
+	ModTime     time.Time
+}
+
+// Storage stores files under slash-separated keys such as
+// "menu-items/12/3f9a-thumb.jpg"
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns ErrNotFound for keys that were never stored or were deleted
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Delete succeeds for keys that do not exist
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures a storage driver
+type Config struct {
+	Driver string // local, s3
+	Dir    string // Root directory for the local driver
+	S3     S3Config
+}
+
+// New creates the storage selected by the config
+func New(config Config) (Storage, error) {
+	switch config.Driver {
+	case "", "local":
+		return NewLocal(config.Dir)
+	case "s3":
+		return NewS3(config.S3)
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", config.Driver)
+	}
+}
+
+// ValidKey reports whether a key is safe to use as both a file path and an
+// object name: lowercase letters, digits, dots, dashes and underscores in
+// slash-separated segments, none of them "." or ".."
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 512 {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, r := range segment {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
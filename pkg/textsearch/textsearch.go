@@ -0,0 +1,108 @@
+// Package textsearch prepares search queries for PostgreSQL full-text search
+// and highlights matching words, including misspelt ones, in results.
+package textsearch
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// FuzzyThreshold is the trigram similarity from which a word is treated as a
+// misspelling of a search term when highlighting
+const FuzzyThreshold = 0.4
+
+// Terms splits a search query into lowercase words of letters and digits
+func Terms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), isSeparator)
+}
+
+// PrefixQuery builds a to_tsquery expression that matches documents
+// containing every term, each as a word prefix, so "iced lat" finds
+// "Iced Latte". Terms must come from Terms.
+func PrefixQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// Similarity returns the trigram similarity of two words between 0 and 1,
+// computed like PostgreSQL's pg_trgm similarity()
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for trigram := range ta {
+		if tb[trigram] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// Highlight HTML-escapes text and wraps the words that match a term in
+// <mark> tags. A word matches when a term is a prefix of it or, for terms of
+// three or more characters, when it is similar enough to be a misspelling.
+// matched reports whether any word was marked.
+func Highlight(text string, terms []string) (highlighted string, matched bool) {
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if isSeparator(runes[i]) {
+			start := i
+			for i < len(runes) && isSeparator(runes[i]) {
+				i++
+			}
+			b.WriteString(html.EscapeString(string(runes[start:i])))
+			continue
+		}
+
+		start := i
+		for i < len(runes) && !isSeparator(runes[i]) {
+			i++
+		}
+		word := string(runes[start:i])
+		if wordMatches(strings.ToLower(word), terms) {
+			matched = true
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+	}
+	return b.String(), matched
+}
+
+func wordMatches(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+		if len([]rune(term)) >= 3 && Similarity(word, term) >= FuzzyThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// trigrams returns the set of trigrams of a word padded as pg_trgm does, with
+// two spaces in front and one behind
+func trigrams(word string) map[string]bool {
+	word = strings.ToLower(word)
+	if word == "" {
+		return nil
+	}
+	padded := []rune("  " + word + " ")
+	set := make(map[string]bool, len(padded))
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = true
+	}
+	return set
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,60 @@
+package textsearch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	terms := Terms("  Iced CAPPUCCINO, oat-milk!")
+	expected := []string{"iced", "cappuccino", "oat", "milk"}
+	if len(terms) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, terms)
+	}
+	for i := range expected {
+		if terms[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, terms)
+		}
+	}
+
+	if len(Terms("'&|!:*")) != 0 {
+		t.Error("Expected punctuation to give no terms")
+	}
+}
+
+func TestPrefixQuery(t *testing.T) {
+	if query := PrefixQuery([]string{"iced", "lat"}); query != "iced:* & lat:*" {
+		t.Errorf("Expected iced:* & lat:*, got %s", query)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	// Matches pg_trgm: SELECT similarity('capucino', 'cappuccino') = 0.5384615
+	if s := Similarity("capucino", "cappuccino"); math.Abs(s-7.0/13.0) > 1e-9 {
+		t.Errorf("Expected 7/13, got %v", s)
+	}
+	if s := Similarity("latte", "LATTE"); s != 1 {
+		t.Errorf("Expected identical words to have similarity 1, got %v", s)
+	}
+	if s := Similarity("latte", ""); s != 0 {
+		t.Errorf("Expected 0 for an empty word, got %v", s)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	text, matched := Highlight("Iced Cappuccino & Croissant", Terms("capucino"))
+	if !matched || text != "Iced <mark>Cappuccino</mark> &amp; Croissant" {
+		t.Errorf("Unexpected highlight: %q", text)
+	}
+
+	text, matched = Highlight("Iced Latte", Terms("lat"))
+	if !matched || text != "Iced <mark>Latte</mark>" {
+		t.Errorf("Expected prefix match, got %q", text)
+	}
+
+	// Short terms only match as prefixes
+	text, matched = Highlight("Tea <b>", Terms("ta"))
+	if matched || text != "Tea &lt;b&gt;" {
+		t.Errorf("Expected no match and escaped text, got %q", text)
+	}
+}
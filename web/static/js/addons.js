@@ -2,6 +2,7 @@
 
 let addOns = [];
 let menuItems = [];
+let categories = [];
 let isEditingAddOn = false;
 
 // Initialize page
@@ -12,6 +13,7 @@ document.addEventListener('DOMContentLoaded', async function() {
     }
     
     await loadMenuItems();
+    await loadCategories();
     await loadAddOns();
 });
 
@@ -28,6 +30,55 @@ async function loadMenuItems() {
     }
 }
 
+// Load categories for the dropdown
+async function loadCategories() {
+    try {
+        const response = await apiCall('/menu/categories');
+        categories = Array.isArray(response) ? response : (response.data || []);
+        populateCategoryDropdown();
+    } catch (error) {
+        console.error('Failed to load categories:', error);
+        showError('Failed to load categories: ' + error.message);
+    }
+}
+
+// Populate category dropdown in form
+function populateCategoryDropdown() {
+    const select = document.getElementById('addOnCategoryIds');
+    select.innerHTML = '';
+    
+    categories.forEach(category => {
+        const option = document.createElement('option');
+        option.value = category.id;
+        option.textContent = category.name;
+        select.appendChild(option);
+    });
+}
+
+// An add-on without menu item or category links applies to every menu item
+function isGlobalAddOn(addOn) {
+    return !(addOn.menu_items && addOn.menu_items.length) && !(addOn.categories && addOn.categories.length);
+}
+
+function addOnLinksLabel(addOn) {
+    if (isGlobalAddOn(addOn)) {
+        return 'Global';
+    }
+    const names = (addOn.menu_items || []).map(item => item.name)
+        .concat((addOn.categories || []).map(category => category.name + ' (category)'));
+    return names.join(', ');
+}
+
+function selectedValues(select) {
+    return Array.from(select.selectedOptions).map(option => parseInt(option.value));
+}
+
+function setSelectedValues(select, values) {
+    Array.from(select.options).forEach(option => {
+        option.selected = values.includes(parseInt(option.value));
+    });
+}
+
 // Populate menu item filter
 function populateMenuItemFilter() {
     const select = document.getElementById('menuItemFilter');
@@ -44,9 +95,8 @@ function populateMenuItemFilter() {
 
 // Populate menu item dropdown in form
 function populateMenuItemDropdown() {
-    const select = document.getElementById('addOnMenuItemId');
-    const currentOptions = Array.from(select.options).slice(1); // Keep first option
-    currentOptions.forEach(option => option.remove());
+    const select = document.getElementById('addOnMenuItemIds');
+    select.innerHTML = '';
     
     menuItems.forEach(item => {
         const option = document.createElement('option');
@@ -79,16 +129,14 @@ function displayAddOns() {
     
     tbody.innerHTML = addOns.map(addOn => {
         const margin = addOn.price > 0 ? ((addOn.price - addOn.cogs) / addOn.price * 100).toFixed(1) : 0;
-        const menuItemName = addOn.menu_item_id ? 
-            (menuItems.find(item => item.id === addOn.menu_item_id)?.name || 'Unknown') : 
-            'Global';
+        const menuItemName = addOnLinksLabel(addOn);
         return `
             <tr>
                 <td>${addOn.id}</td>
                 <td>${addOn.name}</td>
                 <td>${addOn.description || '-'}</td>
                 <td>
-                    <span class="menu-item-tag ${addOn.menu_item_id ? 'specific' : 'global'}">
+                    <span class="menu-item-tag ${isGlobalAddOn(addOn) ? 'global' : 'specific'}">
                         ${menuItemName}
                     </span>
                 </td>
@@ -127,9 +175,12 @@ function filterAddOns() {
     
     if (menuItemFilter !== '') {
         if (menuItemFilter === 'global') {
-            filteredAddOns = filteredAddOns.filter(addOn => !addOn.menu_item_id);
+            filteredAddOns = filteredAddOns.filter(addOn => isGlobalAddOn(addOn));
         } else {
-            filteredAddOns = filteredAddOns.filter(addOn => addOn.menu_item_id === parseInt(menuItemFilter));
+            const menuItem = menuItems.find(item => item.id === parseInt(menuItemFilter));
+            filteredAddOns = filteredAddOns.filter(addOn => isGlobalAddOn(addOn) ||
+                (addOn.menu_items || []).some(item => item.id === parseInt(menuItemFilter)) ||
+                (menuItem && (addOn.categories || []).some(category => category.id === menuItem.category_id)));
         }
     }
     
@@ -142,16 +193,14 @@ function filterAddOns() {
     
     tbody.innerHTML = filteredAddOns.map(addOn => {
         const margin = addOn.price > 0 ? ((addOn.price - addOn.cogs) / addOn.price * 100).toFixed(1) : 0;
-        const menuItemName = addOn.menu_item_id ? 
-            (menuItems.find(item => item.id === addOn.menu_item_id)?.name || 'Unknown') : 
-            'Global';
+        const menuItemName = addOnLinksLabel(addOn);
         return `
             <tr>
                 <td>${addOn.id}</td>
                 <td>${addOn.name}</td>
                 <td>${addOn.description || '-'}</td>
                 <td>
-                    <span class="menu-item-tag ${addOn.menu_item_id ? 'specific' : 'global'}">
+                    <span class="menu-item-tag ${isGlobalAddOn(addOn) ? 'global' : 'specific'}">
                         ${menuItemName}
                     </span>
                 </td>
@@ -195,7 +244,8 @@ function editAddOn(addOnId) {
     document.getElementById('addOnId').value = addOn.id;
     document.getElementById('addOnName').value = addOn.name;
     document.getElementById('addOnDescription').value = addOn.description || '';
-    document.getElementById('addOnMenuItemId').value = addOn.menu_item_id || '';
+    setSelectedValues(document.getElementById('addOnMenuItemIds'), (addOn.menu_items || []).map(item => item.id));
+    setSelectedValues(document.getElementById('addOnCategoryIds'), (addOn.categories || []).map(category => category.id));
     document.getElementById('addOnPrice').value = addOn.price;
     document.getElementById('addOnCOGS').value = addOn.cogs;
     document.getElementById('addOnAvailable').checked = addOn.is_available;
@@ -210,20 +260,17 @@ function closeAddOnModal() {
 document.getElementById('addOnForm').addEventListener('submit', async function(e) {
     e.preventDefault();
     
-    const menuItemId = document.getElementById('addOnMenuItemId').value;
     const addOnData = {
         name: document.getElementById('addOnName').value,
         description: document.getElementById('addOnDescription').value,
         price: parseFloat(document.getElementById('addOnPrice').value),
         cogs: parseFloat(document.getElementById('addOnCOGS').value),
-        is_available: document.getElementById('addOnAvailable').checked
+        is_available: document.getElementById('addOnAvailable').checked,
+        // Leave both empty for a global add-on
+        menu_item_ids: selectedValues(document.getElementById('addOnMenuItemIds')),
+        category_ids: selectedValues(document.getElementById('addOnCategoryIds'))
     };
     
-    // Only include menu_item_id if a menu item is selected
-    if (menuItemId) {
-        addOnData.menu_item_id = parseInt(menuItemId);
-    }
-    
     try {
         if (isEditingAddOn) {
             const addOnId = document.getElementById('addOnId').value;
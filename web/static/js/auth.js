@@ -12,18 +12,59 @@ function setToken(token) {
 
 function removeToken() {
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
+}
+
+function getRefreshToken() {
+    return localStorage.getItem('refresh_token');
+}
+
+function setTokens(response) {
+    setToken(response.token);
+    localStorage.setItem('refresh_token', response.refresh_token);
+}
+
+// Trade the refresh token for a new access token; false if the session is over
+async function refreshToken() {
+    const token = getRefreshToken();
+    if (!token) {
+        return false;
+    }
+
+    const response = await fetch(`${API_BASE}/auth/refresh`, {
+        method: 'POST',
+        headers: getHeaders(),
+        body: JSON.stringify({ refresh_token: token })
+    });
+    if (!response.ok) {
+        return false;
+    }
+
+    setTokens(await response.json());
+    return true;
+}
+
+// Token of this browser when it is registered as a shared device
+function getDeviceToken() {
+    return localStorage.getItem('device_token');
+}
+
+function setDeviceToken(token) {
+    localStorage.setItem('device_token', token);
 }
 
 function getHeaders() {
     const token = getToken();
+    const deviceToken = getDeviceToken();
     return {
         'Content-Type': 'application/json',
-        ...(token && { 'Authorization': `Bearer ${token}` })
+        ...(token && { 'Authorization': `Bearer ${token}` }),
+        ...(deviceToken && { 'X-Device-Token': deviceToken })
     };
 }
 
 // API wrapper
-async function apiCall(url, options = {}) {
+async function apiCall(url, options = {}, retried = false) {
     console.log('apiCall called with URL:', url, 'Options:', options);
     const response = await fetch(`${API_BASE}${url}`, {
         ...options,
@@ -37,7 +78,12 @@ async function apiCall(url, options = {}) {
     console.log('Response headers:', response.headers);
 
     if (!response.ok) {
-        if (response.status === 401) {
+        // Access tokens are short-lived; renew once and try again
+        if (response.status === 401 && !retried && url !== '/auth/login' && url !== '/auth/switch-user' && await refreshToken()) {
+            return apiCall(url, options, true);
+        }
+
+        if (response.status === 401 && url !== '/auth/switch-user') {
             console.log('Unauthorized, removing token and redirecting');
             removeToken();
             window.location.href = '/admin/';
@@ -62,7 +108,7 @@ async function login(username, password) {
             body: JSON.stringify({ username, password })
         });
 
-        setToken(response.token);
+        setTokens(response);
         return response;
     } catch (error) {
         throw error;
@@ -70,9 +116,58 @@ async function login(username, password) {
 }
 
 // Logout function
-function logout() {
-    removeToken();
-    window.location.href = '/admin/';
+async function logout() {
+    try {
+        await fetch(`${API_BASE}/auth/logout`, { method: 'POST', headers: getHeaders() });
+    } finally {
+        removeToken();
+        window.location.href = '/admin/';
+    }
+}
+
+// Hand a registered device over to another user; their PIN ends the
+// current user's session
+function switchUser() {
+    window.location.href = '/admin/?switch=1';
+}
+
+// Set the PIN the current user logs in with on registered devices
+async function setPIN() {
+    const pin = prompt('New PIN (4 to 8 digits):');
+    if (!pin) {
+        return;
+    }
+    const password = prompt('Your password:');
+    if (!password) {
+        return;
+    }
+
+    try {
+        await apiCall('/profile/pin', {
+            method: 'PUT',
+            body: JSON.stringify({ pin, password })
+        });
+        alert('PIN set successfully');
+    } catch (error) {
+        showError(error.message);
+    }
+}
+
+// Fill the PIN form with the users who can log in on this device
+async function loadDeviceUsers() {
+    const select = document.getElementById('pinUsername');
+    try {
+        const users = await apiCall('/auth/device/users');
+        select.innerHTML = '<option value="">Select User</option>';
+        users.forEach(user => {
+            const option = document.createElement('option');
+            option.value = user.username;
+            option.textContent = user.full_name || user.username;
+            select.appendChild(option);
+        });
+    } catch (error) {
+        showError(error.message);
+    }
 }
 
 // Check if user is authenticated
@@ -98,9 +193,68 @@ function requireAuth() {
 document.addEventListener('DOMContentLoaded', function() {
     console.log('auth.js loaded');
     const loginForm = document.getElementById('loginForm');
-    if (loginForm) {
+    const acceptInviteForm = document.getElementById('acceptInviteForm');
+    if (acceptInviteForm) {
+        // Invitees have no account yet; the token in the link stands in for one
+        acceptInviteForm.addEventListener('submit', async function(e) {
+            e.preventDefault();
+            
+            const password = document.getElementById('password').value;
+            if (password !== document.getElementById('confirmPassword').value) {
+                showError('Passwords do not match');
+                return;
+            }
+            
+            try {
+                const response = await apiCall('/auth/invitations/accept', {
+                    method: 'POST',
+                    body: JSON.stringify({
+                        token: new URLSearchParams(window.location.search).get('token') || '',
+                        username: document.getElementById('username').value,
+                        full_name: document.getElementById('fullName').value,
+                        password
+                    })
+                });
+                
+                setTokens(response);
+                window.location.href = '/admin/dashboard';
+            } catch (error) {
+                showError(error.message);
+            }
+        });
+    } else if (loginForm) {
         console.log('Login form found, checking if already authenticated');
-        redirectIfAuthenticated();
+        const switching = new URLSearchParams(window.location.search).get('switch') === '1';
+        if (!switching) {
+            redirectIfAuthenticated();
+        }
+        
+        const pinForm = document.getElementById('pinForm');
+        if (pinForm && getDeviceToken()) {
+            // Registered devices log in with a PIN; the password form stays available
+            pinForm.style.display = 'block';
+            loadDeviceUsers();
+            
+            pinForm.addEventListener('submit', async function(e) {
+                e.preventDefault();
+                
+                try {
+                    const response = await apiCall('/auth/switch-user', {
+                        method: 'POST',
+                        body: JSON.stringify({
+                            username: document.getElementById('pinUsername').value,
+                            pin: document.getElementById('pin').value
+                        })
+                    });
+                    
+                    setTokens(response);
+                    window.location.href = '/admin/pos';
+                } catch (error) {
+                    document.getElementById('pin').value = '';
+                    showError(error.message);
+                }
+            });
+        }
         
         loginForm.addEventListener('submit', async function(e) {
             e.preventDefault();
@@ -43,7 +43,7 @@ function displayCategories() {
             <td>${category.id}</td>
             <td>${category.name}</td>
             <td>${category.description || '-'}</td>
-            <td>${category.menu_items ? category.menu_items.length : 0}</td>
+            <td>${category.item_count || 0}</td>
             <td>
                 <button class="btn btn-sm btn-primary" onclick="editCategory(${category.id})">
                     <i class="fas fa-edit"></i>
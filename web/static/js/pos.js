@@ -5,6 +5,7 @@ let menuItems = [];
 let addOns = [];
 let currentCategory = null;
 let currentItemForAddOns = null;
+let currentCustomer = null; // Customer found by phone, linked to the order
 let isLoading = false; // Add loading state
 
 // Initialize POS
@@ -174,7 +175,7 @@ function showAddOnModal(availableAddOns = addOns) {
                 <h5>${addon.name}</h5>
                 <p>${addon.description}</p>
                 <span class="addon-price">${formatCurrency(addon.price)}</span>
-                ${addon.menu_item_id ? '<span class="addon-type">Specific</span>' : '<span class="addon-type">Global</span>'}
+                ${(addon.menu_items && addon.menu_items.length) || (addon.categories && addon.categories.length) ? '<span class="addon-type">Specific</span>' : '<span class="addon-type">Global</span>'}
             </div>
             <div class="addon-controls">
                 <button type="button" onclick="decreaseAddonQuantity(${addon.id})" class="quantity-btn">-</button>
@@ -325,10 +326,59 @@ function clearCart() {
     if (confirm('Are you sure you want to clear the cart?')) {
         cart = [];
         document.getElementById('customerName').value = '';
+        resetCustomer();
         updateCartDisplay();
     }
 }
 
+// Look up the customer by phone; offer to add them when they are new
+async function lookupCustomer() {
+    const phone = document.getElementById('customerPhone').value.trim();
+    const status = document.getElementById('customerStatus');
+    if (!phone) {
+        resetCustomer();
+        return;
+    }
+    if (currentCustomer && currentCustomer.phoneInput === phone) {
+        return;
+    }
+
+    const nameInput = document.getElementById('customerName');
+    try {
+        currentCustomer = await apiCall(`/customers/lookup?phone=${encodeURIComponent(phone)}`);
+    } catch (error) {
+        currentCustomer = null;
+        if (error.message !== 'Customer not found') {
+            status.textContent = error.message;
+            return;
+        }
+        const name = nameInput.value.trim() || prompt('New customer. Name:');
+        if (!name) {
+            status.textContent = 'Customer not found';
+            return;
+        }
+        try {
+            currentCustomer = await apiCall('/customers', {
+                method: 'POST',
+                body: JSON.stringify({ name: name, phone: phone })
+            });
+        } catch (createError) {
+            status.textContent = createError.message;
+            return;
+        }
+    }
+
+    currentCustomer.phoneInput = phone;
+    nameInput.value = currentCustomer.name;
+    status.textContent = `${currentCustomer.name} (${currentCustomer.phone})`;
+}
+
+function resetCustomer() {
+    currentCustomer = null;
+    document.getElementById('customerPhone').value = '';
+    document.getElementById('customerStatus').textContent = '';
+}
+
 // Save transaction
 async function saveTransaction() {
     if (cart.length === 0) {
@@ -432,6 +482,7 @@ function prepareTransactionData() {
     
     return {
         customer_name: customerName,
+        customer_id: currentCustomer ? currentCustomer.id : null,
         items: items,
         tax: tax,
         discount: 0
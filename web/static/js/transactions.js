@@ -162,8 +162,10 @@ function displayTransactionDetails(transaction) {
             ? item.add_ons.map(addon => `${addon.add_on.name} (${addon.quantity}x)`).join(', ')
             : '-';
         
+        const allergens = itemAllergens(item);
+        
         return `
-            <tr>
+            <tr data-allergens="${allergens.join(', ')}">
                 <td>${item.menu_item.name}</td>
                 <td>${item.quantity}</td>
                 <td>${formatCurrency(item.unit_price)}</td>
@@ -180,6 +182,20 @@ function displayTransactionDetails(transaction) {
     document.getElementById('transactionTotal').textContent = formatCurrency(transaction.total);
 }
 
+// Allergen names of a line, including its add-ons and bundle components
+function itemAllergens(item) {
+    const names = new Set();
+    const addTags = tags => (tags || []).forEach(tag => {
+        if (tag.kind === 'allergen') names.add(tag.name);
+    });
+    
+    addTags(item.menu_item && item.menu_item.tags);
+    (item.add_ons || []).forEach(addon => addTags(addon.add_on && addon.add_on.tags));
+    (item.components || []).forEach(component => addTags(component.menu_item && component.menu_item.tags));
+    
+    return Array.from(names).sort();
+}
+
 // Mark transaction as paid
 async function markAsPaid(transactionId) {
     // Set the current transaction ID and show the payment modal
@@ -251,6 +267,9 @@ function generateReceiptContent() {
         if (cells[3].textContent !== '-') {
             receiptHTML += `<div style="font-size: 10px; color: #666; margin-left: 10px;">+ ${cells[3].textContent}</div>`;
         }
+        if (row.dataset.allergens) {
+            receiptHTML += `<div style="font-size: 10px; color: #666; margin-left: 10px;">Contains: ${row.dataset.allergens}</div>`;
+        }
     });
     
     receiptHTML += `
@@ -10,8 +10,10 @@ document.addEventListener('DOMContentLoaded', function() {
     // Check authentication
     requireAuth();
     
-    // Load users
+    // Load users, pending invitations and devices
     loadUsers();
+    loadInvitations();
+    loadDevices();
     
     // Setup form handlers
     setupFormHandlers();
@@ -21,11 +23,16 @@ document.addEventListener('DOMContentLoaded', function() {
 function setupFormHandlers() {
     const userForm = document.getElementById('userForm');
     const roleForm = document.getElementById('roleForm');
+    const inviteForm = document.getElementById('inviteForm');
     
     if (userForm) {
         userForm.addEventListener('submit', handleUserSubmit);
     }
     
+    if (inviteForm) {
+        inviteForm.addEventListener('submit', handleInviteSubmit);
+    }
+    
     if (roleForm) {
         roleForm.addEventListener('submit', handleRoleChange);
     }
@@ -83,13 +90,206 @@ function displayUsers(users) {
     });
 }
 
-// Open user modal for adding new user
-function openUserModal() {
-    currentEditingUserId = null;
-    document.getElementById('modalTitle').textContent = 'Add User';
-    document.getElementById('userForm').reset();
-    document.getElementById('password').required = true;
-    document.getElementById('userModal').style.display = 'block';
+// Load pending invitations
+async function loadInvitations() {
+    try {
+        const invitations = await apiCall('/users/invitations?status=pending');
+        displayInvitations(invitations);
+    } catch (error) {
+        console.error('Failed to load invitations:', error);
+        showError('Failed to load invitations: ' + error.message);
+    }
+}
+
+// Display pending invitations in table
+function displayInvitations(invitations) {
+    const tbody = document.querySelector('#invitationsTable tbody');
+    tbody.innerHTML = '';
+    
+    if (!invitations || invitations.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="5" class="text-center">No pending invitations</td></tr>';
+        return;
+    }
+    
+    invitations.forEach(invitation => {
+        const row = document.createElement('tr');
+        row.innerHTML = `
+            <td>${invitation.email}</td>
+            <td>
+                <span class="role-badge role-${invitation.role}">${invitation.role}</span>
+            </td>
+            <td>${invitation.invited_by ? invitation.invited_by.username : '-'}</td>
+            <td>${formatDateTime(invitation.expires_at)}</td>
+            <td>
+                <button onclick="revokeInvitation(${invitation.id}, '${invitation.email}')" 
+                        class="btn btn-sm btn-danger" title="Revoke Invitation">
+                    <i class="fas fa-ban"></i>
+                </button>
+            </td>
+        `;
+        tbody.appendChild(row);
+    });
+}
+
+// Load devices registered for PIN logins
+async function loadDevices() {
+    try {
+        const devices = await apiCall('/devices');
+        displayDevices(devices);
+    } catch (error) {
+        console.error('Failed to load devices:', error);
+        showError('Failed to load devices: ' + error.message);
+    }
+}
+
+// Display devices in table
+function displayDevices(devices) {
+    const tbody = document.querySelector('#devicesTable tbody');
+    tbody.innerHTML = '';
+    
+    if (!devices || devices.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="5" class="text-center">No devices registered</td></tr>';
+        return;
+    }
+    
+    devices.forEach(device => {
+        const locked = device.locked_until && new Date(device.locked_until) > new Date();
+        const row = document.createElement('tr');
+        row.innerHTML = `
+            <td>${device.name}</td>
+            <td>${device.outlet ? device.outlet.name : 'All outlets'}</td>
+            <td>${device.last_used_at ? formatDateTime(device.last_used_at) : '-'}</td>
+            <td>${locked ? 'Locked until ' + formatDateTime(device.locked_until) : 'Active'}</td>
+            <td>
+                ${locked ? `
+                <button onclick="unlockDevice(${device.id})" 
+                        class="btn btn-sm btn-secondary" title="Unlock Device">
+                    <i class="fas fa-unlock"></i>
+                </button>` : ''}
+                <button onclick="revokeDevice(${device.id}, '${device.name}')" 
+                        class="btn btn-sm btn-danger" title="Revoke Device">
+                    <i class="fas fa-ban"></i>
+                </button>
+            </td>
+        `;
+        tbody.appendChild(row);
+    });
+}
+
+// Register the browser this page is open in as a shared device
+async function registerThisDevice() {
+    if (getDeviceToken() && !confirm('This browser is already registered. Register it again?')) {
+        return;
+    }
+    const name = prompt('Device name (e.g. Front counter tablet):');
+    if (!name) {
+        return;
+    }
+    
+    try {
+        const result = await apiCall('/devices', {
+            method: 'POST',
+            body: JSON.stringify({ name })
+        });
+        
+        setDeviceToken(result.token);
+        showSuccess('Device registered; cashiers can now log in here with their PIN');
+        loadDevices();
+    } catch (error) {
+        console.error('Failed to register device:', error);
+        showError('Failed to register device: ' + error.message);
+    }
+}
+
+// Allow PIN logins again on a locked device
+async function unlockDevice(deviceId) {
+    try {
+        await apiCall(`/devices/${deviceId}/unlock`, {
+            method: 'POST'
+        });
+        
+        showSuccess('Device unlocked successfully');
+        loadDevices();
+    } catch (error) {
+        console.error('Failed to unlock device:', error);
+        showError('Failed to unlock device: ' + error.message);
+    }
+}
+
+// Revoke device
+async function revokeDevice(deviceId, name) {
+    if (!confirm(`Revoke device "${name}"? Everyone logged in on it will be logged out.`)) {
+        return;
+    }
+    
+    try {
+        await apiCall(`/devices/${deviceId}`, {
+            method: 'DELETE'
+        });
+        
+        showSuccess('Device revoked successfully');
+        loadDevices();
+    } catch (error) {
+        console.error('Failed to revoke device:', error);
+        showError('Failed to revoke device: ' + error.message);
+    }
+}
+
+// Open invite modal
+function openInviteModal() {
+    document.getElementById('inviteForm').reset();
+    document.getElementById('inviteLinkGroup').style.display = 'none';
+    document.getElementById('inviteSubmit').style.display = '';
+    document.getElementById('inviteModal').style.display = 'block';
+}
+
+// Close invite modal
+function closeInviteModal() {
+    document.getElementById('inviteModal').style.display = 'none';
+}
+
+// Handle invite form submission
+async function handleInviteSubmit(e) {
+    e.preventDefault();
+    
+    const formData = new FormData(e.target);
+    const inviteData = Object.fromEntries(formData.entries());
+    
+    try {
+        const result = await apiCall('/users/invitations', {
+            method: 'POST',
+            body: JSON.stringify(inviteData)
+        });
+        
+        // The link is only available now, so show it for the admin to send
+        document.getElementById('inviteLink').value = result.accept_url;
+        document.getElementById('inviteLinkGroup').style.display = 'block';
+        document.getElementById('inviteSubmit').style.display = 'none';
+        showSuccess('Invitation created for ' + result.invitation.email);
+        loadInvitations();
+    } catch (error) {
+        console.error('Failed to invite user:', error);
+        showError('Failed to invite user: ' + error.message);
+    }
+}
+
+// Revoke invitation
+async function revokeInvitation(invitationId, email) {
+    if (!confirm(`Revoke the invitation for "${email}"?`)) {
+        return;
+    }
+    
+    try {
+        await apiCall(`/users/invitations/${invitationId}`, {
+            method: 'DELETE'
+        });
+        
+        showSuccess('Invitation revoked successfully');
+        loadInvitations();
+    } catch (error) {
+        console.error('Failed to revoke invitation:', error);
+        showError('Failed to revoke invitation: ' + error.message);
+    }
 }
 
 // Close user modal
@@ -116,25 +316,20 @@ function closeRoleModal() {
 async function handleUserSubmit(e) {
     e.preventDefault();
     
+    if (!currentEditingUserId) {
+        return;
+    }
+    
     const formData = new FormData(e.target);
     const userData = Object.fromEntries(formData.entries());
     
     try {
-        if (currentEditingUserId) {
-            // Update existing user
-            await apiCall(`/users/${currentEditingUserId}`, {
-                method: 'PUT',
-                body: JSON.stringify(userData)
-            });
-            showSuccess('User updated successfully');
-        } else {
-            // Create new user
-            await apiCall('/auth/register', {
-                method: 'POST',
-                body: JSON.stringify(userData)
-            });
-            showSuccess('User created successfully');
-        }
+        // New users are invited; this only updates existing ones
+        await apiCall(`/users/${currentEditingUserId}`, {
+            method: 'PUT',
+            body: JSON.stringify(userData)
+        });
+        showSuccess('User updated successfully');
         
         closeUserModal();
         loadUsers();
@@ -182,7 +377,6 @@ async function editUser(userId) {
         document.getElementById('fullName').value = user.full_name;
         document.getElementById('role').value = user.role;
         document.getElementById('password').value = '';
-        document.getElementById('password').required = false;
         
         document.getElementById('userModal').style.display = 'block';
     } catch (error) {
@@ -242,10 +436,14 @@ function showError(message) {
 window.onclick = function(event) {
     const userModal = document.getElementById('userModal');
     const roleModal = document.getElementById('roleModal');
+    const inviteModal = document.getElementById('inviteModal');
     
     if (event.target === userModal) {
         closeUserModal();
     }
+    if (event.target === inviteModal) {
+        closeInviteModal();
+    }
     if (event.target === roleModal) {
         closeRoleModal();
     }